@@ -21,6 +21,7 @@ import (
 	"errors"
 	"log"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/huaweicloud/devcloud-go/common/util"
@@ -66,7 +67,7 @@ func NewEtcdV3Client(props *ClientProperties) (*EtcdV3Client, error) {
 			Certificates: []tls.Certificate{cert},
 			RootCAs:      pool,
 		}
-	} else {
+	} else if hasHTTPSEndpoint(props.Endpoints) {
 		config.TLS = &tls.Config{
 			InsecureSkipVerify: true,
 		}
@@ -83,6 +84,16 @@ func NewEtcdV3Client(props *ClientProperties) (*EtcdV3Client, error) {
 	}, nil
 }
 
+// hasHTTPSEndpoint plain endpoints must not be dialed with tls.
+func hasHTTPSEndpoint(endpoints []string) bool {
+	for _, endpoint := range endpoints {
+		if strings.HasPrefix(endpoint, "https://") {
+			return true
+		}
+	}
+	return false
+}
+
 // Get return the val corresponding to the key in etcd
 func (c *EtcdV3Client) Get(key string) (string, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), contextTimeOut)
@@ -0,0 +1,131 @@
+/*
+ * Copyright (c) Huawei Technologies Co., Ltd. 2021.
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use
+ * this file except in compliance with the License.  You may obtain a copy of the
+ * License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package redis
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/huaweicloud/devcloud-go/mas"
+	"github.com/huaweicloud/devcloud-go/mock"
+	"github.com/huaweicloud/devcloud-go/redis/config"
+	"github.com/huaweicloud/devcloud-go/redis/instrument"
+	"github.com/huaweicloud/devcloud-go/redis/redigostrategy"
+	"github.com/huaweicloud/devcloud-go/redis/strategy"
+)
+
+func chaosConfiguration(addr string, chaos *mas.InjectionProperties) *config.Configuration {
+	return &config.Configuration{
+		RouteAlgorithm: strategy.SingleReadWriteMode,
+		Active:         "dc1",
+		Chaos:          chaos,
+		RedisConfig: &config.RedisConfiguration{
+			Servers: map[string]*config.ServerConfiguration{
+				"dc1": {Hosts: addr, Type: config.ServerTypeNormal,
+					ConnectionPool: &config.ServerConnectionPoolConfiguration{MaxTotal: 10, MaxIdle: 2}},
+			},
+		},
+	}
+}
+
+func startChaosMock(t *testing.T) *mock.RedisMock {
+	redisMock := &mock.RedisMock{}
+	if err := redisMock.StartMockRedis(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(redisMock.StopMockRedis)
+	return redisMock
+}
+
+func errorChaos() *mas.InjectionProperties {
+	return &mas.InjectionProperties{Active: true, Duration: 100, Interval: 100, Percentage: 100,
+		DelayInjection: &mas.DelayInjection{}, ErrorInjection: &mas.ErrorInjection{Active: true, Percentage: 100}}
+}
+
+func delayChaos() *mas.InjectionProperties {
+	return &mas.InjectionProperties{Active: true, Duration: 100, Interval: 100, Percentage: 100,
+		DelayInjection: &mas.DelayInjection{Active: true, Percentage: 100, TimeMs: 100},
+		ErrorInjection: &mas.ErrorInjection{}}
+}
+
+func TestDevsporeClient_ChaosError(t *testing.T) {
+	redisMock := startChaosMock(t)
+	client := NewDevsporeClient(chaosConfiguration(redisMock.Addr, errorChaos()))
+	defer client.Close()
+
+	err := client.Set(context.Background(), "chaos_key", "value", 0).Err()
+	assert.Contains(t, mas.RedisErrors(), err)
+	assert.False(t, redisMock.GetMockRedis().Exists("chaos_key"))
+}
+
+func TestDevsporeRedigoClient_ChaosError(t *testing.T) {
+	redisMock := startChaosMock(t)
+	client := NewDevsporeRedigoClient(chaosConfiguration(redisMock.Addr, errorChaos()))
+	defer client.strategy.Close()
+
+	_, err := client.Do("SET", "chaos_key", "value")
+	assert.Contains(t, mas.RedisErrors(), err)
+	_, err = client.DoContext(context.Background(), "SET", "chaos_key", "value")
+	assert.Contains(t, mas.RedisErrors(), err)
+	cmds := []*redigostrategy.RedigoCommandArgs{{CommandName: "SET", Args: []interface{}{"chaos_key", "value"}}}
+	_, err = client.Pipeline(cmds)
+	assert.Contains(t, mas.RedisErrors(), err)
+	_, err = client.Transactions(cmds)
+	assert.Contains(t, mas.RedisErrors(), err)
+	_, err = client.Subscribe(context.Background(), time.Second, "chaos_channel")
+	assert.Contains(t, mas.RedisErrors(), err)
+	assert.False(t, redisMock.GetMockRedis().Exists("chaos_key"))
+}
+
+func TestDevsporeClient_ChaosDelay(t *testing.T) {
+	redisMock := startChaosMock(t)
+	delay := 100 * time.Millisecond
+
+	client := NewDevsporeClient(chaosConfiguration(redisMock.Addr, delayChaos()))
+	defer client.Close()
+	start := time.Now()
+	assert.Nil(t, client.Set(context.Background(), "goredis_key", "value", 0).Err())
+	assert.GreaterOrEqual(t, time.Since(start), delay)
+
+	redigoClient := NewDevsporeRedigoClient(chaosConfiguration(redisMock.Addr, delayChaos()))
+	defer redigoClient.strategy.Close()
+	start = time.Now()
+	_, err := redigoClient.Do("SET", "redigo_key", "value")
+	assert.Nil(t, err)
+	assert.GreaterOrEqual(t, time.Since(start), delay)
+	start = time.Now()
+	_, err = redigoClient.Pipeline([]*redigostrategy.RedigoCommandArgs{
+		{CommandName: "SET", Args: []interface{}{"redigo_pipeline_key", "value"}}})
+	assert.Nil(t, err)
+	assert.GreaterOrEqual(t, time.Since(start), delay)
+	assert.True(t, redisMock.GetMockRedis().Exists("redigo_pipeline_key"))
+}
+
+func TestDevsporeClient_ChaosWithInstrumentation(t *testing.T) {
+	redisMock := startChaosMock(t)
+	recorder, instrumentationConfig := registerRecorder("recorder-chaos")
+	configuration := chaosConfiguration(redisMock.Addr, errorChaos())
+	configuration.RedisConfig.Instrumentation = instrumentationConfig
+	client := NewDevsporeClient(configuration)
+	defer client.Close()
+
+	err := client.Set(context.Background(), "chaos_key", "value", 0).Err()
+	assert.Contains(t, mas.RedisErrors(), err)
+	assertEvent(t, recorder, "set", "dc1", instrument.RouteTypeWrite, true)
+	assert.False(t, redisMock.GetMockRedis().Exists("chaos_key"))
+}
@@ -0,0 +1,97 @@
+/*
+ * Copyright (c) Huawei Technologies Co., Ltd. 2021.
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use
+ * this file except in compliance with the License.  You may obtain a copy of the
+ * License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package redis
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	goredis "github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/huaweicloud/devcloud-go/redis/config"
+	"github.com/huaweicloud/devcloud-go/redis/strategy"
+)
+
+func circuitBreakerConfiguration(routeAlgorithm, addr1, addr2 string) *config.Configuration {
+	configuration := doubleWriteConfiguration(routeAlgorithm, addr1, addr2)
+	configuration.Active = "dc2"
+	configuration.RedisConfig.CircuitBreaker = &config.CircuitBreakerConfiguration{
+		Enable:              true,
+		FailureThreshold:    2,
+		OpenMillis:          200,
+		HalfOpenMaxRequests: 1,
+	}
+	return configuration
+}
+
+func TestDevsporeClient_CircuitBreakerFallbackRead(t *testing.T) {
+	nearest, active := startDoubleWriteMocks(t)
+	client := NewDevsporeClient(circuitBreakerConfiguration(strategy.LocalReadSingleWriteMode, nearest.Addr, active.Addr))
+	defer client.Close()
+	ctx := context.Background()
+	_ = nearest.GetMockRedis().Set("key", "nearest")
+	_ = active.GetMockRedis().Set("key", "active")
+	assert.Equal(t, "nearest", client.Get(ctx, "key").Val())
+
+	// nearest server is down, reads fall back to the active server after the breaker opened
+	nearest.StopMockRedis()
+	for i := 0; i < 2; i++ {
+		assert.NotNil(t, client.Get(ctx, "key").Err())
+	}
+	assert.Equal(t, strategy.CircuitOpen, client.CircuitBreakerStats()["dc1"].State)
+	assert.Equal(t, strategy.CircuitClosed, client.CircuitBreakerStats()["dc2"].State)
+	assert.Equal(t, "active", client.Get(ctx, "key").Val())
+
+	// nearest server recovers, the half-open probe closes the breaker
+	if err := nearest.StartMockRedis(); err != nil {
+		t.Fatal(err)
+	}
+	_ = nearest.GetMockRedis().Set("key", "nearest")
+	time.Sleep(300 * time.Millisecond)
+	assert.Equal(t, strategy.CircuitHalfOpen, client.CircuitBreakerStats()["dc1"].State)
+	assert.Eventually(t, func() bool {
+		return client.Get(ctx, "key").Val() == "nearest"
+	}, 5*time.Second, 20*time.Millisecond)
+	assert.Equal(t, strategy.CircuitClosed, client.CircuitBreakerStats()["dc1"].State)
+}
+
+func TestDevsporeClient_CircuitBreakerFailFastWrite(t *testing.T) {
+	nearest, active := startDoubleWriteMocks(t)
+	client := NewDevsporeClient(circuitBreakerConfiguration(strategy.LocalReadSingleWriteMode, nearest.Addr, active.Addr))
+	defer client.Close()
+	ctx := context.Background()
+
+	active.StopMockRedis()
+	for i := 0; i < 2; i++ {
+		assert.NotNil(t, client.Set(ctx, "key", "value", 0).Err())
+	}
+	assert.Equal(t, strategy.ErrCircuitOpen, client.Set(ctx, "key", "value", 0).Err())
+	_, err := client.Pipelined(ctx, func(pipe goredis.Pipeliner) error {
+		pipe.Set(ctx, "key", "value", 0)
+		return nil
+	})
+	assert.Equal(t, strategy.ErrCircuitOpen, err)
+	stats := client.CircuitBreakerStats()["dc2"]
+	assert.Equal(t, strategy.CircuitOpen, stats.State)
+	assert.Equal(t, uint64(2), stats.Failures)
+	assert.Equal(t, uint64(2), stats.Rejected)
+
+	// redis errors are not failures of the server
+	_ = nearest.GetMockRedis().Set("string_key", "value")
+	assert.NotNil(t, client.HGet(ctx, "string_key", "field").Err())
+	assert.Equal(t, uint64(0), client.CircuitBreakerStats()["dc1"].Failures)
+}
@@ -0,0 +1,168 @@
+/*
+ * Copyright (c) Huawei Technologies Co., Ltd. 2021.
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use
+ * this file except in compliance with the License.  You may obtain a copy of the
+ * License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package redis
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	goredis "github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/huaweicloud/devcloud-go/redis/strategy"
+)
+
+func TestParseCommandTable(t *testing.T) {
+	// redis 7.0 reply with subcommands, bulk strings are []byte in redigo
+	reply := []interface{}{
+		[]interface{}{"get", int64(2), []interface{}{"readonly", "fast"}, int64(1), int64(1), int64(1),
+			[]interface{}{}, []interface{}{}, []interface{}{}, []interface{}{}},
+		[]interface{}{[]byte("xgroup"), int64(-2), []interface{}{}, int64(0), int64(0), int64(0),
+			[]interface{}{}, []interface{}{}, []interface{}{}, []interface{}{
+				[]interface{}{"xgroup|create", int64(-5), []interface{}{"write", "denyoom"}, int64(2), int64(2),
+					int64(1), []interface{}{}, []interface{}{}, []interface{}{}, []interface{}{}},
+				[]interface{}{"xgroup|help", int64(2), []interface{}{"loading", "stale"}, int64(0), int64(0),
+					int64(0), []interface{}{}, []interface{}{}, []interface{}{}, []interface{}{}},
+			}},
+		[]interface{}{"eval", int64(-3), []interface{}{"noscript", "movablekeys"}, int64(0), int64(0), int64(0)},
+		nil,
+	}
+	table, err := strategy.ParseCommandTable(reply)
+	assert.Nil(t, err)
+	assert.Equal(t, strategy.CommandTable{
+		"get":           {ReadOnly: true},
+		"xgroup":        {},
+		"xgroup|create": {Write: true},
+		"xgroup|help":   {},
+		"eval":          {MovableKeys: true},
+	}, table)
+
+	_, err = strategy.ParseCommandTable("OK")
+	assert.NotNil(t, err)
+
+	classifier := strategy.NewCommandClassifier(func(serverName string) (strategy.CommandTable, error) {
+		return table, nil
+	})
+	assert.Nil(t, classifier.Load("dc1"))
+	assert.False(t, classifier.IsWrite("dc1", "get", []interface{}{"key"}))
+	assert.True(t, classifier.IsWrite("dc1", "xgroup", []interface{}{"xgroup", "create", "stream", "group", "$"}))
+	assert.True(t, classifier.IsWrite("dc1", "XGROUP", []interface{}{"CREATE", "stream", "group", "$"}))
+	// neither write nor readonly, classified by the static rules
+	assert.True(t, classifier.IsWrite("dc1", "eval", []interface{}{"return redis.call('set', KEYS[1], 1)", 1, "key"}))
+	assert.False(t, classifier.IsWrite("dc1", "eval", []interface{}{"#!lua flags=no-writes\nreturn 1", 0}))
+	// publish is mirrored only if mirrorPublish is enabled
+	assert.False(t, classifier.IsWrite("dc1", "publish", []interface{}{"channel", "message"}))
+	classifier.SetMirrorPublish(true)
+	assert.True(t, classifier.IsWrite("dc1", "publish", []interface{}{"channel", "message"}))
+	classifier.SetMirrorPublish(false)
+	// not in the table of the server
+	assert.True(t, classifier.IsWrite("dc1", "json.set", []interface{}{"key", "$", "1"}))
+	assert.False(t, classifier.IsWrite("dc1", "json.get", []interface{}{"key"}))
+	assert.True(t, classifier.IsWrite("dc1", "function", []interface{}{"load", "#!lua name=lib\n"}))
+	assert.False(t, classifier.IsWrite("dc1", "function", []interface{}{"list"}))
+	assert.False(t, classifier.IsWrite("dc1", "fcall_ro", []interface{}{"fn", 0}))
+	classifier.Scripts().RegisterReadOnly(strategy.ScriptSHA("return redis.call('get', KEYS[1])"))
+	assert.False(t, classifier.IsWrite("dc1", "eval", []interface{}{"return redis.call('get', KEYS[1])", 1, "key"}))
+	assert.False(t, classifier.IsWrite("dc1", "evalsha",
+		[]interface{}{"evalsha", strategy.ScriptSHA("return redis.call('get', KEYS[1])"), 1, "key"}))
+
+	failed := strategy.NewCommandClassifier(func(serverName string) (strategy.CommandTable, error) {
+		return nil, errors.New("unknown command")
+	})
+	assert.NotNil(t, failed.Load("dc1"))
+	assert.True(t, failed.IsWrite("dc1", "unlink", []interface{}{"key"}))
+	assert.True(t, failed.IsWrite("dc1", "georadius", []interface{}{"key", 1, 2, 3, "km", "STORE", "dest"}))
+}
+
+func TestDevsporeClient_DoRouteAndMirror(t *testing.T) {
+	local, remote := startDoubleWriteMocks(t)
+	client := NewDevsporeClient(doubleWriteConfiguration(strategy.LocalReadDoubleWriteMode, local.Addr, remote.Addr))
+	defer client.Close()
+	ctx := context.Background()
+
+	// reads by Do are routed to the nearest server
+	_ = local.GetMockRedis().Set("read_key", "local")
+	_ = remote.GetMockRedis().Set("read_key", "remote")
+	assert.Equal(t, "local", client.Do(ctx, "get", "read_key").Val())
+
+	// commands missing in the old static map are mirrored, the COMMAND reply of the mock server is invalid, so
+	// they are classified statically
+	_ = local.GetMockRedis().Set("unlink_key", "value")
+	_ = remote.GetMockRedis().Set("unlink_key", "value")
+	assert.Nil(t, client.Do(ctx, "unlink", "unlink_key").Err())
+	assert.Eventually(t, func() bool {
+		return !remote.GetMockRedis().Exists("unlink_key")
+	}, 5*time.Second, 10*time.Millisecond)
+
+	redigoClient := NewDevsporeRedigoClient(doubleWriteConfiguration(strategy.LocalReadDoubleWriteMode, local.Addr,
+		remote.Addr))
+	defer redigoClient.strategy.Close()
+	_ = remote.GetMockRedis().Set("redigo_unlink_key", "value")
+	_ = local.GetMockRedis().Set("redigo_unlink_key", "value")
+	_, err := redigoClient.Do("unlink", "redigo_unlink_key")
+	assert.Nil(t, err)
+	assert.Eventually(t, func() bool {
+		return !remote.GetMockRedis().Exists("redigo_unlink_key")
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+// serverRecorder records the servers which the commands are executed on.
+type serverRecorder struct {
+	serverName string
+	mutex      *sync.Mutex
+	servers    map[string][]string
+}
+
+func (h serverRecorder) BeforeProcess(ctx context.Context, cmd goredis.Cmder) (context.Context, error) {
+	return ctx, nil
+}
+
+func (h serverRecorder) AfterProcess(ctx context.Context, cmd goredis.Cmder) error {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.servers[cmd.Name()] = append(h.servers[cmd.Name()], h.serverName)
+	return nil
+}
+
+func (h serverRecorder) BeforeProcessPipeline(ctx context.Context, cmds []goredis.Cmder) (context.Context, error) {
+	return ctx, nil
+}
+
+func (h serverRecorder) AfterProcessPipeline(ctx context.Context, cmds []goredis.Cmder) error {
+	return nil
+}
+
+func TestDevsporeClient_SortStoreAndTouchRoute(t *testing.T) {
+	dc1, dc2 := startDoubleWriteMocks(t)
+	client := NewDevsporeClient(doubleWriteConfiguration(strategy.LocalReadSingleWriteMode, dc1.Addr, dc2.Addr))
+	defer client.Close()
+	mutex, servers := &sync.Mutex{}, make(map[string][]string)
+	client.strategy.AddClientHook(func(serverName string) goredis.Hook {
+		return serverRecorder{serverName: serverName, mutex: mutex, servers: servers}
+	})
+	ctx := context.Background()
+
+	// SORT is read on the nearest dc1, SORT ... STORE and TOUCH are writes on the active dc2
+	client.Sort(ctx, "list", &goredis.Sort{})
+	client.SortStore(ctx, "list", "dest", &goredis.Sort{})
+	client.Touch(ctx, "key1", "key2")
+	mutex.Lock()
+	defer mutex.Unlock()
+	assert.Equal(t, []string{"dc1", "dc2"}, servers["sort"])
+	assert.Equal(t, []string{"dc2"}, servers["touch"])
+}
@@ -24,13 +24,16 @@ import (
 	"log"
 	"os"
 	"path/filepath"
+	"sync"
+	"sync/atomic"
 
 	"github.com/huaweicloud/devcloud-go/common/etcd"
 	"github.com/huaweicloud/devcloud-go/mas"
 	"gopkg.in/yaml.v3"
 )
 
-// Configuration is used to create DevsporeClient
+// Configuration is used to create DevsporeClient. After the client is created, RouteAlgorithm, Active and
+// RedisConfig.Servers keep the initial values, the current routing state is returned by Snapshot.
 type Configuration struct {
 	Props          *mas.PropertiesConfiguration `yaml:"props"`
 	EtcdConfig     *etcd.EtcdConfiguration      `yaml:"etcd"`
@@ -38,17 +41,159 @@ type Configuration struct {
 	RouteAlgorithm string                       `yaml:"routeAlgorithm"`
 	Active         string                       `yaml:"active"`
 	Chaos          *mas.InjectionProperties     `yaml:"chaos"`
+
+	reloadMutex     sync.Mutex
+	reloadListeners []ReloadListener
+	snapshot        atomic.Value // *RoutingSnapshot
+}
+
+// Snapshot returns the current routing snapshot, the first call publishes the snapshot of the loaded configuration.
+func (c *Configuration) Snapshot() *RoutingSnapshot {
+	if snapshot := c.loadSnapshot(); snapshot != nil {
+		return snapshot
+	}
+	c.reloadMutex.Lock()
+	defer c.reloadMutex.Unlock()
+	if snapshot := c.loadSnapshot(); snapshot != nil {
+		return snapshot
+	}
+	snapshot := newRoutingSnapshot(1, c.RouteAlgorithm, c.Active, c.RedisConfig.Nearest, c.RedisConfig.Servers)
+	c.snapshot.Store(snapshot)
+	return snapshot
+}
+
+func (c *Configuration) loadSnapshot() *RoutingSnapshot {
+	snapshot, _ := c.snapshot.Load().(*RoutingSnapshot)
+	return snapshot
 }
 
-// OnChanged when remote etcd active key changed, change the Configuration's active server.
+// OnChanged when remote etcd active key changed, publish a snapshot with the new active server.
 func (c *Configuration) OnChanged(active string) {
-	c.Active = active
+	c.SwitchActive(active)
+}
+
+// SwitchActive publish a snapshot with the new active server.
+func (c *Configuration) SwitchActive(active string) {
+	c.reloadMutex.Lock()
+	defer c.reloadMutex.Unlock()
+	snapshot := c.loadSnapshot()
+	if snapshot == nil {
+		// the client is not created yet
+		c.Active = active
+		return
+	}
+	if snapshot.Active == active {
+		return
+	}
+	if _, ok := snapshot.Servers[active]; !ok {
+		log.Printf("WARNING: active server '%s' has no config", active)
+	}
+	newSnapshot := snapshot.withActive(active)
+	c.snapshot.Store(newSnapshot)
+	log.Printf("INFO: redis active server changed to '%s', routing version %d", active, newSnapshot.Version)
+}
+
+// SwitchNearest publish a snapshot with the new nearest server.
+func (c *Configuration) SwitchNearest(nearest string) {
+	c.reloadMutex.Lock()
+	defer c.reloadMutex.Unlock()
+	snapshot := c.loadSnapshot()
+	if snapshot == nil {
+		// the client is not created yet
+		c.RedisConfig.Nearest = nearest
+		return
+	}
+	if snapshot.Nearest == nearest {
+		return
+	}
+	if _, ok := snapshot.Servers[nearest]; !ok {
+		log.Printf("WARNING: nearest server '%s' has no config", nearest)
+	}
+	newSnapshot := snapshot.withNearest(nearest)
+	c.snapshot.Store(newSnapshot)
+	log.Printf("INFO: redis nearest server changed to '%s', routing version %d", nearest, newSnapshot.Version)
+}
+
+// AddReloadListener add a listener which is notified after servers or route algorithm are reloaded from etcd.
+func (c *Configuration) AddReloadListener(listener ReloadListener) {
+	c.reloadMutex.Lock()
+	defer c.reloadMutex.Unlock()
+	c.reloadListeners = append(c.reloadListeners, listener)
+}
+
+// OnTopologyChanged when remote etcd servers or route algorithm changed, publish a snapshot with the changed
+// servers and route algorithm, then notify the reload listeners. Changed servers are copied instead of modified
+// in place, so the clients which are still using the old server configuration are not affected. Servers added to
+// or removed from etcd are not followed, as the servers of the client are declared by the local configuration.
+func (c *Configuration) OnTopologyChanged(remoteConfiguration *RemoteRedisConfiguration) {
+	c.reloadMutex.Lock()
+	defer c.reloadMutex.Unlock()
+	snapshot := c.loadSnapshot()
+	routeAlgorithm, currentServers := c.RouteAlgorithm, c.RedisConfig.Servers
+	if snapshot != nil {
+		routeAlgorithm, currentServers = snapshot.RouteAlgorithm, snapshot.Servers
+	}
+	routeAlgorithmChanged := false
+	if remoteConfiguration.RouteAlgorithm != "" && remoteConfiguration.RouteAlgorithm != routeAlgorithm {
+		routeAlgorithm = remoteConfiguration.RouteAlgorithm
+		routeAlgorithmChanged = true
+	}
+	servers := make(map[string]*ServerConfiguration, len(currentServers))
+	for serverName, serverConfig := range currentServers {
+		servers[serverName] = serverConfig
+	}
+	var changedServers []string
+	modified := routeAlgorithmChanged
+	for serverName, remoteServerConfig := range remoteConfiguration.Servers {
+		serverConfig, ok := servers[serverName]
+		if !ok {
+			log.Printf("WARNING: etcd server '%s' is not in the local configuration, ignored", serverName)
+			continue
+		}
+		if !serverConfig.differsFrom(remoteServerConfig) {
+			continue
+		}
+		modified = true
+		newServerConfig := *serverConfig
+		newServerConfig.assign(remoteServerConfig)
+		newServerConfig.convertOptions()
+		if serverConfig.rebuildOf(&newServerConfig) {
+			changedServers = append(changedServers, serverName)
+		}
+		servers[serverName] = &newServerConfig
+	}
+	if len(remoteConfiguration.Servers) > 0 {
+		for serverName := range servers {
+			if _, ok := remoteConfiguration.Servers[serverName]; !ok {
+				log.Printf("WARNING: server '%s' is not in etcd servers, keep using the local configuration", serverName)
+			}
+		}
+	}
+	if snapshot == nil {
+		// the client is not created yet
+		c.RouteAlgorithm, c.RedisConfig.Servers = routeAlgorithm, servers
+		return
+	}
+	if !modified {
+		return
+	}
+	newSnapshot := snapshot.withTopology(routeAlgorithm, servers)
+	c.snapshot.Store(newSnapshot)
+	if len(changedServers) == 0 && !routeAlgorithmChanged {
+		return
+	}
+	log.Printf("INFO: redis topology changed, changed servers %v, route algorithm [%s], routing version %d",
+		changedServers, routeAlgorithm, newSnapshot.Version)
+	for _, listener := range c.reloadListeners {
+		listener.OnReload(changedServers, routeAlgorithmChanged)
+	}
 }
 
 // AssignRemoteConfig will combine local configuration and remote configuration.
 func (c *Configuration) AssignRemoteConfig() {
 	remoteConfigurationLoader := NewRemoteConfigurationLoader(c.Props, c.EtcdConfig)
 	remoteConfigurationLoader.AddRouterListener(c)
+	remoteConfigurationLoader.AddTopologyListener(c)
 	remoteConfigurationLoader.Init()
 	remoteConfiguration := remoteConfigurationLoader.GetConfiguration()
 	if remoteConfiguration == nil {
@@ -68,17 +213,7 @@ func (c *Configuration) AssignRemoteConfig() {
 			if _, ok := c.RedisConfig.Servers[serverName]; !ok {
 				continue
 			}
-			c.RedisConfig.Servers[serverName].Hosts = serverConfig.Hosts
-			c.RedisConfig.Servers[serverName].Type = serverConfig.Type
-			if len(serverConfig.Cloud) != 0 {
-				c.RedisConfig.Servers[serverName].Cloud = serverConfig.Cloud
-			}
-			if len(serverConfig.Region) != 0 {
-				c.RedisConfig.Servers[serverName].Region = serverConfig.Region
-			}
-			if len(serverConfig.Azs) != 0 {
-				c.RedisConfig.Servers[serverName].Azs = serverConfig.Azs
-			}
+			c.RedisConfig.Servers[serverName].assign(serverConfig)
 		}
 	}
 }
@@ -111,6 +246,9 @@ func (c *Configuration) ComputeNearestServer() {
 // ConvertServerConfiguration convert devspore server configuration to go-redis Options or cluster Options.
 func (c *Configuration) ConvertServerConfiguration() {
 	for _, serverConfig := range c.RedisConfig.Servers {
+		if serverConfig.Username == "" {
+			serverConfig.Username = c.RedisConfig.UserName
+		}
 		serverConfig.convertOptions()
 	}
 }
@@ -130,6 +268,12 @@ func LoadConfiguration(yamlFilePath string) (*Configuration, error) {
 	if err = yaml.Unmarshal(yamlFile, configuration); err != nil {
 		return nil, nil
 	}
+	if configuration.RedisConfig != nil && configuration.RedisConfig.UseName != "" {
+		log.Printf("WARNING: redis.useName is deprecated, use redis.username instead")
+		if configuration.RedisConfig.UserName == "" {
+			configuration.RedisConfig.UserName = configuration.RedisConfig.UseName
+		}
+	}
 	// check yaml config
 	if etcdCheckMessage := checkEtcdConfig(configuration); etcdCheckMessage != "" {
 		log.Printf("Info: yaml etcd config check fail, err [%s]", etcdCheckMessage)
@@ -139,7 +283,10 @@ func LoadConfiguration(yamlFilePath string) (*Configuration, error) {
 		return configuration, nil
 	}
 	for _, serverConfig := range configuration.RedisConfig.Servers {
-		if serverConfig.ConnectionPool == nil {
+		if !configuration.RedisConfig.ConnectionPoolConfig.Enable {
+			// the pools of the clients use their defaults
+			serverConfig.ConnectionPool = nil
+		} else if serverConfig.ConnectionPool == nil {
 			serverConfig.ConnectionPool = newDefaultConnectionPool()
 		}
 	}
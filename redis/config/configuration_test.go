@@ -0,0 +1,148 @@
+/*
+ * Copyright (c) Huawei Technologies Co., Ltd. 2021.
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use
+ * this file except in compliance with the License.  You may obtain a copy of the
+ * License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type reloadRecorder struct {
+	changedServers        []string
+	routeAlgorithmChanged bool
+	times                 int
+}
+
+func (r *reloadRecorder) OnReload(changedServers []string, routeAlgorithmChanged bool) {
+	r.changedServers = changedServers
+	r.routeAlgorithmChanged = routeAlgorithmChanged
+	r.times++
+}
+
+func TestConfiguration_OnTopologyChanged(t *testing.T) {
+	configuration, err := LoadConfiguration("../resources/config_no_pool.yaml")
+	if err != nil {
+		t.Errorf("load configuration from config_no_pool.yaml failed, err: %v", err)
+		return
+	}
+	configuration.ConvertServerConfiguration()
+	assert.Equal(t, uint64(1), configuration.Snapshot().Version)
+	recorder := &reloadRecorder{}
+	configuration.AddReloadListener(recorder)
+	oldDc1 := configuration.RedisConfig.Servers["dc1"]
+
+	// nothing changed
+	configuration.OnTopologyChanged(NewRemoteRedisConfiguration("",
+		"", `{"dc1":{"hosts":"127.0.0.1:6379","type":"normal"}}`))
+	assert.Equal(t, 0, recorder.times)
+
+	// only location changed
+	configuration.OnTopologyChanged(NewRemoteRedisConfiguration("",
+		"", `{"dc1":{"hosts":"127.0.0.1:6379","type":"normal","region":"cn-north-7"}}`))
+	assert.Equal(t, 0, recorder.times)
+	assert.Equal(t, "cn-north-7", configuration.Snapshot().Servers["dc1"].Region)
+	assert.Equal(t, "cn-north-4", oldDc1.Region)
+
+	// hosts changed, old server configuration is not modified
+	configuration.OnTopologyChanged(NewRemoteRedisConfiguration("",
+		"", `{"dc1":{"hosts":"127.0.0.1:7379","type":"normal"},"dc3":{"hosts":"127.0.0.1:8379","type":"normal"}}`))
+	assert.Equal(t, 1, recorder.times)
+	assert.Equal(t, []string{"dc1"}, recorder.changedServers)
+	assert.False(t, recorder.routeAlgorithmChanged)
+	assert.Equal(t, "127.0.0.1:6379", oldDc1.Options.Addr)
+	assert.Equal(t, "127.0.0.1:7379", configuration.Snapshot().Servers["dc1"].Options.Addr)
+	assert.Equal(t, 2, len(configuration.Snapshot().Servers))
+
+	// replicas changed, the clients are rebuilt
+	configuration.OnTopologyChanged(NewRemoteRedisConfiguration("",
+		"", `{"dc1":{"hosts":"127.0.0.1:7379","type":"normal","replicas":"127.0.0.1:7380"}}`))
+	assert.Equal(t, 2, recorder.times)
+	assert.Equal(t, []string{"dc1"}, recorder.changedServers)
+	assert.Equal(t, "127.0.0.1:7380", configuration.Snapshot().Servers["dc1"].Replicas)
+
+	// readFrom changed, the clients are rebuilt
+	configuration.OnTopologyChanged(NewRemoteRedisConfiguration("",
+		"", `{"dc1":{"hosts":"127.0.0.1:7379","type":"normal","readFrom":"round-robin"}}`))
+	assert.Equal(t, 3, recorder.times)
+	assert.Equal(t, []string{"dc1"}, recorder.changedServers)
+	assert.Equal(t, ReadFromRoundRobin, configuration.Snapshot().Servers["dc1"].ReadFrom)
+	assert.Equal(t, "127.0.0.1:7380", configuration.Snapshot().Servers["dc1"].Replicas)
+
+	// route algorithm changed
+	configuration.OnTopologyChanged(NewRemoteRedisConfiguration("local-read-single-write", "", ""))
+	assert.Equal(t, 4, recorder.times)
+	assert.Equal(t, 0, len(recorder.changedServers))
+	assert.True(t, recorder.routeAlgorithmChanged)
+	assert.Equal(t, "local-read-single-write", configuration.Snapshot().RouteAlgorithm)
+	assert.Equal(t, uint64(6), configuration.Snapshot().Version)
+}
+
+func TestConfiguration_OnChanged(t *testing.T) {
+	configuration, err := LoadConfiguration("../resources/config_no_pool.yaml")
+	if err != nil {
+		t.Errorf("load configuration from config_no_pool.yaml failed, err: %v", err)
+		return
+	}
+	// before the snapshot is published, the active is assigned to configuration
+	configuration.OnChanged("dc1")
+	assert.Equal(t, "dc1", configuration.Active)
+	snapshot := configuration.Snapshot()
+	assert.Equal(t, "dc1", snapshot.Active)
+
+	configuration.OnChanged("dc2")
+	assert.Equal(t, "dc2", configuration.Snapshot().Active)
+	assert.Equal(t, snapshot.Version+1, configuration.Snapshot().Version)
+	assert.Equal(t, "dc1", snapshot.Active)
+	assert.Equal(t, "dc1", configuration.Snapshot().NoActive())
+
+	// same active does not publish a new snapshot
+	configuration.OnChanged("dc2")
+	assert.Equal(t, snapshot.Version+1, configuration.Snapshot().Version)
+}
+
+func TestLoadConfiguration_UseName(t *testing.T) {
+	dir := t.TempDir()
+	yamlFile := filepath.Join(dir, "config_use_name.yaml")
+	content := `
+redis:
+  useName: legacy
+  servers:
+    dc1:
+      hosts: 127.0.0.1:6379
+    dc2:
+      hosts: 127.0.0.1:6380
+      username: app
+routeAlgorithm: single-read-write
+active: dc1
+`
+	assert.Nil(t, os.WriteFile(yamlFile, []byte(content), 0600))
+	configuration, err := LoadConfiguration(yamlFile)
+	assert.Nil(t, err)
+	configuration.ConvertServerConfiguration()
+	assert.Equal(t, "legacy", configuration.RedisConfig.UserName)
+	assert.Equal(t, "legacy", configuration.RedisConfig.Servers["dc1"].Options.Username)
+	assert.Equal(t, "app", configuration.RedisConfig.Servers["dc2"].Options.Username)
+
+	// username wins over the deprecated useName
+	content = strings.Replace(content, "useName: legacy", "useName: legacy\n  username: user", 1)
+	assert.Nil(t, os.WriteFile(yamlFile, []byte(content), 0600))
+	configuration, err = LoadConfiguration(yamlFile)
+	assert.Nil(t, err)
+	assert.Equal(t, "user", configuration.RedisConfig.UserName)
+}
@@ -18,3 +18,14 @@ package config
 type Listener interface {
 	OnChanged(active string)
 }
+
+// TopologyListener is the interface for watching etcd servers and route algorithm key changes.
+type TopologyListener interface {
+	OnTopologyChanged(remoteConfiguration *RemoteRedisConfiguration)
+}
+
+// ReloadListener is the interface for watching Configuration reload, changedServers are the servers whose
+// hosts or type changed, routeAlgorithmChanged is true when Configuration's route algorithm changed.
+type ReloadListener interface {
+	OnReload(changedServers []string, routeAlgorithmChanged bool)
+}
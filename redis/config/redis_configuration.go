@@ -17,12 +17,20 @@ package config
 // RedisConfiguration defines a series of redis configuration in yaml file.
 type RedisConfiguration struct {
 	RedisGroupName               string                            `yaml:"redisGroupName"`
-	UserName                     string                            `yaml:"useName"`
+	UserName                     string                            `yaml:"username"` // default ACL username of the servers
+	UseName                      string                            `yaml:"useName"`  // deprecated, use username
 	Nearest                      string                            `yaml:"nearest"`
 	Servers                      map[string]*ServerConfiguration   `yaml:"servers"`
 	ConnectionPoolConfig         *RedisConnectionPoolConfiguration `yaml:"connectionPool"`
 	AsyncRemoteWrite             *AsyncRemoteWrite                 `yaml:"asyncRemoteWrite"`
 	AsyncRemotePoolConfiguration *AsyncRemotePoolConfiguration     `yaml:"asyncRemotePool"`
+	HealthCheck                  *HealthCheckConfiguration         `yaml:"healthCheck"`
+	CircuitBreaker               *CircuitBreakerConfiguration      `yaml:"circuitBreaker"`
+	PubSub                       *PubSubConfiguration              `yaml:"pubSub"`
+	Instrumentation              *InstrumentationConfiguration     `yaml:"instrumentation"`
+	NearCache                    *NearCacheConfiguration           `yaml:"nearCache"`
+	ReadCoalescing               *ReadCoalescingConfiguration      `yaml:"readCoalescing"`
+	HotKey                       *HotKeyConfiguration              `yaml:"hotKey"`
 }
 
 type RedisConnectionPoolConfiguration struct {
@@ -31,6 +39,8 @@ type RedisConnectionPoolConfiguration struct {
 
 type AsyncRemoteWrite struct {
 	RetryTimes int `yaml:"retryTimes"`
+	// IdempotentRewrite mirror non-idempotent commands such as INCR and APPEND in idempotent forms
+	IdempotentRewrite bool `yaml:"idempotentRewrite"`
 }
 
 type AsyncRemotePoolConfiguration struct {
@@ -40,4 +50,92 @@ type AsyncRemotePoolConfiguration struct {
 	KeepAliveTime   int64  `yaml:"keepAliveTime"`
 	TaskQueueSize   int    `yaml:"taskQueueSize"`
 	PersistDir      string `yaml:"persistDir"`
+	// FsyncPolicy of the file double-write WAL, always, interval(default) or never
+	FsyncPolicy          string `yaml:"fsyncPolicy"`
+	FsyncIntervalMillis  int    `yaml:"fsyncIntervalMillis"`
+	SegmentSize          int64  `yaml:"segmentSize"`
+	ReplayIntervalMillis int    `yaml:"replayIntervalMillis"`
+	// OverflowPolicy of the memory double-write queue, block(default), drop-newest, drop-oldest or spill
+	OverflowPolicy string `yaml:"overflowPolicy"`
+}
+
+// HealthCheckConfiguration local health check of redis servers, an unhealthy active or nearest server is
+// switched to a healthy one, and switched back after it recovers.
+type HealthCheckConfiguration struct {
+	Enable           bool `yaml:"enable"`
+	IntervalMillis   int  `yaml:"intervalMillis"`   // default 1000
+	TimeoutMillis    int  `yaml:"timeoutMillis"`    // default 500
+	FailureThreshold int  `yaml:"failureThreshold"` // default 3, consecutive failed PINGs to mark a server down
+	SuccessThreshold int  `yaml:"successThreshold"` // default 3, consecutive succeeded PINGs to mark a server up
+}
+
+// CircuitBreakerConfiguration per server circuit breaker, commands to a server whose breaker is open fail fast.
+type CircuitBreakerConfiguration struct {
+	Enable              bool `yaml:"enable"`
+	FailureThreshold    int  `yaml:"failureThreshold"`    // default 5, consecutive failures to open the breaker
+	OpenMillis          int  `yaml:"openMillis"`          // default 5000, time before an open breaker turns half-open
+	HalfOpenMaxRequests int  `yaml:"halfOpenMaxRequests"` // default 1, succeeded probes in half-open to close the breaker
+}
+
+// PubSubConfiguration cross-DC pub/sub, so that a subscriber receives the messages published to every server.
+type PubSubConfiguration struct {
+	// MirrorPublish publish the messages to all servers, they are mirrored like the writes in the double-write
+	// route algorithms
+	MirrorPublish bool `yaml:"mirrorPublish"`
+	// DedupWindowMillis the window in which the copies of a message received from other servers are dropped by
+	// the fan-in subscription, default 10000
+	DedupWindowMillis int `yaml:"dedupWindowMillis"`
+}
+
+// MirrorPublish whether the published messages are mirrored to all servers.
+func (r *RedisConfiguration) MirrorPublish() bool {
+	return r.PubSub != nil && r.PubSub.MirrorPublish
+}
+
+// InstrumentationConfiguration per-command metrics and tracing of the commands executed on every server.
+type InstrumentationConfiguration struct {
+	Enable bool `yaml:"enable"`
+	// Providers names of the instrumentations, prometheus and opentelemetry are built in, the others are
+	// registered by instrument.Register
+	Providers     []string                    `yaml:"providers"`
+	Prometheus    *PrometheusConfiguration    `yaml:"prometheus"`
+	OpenTelemetry *OpenTelemetryConfiguration `yaml:"openTelemetry"`
+}
+
+type PrometheusConfiguration struct {
+	Namespace string    `yaml:"namespace"` // default devspore
+	Buckets   []float64 `yaml:"buckets"`   // latency histogram buckets in seconds, default prometheus.DefBuckets
+}
+
+type OpenTelemetryConfiguration struct {
+	TracerName string `yaml:"tracerName"` // default github.com/huaweicloud/devcloud-go/redis
+}
+
+// NearCacheConfiguration client-side caching of the GET, HGET and HGETALL of DevsporeClient, the cached keys are
+// invalidated by the redis 6 CLIENT TRACKING of the server which the reads are routed to.
+type NearCacheConfiguration struct {
+	Enable     bool `yaml:"enable"`
+	MaxEntries int  `yaml:"maxEntries"` // default 10000, max cached keys, the least recently used are evicted
+	TTLMillis  int  `yaml:"ttlMillis"`  // default 60000, max time a reply is cached
+	// Mode of the tracking, default or bcast; default tracks the keys read, bcast tracks all keys of Prefixes
+	// and only they are cached
+	Mode     string   `yaml:"mode"`
+	Prefixes []string `yaml:"prefixes"`
+}
+
+// ReadCoalescingConfiguration the identical reads sent to a server concurrently by DevsporeClient are executed once,
+// the others wait for and share the reply.
+type ReadCoalescingConfiguration struct {
+	Enable bool `yaml:"enable"`
+}
+
+// HotKeyConfiguration count the keys of the commands of every server in a sliding window, to report the top-N keys.
+type HotKeyConfiguration struct {
+	Enable       bool `yaml:"enable"`
+	WindowMillis int  `yaml:"windowMillis"` // default 10000
+	Buckets      int  `yaml:"buckets"`      // default 10, the window slides by a bucket
+	TopN         int  `yaml:"topN"`         // default 10
+	// MaxKeys default 10000, max distinct keys counted in a bucket of a server, the new keys are not counted when
+	// the bucket is full
+	MaxKeys int `yaml:"maxKeys"`
 }
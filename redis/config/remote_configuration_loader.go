@@ -36,6 +36,7 @@ type RemoteConfigurationLoader struct {
 	activeKey          string
 	serversKey         string
 	listeners          []Listener
+	topologyListeners  []TopologyListener
 }
 
 // NewRemoteConfigurationLoader create a loader to load remote configuration
@@ -91,6 +92,14 @@ func (l *RemoteConfigurationLoader) AddRouterListener(listener Listener) {
 	l.listeners = append(l.listeners, listener)
 }
 
+// AddTopologyListener add a listener for servers and route algorithm changes
+func (l *RemoteConfigurationLoader) AddTopologyListener(listener TopologyListener) {
+	if l.topologyListeners == nil {
+		l.topologyListeners = []TopologyListener{}
+	}
+	l.topologyListeners = append(l.topologyListeners, listener)
+}
+
 // onChanged listening for etcd activeKey changes
 func (l *RemoteConfigurationLoader) onChanged(event *clientv3.Event) {
 	if string(event.Kv.Key) == l.activeKey && event.Type == clientv3.EventTypePut {
@@ -100,10 +109,28 @@ func (l *RemoteConfigurationLoader) onChanged(event *clientv3.Event) {
 	}
 }
 
-// Init etcd start watch activeKey
+// onTopologyChanged listening for etcd serversKey and routerAlgorithmKey changes, the whole remote configuration
+// is reloaded, so listeners always get a consistent servers and route algorithm.
+func (l *RemoteConfigurationLoader) onTopologyChanged(event *clientv3.Event) {
+	key := string(event.Kv.Key)
+	if (key != l.serversKey && key != l.routerAlgorithmKey) || event.Type != clientv3.EventTypePut {
+		return
+	}
+	remoteConfiguration := l.GetConfiguration()
+	if remoteConfiguration == nil {
+		return
+	}
+	for _, listener := range l.topologyListeners {
+		listener.OnTopologyChanged(remoteConfiguration)
+	}
+}
+
+// Init etcd start watch activeKey, serversKey and routerAlgorithmKey
 func (l *RemoteConfigurationLoader) Init() {
 	if l.etcdClient == nil {
 		return
 	}
 	go l.etcdClient.Watch(l.activeKey, 0, l.onChanged)
+	go l.etcdClient.Watch(l.serversKey, 0, l.onTopologyChanged)
+	go l.etcdClient.Watch(l.routerAlgorithmKey, 0, l.onTopologyChanged)
 }
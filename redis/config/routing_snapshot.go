@@ -0,0 +1,109 @@
+/*
+ * Copyright (c) Huawei Technologies Co., Ltd. 2021.
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use
+ * this file except in compliance with the License.  You may obtain a copy of the
+ * License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations under the License.
+ *
+ */
+
+package config
+
+import "sort"
+
+// RoutingSnapshot is an immutable view of the routing state of a Configuration. Every change of active server,
+// servers or route algorithm publishes a new snapshot with a bigger Version, so a command which routes with one
+// snapshot never sees a half updated state. Snapshots must not be modified.
+type RoutingSnapshot struct {
+	Version        uint64
+	RouteAlgorithm string
+	Active         string
+	Nearest        string
+	Servers        map[string]*ServerConfiguration
+
+	serverNames []string
+}
+
+func newRoutingSnapshot(version uint64, routeAlgorithm, active, nearest string,
+	servers map[string]*ServerConfiguration) *RoutingSnapshot {
+	snapshot := &RoutingSnapshot{
+		Version:        version,
+		RouteAlgorithm: routeAlgorithm,
+		Active:         active,
+		Nearest:        nearest,
+		Servers:        make(map[string]*ServerConfiguration, len(servers)),
+		serverNames:    make([]string, 0, len(servers)),
+	}
+	for name, serverConfig := range servers {
+		snapshot.Servers[name] = serverConfig
+		snapshot.serverNames = append(snapshot.serverNames, name)
+	}
+	sort.Strings(snapshot.serverNames)
+	return snapshot
+}
+
+// ServerNames returns the sorted server names, which must not be modified.
+func (s *RoutingSnapshot) ServerNames() []string {
+	return s.serverNames
+}
+
+// NoActive returns a server other than the active server, "" if there is none.
+func (s *RoutingSnapshot) NoActive() string {
+	return s.otherServer(s.Active)
+}
+
+// Remote returns a server other than the nearest server, "" if there is none.
+func (s *RoutingSnapshot) Remote() string {
+	return s.otherServer(s.Nearest)
+}
+
+// NoActives returns all the servers other than the active server in order.
+func (s *RoutingSnapshot) NoActives() []string {
+	return s.otherServers(s.Active)
+}
+
+// Remotes returns all the servers other than the nearest server in order.
+func (s *RoutingSnapshot) Remotes() []string {
+	return s.otherServers(s.Nearest)
+}
+
+func (s *RoutingSnapshot) otherServers(serverName string) []string {
+	names := make([]string, 0, len(s.serverNames))
+	for _, name := range s.serverNames {
+		if name != serverName {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// otherServer the server names are sorted, so that the same snapshot always returns the same server.
+func (s *RoutingSnapshot) otherServer(serverName string) string {
+	for _, name := range s.serverNames {
+		if name != serverName {
+			return name
+		}
+	}
+	return ""
+}
+
+// withActive returns a copy of the snapshot with the new active server.
+func (s *RoutingSnapshot) withActive(active string) *RoutingSnapshot {
+	return newRoutingSnapshot(s.Version+1, s.RouteAlgorithm, active, s.Nearest, s.Servers)
+}
+
+// withNearest returns a copy of the snapshot with the new nearest server.
+func (s *RoutingSnapshot) withNearest(nearest string) *RoutingSnapshot {
+	return newRoutingSnapshot(s.Version+1, s.RouteAlgorithm, s.Active, nearest, s.Servers)
+}
+
+// withTopology returns a copy of the snapshot with the new route algorithm and servers.
+func (s *RoutingSnapshot) withTopology(routeAlgorithm string, servers map[string]*ServerConfiguration) *RoutingSnapshot {
+	return newRoutingSnapshot(s.Version+1, routeAlgorithm, s.Active, s.Nearest, servers)
+}
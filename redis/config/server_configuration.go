@@ -15,18 +15,25 @@
 package config
 
 import (
+	"crypto/tls"
+	"encoding/json"
+	"log"
+	"strings"
 	"time"
 
 	"github.com/go-redis/redis/v8"
 	"github.com/huaweicloud/devcloud-go/common/password"
 	"github.com/huaweicloud/devcloud-go/common/util"
+	"gopkg.in/yaml.v3"
 )
 
 // ServerConfiguration contains yaml redis server configuration, go-redis Options and ClusterOptions(when type is cluster).
 type ServerConfiguration struct {
 	Hosts            string                             `yaml:"hosts"`
+	Username         string                             `yaml:"username"` // redis 6 ACL user, default redis.username
 	Password         string                             `yaml:"password"`
-	Type             string                             `yaml:"type"` // cluster, normal, sentinel
+	TLS              *TLSConfiguration                  `yaml:"tls"`
+	Type             string                             `yaml:"type"` // cluster, normal, master-slave, sentinel
 	Cloud            string                             `yaml:"cloud"`
 	Region           string                             `yaml:"region"`
 	Azs              string                             `yaml:"azs"`
@@ -35,10 +42,23 @@ type ServerConfiguration struct {
 	Timeout          int                                `yaml:"timeout"`
 	SentinelPassword string                             `yaml:"sentinelPassword"` // sentinel opt
 	MasterName       string                             `yaml:"masterName"`       // sentinel opt
+	RouteByLatency   bool                               `yaml:"routeByLatency"`   // sentinel opt, read from the closest node
+	RouteRandomly    bool                               `yaml:"routeRandomly"`    // sentinel opt, read from a random node
+	SlaveOnly        bool                               `yaml:"slaveOnly"`        // sentinel opt, all commands to replicas
 	ConnectionPool   *ServerConnectionPoolConfiguration `yaml:"pool"`
+	// AsyncRemoteWrite overrides redis.asyncRemoteWrite when commands are mirrored to this server
+	AsyncRemoteWrite *AsyncRemoteWrite `yaml:"asyncRemoteWrite"`
 	ClusterOptions   *redis.ClusterOptions
 	FailoverOptions  *redis.FailoverOptions
 	Options          *redis.Options
+
+	// master-slave opt, hosts is the master, reads are balanced across the healthy replicas by readFrom: random,
+	// round-robin (default) or least-latency.
+	Replicas                   string `yaml:"replicas"`
+	ReadFrom                   string `yaml:"readFrom"`
+	ReplicaCheckIntervalMillis int    `yaml:"replicaCheckIntervalMillis"` // default 1000
+	// ReplicaOptions the go-redis Options of the replicas
+	ReplicaOptions []*redis.Options
 }
 
 // ServerConnectionPoolConfiguration connection pool configuration
@@ -48,7 +68,48 @@ type ServerConnectionPoolConfiguration struct {
 	MinIdle                       int  `yaml:"minIdle"`
 	MaxWaitMillis                 int  `yaml:"maxWaitMillis"`
 	TimeBetweenEvictionRunsMillis int  `yaml:"timeBetweenEvictionRunsMillis"`
-	Lifo                          bool `yaml:"lifo"`
+	MinEvictableIdleTimeMillis    int  `yaml:"minEvictableIdleTimeMillis"` // default 300000
+	MaxConnLifetimeMillis         int  `yaml:"maxConnLifetimeMillis"`      // default 0, never closed by age
+	Lifo                          bool `yaml:"lifo"`                       // the zero value means not set, lifo
+	// lifoSet whether lifo is set in the yaml or json configuration, so that an explicit false is not the zero value
+	lifoSet bool
+}
+
+// UnmarshalYAML decode the pool configuration and record whether lifo is set.
+func (p *ServerConnectionPoolConfiguration) UnmarshalYAML(value *yaml.Node) error {
+	type plain ServerConnectionPoolConfiguration
+	if err := value.Decode((*plain)(p)); err != nil {
+		return err
+	}
+	for i := 0; i+1 < len(value.Content); i += 2 {
+		if value.Content[i].Value == "lifo" {
+			p.lifoSet = true
+		}
+	}
+	return nil
+}
+
+// UnmarshalJSON decode the pool configuration of etcd and record whether lifo is set.
+func (p *ServerConnectionPoolConfiguration) UnmarshalJSON(data []byte) error {
+	type plain ServerConnectionPoolConfiguration
+	if err := json.Unmarshal(data, (*plain)(p)); err != nil {
+		return err
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+	for name := range fields {
+		if strings.EqualFold(name, "lifo") {
+			p.lifoSet = true
+		}
+	}
+	return nil
+}
+
+// FIFO whether the pool reuse the least recently returned connection first, only if lifo is set to false.
+func (p *ServerConnectionPoolConfiguration) FIFO() bool {
+	return p.lifoSet && !p.Lifo
 }
 
 const (
@@ -58,6 +119,50 @@ const (
 	ServerTypeSentinel    = "sentinel"
 )
 
+// the policies to choose a replica of a master-slave server for reads.
+const (
+	ReadFromRandom       = "random"
+	ReadFromRoundRobin   = "round-robin"
+	ReadFromLeastLatency = "least-latency"
+)
+
+// assign the remote server configuration's hosts, type, replicas and location to the server configuration.
+func (s *ServerConfiguration) assign(remote *ServerConfiguration) {
+	s.Hosts = remote.Hosts
+	s.Type = remote.Type
+	if len(remote.Replicas) != 0 {
+		s.Replicas = remote.Replicas
+	}
+	if len(remote.ReadFrom) != 0 {
+		s.ReadFrom = remote.ReadFrom
+	}
+	if len(remote.Cloud) != 0 {
+		s.Cloud = remote.Cloud
+	}
+	if len(remote.Region) != 0 {
+		s.Region = remote.Region
+	}
+	if len(remote.Azs) != 0 {
+		s.Azs = remote.Azs
+	}
+}
+
+// rebuildOf whether the clients of the server must be rebuilt for the new server configuration.
+func (s *ServerConfiguration) rebuildOf(newServerConfig *ServerConfiguration) bool {
+	return s.Hosts != newServerConfig.Hosts || s.Type != newServerConfig.Type ||
+		s.Replicas != newServerConfig.Replicas || s.ReadFrom != newServerConfig.ReadFrom
+}
+
+// differsFrom whether the remote server configuration will change the server configuration.
+func (s *ServerConfiguration) differsFrom(remote *ServerConfiguration) bool {
+	return s.Hosts != remote.Hosts || s.Type != remote.Type ||
+		(len(remote.Replicas) != 0 && s.Replicas != remote.Replicas) ||
+		(len(remote.ReadFrom) != 0 && s.ReadFrom != remote.ReadFrom) ||
+		(len(remote.Cloud) != 0 && s.Cloud != remote.Cloud) ||
+		(len(remote.Region) != 0 && s.Region != remote.Region) ||
+		(len(remote.Azs) != 0 && s.Azs != remote.Azs)
+}
+
 // convertOptions convert yaml redis server configuration to go-redis Options or ClusterOptions
 func (s *ServerConfiguration) convertOptions() {
 	if s.Timeout == 0 {
@@ -74,15 +179,20 @@ func (s *ServerConfiguration) convertOptions() {
 		if len(s.Password) > 0 {
 			clusterOpts.Password = password.GetDecipher().Decode(s.Password)
 		}
+		clusterOpts.Username = s.Username
+		clusterOpts.TLSConfig = s.tlsConfig()
 		clusterOpts.MaxRetries = s.MaxAttempts
 		clusterOpts.DialTimeout = timeout
 		clusterOpts.WriteTimeout = timeout
 		clusterOpts.ReadTimeout = timeout
-		if *s.ConnectionPool != (ServerConnectionPoolConfiguration{}) {
+		if s.ConnectionPool != nil && *s.ConnectionPool != (ServerConnectionPoolConfiguration{}) {
 			clusterOpts.PoolSize = s.ConnectionPool.MaxTotal
 			clusterOpts.MinIdleConns = s.ConnectionPool.MinIdle
 			clusterOpts.IdleCheckFrequency = time.Duration(s.ConnectionPool.TimeBetweenEvictionRunsMillis) * time.Millisecond
 			clusterOpts.PoolTimeout = time.Duration(s.ConnectionPool.MaxWaitMillis) * time.Millisecond
+			clusterOpts.IdleTimeout = time.Duration(s.ConnectionPool.MinEvictableIdleTimeMillis) * time.Millisecond
+			clusterOpts.MaxConnAge = time.Duration(s.ConnectionPool.MaxConnLifetimeMillis) * time.Millisecond
+			clusterOpts.PoolFIFO = s.ConnectionPool.FIFO()
 		}
 		s.ClusterOptions = clusterOpts
 		return
@@ -96,6 +206,8 @@ func (s *ServerConfiguration) convertOptions() {
 	if len(s.Password) > 0 {
 		opts.Password = password.GetDecipher().Decode(s.Password)
 	}
+	opts.Username = s.Username
+	opts.TLSConfig = s.tlsConfig()
 	opts.DB = s.Db
 	opts.DialTimeout = timeout
 	opts.WriteTimeout = timeout
@@ -105,8 +217,22 @@ func (s *ServerConfiguration) convertOptions() {
 		opts.MinIdleConns = s.ConnectionPool.MinIdle
 		opts.IdleCheckFrequency = time.Duration(s.ConnectionPool.TimeBetweenEvictionRunsMillis) * time.Millisecond
 		opts.PoolTimeout = time.Duration(s.ConnectionPool.MaxWaitMillis) * time.Millisecond
+		opts.IdleTimeout = time.Duration(s.ConnectionPool.MinEvictableIdleTimeMillis) * time.Millisecond
+		opts.MaxConnAge = time.Duration(s.ConnectionPool.MaxConnLifetimeMillis) * time.Millisecond
+		opts.PoolFIFO = s.ConnectionPool.FIFO()
 	}
 	s.Options = opts
+	s.ReplicaOptions = nil
+	if s.Type == ServerTypeMasterSlave {
+		if s.ReadFrom == "" {
+			s.ReadFrom = ReadFromRoundRobin
+		}
+		for _, replica := range util.ConvertAddressStrToSlice(s.Replicas, false) {
+			replicaOpts := *opts
+			replicaOpts.Addr = replica
+			s.ReplicaOptions = append(s.ReplicaOptions, &replicaOpts)
+		}
+	}
 }
 
 func (s *ServerConfiguration) getFailoverOptions() *redis.FailoverOptions {
@@ -117,12 +243,17 @@ func (s *ServerConfiguration) getFailoverOptions() *redis.FailoverOptions {
 		opts.Password = password.GetDecipher().Decode(s.Password)
 	}
 	if len(s.SentinelPassword) > 0 {
-		opts.SentinelPassword = password.GetDecipher().Decode(s.Password)
+		opts.SentinelPassword = password.GetDecipher().Decode(s.SentinelPassword)
 	}
+	opts.Username = s.Username
+	opts.TLSConfig = s.tlsConfig()
 	if s.MasterName == "" {
 		s.MasterName = "mymaster"
 	}
 	opts.MasterName = s.MasterName
+	opts.RouteByLatency = s.RouteByLatency
+	opts.RouteRandomly = s.RouteRandomly
+	opts.SlaveOnly = s.SlaveOnly
 	opts.MaxRetries = s.MaxAttempts
 	timeout := time.Millisecond * time.Duration(s.Timeout)
 	opts.DialTimeout = timeout
@@ -134,7 +265,9 @@ func (s *ServerConfiguration) getFailoverOptions() *redis.FailoverOptions {
 		opts.MinIdleConns = s.ConnectionPool.MinIdle
 		opts.IdleCheckFrequency = time.Duration(s.ConnectionPool.TimeBetweenEvictionRunsMillis) * time.Millisecond
 		opts.PoolTimeout = time.Duration(s.ConnectionPool.MaxWaitMillis) * time.Millisecond
-		opts.PoolFIFO = s.ConnectionPool.Lifo
+		opts.IdleTimeout = time.Duration(s.ConnectionPool.MinEvictableIdleTimeMillis) * time.Millisecond
+		opts.MaxConnAge = time.Duration(s.ConnectionPool.MaxConnLifetimeMillis) * time.Millisecond
+		opts.PoolFIFO = s.ConnectionPool.FIFO()
 	}
 	return opts
 }
@@ -149,3 +282,14 @@ func newDefaultConnectionPool() *ServerConnectionPoolConfiguration {
 		Lifo:                          true,
 	}
 }
+
+// tlsConfig create the tls.Config of the connections, if the TLS configuration is invalid, TLS is still enabled
+// without the invalid files, so that the server rejects the connections rather than receives plaintext.
+func (s *ServerConfiguration) tlsConfig() *tls.Config {
+	tlsConfig, err := s.TLS.Build()
+	if err != nil {
+		log.Printf("ERROR: invalid tls configuration of redis server '%s', %v", s.Hosts, err)
+		return &tls.Config{MinVersion: tls.VersionTLS12, ServerName: s.TLS.ServerName}
+	}
+	return tlsConfig
+}
@@ -20,6 +20,7 @@ import (
 
 	"github.com/huaweicloud/devcloud-go/common/password"
 	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v3"
 )
 
 func TestServerConfigurationConvertOptions(t *testing.T) {
@@ -83,6 +84,7 @@ func TestServerConfigurationConvertOptions_DefaultPool(t *testing.T) {
 		assert.Equal(t, 0, serverConfig.Options.MinIdleConns)
 		assert.Equal(t, time.Duration(60000)*time.Millisecond, serverConfig.Options.IdleCheckFrequency)
 		assert.Equal(t, time.Duration(10000)*time.Millisecond, serverConfig.Options.PoolTimeout)
+		assert.False(t, serverConfig.Options.PoolFIFO)
 	}
 }
 
@@ -92,3 +94,82 @@ type myDecipher struct {
 func (d *myDecipher) Decode(password string) string {
 	return password + "!!!"
 }
+
+func TestServerConfigurationConvertOptions_MasterSlave(t *testing.T) {
+	serverConfig := &ServerConfiguration{
+		Type:     ServerTypeMasterSlave,
+		Hosts:    "127.0.0.1:6379",
+		Replicas: "127.0.0.1:6380, 127.0.0.1:6381",
+		Db:       1,
+	}
+	serverConfig.convertOptions()
+	assert.Equal(t, "127.0.0.1:6379", serverConfig.Options.Addr)
+	assert.Equal(t, ReadFromRoundRobin, serverConfig.ReadFrom)
+	assert.Equal(t, 2, len(serverConfig.ReplicaOptions))
+	assert.Equal(t, "127.0.0.1:6380", serverConfig.ReplicaOptions[0].Addr)
+	assert.Equal(t, "127.0.0.1:6381", serverConfig.ReplicaOptions[1].Addr)
+	assert.Equal(t, 1, serverConfig.ReplicaOptions[1].DB)
+
+	sentinelConfig := &ServerConfiguration{
+		Type:           ServerTypeSentinel,
+		Hosts:          "127.0.0.1:26379",
+		RouteByLatency: true,
+		SlaveOnly:      true,
+	}
+	sentinelConfig.convertOptions()
+	assert.True(t, sentinelConfig.FailoverOptions.RouteByLatency)
+	assert.False(t, sentinelConfig.FailoverOptions.RouteRandomly)
+	assert.True(t, sentinelConfig.FailoverOptions.SlaveOnly)
+}
+
+func TestServerConfigurationConvertOptions_Lifo(t *testing.T) {
+	var servers map[string]*ServerConfiguration
+	yamlServers := `
+lifo: {hosts: "127.0.0.1:6379", pool: {maxTotal: 10, lifo: true}}
+fifo: {hosts: "127.0.0.1:6380", pool: {maxTotal: 10, lifo: false}}
+unset: {hosts: "127.0.0.1:6381", pool: {maxTotal: 10}}
+`
+	assert.Nil(t, yaml.Unmarshal([]byte(yamlServers), &servers))
+	remote := NewRemoteRedisConfiguration("", "",
+		`{"remoteFifo": {"Hosts": "127.0.0.1:6382", "ConnectionPool": {"MaxTotal": 10, "Lifo": false}}}`)
+	servers["remoteFifo"] = remote.Servers["remoteFifo"]
+	servers["default"] = &ServerConfiguration{Hosts: "127.0.0.1:6383", ConnectionPool: newDefaultConnectionPool()}
+	servers["zero"] = &ServerConfiguration{Hosts: "127.0.0.1:6384",
+		ConnectionPool: &ServerConnectionPoolConfiguration{MaxTotal: 10}}
+	expected := map[string]bool{"lifo": false, "fifo": true, "unset": false, "remoteFifo": true, "default": false,
+		"zero": false}
+	for serverName, fifo := range expected {
+		serverConfig := servers[serverName]
+		serverConfig.convertOptions()
+		assert.Equal(t, fifo, serverConfig.Options.PoolFIFO, serverName)
+	}
+}
+
+func TestServerConfigurationConvertOptions_UsernameAndTLS(t *testing.T) {
+	configuration := &Configuration{RedisConfig: &RedisConfiguration{
+		UserName: "default_user",
+		Servers: map[string]*ServerConfiguration{
+			"dc1": {Type: ServerTypeNormal, Hosts: "127.0.0.1:6379",
+				TLS: &TLSConfiguration{Enable: true, ServerName: "redis.example.com", InsecureSkipVerify: true}},
+			"dc2": {Type: ServerTypeCluster, Hosts: "127.0.0.1:7000", Username: "cluster_user"},
+			"dc3": {Type: ServerTypeSentinel, Hosts: "127.0.0.1:26379", SentinelPassword: "sentinel",
+				TLS: &TLSConfiguration{Enable: true, CaFile: "not_exist.pem"}},
+		},
+	}}
+	configuration.ConvertServerConfiguration()
+	servers := configuration.RedisConfig.Servers
+
+	assert.Equal(t, "default_user", servers["dc1"].Options.Username)
+	assert.NotNil(t, servers["dc1"].Options.TLSConfig)
+	assert.Equal(t, "redis.example.com", servers["dc1"].Options.TLSConfig.ServerName)
+	assert.True(t, servers["dc1"].Options.TLSConfig.InsecureSkipVerify)
+
+	assert.Equal(t, "cluster_user", servers["dc2"].ClusterOptions.Username)
+	assert.Nil(t, servers["dc2"].ClusterOptions.TLSConfig)
+
+	assert.Equal(t, "default_user", servers["dc3"].FailoverOptions.Username)
+	assert.Equal(t, password.GetDecipher().Decode("sentinel"), servers["dc3"].FailoverOptions.SentinelPassword)
+	// an invalid TLS configuration still uses TLS
+	assert.NotNil(t, servers["dc3"].FailoverOptions.TLSConfig)
+	assert.Nil(t, servers["dc3"].FailoverOptions.TLSConfig.RootCAs)
+}
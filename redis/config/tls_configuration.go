@@ -0,0 +1,63 @@
+/*
+ * Copyright (c) Huawei Technologies Co., Ltd. 2021.
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use
+ * this file except in compliance with the License.  You may obtain a copy of the
+ * License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package config
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// TLSConfiguration the TLS of the connections to a redis server.
+type TLSConfiguration struct {
+	Enable             bool   `yaml:"enable"`
+	CaFile             string `yaml:"caFile"`   // PEM CA certificates to verify the server, default system roots
+	CertFile           string `yaml:"certFile"` // PEM client certificate, for mutual TLS
+	KeyFile            string `yaml:"keyFile"`  // PEM client private key, for mutual TLS
+	ServerName         string `yaml:"serverName"`
+	InsecureSkipVerify bool   `yaml:"insecureSkipVerify"`
+}
+
+// Build create the tls.Config, nil if TLS is not enabled.
+func (t *TLSConfiguration) Build() (*tls.Config, error) {
+	if t == nil || !t.Enable {
+		return nil, nil
+	}
+	tlsConfig := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		ServerName:         t.ServerName,
+		InsecureSkipVerify: t.InsecureSkipVerify,
+	}
+	if t.CaFile != "" {
+		ca, err := os.ReadFile(filepath.Clean(t.CaFile))
+		if err != nil {
+			return nil, fmt.Errorf("read tls caFile failed, %w", err)
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("tls caFile '%s' has no PEM certificate", t.CaFile)
+		}
+	}
+	if t.CertFile != "" || t.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(t.CertFile, t.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("load tls certFile and keyFile failed, %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return tlsConfig, nil
+}
@@ -28,16 +28,28 @@ import (
 	"log"
 
 	"github.com/huaweicloud/devcloud-go/redis/config"
+	"github.com/huaweicloud/devcloud-go/redis/file"
+	"github.com/huaweicloud/devcloud-go/redis/hotkey"
+	"github.com/huaweicloud/devcloud-go/redis/nearcache"
 	"github.com/huaweicloud/devcloud-go/redis/redigostrategy"
+	"github.com/huaweicloud/devcloud-go/redis/resync"
 	"github.com/huaweicloud/devcloud-go/redis/strategy"
 )
 
+const defaultPublishQueueSize = 1000
+
 // DevsporeClient implements go-redis/UniversalClient interface which defines all redis commands, DevsporeClient includes
 // configuration and a client pool, the pool will store redis client or cluster client.
 type DevsporeClient struct {
 	ctx           context.Context
 	configuration *config.Configuration
 	strategy      strategy.StrategyMode
+	healthChecker *strategy.HealthChecker
+	nearCache     *nearcache.NearCache
+	coalescer     *hotkey.Coalescer
+	detector      *hotkey.Detector
+	// publisher mirrors the published messages to the other servers, nil if mirrorPublish is not enabled
+	publisher *strategy.AsyncExecutor
 }
 
 type DevsporeRedigoClient struct {
@@ -65,11 +77,42 @@ func NewDevsporeClient(configuration *config.Configuration) *DevsporeClient {
 		log.Fatalf("ERROR: configuration is invalid, config is [%+v], err [%v]", configuration, err)
 		return nil
 	}
-	return &DevsporeClient{
+	client := &DevsporeClient{
 		ctx:           context.Background(),
-		strategy:      strategy.NewStrategy(configuration),
+		strategy:      strategy.NewReloadableStrategy(configuration),
 		configuration: configuration,
 	}
+	if healthCheck := configuration.RedisConfig.HealthCheck; healthCheck != nil && healthCheck.Enable {
+		client.healthChecker = strategy.NewHealthChecker(configuration)
+		client.healthChecker.Start()
+	}
+	if client.nearCache = nearcache.New(configuration); client.nearCache != nil {
+		client.strategy.AddClientHook(client.nearCache.Hook)
+	}
+	// the detector is added first, so that the coalesced reads are counted too
+	if client.detector = hotkey.NewDetector(configuration.RedisConfig.HotKey); client.detector != nil {
+		client.strategy.AddClientHook(client.detector.Hook)
+	}
+	client.coalescer = hotkey.NewCoalescer(configuration.RedisConfig.ReadCoalescing, client.isRead)
+	if client.coalescer != nil {
+		client.strategy.AddClientHook(client.coalescer.Hook)
+	}
+	if configuration.RedisConfig.MirrorPublish() {
+		client.publisher = strategy.NewAsyncExecutor(publisherConfiguration(configuration), nil)
+	}
+	return client
+}
+
+// publisherConfiguration the mirrored messages are queued like the double-write commands by asyncRemotePool, or
+// dropped when the default queue is full if it is not configured.
+func publisherConfiguration(configuration *config.Configuration) *config.AsyncRemotePoolConfiguration {
+	if poolConfig := configuration.RedisConfig.AsyncRemotePoolConfiguration; poolConfig != nil {
+		return poolConfig
+	}
+	return &config.AsyncRemotePoolConfiguration{
+		TaskQueueSize:  defaultPublishQueueSize,
+		OverflowPolicy: strategy.OverflowDropNewest,
+	}
 }
 
 // NewDevsporeClientWithYaml create a devsporeClient with yaml configuration.
@@ -87,19 +130,123 @@ func NewDevsporeRedigoClient(configuration *config.Configuration) *DevsporeRedig
 	configuration.AssignRemoteConfig()
 	configuration.ComputeNearestServer()
 	configuration.ConvertServerConfiguration()
-	if err := validateConfiguration(configuration); err != nil {
+	if err := validateRedigoConfiguration(configuration); err != nil {
 		log.Fatalf("ERROR: configuration is invalid, config is [%+v], err [%v]", configuration, err)
 		return nil
 	}
 	return &DevsporeRedigoClient{
 		ctx:           context.Background(),
-		strategy:      redigostrategy.NewStrategy(configuration),
+		strategy:      redigostrategy.NewReloadableStrategy(configuration),
 		configuration: configuration,
 	}
 }
 
+// HealthChecker returns the health checker, nil if health check is not enabled.
+func (c *DevsporeClient) HealthChecker() *strategy.HealthChecker {
+	return c.healthChecker
+}
+
+// CircuitBreakerStats returns the circuit breaker stats of every server, empty if circuit breaker is not enabled.
+func (c *DevsporeClient) CircuitBreakerStats() map[string]strategy.CircuitBreakerStats {
+	return c.strategy.CircuitBreakerStats()
+}
+
+// ReplayLag returns the pending records of the file double-write of every target server, empty if file
+// double-write is not enabled.
+func (c *DevsporeClient) ReplayLag() map[string]file.ReplayLag {
+	return c.strategy.ReplayLag()
+}
+
+// DoubleWriteStats returns the queued, executed, dropped and spilled commands of the memory double-write of every
+// target server, empty if memory double-write is not enabled.
+func (c *DevsporeClient) DoubleWriteStats() map[string]strategy.AsyncExecutorStats {
+	return c.strategy.DoubleWriteStats()
+}
+
+// Resync copies all keys of the source server to the target server, the source is walked by SCAN, every master
+// node of a cluster. The live double-writes continue during the resync, and the copies are not mirrored again.
+func (c *DevsporeClient) Resync(ctx context.Context, source, target string,
+	options *resync.Options) (resync.Progress, error) {
+	sourceClient := c.strategy.ServerClient(source)
+	targetClient := c.strategy.ServerClient(target)
+	if sourceClient == nil || targetClient == nil {
+		return resync.Progress{}, fmt.Errorf("resync from server '%s' to '%s', server has no client", source, target)
+	}
+	resyncer := resync.NewResyncer(resync.Server{Name: source, Client: sourceClient},
+		resync.Server{Name: target, Client: targetClient}, options)
+	return resyncer.Run(strategy.MirrorContext(ctx))
+}
+
+// Verify compares the keys of the target server with the source server, such as the standby server with the
+// active one before switching active, and repairs the divergent keys if options.Repair is set.
+func (c *DevsporeClient) Verify(ctx context.Context, source, target string,
+	options *resync.VerifyOptions) (*resync.Report, error) {
+	sourceClient := c.strategy.ServerClient(source)
+	targetClient := c.strategy.ServerClient(target)
+	if sourceClient == nil || targetClient == nil {
+		return nil, fmt.Errorf("verify server '%s' against '%s', server has no client", target, source)
+	}
+	verifier := resync.NewVerifier(resync.Server{Name: source, Client: sourceClient},
+		resync.Server{Name: target, Client: targetClient}, options)
+	return verifier.Run(strategy.MirrorContext(ctx))
+}
+
+// NearCacheStats returns the hits, misses and invalidations of the near cache, zero if near cache is not enabled.
+func (c *DevsporeClient) NearCacheStats() nearcache.Stats {
+	if c.nearCache == nil {
+		return nearcache.Stats{}
+	}
+	return c.nearCache.Stats()
+}
+
+// HotKeys returns the top-N keys of every server in the sliding window, empty if hot key detection is not enabled.
+// The reads served by the near cache are not counted.
+func (c *DevsporeClient) HotKeys() map[string][]hotkey.KeyCount {
+	if c.detector == nil {
+		return map[string][]hotkey.KeyCount{}
+	}
+	return c.detector.TopN()
+}
+
+// CoalescedReads returns the reads which shared the reply of another read of every server, empty if read
+// coalescing is not enabled.
+func (c *DevsporeClient) CoalescedReads() map[string]uint64 {
+	if c.coalescer == nil {
+		return map[string]uint64{}
+	}
+	return c.coalescer.Coalesced()
+}
+
+// nearCacheOf returns the near cache of the reads of the context, nil if near cache is not enabled or the reads are
+// routed by the hints of the context.
+func (c *DevsporeClient) nearCacheOf(ctx context.Context) *nearcache.NearCache {
+	if c.nearCache == nil || strategy.RouteHintFrom(ctx) != (strategy.RouteHint{}) {
+		return nil
+	}
+	return c.nearCache
+}
+
+func (c *DevsporeClient) isRead(args []interface{}) bool {
+	return c.strategy.CommandType(args...) == strategy.CommandTypeRead
+}
+
+// RegisterReadOnlyScript declare the script of the SHA does not write, EVAL and EVALSHA of it are routed as reads
+// and never mirrored by double-write.
+func (c *DevsporeClient) RegisterReadOnlyScript(sha string) {
+	c.strategy.Scripts().RegisterReadOnly(sha)
+}
+
 // Close closes all clients in clientPool
 func (c *DevsporeClient) Close() error {
+	if c.healthChecker != nil {
+		_ = c.healthChecker.Close()
+	}
+	if c.nearCache != nil {
+		c.nearCache.Close()
+	}
+	if c.publisher != nil {
+		c.publisher.Close()
+	}
 	return c.strategy.Close()
 }
 
@@ -113,6 +260,12 @@ func validateConfiguration(configuration *config.Configuration) error {
 	if configuration.RouteAlgorithm == "" {
 		return errors.New("router config cannot be null")
 	}
+	switch configuration.RouteAlgorithm {
+	case strategy.SingleReadWriteMode, strategy.LocalReadSingleWriteMode, strategy.SingleReadDoubleWriteMode,
+		strategy.LocalReadDoubleWriteMode:
+	default:
+		return fmt.Errorf("routeAlgorithm: %s is not supported", configuration.RouteAlgorithm)
+	}
 	if configuration.EtcdConfig != nil {
 		if configuration.Props == nil {
 			return errors.New("props is required")
@@ -127,8 +280,22 @@ func validateConfiguration(configuration *config.Configuration) error {
 	if configuration.RedisConfig.Servers == nil || len(configuration.RedisConfig.Servers) == 0 {
 		return errors.New("servers is required")
 	}
-	if configuration.RouteAlgorithm == strategy.LocalReadDoubleWriteMode && configuration.RedisConfig.Nearest == "" {
-		return fmt.Errorf("routeAlgorithm: %s required nearest setting", strategy.LocalReadDoubleWriteMode)
+	if (configuration.RouteAlgorithm == strategy.LocalReadSingleWriteMode ||
+		configuration.RouteAlgorithm == strategy.LocalReadDoubleWriteMode) && configuration.RedisConfig.Nearest == "" {
+		return fmt.Errorf("routeAlgorithm: %s required nearest setting", configuration.RouteAlgorithm)
+	}
+	return nil
+}
+
+// validateRedigoConfiguration validate the configuration of DevsporeRedigoClient, whose pools only support lifo.
+func validateRedigoConfiguration(configuration *config.Configuration) error {
+	if err := validateConfiguration(configuration); err != nil {
+		return err
+	}
+	for serverName, serverConfig := range configuration.RedisConfig.Servers {
+		if serverConfig.ConnectionPool != nil && serverConfig.ConnectionPool.FIFO() {
+			return fmt.Errorf("server %s: lifo false is not supported by redigo pools", serverName)
+		}
 	}
 	return nil
 }
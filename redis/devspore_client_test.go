@@ -17,12 +17,21 @@ package redis
 import (
 	"context"
 	"fmt"
+	"strconv"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	goredis "github.com/go-redis/redis/v8"
 	"github.com/stretchr/testify/assert"
+	clientv3 "go.etcd.io/etcd/client/v3"
 
+	"github.com/huaweicloud/devcloud-go/common/etcd"
+	"github.com/huaweicloud/devcloud-go/mas"
 	"github.com/huaweicloud/devcloud-go/mock"
+	"github.com/huaweicloud/devcloud-go/redis/config"
+	"github.com/huaweicloud/devcloud-go/redis/redigostrategy"
 	"github.com/huaweicloud/devcloud-go/redis/strategy"
 )
 
@@ -45,7 +54,7 @@ func TestDevsporeClient_ActiveChanges(t *testing.T) {
 	ctx := context.Background()
 
 	// active server is dc1
-	client.configuration.Active = "dc1"
+	client.configuration.OnChanged("dc1")
 	var (
 		tests1Key   = "test_s1_key"
 		tests1Value = "test_value"
@@ -57,7 +66,7 @@ func TestDevsporeClient_ActiveChanges(t *testing.T) {
 	assert.Equal(t, "", s2res)
 
 	// active server is dc2
-	client.configuration.Active = "dc2"
+	client.configuration.OnChanged("dc2")
 	var (
 		tests2Key   = "test_s2_key"
 		tests2Value = "test_value"
@@ -118,3 +127,227 @@ func TestDevsporeClient_ReadWriteSeparated(t *testing.T) {
 	assert.Equal(t, testValue, s1res)
 	assert.Equal(t, testValue, s2res)
 }
+
+const (
+	reloadEtcdAddr      = "127.0.0.1:23791"
+	reloadEtcdPeerAddr  = "127.0.0.1:23801"
+	reloadServersKey    = "/mas-monitor/conf/dcs/services/reload_app/reload_monitor/servers"
+	reloadAlgorithmKey  = "/mas-monitor/conf/dcs/services/reload_app/reload_monitor/route-algorithm"
+	reloadActiveKey     = "/mas-monitor/status/dcs/services/reload_app/reload_monitor/active"
+	reloadServersFormat = `{"dc1":{"hosts":"%s","type":"normal"},"dc2":{"hosts":"%s","type":"normal"}}`
+)
+
+func startReloadEtcd(t *testing.T) *clientv3.Client {
+	metadata := mock.NewEtcdMetadata()
+	metadata.ClientAddrs = []string{reloadEtcdAddr}
+	metadata.PeerAddrs = []string{reloadEtcdPeerAddr}
+	metadata.DataDir = t.TempDir()
+	metadata.AuthEnable = false
+	etcdMock := &mock.MockEtcd{}
+	etcdMock.StartMockEtcd(metadata)
+	t.Cleanup(etcdMock.StopMockEtcd)
+	client, err := clientv3.New(clientv3.Config{Endpoints: []string{reloadEtcdAddr}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = client.Close()
+	})
+	return client
+}
+
+func reloadConfiguration(routeAlgorithm, addr1, addr2 string) *config.Configuration {
+	configuration := doubleWriteConfiguration(routeAlgorithm, addr1, addr2)
+	configuration.Active = "dc1"
+	configuration.RedisConfig.Nearest = "dc2"
+	configuration.Props = &mas.PropertiesConfiguration{AppID: "reload_app", MonitorID: "reload_monitor"}
+	configuration.EtcdConfig = &etcd.EtcdConfiguration{Address: reloadEtcdAddr}
+	return configuration
+}
+
+func putEtcd(t *testing.T, client *clientv3.Client, key, value string) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if _, err := client.Put(ctx, key, value); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDevsporeClient_TopologyReload(t *testing.T) {
+	etcdClient := startReloadEtcd(t)
+	redisMock1, redisMock2 := startDoubleWriteMocks(t)
+	redisMock3 := &mock.RedisMock{}
+	if err := redisMock3.StartMockRedis(); err != nil {
+		t.Fatal(err)
+	}
+	defer redisMock3.StopMockRedis()
+	putEtcd(t, etcdClient, reloadServersKey, fmt.Sprintf(reloadServersFormat, redisMock1.Addr, redisMock2.Addr))
+	putEtcd(t, etcdClient, reloadAlgorithmKey, strategy.SingleReadWriteMode)
+
+	client := NewDevsporeClient(reloadConfiguration(strategy.SingleReadWriteMode, redisMock1.Addr, redisMock2.Addr))
+	defer client.Close()
+	ctx := context.Background()
+	assert.Nil(t, client.Set(ctx, "key", "value1", 0).Err())
+	res, _ := redisMock1.GetMockRedis().Get("key")
+	assert.Equal(t, "value1", res)
+
+	// hosts of the active server changed, the client of dc1 is rebuilt
+	putEtcd(t, etcdClient, reloadServersKey, fmt.Sprintf(reloadServersFormat, redisMock3.Addr, redisMock2.Addr))
+	assert.Eventually(t, func() bool {
+		_ = client.Set(ctx, "key", "value3", 0)
+		res, _ := redisMock3.GetMockRedis().Get("key")
+		return res == "value3"
+	}, 5*time.Second, 50*time.Millisecond)
+
+	// route algorithm changed, reads go to the nearest server dc2
+	_ = redisMock2.GetMockRedis().Set("read_key", "nearest")
+	_ = redisMock3.GetMockRedis().Set("read_key", "active")
+	assert.Equal(t, "active", client.Get(ctx, "read_key").Val())
+	putEtcd(t, etcdClient, reloadAlgorithmKey, strategy.LocalReadSingleWriteMode)
+	assert.Eventually(t, func() bool {
+		return client.Get(ctx, "read_key").Val() == "nearest"
+	}, 5*time.Second, 50*time.Millisecond)
+	assert.Nil(t, client.Set(ctx, "write_key", "value", 0).Err())
+	res, _ = redisMock3.GetMockRedis().Get("write_key")
+	assert.Equal(t, "value", res)
+}
+
+func TestDevsporeRedigoClient_TopologyReload(t *testing.T) {
+	etcdClient := startReloadEtcd(t)
+	redisMock1, redisMock2 := startDoubleWriteMocks(t)
+	redisMock3 := &mock.RedisMock{}
+	if err := redisMock3.StartMockRedis(); err != nil {
+		t.Fatal(err)
+	}
+	defer redisMock3.StopMockRedis()
+	putEtcd(t, etcdClient, reloadServersKey, fmt.Sprintf(reloadServersFormat, redisMock1.Addr, redisMock2.Addr))
+	putEtcd(t, etcdClient, reloadAlgorithmKey, strategy.SingleReadWriteMode)
+
+	client := NewDevsporeRedigoClient(reloadConfiguration(strategy.SingleReadWriteMode, redisMock1.Addr, redisMock2.Addr))
+	defer client.strategy.Close()
+	_, err := client.Do("SET", "key", "value1")
+	assert.Nil(t, err)
+	res, _ := redisMock1.GetMockRedis().Get("key")
+	assert.Equal(t, "value1", res)
+
+	putEtcd(t, etcdClient, reloadServersKey, fmt.Sprintf(reloadServersFormat, redisMock3.Addr, redisMock2.Addr))
+	assert.Eventually(t, func() bool {
+		_, _ = client.Do("SET", "key", "value3")
+		res, _ := redisMock3.GetMockRedis().Get("key")
+		return res == "value3"
+	}, 5*time.Second, 50*time.Millisecond)
+
+	_ = redisMock2.GetMockRedis().Set("read_key", "nearest")
+	putEtcd(t, etcdClient, reloadAlgorithmKey, strategy.LocalReadSingleWriteMode)
+	assert.Eventually(t, func() bool {
+		reply, _ := client.Do("GET", "read_key")
+		value, _ := reply.([]byte)
+		return string(value) == "nearest"
+	}, 5*time.Second, 50*time.Millisecond)
+}
+
+const (
+	switchGoroutines = 2000
+	switchTimes      = 20
+)
+
+// runWhileSwitching flips the active key in etcd while thousands of goroutines issue commands, run it with -race.
+func runWhileSwitching(t *testing.T, etcdClient *clientv3.Client, do func(i int) error) {
+	var (
+		wg       sync.WaitGroup
+		failures int64
+		stop     = make(chan struct{})
+	)
+	for i := 0; i < switchGoroutines; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				if err := do(i); err != nil {
+					atomic.AddInt64(&failures, 1)
+				}
+			}
+		}(i)
+	}
+	for i := 0; i < switchTimes; i++ {
+		putEtcd(t, etcdClient, reloadActiveKey, "dc"+strconv.Itoa(i%2+1))
+		time.Sleep(20 * time.Millisecond)
+	}
+	close(stop)
+	wg.Wait()
+	assert.Equal(t, int64(0), failures)
+	putEtcd(t, etcdClient, reloadActiveKey, "dc2")
+}
+
+func switchConfiguration(addr1, addr2 string, maxTotal int) *config.Configuration {
+	configuration := reloadConfiguration(strategy.SingleReadWriteMode, addr1, addr2)
+	for _, serverConfig := range configuration.RedisConfig.Servers {
+		serverConfig.ConnectionPool = &config.ServerConnectionPoolConfiguration{MaxTotal: maxTotal, MaxIdle: 200}
+	}
+	return configuration
+}
+
+func TestDevsporeClient_ActiveSwitchRace(t *testing.T) {
+	etcdClient := startReloadEtcd(t)
+	redisMock1, redisMock2 := startDoubleWriteMocks(t)
+	putEtcd(t, etcdClient, reloadActiveKey, "dc1")
+	client := NewDevsporeClient(switchConfiguration(redisMock1.Addr, redisMock2.Addr, 200))
+	defer client.Close()
+	ctx := context.Background()
+
+	runWhileSwitching(t, etcdClient, func(i int) error {
+		key := "key" + strconv.Itoa(i)
+		if err := client.Set(ctx, key, i, 0).Err(); err != nil {
+			return err
+		}
+		// the key may be written to the other server before a switch
+		if err := client.Get(ctx, key).Err(); err != goredis.Nil {
+			return err
+		}
+		return nil
+	})
+	assert.Eventually(t, func() bool {
+		_ = client.Set(ctx, "final_key", "dc2", 0)
+		res, _ := redisMock2.GetMockRedis().Get("final_key")
+		return res == "dc2"
+	}, 5*time.Second, 50*time.Millisecond)
+}
+
+func TestDevsporeRedigoClient_ActiveSwitchRace(t *testing.T) {
+	etcdClient := startReloadEtcd(t)
+	redisMock1, redisMock2 := startDoubleWriteMocks(t)
+	putEtcd(t, etcdClient, reloadActiveKey, "dc1")
+	client := NewDevsporeRedigoClient(switchConfiguration(redisMock1.Addr, redisMock2.Addr, 0))
+	defer client.strategy.Close()
+
+	runWhileSwitching(t, etcdClient, func(i int) error {
+		key := "key" + strconv.Itoa(i)
+		if _, err := client.Do("SET", key, i); err != nil {
+			return err
+		}
+		_, err := client.Do("GET", key)
+		return err
+	})
+	assert.Eventually(t, func() bool {
+		_, _ = client.Do("SET", "final_key", "dc2")
+		res, _ := redisMock2.GetMockRedis().Get("final_key")
+		return res == "dc2"
+	}, 5*time.Second, 50*time.Millisecond)
+}
+
+func TestValidateConfiguration_UnknownRouteAlgorithm(t *testing.T) {
+	configuration := doubleWriteConfiguration("unknown-mode", "127.0.0.1:0", "127.0.0.1:0")
+	assert.EqualError(t, validateConfiguration(configuration), "routeAlgorithm: unknown-mode is not supported")
+	configuration.RouteAlgorithm = strategy.SingleReadWriteMode
+	assert.Nil(t, validateConfiguration(configuration))
+
+	// the strategies of an unknown route algorithm are nil interfaces, not typed nil pointers
+	configuration = doubleWriteConfiguration("unknown-mode", "127.0.0.1:0", "127.0.0.1:0")
+	assert.True(t, strategy.NewReloadableStrategy(configuration) == nil)
+	assert.True(t, redigostrategy.NewReloadableStrategy(configuration) == nil)
+}
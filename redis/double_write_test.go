@@ -0,0 +1,939 @@
+/*
+ * Copyright (c) Huawei Technologies Co., Ltd. 2021.
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use
+ * this file except in compliance with the License.  You may obtain a copy of the
+ * License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package redis
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	goredis "github.com/go-redis/redis/v8"
+	redigo "github.com/gomodule/redigo/redis"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/huaweicloud/devcloud-go/mock"
+	"github.com/huaweicloud/devcloud-go/redis/config"
+	"github.com/huaweicloud/devcloud-go/redis/file"
+	"github.com/huaweicloud/devcloud-go/redis/redigostrategy"
+	"github.com/huaweicloud/devcloud-go/redis/strategy"
+)
+
+func startDoubleWriteMocks(t *testing.T) (*mock.RedisMock, *mock.RedisMock) {
+	redisMock1 := &mock.RedisMock{}
+	redisMock2 := &mock.RedisMock{}
+	if err := redisMock1.StartMockRedis(); err != nil {
+		t.Fatal(err)
+	}
+	if err := redisMock2.StartMockRedis(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		redisMock1.StopMockRedis()
+		redisMock2.StopMockRedis()
+	})
+	return redisMock1, redisMock2
+}
+
+func doubleWriteConfiguration(routeAlgorithm string, addr1, addr2 string) *config.Configuration {
+	return &config.Configuration{
+		RouteAlgorithm: routeAlgorithm,
+		Active:         "dc2",
+		RedisConfig: &config.RedisConfiguration{
+			Nearest:          "dc1",
+			AsyncRemoteWrite: &config.AsyncRemoteWrite{RetryTimes: 3},
+			AsyncRemotePoolConfiguration: &config.AsyncRemotePoolConfiguration{
+				TaskQueueSize: 100,
+			},
+			Servers: map[string]*config.ServerConfiguration{
+				"dc1": {Hosts: addr1, Type: config.ServerTypeNormal, ConnectionPool: &config.ServerConnectionPoolConfiguration{
+					MaxTotal: 10, MaxIdle: 2}},
+				"dc2": {Hosts: addr2, Type: config.ServerTypeNormal, ConnectionPool: &config.ServerConnectionPoolConfiguration{
+					MaxTotal: 10, MaxIdle: 2}},
+			},
+		},
+	}
+}
+
+func assertEventuallyValue(t *testing.T, redisMock *mock.RedisMock, key, value string) {
+	assert.Eventually(t, func() bool {
+		res, _ := redisMock.GetMockRedis().Get(key)
+		return res == value
+	}, 5*time.Second, 10*time.Millisecond, "key %s is not mirrored to %s", key, redisMock.Addr)
+}
+
+func TestDevsporeClient_LocalReadDoubleWrite(t *testing.T) {
+	local, remote := startDoubleWriteMocks(t)
+	client := NewDevsporeClient(doubleWriteConfiguration(strategy.LocalReadDoubleWriteMode, local.Addr, remote.Addr))
+	defer client.Close()
+	ctx := context.Background()
+
+	// read from nearest server
+	_ = local.GetMockRedis().Set("read_key", "local")
+	_ = remote.GetMockRedis().Set("read_key", "remote")
+	assert.Equal(t, "local", client.Get(ctx, "read_key").Val())
+
+	// single command
+	assert.Nil(t, client.Set(ctx, "single_key", "single_value", 0).Err())
+	assert.Nil(t, client.Incr(ctx, "counter").Err())
+	assertEventuallyValue(t, remote, "single_key", "single_value")
+	assertEventuallyValue(t, remote, "counter", "1")
+
+	// pipeline
+	_, err := client.Pipelined(ctx, func(pipe goredis.Pipeliner) error {
+		pipe.Set(ctx, "pipeline_key", "pipeline_value", 0)
+		pipe.Get(ctx, "pipeline_key")
+		return nil
+	})
+	assert.Nil(t, err)
+	assertEventuallyValue(t, remote, "pipeline_key", "pipeline_value")
+
+	// tx pipeline
+	_, err = client.TxPipelined(ctx, func(pipe goredis.Pipeliner) error {
+		pipe.Set(ctx, "tx_key", "tx_value", 0)
+		return nil
+	})
+	assert.Nil(t, err)
+	assertEventuallyValue(t, remote, "tx_key", "tx_value")
+
+	// watch
+	err = client.Watch(ctx, func(tx *goredis.Tx) error {
+		value, err := tx.Get(ctx, "tx_key").Result()
+		if err != nil {
+			return err
+		}
+		_, err = tx.TxPipelined(ctx, func(pipe goredis.Pipeliner) error {
+			pipe.Set(ctx, "watch_key", value+"_watched", 0)
+			return nil
+		})
+		return err
+	}, "tx_key")
+	assert.Nil(t, err)
+	assertEventuallyValue(t, remote, "watch_key", "tx_value_watched")
+
+	// mirrored commands are executed only once on remote server
+	time.Sleep(100 * time.Millisecond)
+	counter, _ := remote.GetMockRedis().Get("counter")
+	assert.Equal(t, "1", counter)
+}
+
+func TestDevsporeClient_SingleReadDoubleWrite(t *testing.T) {
+	standby, active := startDoubleWriteMocks(t)
+	client := NewDevsporeClient(doubleWriteConfiguration(strategy.SingleReadDoubleWriteMode, standby.Addr, active.Addr))
+	defer client.Close()
+	ctx := context.Background()
+
+	// read from active server
+	_ = standby.GetMockRedis().Set("read_key", "standby")
+	_ = active.GetMockRedis().Set("read_key", "active")
+	assert.Equal(t, "active", client.Get(ctx, "read_key").Val())
+
+	assert.Nil(t, client.Set(ctx, "single_key", "single_value", 0).Err())
+	activeRes, _ := active.GetMockRedis().Get("single_key")
+	assert.Equal(t, "single_value", activeRes)
+	assertEventuallyValue(t, standby, "single_key", "single_value")
+
+	_, err := client.Pipelined(ctx, func(pipe goredis.Pipeliner) error {
+		pipe.Set(ctx, "pipeline_key", "pipeline_value", 0)
+		return nil
+	})
+	assert.Nil(t, err)
+	assertEventuallyValue(t, standby, "pipeline_key", "pipeline_value")
+
+	_, err = client.TxPipelined(ctx, func(pipe goredis.Pipeliner) error {
+		pipe.Set(ctx, "tx_key", "tx_value", 0)
+		return nil
+	})
+	assert.Nil(t, err)
+	assertEventuallyValue(t, standby, "tx_key", "tx_value")
+
+	err = client.Watch(ctx, func(tx *goredis.Tx) error {
+		_, err := tx.TxPipelined(ctx, func(pipe goredis.Pipeliner) error {
+			pipe.Set(ctx, "watch_key", "watch_value", 0)
+			return nil
+		})
+		return err
+	}, "watch_key")
+	assert.Nil(t, err)
+	assertEventuallyValue(t, standby, "watch_key", "watch_value")
+}
+
+func TestDevsporeClient_ClusterWatchDoubleWrite(t *testing.T) {
+	for _, routeAlgorithm := range []string{strategy.LocalReadDoubleWriteMode, strategy.SingleReadDoubleWriteMode} {
+		t.Run(routeAlgorithm, func(t *testing.T) {
+			local, remote := startDoubleWriteMocks(t)
+			configuration := doubleWriteConfiguration(routeAlgorithm, local.Addr, remote.Addr)
+			// the source server is a cluster, the mirror target is dc1 for single-read-write and dc2 for local-read
+			source, target := "dc1", remote
+			if routeAlgorithm == strategy.SingleReadDoubleWriteMode {
+				source, target = "dc2", local
+			}
+			configuration.RedisConfig.Servers[source].Type = config.ServerTypeCluster
+			client := NewDevsporeClient(configuration)
+			defer client.Close()
+			ctx := context.Background()
+
+			err := client.Watch(ctx, func(tx *goredis.Tx) error {
+				_, err := tx.TxPipelined(ctx, func(pipe goredis.Pipeliner) error {
+					pipe.Set(ctx, "cluster_watch_key", "cluster_watch_value", 0)
+					return nil
+				})
+				return err
+			}, "cluster_watch_key")
+			assert.Nil(t, err)
+			assertEventuallyValue(t, target, "cluster_watch_key", "cluster_watch_value")
+		})
+	}
+}
+
+func TestDevsporeClient_PersistDoubleWrite(t *testing.T) {
+	local, remote := startDoubleWriteMocks(t)
+	configuration := doubleWriteConfiguration(strategy.LocalReadDoubleWriteMode, local.Addr, remote.Addr)
+	persistDir := t.TempDir()
+	poolConfig := configuration.RedisConfig.AsyncRemotePoolConfiguration
+	poolConfig.Persist = true
+	poolConfig.PersistDir = persistDir
+	poolConfig.FsyncPolicy = "always"
+	poolConfig.ReplayIntervalMillis = 50
+	client := NewDevsporeClient(configuration)
+	ctx := context.Background()
+
+	assert.Nil(t, client.Set(ctx, "single_key", "single_value", 0).Err())
+	assertEventuallyValue(t, remote, "single_key", "single_value")
+
+	// the remote server is down, writes are kept in the wal and replayed after the restart of the client
+	remote.StopMockRedis()
+	assert.Nil(t, client.Set(ctx, "offline_key", "offline_value", 0).Err())
+	time.Sleep(200 * time.Millisecond)
+	assert.Nil(t, client.Close())
+	if err := remote.StartMockRedis(); err != nil {
+		t.Fatal(err)
+	}
+	configuration = doubleWriteConfiguration(strategy.LocalReadDoubleWriteMode, local.Addr, remote.Addr)
+	configuration.RedisConfig.AsyncRemotePoolConfiguration = poolConfig
+	client = NewDevsporeClient(configuration)
+	defer client.Close()
+	assertEventuallyValue(t, remote, "offline_key", "offline_value")
+}
+
+func TestDevsporeClient_LegacyFilesReplay(t *testing.T) {
+	local, remote := startDoubleWriteMocks(t)
+	configuration := doubleWriteConfiguration(strategy.LocalReadDoubleWriteMode, local.Addr, remote.Addr)
+	poolConfig := configuration.RedisConfig.AsyncRemotePoolConfiguration
+	poolConfig.PersistDir = t.TempDir()
+	poolConfig.ReplayIntervalMillis = 50
+	// the file left by an old version is replayed before the new writes of memory double-write
+	legacyFile := filepath.Join(poolConfig.PersistDir, "dc2-1700000000000-0.dat")
+	if err := os.WriteFile(legacyFile, []byte("{\"Args\":[\"set\",\"legacy_key\",\"old\"]}\r\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	client := NewDevsporeClient(configuration)
+	defer client.Close()
+	assert.Nil(t, client.Set(context.Background(), "legacy_key", "new", 0).Err())
+	assertEventuallyValue(t, remote, "legacy_key", "new")
+	assert.Eventually(t, func() bool {
+		return client.ReplayLag()["dc2"].PendingSegments == 0
+	}, 5*time.Second, 10*time.Millisecond)
+	res, _ := remote.GetMockRedis().Get("legacy_key")
+	assert.Equal(t, "new", res)
+	_, err := os.Stat(legacyFile)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestDevsporeClient_IdempotentDoubleWrite(t *testing.T) {
+	local, remote := startDoubleWriteMocks(t)
+	configuration := doubleWriteConfiguration(strategy.LocalReadDoubleWriteMode, local.Addr, remote.Addr)
+	configuration.RedisConfig.AsyncRemoteWrite.IdempotentRewrite = true
+	client := NewDevsporeClient(configuration)
+	defer client.Close()
+	ctx := context.Background()
+
+	// the remote server has a different value, the mirrored commands overwrite it with the local results
+	_ = remote.GetMockRedis().Set("counter", "10")
+	assert.Nil(t, client.Incr(ctx, "counter").Err())
+	assert.Nil(t, client.IncrBy(ctx, "counter", 2).Err())
+	assertEventuallyValue(t, remote, "counter", "3")
+	assert.Nil(t, client.Append(ctx, "append_key", "hello").Err())
+	assert.Nil(t, client.Append(ctx, "append_key", " world").Err())
+	assertEventuallyValue(t, remote, "append_key", "hello world")
+	assert.Nil(t, client.HIncrBy(ctx, "hash_key", "field", 5).Err())
+	assert.Eventually(t, func() bool {
+		return remote.GetMockRedis().HGet("hash_key", "field") == "5"
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestDevsporeClient_ServerIdempotentRewrite(t *testing.T) {
+	local, remote := startDoubleWriteMocks(t)
+	configuration := doubleWriteConfiguration(strategy.LocalReadDoubleWriteMode, local.Addr, remote.Addr)
+	// the rewrite is enabled for dc2 only
+	configuration.RedisConfig.Servers["dc2"].AsyncRemoteWrite = &config.AsyncRemoteWrite{RetryTimes: 3,
+		IdempotentRewrite: true}
+	client := NewDevsporeClient(configuration)
+	defer client.Close()
+	ctx := context.Background()
+
+	_ = remote.GetMockRedis().Set("counter", "10")
+	assert.Nil(t, client.Incr(ctx, "counter").Err())
+	assertEventuallyValue(t, remote, "counter", "1")
+	_ = remote.GetMockRedis().Set("pipeline_counter", "10")
+	_, err := client.Pipelined(ctx, func(pipe goredis.Pipeliner) error {
+		pipe.IncrBy(ctx, "pipeline_counter", 2)
+		return nil
+	})
+	assert.Nil(t, err)
+	assertEventuallyValue(t, remote, "pipeline_counter", "2")
+
+	redigoClient := NewDevsporeRedigoClient(configuration)
+	defer redigoClient.strategy.Close()
+	_ = remote.GetMockRedis().Set("redigo_counter", "10")
+	_, err = redigoClient.Do("INCR", "redigo_counter")
+	assert.Nil(t, err)
+	assertEventuallyValue(t, remote, "redigo_counter", "1")
+	_ = remote.GetMockRedis().Set("redigo_pipeline_counter", "10")
+	_, err = redigoClient.Pipeline([][]string{{"INCRBY", "redigo_pipeline_counter", "2"}})
+	assert.Nil(t, err)
+	assertEventuallyValue(t, remote, "redigo_pipeline_counter", "2")
+}
+
+func TestDevsporeClient_PersistReplayLag(t *testing.T) {
+	local, remote := startDoubleWriteMocks(t)
+	configuration := doubleWriteConfiguration(strategy.LocalReadDoubleWriteMode, local.Addr, remote.Addr)
+	poolConfig := configuration.RedisConfig.AsyncRemotePoolConfiguration
+	poolConfig.Persist = true
+	poolConfig.PersistDir = t.TempDir()
+	poolConfig.ReplayIntervalMillis = 50
+	client := NewDevsporeClient(configuration)
+	defer client.Close()
+	ctx := context.Background()
+
+	remote.StopMockRedis()
+	assert.Nil(t, client.Set(ctx, "key", "value", 0).Err())
+	time.Sleep(200 * time.Millisecond)
+	lag := client.ReplayLag()["dc2"]
+	assert.Equal(t, 1, lag.PendingSegments)
+	assert.False(t, lag.OldestTimestamp.IsZero())
+	memoryClient := NewDevsporeClient(doubleWriteConfiguration(strategy.LocalReadDoubleWriteMode, local.Addr, remote.Addr))
+	assert.Equal(t, 0, len(memoryClient.ReplayLag()))
+	_ = memoryClient.Close()
+
+	if err := remote.StartMockRedis(); err != nil {
+		t.Fatal(err)
+	}
+	assertEventuallyValue(t, remote, "key", "value")
+	assert.Eventually(t, func() bool {
+		return client.ReplayLag()["dc2"].PendingSegments == 0
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestDevsporeRedigoClient_LocalReadDoubleWrite(t *testing.T) {
+	local, remote := startDoubleWriteMocks(t)
+	client := NewDevsporeRedigoClient(doubleWriteConfiguration(strategy.LocalReadDoubleWriteMode, local.Addr, remote.Addr))
+	defer client.strategy.Close()
+
+	_ = remote.GetMockRedis().Set("read_key", "remote")
+	_ = local.GetMockRedis().Set("read_key", "local")
+	reply, err := client.Do("GET", "read_key")
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("local"), reply)
+
+	_, err = client.Do("SET", "single_key", "single_value")
+	assert.Nil(t, err)
+	assertEventuallyValue(t, remote, "single_key", "single_value")
+
+	_, err = client.Pipeline([][]string{{"SET", "pipeline_key", "pipeline_value"}, {"GET", "pipeline_key"}})
+	assert.Nil(t, err)
+	assertEventuallyValue(t, remote, "pipeline_key", "pipeline_value")
+
+	_, err = client.Transactions([]*redigostrategy.RedigoCommandArgs{
+		{CommandName: "SET", Args: []interface{}{"tx_key", "tx_value"}},
+	})
+	assert.Nil(t, err)
+	assertEventuallyValue(t, remote, "tx_key", "tx_value")
+}
+
+func TestDevsporeRedigoClient_SingleReadDoubleWrite(t *testing.T) {
+	standby, active := startDoubleWriteMocks(t)
+	client := NewDevsporeRedigoClient(doubleWriteConfiguration(strategy.SingleReadDoubleWriteMode, standby.Addr, active.Addr))
+	defer client.strategy.Close()
+
+	_, err := client.Do("SET", "single_key", "single_value")
+	assert.Nil(t, err)
+	activeRes, _ := active.GetMockRedis().Get("single_key")
+	assert.Equal(t, "single_value", activeRes)
+	assertEventuallyValue(t, standby, "single_key", "single_value")
+
+	_, err = client.Pipeline([][]string{{"SET", "pipeline_key", "pipeline_value"}})
+	assert.Nil(t, err)
+	assertEventuallyValue(t, standby, "pipeline_key", "pipeline_value")
+
+	_, err = client.Transactions([]*redigostrategy.RedigoCommandArgs{
+		{CommandName: "SET", Args: []interface{}{"tx_key", "tx_value"}},
+	})
+	assert.Nil(t, err)
+	assertEventuallyValue(t, standby, "tx_key", "tx_value")
+}
+
+func TestDevsporeRedigoClient_Watch(t *testing.T) {
+	local, remote := startDoubleWriteMocks(t)
+	client := NewDevsporeRedigoClient(doubleWriteConfiguration(strategy.LocalReadSingleWriteMode, local.Addr,
+		remote.Addr))
+	defer client.strategy.Close()
+	ctx := context.Background()
+
+	// the transaction is executed on the watched connection, which is released after
+	err := client.strategy.Watch(ctx, func(conn redigo.Conn) error {
+		if err := conn.Send("MULTI"); err != nil {
+			return err
+		}
+		if err := conn.Send("SET", "watch_key", "value"); err != nil {
+			return err
+		}
+		_, err := conn.Do("EXEC")
+		return err
+	}, "watch_key")
+	assert.Nil(t, err)
+	res, _ := remote.GetMockRedis().Get("watch_key")
+	assert.Equal(t, "value", res)
+	stats := client.strategy.RouteClient(ctx, strategy.CommandTypeMulti).Stats()
+	assert.Equal(t, stats.IdleCount, stats.ActiveCount)
+
+}
+
+func TestDevsporeRedigoClient_WatchDoubleWrite(t *testing.T) {
+	local, remote := startDoubleWriteMocks(t)
+	client := NewDevsporeRedigoClient(doubleWriteConfiguration(strategy.LocalReadDoubleWriteMode, local.Addr,
+		remote.Addr))
+	defer client.strategy.Close()
+	ctx := context.Background()
+
+	// the writes of EXEC are mirrored as one transaction, the writes outside MULTI are mirrored as well
+	err := client.strategy.Watch(ctx, func(conn redigo.Conn) error {
+		if _, err := conn.Do("SET", "plain_key", "plain_value"); err != nil {
+			return err
+		}
+		if err := conn.Send("MULTI"); err != nil {
+			return err
+		}
+		if err := conn.Send("SET", "watch_key", "value"); err != nil {
+			return err
+		}
+		if err := conn.Send("INCR", "watch_counter"); err != nil {
+			return err
+		}
+		reply, err := conn.Do("EXEC")
+		assert.Len(t, reply, 2)
+		return err
+	}, "watch_key")
+	assert.Nil(t, err)
+	assertEventuallyValue(t, remote, "plain_key", "plain_value")
+	assertEventuallyValue(t, remote, "watch_key", "value")
+	assertEventuallyValue(t, remote, "watch_counter", "1")
+
+	// the transaction aborted by WATCH and the discarded one are not mirrored
+	err = client.strategy.Watch(ctx, func(conn redigo.Conn) error {
+		_ = local.GetMockRedis().Set("watch_key", "changed")
+		if _, err := conn.Do("MULTI"); err != nil {
+			return err
+		}
+		if _, err := conn.Do("SET", "watch_key", "aborted"); err != nil {
+			return err
+		}
+		reply, err := conn.Do("EXEC")
+		assert.Nil(t, reply)
+		if err != nil {
+			return err
+		}
+		if _, err = conn.Do("MULTI"); err != nil {
+			return err
+		}
+		if _, err = conn.Do("SET", "discard_key", "value"); err != nil {
+			return err
+		}
+		_, err = conn.Do("DISCARD")
+		return err
+	}, "watch_key")
+	assert.Nil(t, err)
+	_, err = client.Do("SET", "last_key", "value")
+	assert.Nil(t, err)
+	assertEventuallyValue(t, remote, "last_key", "value")
+	res, _ := remote.GetMockRedis().Get("watch_key")
+	assert.Equal(t, "value", res)
+	assert.False(t, remote.GetMockRedis().Exists("discard_key"))
+}
+
+func TestDevsporeRedigoClient_PipelineMirrorPartial(t *testing.T) {
+	local, remote := startDoubleWriteMocks(t)
+	configuration := doubleWriteConfiguration(strategy.LocalReadDoubleWriteMode, local.Addr, remote.Addr)
+	configuration.RedisConfig.AsyncRemoteWrite.IdempotentRewrite = true
+	client := NewDevsporeRedigoClient(configuration)
+	defer client.strategy.Close()
+
+	// the failed command is not mirrored, the succeeded ones are mirrored in idempotent form
+	_ = remote.GetMockRedis().Set("counter", "10")
+	_ = local.GetMockRedis().Set("string_key", "value")
+	reply, err := client.Pipeline([][]string{{"INCR", "counter"}, {"HSET", "string_key", "field", "value"},
+		{"SET", "pipeline_key", "pipeline_value"}})
+	assert.NotNil(t, err)
+	assert.Len(t, reply, 3)
+	assertEventuallyValue(t, remote, "pipeline_key", "pipeline_value")
+	assertEventuallyValue(t, remote, "counter", "1")
+	assert.False(t, remote.GetMockRedis().Exists("string_key"))
+
+	_, err = client.Transactions([]*redigostrategy.RedigoCommandArgs{
+		{CommandName: "INCRBY", Args: []interface{}{"counter", 2}},
+	})
+	assert.Nil(t, err)
+	assertEventuallyValue(t, remote, "counter", "3")
+}
+
+func TestDevsporeRedigoClient_PersistDoubleWrite(t *testing.T) {
+	local, remote := startDoubleWriteMocks(t)
+	configuration := doubleWriteConfiguration(strategy.LocalReadDoubleWriteMode, local.Addr, remote.Addr)
+	poolConfig := configuration.RedisConfig.AsyncRemotePoolConfiguration
+	poolConfig.Persist = true
+	poolConfig.PersistDir = t.TempDir()
+	poolConfig.FsyncPolicy = "always"
+	poolConfig.ReplayIntervalMillis = 50
+	client := NewDevsporeRedigoClient(configuration)
+
+	_, err := client.Do("SET", "single_key", "single_value")
+	assert.Nil(t, err)
+	assertEventuallyValue(t, remote, "single_key", "single_value")
+	assert.Equal(t, 0, len(client.DoubleWriteStats()))
+
+	// the remote server is down, writes are kept in the wal and replayed after the restart of the client
+	remote.StopMockRedis()
+	_, err = client.Pipeline([][]string{{"SET", "offline_key", "offline_value"}})
+	assert.Nil(t, err)
+	time.Sleep(200 * time.Millisecond)
+	assert.Nil(t, client.strategy.Close())
+	if err = remote.StartMockRedis(); err != nil {
+		t.Fatal(err)
+	}
+	configuration = doubleWriteConfiguration(strategy.LocalReadDoubleWriteMode, local.Addr, remote.Addr)
+	configuration.RedisConfig.AsyncRemotePoolConfiguration = poolConfig
+	client = NewDevsporeRedigoClient(configuration)
+	defer client.strategy.Close()
+	assertEventuallyValue(t, remote, "offline_key", "offline_value")
+}
+
+func startThreeServerDoubleWrite(t *testing.T, routeAlgorithm string) (*config.Configuration, []*mock.RedisMock) {
+	redisMock1, redisMock2 := startDoubleWriteMocks(t)
+	redisMock3 := &mock.RedisMock{}
+	if err := redisMock3.StartMockRedis(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(redisMock3.StopMockRedis)
+	configuration := doubleWriteConfiguration(routeAlgorithm, redisMock1.Addr, redisMock2.Addr)
+	servers := configuration.RedisConfig.Servers
+	servers["beijing"], servers["shanghai"] = servers["dc1"], servers["dc2"]
+	delete(servers, "dc1")
+	delete(servers, "dc2")
+	servers["guangzhou-az2"] = &config.ServerConfiguration{Hosts: redisMock3.Addr, Type: config.ServerTypeNormal,
+		ConnectionPool:   &config.ServerConnectionPoolConfiguration{MaxTotal: 10, MaxIdle: 2},
+		AsyncRemoteWrite: &config.AsyncRemoteWrite{RetryTimes: 1}}
+	configuration.RedisConfig.Nearest = "beijing"
+	configuration.Active = "beijing"
+	return configuration, []*mock.RedisMock{redisMock1, redisMock2, redisMock3}
+}
+
+func TestDevsporeClient_DoubleWriteReplicas(t *testing.T) {
+	for _, routeAlgorithm := range []string{strategy.LocalReadDoubleWriteMode, strategy.SingleReadDoubleWriteMode} {
+		configuration, mocks := startThreeServerDoubleWrite(t, routeAlgorithm)
+		client := NewDevsporeClient(configuration)
+		ctx := context.Background()
+		assert.Nil(t, client.Set(ctx, "key", routeAlgorithm, 0).Err())
+		_, err := client.Pipelined(ctx, func(pipe goredis.Pipeliner) error {
+			pipe.Set(ctx, "pipeline_key", routeAlgorithm, 0)
+			return nil
+		})
+		assert.Nil(t, err)
+		for _, redisMock := range mocks {
+			assertEventuallyValue(t, redisMock, "key", routeAlgorithm)
+			assertEventuallyValue(t, redisMock, "pipeline_key", routeAlgorithm)
+		}
+
+		// a down replica does not block the others
+		mocks[2].StopMockRedis()
+		for i := 0; i < 10; i++ {
+			assert.Nil(t, client.Incr(ctx, "counter").Err())
+		}
+		assertEventuallyValue(t, mocks[1], "counter", "10")
+		assert.Nil(t, client.Close())
+	}
+}
+
+func TestDevsporeRedigoClient_DoubleWriteReplicas(t *testing.T) {
+	configuration, mocks := startThreeServerDoubleWrite(t, strategy.LocalReadDoubleWriteMode)
+	client := NewDevsporeRedigoClient(configuration)
+	defer client.strategy.Close()
+	_, err := client.Do("SET", "key", "value")
+	assert.Nil(t, err)
+	_, err = client.Pipeline([][]string{{"SET", "pipeline_key", "pipeline_value"}})
+	assert.Nil(t, err)
+	for _, redisMock := range mocks {
+		assertEventuallyValue(t, redisMock, "key", "value")
+		assertEventuallyValue(t, redisMock, "pipeline_key", "pipeline_value")
+	}
+}
+
+func TestAsyncExecutor_OverflowPolicy(t *testing.T) {
+	for _, policy := range []string{strategy.OverflowDropNewest, strategy.OverflowDropOldest, strategy.OverflowSpill} {
+		release := make(chan struct{})
+		var spilled [][]interface{}
+		executor := strategy.NewAsyncExecutor(&config.AsyncRemotePoolConfiguration{
+			ThreadCoreSize: 1,
+			TaskQueueSize:  1,
+			OverflowPolicy: policy,
+		}, func(task strategy.AsyncTask) error {
+			spilled = append(spilled, task.Commands...)
+			return nil
+		})
+		var executed []string
+		var mutex sync.Mutex
+		task := func(key string) strategy.AsyncTask {
+			return strategy.AsyncTask{
+				Run: func() {
+					<-release
+					mutex.Lock()
+					executed = append(executed, key)
+					mutex.Unlock()
+				},
+				Commands: [][]interface{}{{"set", key, "value"}},
+			}
+		}
+		// key1 is run by the worker, key2 is queued, the queue is full for key3
+		executor.Submit(task("key1"))
+		assert.Eventually(t, func() bool { return executor.Queued() == 0 }, time.Second, time.Millisecond)
+		executor.Submit(task("key2"))
+		executor.Submit(task("key3"))
+		close(release)
+		assert.Eventually(t, func() bool { return executor.Stats().Executed == 2 }, time.Second, time.Millisecond)
+
+		stats := executor.Stats()
+		mutex.Lock()
+		switch policy {
+		case strategy.OverflowDropNewest:
+			assert.Equal(t, uint64(1), stats.Dropped)
+			assert.Equal(t, []string{"key1", "key2"}, executed)
+		case strategy.OverflowDropOldest:
+			assert.Equal(t, uint64(1), stats.Dropped)
+			assert.Equal(t, []string{"key1", "key3"}, executed)
+		case strategy.OverflowSpill:
+			assert.Equal(t, uint64(1), stats.Spilled)
+			assert.Equal(t, [][]interface{}{{"set", "key3", "value"}}, spilled)
+		}
+		mutex.Unlock()
+		executor.Close()
+	}
+}
+
+func TestAsyncExecutor_SpillOrder(t *testing.T) {
+	release := make(chan struct{})
+	var mutex sync.Mutex
+	var executed []string
+	var spilled []strategy.AsyncTask
+	executor := strategy.NewAsyncExecutor(&config.AsyncRemotePoolConfiguration{
+		ThreadCoreSize: 1,
+		TaskQueueSize:  1,
+		OverflowPolicy: strategy.OverflowSpill,
+	}, func(task strategy.AsyncTask) error {
+		spilled = append(spilled, task)
+		return nil
+	})
+	defer executor.Close()
+	task := func(value string) strategy.AsyncTask {
+		return strategy.AsyncTask{
+			Run: func() {
+				<-release
+				mutex.Lock()
+				defer mutex.Unlock()
+				executed = append(executed, value)
+			},
+			Commands: [][]interface{}{{"set", "key", value}},
+		}
+	}
+	executor.Submit(task("1"))
+	assert.Eventually(t, func() bool { return executor.Queued() == 0 }, time.Second, time.Millisecond)
+	executor.Submit(task("2"))
+	executor.Submit(task("3"))
+	close(release)
+	assert.Eventually(t, func() bool { return executor.Stats().Executed == 2 }, time.Second, time.Millisecond)
+
+	// the queue has room, but the later tasks are spilled behind the spilled one
+	executor.Submit(task("4"))
+	assert.Equal(t, uint64(2), executor.Stats().Spilled)
+	replay := func() {
+		for _, task := range spilled {
+			task.Run()
+		}
+		spilled = nil
+	}
+	executor.Replay(replay, func() bool { return len(spilled) == 0 })
+	executor.Submit(task("5"))
+	assert.Eventually(t, func() bool { return executor.Stats().Executed == 3 }, time.Second, time.Millisecond)
+	mutex.Lock()
+	defer mutex.Unlock()
+	assert.Equal(t, []string{"1", "2", "3", "4", "5"}, executed)
+	assert.Equal(t, uint64(2), executor.Stats().Spilled)
+}
+
+func TestAsyncExecutor_KeyOrder(t *testing.T) {
+	executor := strategy.NewAsyncExecutor(&config.AsyncRemotePoolConfiguration{
+		ThreadCoreSize:  2,
+		MaximumPoolSize: 8,
+		TaskQueueSize:   1000,
+		KeepAliveTime:   50,
+	}, nil)
+	defer executor.Close()
+	var mutex sync.Mutex
+	values := make(map[string][]int)
+	submit := func(value int, args ...interface{}) {
+		executor.Submit(strategy.AsyncTask{
+			Run: func() {
+				mutex.Lock()
+				defer mutex.Unlock()
+				keys, _ := strategy.CommandKeys(args)
+				for _, key := range keys {
+					values[key] = append(values[key], value)
+				}
+			},
+			Commands: [][]interface{}{args},
+		})
+	}
+	// the commands of a key, including the multi-key commands touching it, run in the submitted order
+	for i := 0; i < 200; i++ {
+		key := "key" + strconv.Itoa(i%10)
+		switch i % 7 {
+		case 3:
+			submit(i, "mset", key, "value", "key"+strconv.Itoa((i+3)%10), "value")
+		case 5:
+			submit(i, "rename", key, "key"+strconv.Itoa((i+5)%10))
+		default:
+			submit(i, "set", key, "value")
+		}
+	}
+	submit(200, "flushdb")
+	assert.Eventually(t, func() bool { return executor.Stats().Executed == 201 }, 5*time.Second, time.Millisecond)
+	mutex.Lock()
+	for key, order := range values {
+		assert.IsIncreasing(t, order, "commands of %s are out of order", key)
+	}
+	mutex.Unlock()
+	assert.True(t, executor.Stats().Workers > 2)
+	// the non-core workers exit after idle for the keep alive time
+	assert.Eventually(t, func() bool { return executor.Stats().Workers == 2 }, time.Second, 10*time.Millisecond)
+}
+
+func TestCommandKeys(t *testing.T) {
+	cases := []struct {
+		args   []interface{}
+		keys   []string
+		global bool
+	}{
+		{[]interface{}{"set", "key", "value"}, []string{"key"}, false},
+		{[]interface{}{"MSET", "key1", "value1", []byte("key2"), "value2"}, []string{"key1", "key2"}, false},
+		{[]interface{}{"rename", "key1", "key2"}, []string{"key1", "key2"}, false},
+		{[]interface{}{"copy", "key1", "key2", "replace"}, []string{"key1", "key2"}, false},
+		{[]interface{}{"del", "key1", "key2", "key3"}, []string{"key1", "key2", "key3"}, false},
+		{[]interface{}{"zunionstore", "dest", 2, "key1", "key2", "weights", 1, 2}, []string{"dest", "key1", "key2"}, false},
+		{[]interface{}{"bitop", "and", "dest", "key1"}, []string{"dest", "key1"}, false},
+		{[]interface{}{"georadius", "key", 1, 2, 3, "km", "store", "dest"}, []string{"key", "dest"}, false},
+		{[]interface{}{"blpop", "key1", "key2", 0}, []string{"key1", "key2"}, false},
+		{[]interface{}{"BRPOP", "key1", 1.5}, []string{"key1"}, false},
+		{[]interface{}{"bzpopmin", "key1", "key2", "key3", 0}, []string{"key1", "key2", "key3"}, false},
+		{[]interface{}{"bzpopmax", "key1", "key2", 0}, []string{"key1", "key2"}, false},
+		{[]interface{}{"sort", "key", "by", "weight_*", "limit", 0, 10, "STORE", "dest"}, []string{"key", "dest"}, false},
+		{[]interface{}{"sort", "key", "desc"}, []string{"key"}, false},
+		{[]interface{}{"eval", "return 1", 1, "key", "arg"}, []string{"key"}, false},
+		{[]interface{}{"eval", "return 1", 0}, nil, true},
+		{[]interface{}{"flushdb"}, nil, true},
+		{[]interface{}{"flushall", "async"}, nil, true},
+	}
+	for _, c := range cases {
+		keys, global := strategy.CommandKeys(c.args)
+		assert.Equal(t, c.keys, keys, "%v", c.args)
+		assert.Equal(t, c.global, global, "%v", c.args)
+	}
+}
+
+func TestDevsporeClient_DoubleWriteSpill(t *testing.T) {
+	local, remote := startDoubleWriteMocks(t)
+	configuration := doubleWriteConfiguration(strategy.LocalReadDoubleWriteMode, local.Addr, remote.Addr)
+	poolConfig := configuration.RedisConfig.AsyncRemotePoolConfiguration
+	poolConfig.TaskQueueSize = 1
+	poolConfig.OverflowPolicy = strategy.OverflowSpill
+	poolConfig.PersistDir = t.TempDir()
+	poolConfig.ReplayIntervalMillis = 50
+	configuration.RedisConfig.AsyncRemoteWrite.RetryTimes = 1
+	client := NewDevsporeClient(configuration)
+	defer client.Close()
+	ctx := context.Background()
+
+	// the remote server is down, the overflow commands are spilled and replayed after it is back
+	remote.StopMockRedis()
+	for i := 0; i < 20; i++ {
+		assert.Nil(t, client.Set(ctx, "spill_key", strconv.Itoa(i), 0).Err())
+	}
+	assert.NotZero(t, client.DoubleWriteStats()["dc2"].Spilled)
+	if err := remote.StartMockRedis(); err != nil {
+		t.Fatal(err)
+	}
+	assert.Eventually(t, func() bool {
+		res, _ := remote.GetMockRedis().Get("spill_key")
+		return res != ""
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestDevsporeRedigoClient_DoubleWriteStats(t *testing.T) {
+	local, remote := startDoubleWriteMocks(t)
+	configuration := doubleWriteConfiguration(strategy.LocalReadDoubleWriteMode, local.Addr, remote.Addr)
+	configuration.RedisConfig.AsyncRemotePoolConfiguration.OverflowPolicy = strategy.OverflowDropNewest
+	client := NewDevsporeRedigoClient(configuration)
+	defer client.strategy.Close()
+
+	_, err := client.Do("set", "stats_key", "value")
+	assert.Nil(t, err)
+	assertEventuallyValue(t, remote, "stats_key", "value")
+	stats := client.DoubleWriteStats()
+	assert.Equal(t, uint64(1), stats["dc2"].Executed)
+	assert.Equal(t, uint64(0), stats["dc2"].Dropped)
+}
+
+func TestDevsporeClient_DoubleWriteKeyOrder(t *testing.T) {
+	local, remote := startDoubleWriteMocks(t)
+	configuration := doubleWriteConfiguration(strategy.LocalReadDoubleWriteMode, local.Addr, remote.Addr)
+	configuration.RedisConfig.AsyncRemotePoolConfiguration.ThreadCoreSize = 4
+	client := NewDevsporeClient(configuration)
+	defer client.Close()
+	redigoConfiguration := doubleWriteConfiguration(strategy.LocalReadDoubleWriteMode, local.Addr, remote.Addr)
+	redigoConfiguration.RedisConfig.AsyncRemotePoolConfiguration.ThreadCoreSize = 4
+	redigoClient := NewDevsporeRedigoClient(redigoConfiguration)
+	defer redigoClient.strategy.Close()
+	ctx := context.Background()
+
+	for i := 0; i < 20; i++ {
+		from, to := "from"+strconv.Itoa(i), "to"+strconv.Itoa(i)
+		assert.Nil(t, client.MSet(ctx, from, "old", to, "none").Err())
+		assert.Nil(t, client.Rename(ctx, from, to).Err())
+		assert.Nil(t, client.Set(ctx, from, "new", 0).Err())
+		_, err := redigoClient.Do("set", "redigo_"+from, "old")
+		assert.Nil(t, err)
+		_, err = redigoClient.Do("rename", "redigo_"+from, "redigo_"+to)
+		assert.Nil(t, err)
+		_, err = redigoClient.Do("set", "redigo_"+from, "new")
+		assert.Nil(t, err)
+	}
+	for i := 0; i < 20; i++ {
+		from, to := "from"+strconv.Itoa(i), "to"+strconv.Itoa(i)
+		assertEventuallyValue(t, remote, from, "new")
+		assertEventuallyValue(t, remote, to, "old")
+		assertEventuallyValue(t, remote, "redigo_"+from, "new")
+		assertEventuallyValue(t, remote, "redigo_"+to, "old")
+	}
+}
+
+func TestDevsporeClient_PipelineMirrorUnit(t *testing.T) {
+	local, remote := startDoubleWriteMocks(t)
+	configuration := doubleWriteConfiguration(strategy.LocalReadDoubleWriteMode, local.Addr, remote.Addr)
+	poolConfig := configuration.RedisConfig.AsyncRemotePoolConfiguration
+	poolConfig.Persist = true
+	poolConfig.PersistDir = t.TempDir()
+	poolConfig.FsyncPolicy = "always"
+	poolConfig.ReplayIntervalMillis = 60000
+	client := NewDevsporeClient(configuration)
+	ctx := context.Background()
+
+	// only the write commands are mirrored, in one item
+	_, err := client.TxPipelined(ctx, func(pipe goredis.Pipeliner) error {
+		pipe.Set(ctx, "tx_key", "tx_value", 0)
+		pipe.Get(ctx, "tx_key")
+		pipe.Incr(ctx, "tx_counter")
+		return nil
+	})
+	assert.Nil(t, err)
+	_, err = client.Pipelined(ctx, func(pipe goredis.Pipeliner) error {
+		pipe.Get(ctx, "tx_key")
+		pipe.Set(ctx, "pipeline_key", "pipeline_value", 0)
+		return nil
+	})
+	assert.Nil(t, err)
+	// nothing is mirrored for a pipeline without write
+	_, err = client.Pipelined(ctx, func(pipe goredis.Pipeliner) error {
+		pipe.Get(ctx, "tx_key")
+		return nil
+	})
+	assert.Nil(t, err)
+	assert.Nil(t, client.Close())
+
+	segments, err := filepath.Glob(filepath.Join(poolConfig.PersistDir, "dc2", "*"+file.SegmentSuffix))
+	assert.Nil(t, err)
+	var items []file.Item
+	for _, segment := range segments {
+		_, err = file.ReadSegment(segment, func(item file.Item) error {
+			item.Timestamp = 0
+			items = append(items, item)
+			return nil
+		})
+		assert.Nil(t, err)
+	}
+	assert.Equal(t, []file.Item{
+		{Pipeline: [][]interface{}{{"set", "tx_key", "tx_value"}, {"incr", "tx_counter"}}, Transaction: true},
+		{Pipeline: [][]interface{}{{"set", "pipeline_key", "pipeline_value"}}},
+	}, items)
+
+	// the items are replayed on the remote server
+	configuration = doubleWriteConfiguration(strategy.LocalReadDoubleWriteMode, local.Addr, remote.Addr)
+	replayPoolConfig := *poolConfig
+	replayPoolConfig.ReplayIntervalMillis = 50
+	configuration.RedisConfig.AsyncRemotePoolConfiguration = &replayPoolConfig
+	client = NewDevsporeClient(configuration)
+	defer client.Close()
+	assertEventuallyValue(t, remote, "tx_key", "tx_value")
+	assertEventuallyValue(t, remote, "tx_counter", "1")
+	assertEventuallyValue(t, remote, "pipeline_key", "pipeline_value")
+}
+
+func TestDevsporeClient_TxPipelineMirror(t *testing.T) {
+	local, remote := startDoubleWriteMocks(t)
+	client := NewDevsporeClient(doubleWriteConfiguration(strategy.LocalReadDoubleWriteMode, local.Addr, remote.Addr))
+	defer client.Close()
+	ctx := context.Background()
+
+	// a transaction failed by WATCH is not mirrored
+	_ = local.GetMockRedis().Set("watched", "1")
+	err := client.Watch(ctx, func(tx *goredis.Tx) error {
+		_ = local.GetMockRedis().Set("watched", "2")
+		_, err := tx.TxPipelined(ctx, func(pipe goredis.Pipeliner) error {
+			pipe.Set(ctx, "failed_tx_key", "value", 0)
+			return nil
+		})
+		return err
+	}, "watched")
+	assert.Equal(t, goredis.TxFailedErr, err)
+
+	_, err = client.TxPipelined(ctx, func(pipe goredis.Pipeliner) error {
+		pipe.Set(ctx, "tx_key", "tx_value", 0)
+		pipe.Incr(ctx, "tx_counter")
+		return nil
+	})
+	assert.Nil(t, err)
+	assertEventuallyValue(t, remote, "tx_key", "tx_value")
+	assertEventuallyValue(t, remote, "tx_counter", "1")
+	assert.False(t, remote.GetMockRedis().Exists("failed_tx_key"))
+}
@@ -0,0 +1,99 @@
+/*
+ * Copyright (c) Huawei Technologies Co., Ltd. 2021.
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use
+ * this file except in compliance with the License.  You may obtain a copy of the
+ * License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations under the License.
+ *
+ */
+
+package file
+
+import (
+	"encoding/binary"
+	"hash/crc32"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+)
+
+const (
+	checkpointFileName = "checkpoint"
+	checkpointSize     = 20
+)
+
+// checkpoint all records before offset of the segment seq are replayed.
+type checkpoint struct {
+	seq    uint64
+	offset int64
+}
+
+// checkpointFile stores the checkpoint in a fixed 20 bytes file: 8 bytes segment seq, 8 bytes offset and 4
+// bytes CRC32-C of them, all little-endian. It is overwritten in place on every commit.
+type checkpointFile struct {
+	file  *os.File
+	dirty bool
+}
+
+func openCheckpointFile(dir string) (*checkpointFile, checkpoint, error) {
+	path := filepath.Join(dir, checkpointFileName)
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, walFilePerm)
+	if err != nil {
+		return nil, checkpoint{}, err
+	}
+	buf := make([]byte, checkpointSize)
+	n, err := file.ReadAt(buf, 0)
+	if err != nil && err != io.EOF {
+		_ = file.Close()
+		return nil, checkpoint{}, err
+	}
+	if n == 0 {
+		return &checkpointFile{file: file}, checkpoint{}, nil
+	}
+	if n < checkpointSize || crc32.Checksum(buf[:16], crcTable) != binary.LittleEndian.Uint32(buf[16:]) {
+		log.Printf("WARNING: wal checkpoint '%s' is corrupt, replay from the oldest segment", path)
+		return &checkpointFile{file: file}, checkpoint{}, nil
+	}
+	return &checkpointFile{file: file}, checkpoint{
+		seq:    binary.LittleEndian.Uint64(buf[0:8]),
+		offset: int64(binary.LittleEndian.Uint64(buf[8:16])),
+	}, nil
+}
+
+func (c *checkpointFile) write(cp checkpoint) error {
+	buf := make([]byte, checkpointSize)
+	binary.LittleEndian.PutUint64(buf[0:8], cp.seq)
+	binary.LittleEndian.PutUint64(buf[8:16], uint64(cp.offset))
+	binary.LittleEndian.PutUint32(buf[16:], crc32.Checksum(buf[:16], crcTable))
+	if _, err := c.file.WriteAt(buf, 0); err != nil {
+		return err
+	}
+	c.dirty = true
+	return nil
+}
+
+func (c *checkpointFile) sync() error {
+	if !c.dirty {
+		return nil
+	}
+	if err := c.file.Sync(); err != nil {
+		return err
+	}
+	c.dirty = false
+	return nil
+}
+
+func (c *checkpointFile) close() error {
+	err := c.sync()
+	if closeErr := c.file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
@@ -40,6 +40,20 @@ func (f *NameInfo) joining(delimiter string) string {
 	return f.dir + strings.Join([]string{f.redisName, f.fileIndex, f.version}, delimiter)
 }
 
+// Item is a mirrored command by Args, or the write commands of a pipeline mirrored as one unit by Pipeline,
+// which are wrapped in MULTI/EXEC if Transaction.
 type Item struct {
-	Args []interface{}
+	Args        []interface{}
+	Pipeline    [][]interface{} `json:"Pipeline,omitempty"`
+	Transaction bool            `json:"Transaction,omitempty"`
+	// Timestamp is the unix milliseconds when the item is appended to the WAL
+	Timestamp int64 `json:"Timestamp,omitempty"`
+}
+
+// Commands returns the commands of the item.
+func (i Item) Commands() [][]interface{} {
+	if i.Pipeline != nil {
+		return i.Pipeline
+	}
+	return [][]interface{}{i.Args}
 }
@@ -38,7 +38,7 @@ const (
 	FileTimestampCloseMillions         = 70000
 	FileCloseCheckTimestampGapMillions = 5000
 	FlushGapMillions                   = 10000
-	RelativePattern                    = "(dc[12])-([0-9]{13})-([0-9]*)\\.dat"
+	RelativePattern                    = "^(.+)-([0-9]{13})-([0-9]*)\\.dat$"
 	MaxLine                            = 1 << 20
 )
 
@@ -64,10 +64,7 @@ func (f *Operation) CloseWriter() {
 	defer ticker.Stop()
 	for range ticker.C {
 		f.mutex.Lock()
-		if f.fileWriter == nil {
-			continue
-		}
-		if time.Now().UnixNano()/1e6 > f.lastFlushTime+FileTimestampGapMillions {
+		if f.fileWriter != nil && time.Now().UnixNano()/1e6 > f.lastFlushTime+FileTimestampGapMillions {
 			err := f.fileWriter.Flush()
 			if err != nil {
 				log.Println(err)
@@ -144,24 +141,27 @@ func (f *Operation) CreateFile(originPath string) (*os.File, error) {
 	nameItem = append(nameItem, strconv.FormatInt(f.lastCreateTime, 10))
 	nameItem = append(nameItem, DefaultVersion)
 	path := strings.Join(nameItem, Delimiter) + Suffix
-	return os.OpenFile(filepath.Clean(path), os.O_CREATE, CacheFilePerm)
+	return os.OpenFile(filepath.Clean(path), os.O_CREATE|os.O_WRONLY|os.O_APPEND, CacheFilePerm)
 }
 
-// traversal Traverse and check whether the execution requirements are met
+var relativeRegexp = regexp.MustCompile(RelativePattern)
+
+// traversal Traverse and check whether the execution requirements are met, nameMap records the latest file of
+// every server which may be still written.
 func traversal(info os.FileInfo, matchFile *[]string, nameMap map[string]string, nowTime int64) {
-	if matched, err := regexp.MatchString(RelativePattern, info.Name()); matched {
-		if err != nil {
-			log.Println(err)
-		}
-		*matchFile = append(*matchFile, info.Name())
-		startIndex := strings.Index(info.Name(), Delimiter) + 1
-		endIndex := strings.LastIndex(info.Name(), "-")
-		ux, err := strconv.ParseInt(info.Name()[startIndex:endIndex], 10, 64)
-		if err == nil && ux > nowTime-FileTimestampCloseMillions {
-			if info.Name() > nameMap[info.Name()[0:3]] {
-				nameMap[info.Name()[0:3]] = info.Name()
-			}
-		}
+	matcher := relativeRegexp.FindStringSubmatch(info.Name())
+	if len(matcher) == 0 {
+		return
+	}
+	*matchFile = append(*matchFile, info.Name())
+	redisName := matcher[1]
+	ux, err := strconv.ParseInt(matcher[2], 10, 64)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	if ux > nowTime-FileTimestampCloseMillions && info.Name() > nameMap[redisName] {
+		nameMap[redisName] = info.Name()
 	}
 }
 
@@ -180,7 +180,7 @@ func FileListNeedReplay(dir string) []string {
 			traversal(info, &matchFile, nameMap, nowTime)
 		}
 		for _, name := range matchFile {
-			if nameMap[name[0:3]] != name {
+			if nameMap[relativeRegexp.FindStringSubmatch(name)[1]] != name {
 				totalFilenames = append(totalFilenames, dir+name)
 			}
 		}
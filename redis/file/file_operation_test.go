@@ -0,0 +1,43 @@
+/*
+ * Copyright (c) Huawei Technologies Co., Ltd. 2021.
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use
+ * this file except in compliance with the License.  You may obtain a copy of the
+ * License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package file
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileListNeedReplay(t *testing.T) {
+	dir := t.TempDir() + "/"
+	old := strconv.FormatInt(time.Now().Add(-time.Hour).UnixNano()/1e6, 10)
+	now := strconv.FormatInt(time.Now().UnixNano()/1e6, 10)
+	for _, name := range []string{"dc1-" + old + "-0.dat", "dc1-" + now + "-0.dat", "cn-east-3-" + old + "-1.dat",
+		"cn-east-3-" + now + "-0.dat", "guangzhou-" + old + "-0.dat", "other.txt"} {
+		assert.Nil(t, os.WriteFile(filepath.Join(dir, name), nil, CacheFilePerm))
+	}
+	// the latest file of every server may be still written
+	assert.ElementsMatch(t, []string{dir + "dc1-" + old + "-0.dat", dir + "cn-east-3-" + old + "-1.dat",
+		dir + "guangzhou-" + old + "-0.dat"}, FileListNeedReplay(dir))
+
+	info, err := Parse(dir + "cn-east-3-" + old + "-1.dat")
+	assert.Nil(t, err)
+	assert.Equal(t, "cn-east-3", info.redisName)
+	assert.Equal(t, "1", info.version)
+}
@@ -0,0 +1,206 @@
+/*
+ * Copyright (c) Huawei Technologies Co., Ltd. 2021.
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use
+ * this file except in compliance with the License.  You may obtain a copy of the
+ * License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package file
+
+import (
+	"bufio"
+	"bytes"
+	"encoding"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+)
+
+const (
+	// recordFormatRESP marks the binary records, the JSON records of the older versions start with '{'
+	recordFormatRESP  = 0x01
+	recordTransaction = 1 << 0
+	recordPipeline    = 1 << 1
+	// recordPrefixSize is the format, the flags and the timestamp
+	recordPrefixSize = 10
+)
+
+var errRecordFormat = errors.New("wal: invalid record format")
+
+// encodeItem encode the item as the format, the flags, the 8 bytes little-endian timestamp and the commands as
+// a RESP array of arrays of bulk strings, the args are formatted the same as go-redis, so that binary values are
+// replayed as they are.
+func encodeItem(item Item) ([]byte, error) {
+	var buffer bytes.Buffer
+	var flags byte
+	if item.Transaction {
+		flags |= recordTransaction
+	}
+	if item.Pipeline != nil {
+		flags |= recordPipeline
+	}
+	prefix := make([]byte, recordPrefixSize)
+	prefix[0], prefix[1] = recordFormatRESP, flags
+	binary.LittleEndian.PutUint64(prefix[2:], uint64(item.Timestamp))
+	buffer.Write(prefix)
+	commands := item.Commands()
+	writeLength(&buffer, '*', len(commands))
+	for _, args := range commands {
+		writeLength(&buffer, '*', len(args))
+		for _, arg := range args {
+			value, err := argBytes(arg)
+			if err != nil {
+				return nil, err
+			}
+			writeLength(&buffer, '$', len(value))
+			buffer.Write(value)
+			buffer.WriteString("\r\n")
+		}
+	}
+	return buffer.Bytes(), nil
+}
+
+func writeLength(buffer *bytes.Buffer, kind byte, length int) {
+	buffer.WriteByte(kind)
+	buffer.WriteString(strconv.Itoa(length))
+	buffer.WriteString("\r\n")
+}
+
+// argBytes format the arg the same as the go-redis writer.
+func argBytes(arg interface{}) ([]byte, error) {
+	switch a := arg.(type) {
+	case nil:
+		return []byte{}, nil
+	case string:
+		return []byte(a), nil
+	case []byte:
+		return a, nil
+	case int:
+		return strconv.AppendInt(nil, int64(a), 10), nil
+	case int8:
+		return strconv.AppendInt(nil, int64(a), 10), nil
+	case int16:
+		return strconv.AppendInt(nil, int64(a), 10), nil
+	case int32:
+		return strconv.AppendInt(nil, int64(a), 10), nil
+	case int64:
+		return strconv.AppendInt(nil, a, 10), nil
+	case uint:
+		return strconv.AppendUint(nil, uint64(a), 10), nil
+	case uint8:
+		return strconv.AppendUint(nil, uint64(a), 10), nil
+	case uint16:
+		return strconv.AppendUint(nil, uint64(a), 10), nil
+	case uint32:
+		return strconv.AppendUint(nil, uint64(a), 10), nil
+	case uint64:
+		return strconv.AppendUint(nil, a, 10), nil
+	case float32:
+		return strconv.AppendFloat(nil, float64(a), 'f', -1, 64), nil
+	case float64:
+		return strconv.AppendFloat(nil, a, 'f', -1, 64), nil
+	case bool:
+		if a {
+			return []byte("1"), nil
+		}
+		return []byte("0"), nil
+	case time.Time:
+		return a.AppendFormat(nil, time.RFC3339Nano), nil
+	case time.Duration:
+		return strconv.AppendInt(nil, a.Nanoseconds(), 10), nil
+	case json.Number:
+		return []byte(a), nil
+	case encoding.BinaryMarshaler:
+		return a.MarshalBinary()
+	}
+	return nil, fmt.Errorf("wal: can't marshal %T, implement encoding.BinaryMarshaler", arg)
+}
+
+// decodeItem decode a record, the args are decoded as strings holding the exact bytes.
+func decodeItem(payload []byte) (Item, error) {
+	if len(payload) > 0 && payload[0] == '{' {
+		return decodeJSONItem(payload)
+	}
+	var item Item
+	if len(payload) < recordPrefixSize || payload[0] != recordFormatRESP {
+		return item, errRecordFormat
+	}
+	flags := payload[1]
+	item.Timestamp = int64(binary.LittleEndian.Uint64(payload[2:recordPrefixSize]))
+	item.Transaction = flags&recordTransaction != 0
+	reader := bufio.NewReader(bytes.NewReader(payload[recordPrefixSize:]))
+	count, err := readLength(reader, '*')
+	if err != nil {
+		return item, err
+	}
+	commands := make([][]interface{}, 0, count)
+	for i := 0; i < count; i++ {
+		argc, err := readLength(reader, '*')
+		if err != nil {
+			return item, err
+		}
+		args := make([]interface{}, 0, argc)
+		for j := 0; j < argc; j++ {
+			size, err := readLength(reader, '$')
+			if err != nil {
+				return item, err
+			}
+			value := make([]byte, size+2)
+			if _, err = io.ReadFull(reader, value); err != nil || value[size] != '\r' || value[size+1] != '\n' {
+				return item, errRecordFormat
+			}
+			args = append(args, string(value[:size]))
+		}
+		commands = append(commands, args)
+	}
+	if flags&recordPipeline != 0 {
+		item.Pipeline = commands
+	} else if len(commands) == 1 {
+		item.Args = commands[0]
+	} else {
+		return item, errRecordFormat
+	}
+	return item, nil
+}
+
+func readLength(reader *bufio.Reader, kind byte) (int, error) {
+	line, err := reader.ReadString('\n')
+	if err != nil || len(line) < 4 || line[0] != kind || line[len(line)-2] != '\r' {
+		return 0, errRecordFormat
+	}
+	length, err := strconv.Atoi(line[1 : len(line)-2])
+	if err != nil || length < 0 || length > maxRecordSize {
+		return 0, errRecordFormat
+	}
+	return length, nil
+}
+
+// decodeJSONItem decode the JSON records written by the older versions, numbers are decoded as strings, so that
+// big integers are replayed without precision loss.
+func decodeJSONItem(payload []byte) (Item, error) {
+	var item Item
+	decoder := json.NewDecoder(bytes.NewReader(payload))
+	decoder.UseNumber()
+	if err := decoder.Decode(&item); err != nil {
+		return item, err
+	}
+	for _, args := range item.Commands() {
+		for i, arg := range args {
+			if number, ok := arg.(json.Number); ok {
+				args[i] = number.String()
+			}
+		}
+	}
+	return item, nil
+}
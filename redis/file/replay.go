@@ -16,24 +16,190 @@ package file
 
 import (
 	"bufio"
+	"bytes"
 	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"path/filepath"
 	"reflect"
 	"regexp"
 	"sort"
+	"strconv"
+	"strings"
 
 	"github.com/go-redis/redis/v8"
 )
 
-var Pattern = regexp.MustCompile("(.*/)(.*)?-(.*)?-(.*)?\\.dat")
+var Pattern = regexp.MustCompile("(.*/)(.+)-([0-9]{13})-([0-9]*)\\.dat$")
 
-// BatchReplay Run the following command to filter the files to be executed
-func BatchReplay(clients map[string]redis.UniversalClient, fileNames []string) {
+// transientErrors the error replies of a server which can not execute the commands for now, such as loading the
+// dataset or a replica after failover, the commands succeed when they are replayed again later.
+var transientErrors = map[string]struct{}{
+	"LOADING":     {},
+	"READONLY":    {},
+	"MASTERDOWN":  {},
+	"CLUSTERDOWN": {},
+	"TRYAGAIN":    {},
+	"BUSY":        {},
+	"OOM":         {},
+}
+
+// IsRejected whether the error reply of the command means it is rejected by the server, such as ERR and
+// WRONGTYPE, replaying it again never succeeds. The transient error replies are not rejections.
+func IsRejected(err error) bool {
+	if err == nil {
+		return false
+	}
+	prefix := err.Error()
+	if i := strings.IndexByte(prefix, ' '); i >= 0 {
+		prefix = prefix[:i]
+	}
+	_, transient := transientErrors[prefix]
+	return !transient
+}
+
+// BatchReplay replay the sealed segments of every target's WAL on the target's client in order. Replaying a
+// target stops at the first record failed by connection errors or transient error replies, such as LOADING, and
+// resumes from it in the next round; records rejected by the redis server are logged and skipped. The scripts of
+// EVALSHA are loaded from scripts on NOSCRIPT, scripts may be nil.
+func BatchReplay(ctx context.Context, clients map[string]redis.UniversalClient, wals map[string]*WAL,
+	scripts ScriptSource) {
+	for target, wal := range wals {
+		client, ok := clients[target]
+		if !ok || client == nil {
+			log.Printf("ERROR: server '%s' has no client to replay wal", target)
+			continue
+		}
+		err := wal.Replay(func(item Item) error {
+			err := ExecItemWithScripts(ctx, client, item, scripts)
+			var redisErr redis.Error
+			if err != nil && errors.As(err, &redisErr) && IsRejected(err) {
+				log.Println("WARNING: replay", item.Commands(), err)
+				return nil
+			}
+			return err
+		})
+		if err != nil {
+			log.Printf("ERROR: replay wal of server '%s' interrupted, %v", target, err)
+		}
+	}
+}
+
+// ExecItem execute the item on the client, a pipeline item is executed in one pipeline, or in MULTI/EXEC if it
+// is a transaction. The error is the first failed command's except redis.Nil.
+func ExecItem(ctx context.Context, client redis.UniversalClient, item Item) error {
+	if item.Pipeline == nil {
+		if err := client.Do(ctx, item.Args...).Err(); err != redis.Nil {
+			return err
+		}
+		return nil
+	}
+	fn := func(pipe redis.Pipeliner) error {
+		for _, args := range item.Pipeline {
+			pipe.Do(ctx, args...)
+		}
+		return nil
+	}
+	var cmds []redis.Cmder
+	var err error
+	if item.Transaction {
+		cmds, err = client.TxPipelined(ctx, fn)
+	} else {
+		cmds, err = client.Pipelined(ctx, fn)
+	}
+	if err == redis.Nil {
+		return nil
+	}
+	for _, cmd := range cmds {
+		if cmd.Err() != nil && cmd.Err() != redis.Nil {
+			return cmd.Err()
+		}
+	}
+	return err
+}
+
+// LegacyFiles returns the line files of the server written by Operation.WriteFile in the dir, in written order.
+func LegacyFiles(dir, serverName string) []string {
+	if dir == "" {
+		dir = "."
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("WARNING: list legacy files of dir '%s' failed, %v", dir, err)
+		}
+		return nil
+	}
+	var fileNames []string
+	for _, entry := range entries {
+		matcher := relativeRegexp.FindStringSubmatch(entry.Name())
+		if len(matcher) != 0 && matcher[1] == serverName && !entry.IsDir() {
+			fileNames = append(fileNames, filepath.Join(dir, entry.Name()))
+		}
+	}
+	sort.Strings(fileNames)
+	return fileNames
+}
+
+// MigrateFiles append the items of the line files to the WAL in order and remove the files, so that the commands
+// left by old versions are replayed by the WAL before the new ones. It stops at the first file failed to migrate.
+func MigrateFiles(fileNames []string, wal *WAL) error {
+	for _, fileName := range fileNames {
+		if err := migrateFile(fileName, wal); err != nil {
+			return fmt.Errorf("migrate file '%s' to wal failed, %w", fileName, err)
+		}
+		if err := os.Remove(fileName); err != nil {
+			return err
+		}
+		log.Printf("INFO: legacy file '%s' is migrated to wal '%s'", fileName, wal.Dir())
+	}
+	return nil
+}
+
+func migrateFile(fileName string, wal *WAL) error {
+	var timestamp int64
+	if matcher := relativeRegexp.FindStringSubmatch(filepath.Base(fileName)); len(matcher) != 0 {
+		timestamp, _ = strconv.ParseInt(matcher[2], 10, 64)
+	}
+	legacyFile, err := os.OpenFile(filepath.Clean(fileName), os.O_RDONLY, CacheFilePerm)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := legacyFile.Close(); err != nil {
+			log.Println("ERROR: Close File " + fileName + " failed")
+		}
+	}()
+	br := bufio.NewReader(legacyFile)
+	for {
+		line, readErr := br.ReadBytes('\n')
+		if line = bytes.TrimRight(line, "\r\n"); len(line) > 0 {
+			item, err := decodeJSONItem(line)
+			if err != nil {
+				log.Printf("WARNING: skip the corrupt line of file '%s', %v", fileName, err)
+			} else {
+				item.Timestamp = timestamp
+				if err = wal.Append(item); err != nil {
+					return err
+				}
+			}
+		}
+		if readErr == io.EOF {
+			return nil
+		} else if readErr != nil {
+			return readErr
+		}
+	}
+}
+
+// BatchReplayFiles replay the line files written by Operation.WriteFile.
+//
+// Deprecated: double-write migrates the files left by old versions to the WAL by MigrateFiles.
+func BatchReplayFiles(clients map[string]redis.UniversalClient, fileNames []string) {
 	redis2file := make(map[string][]string)
 	for _, fileName := range fileNames {
 		fileNameInfo, err := Parse(fileName)
@@ -72,7 +238,7 @@ func ReplayExec(client redis.UniversalClient, interrupted, lineIndex *int64, lin
 // Replay Traverse all commands in the file and execute them
 func Replay(filename string, client redis.UniversalClient) bool {
 	var lineIndex, interrupted int64 = 0, 0
-	file, err := os.OpenFile(filepath.Clean(filename), os.O_APPEND, CacheFilePerm)
+	file, err := os.OpenFile(filepath.Clean(filename), os.O_RDONLY, CacheFilePerm)
 	if err != nil {
 		interrupted++
 		log.Println("ERROR: OpenFile " + filename + " failed")
@@ -110,7 +276,7 @@ func Replay(filename string, client redis.UniversalClient) bool {
 
 // failDispose Write the execution exception and subsequent contents to the new version number file
 func failDispose(srcPath, dstPath string, startLine int64) {
-	srcFile, err := os.OpenFile(filepath.Clean(srcPath), os.O_APPEND, CacheFilePerm)
+	srcFile, err := os.OpenFile(filepath.Clean(srcPath), os.O_RDONLY, CacheFilePerm)
 	if err != nil {
 		log.Println("ERROR: OpenFile " + srcPath + " failed")
 		return
@@ -122,7 +288,7 @@ func failDispose(srcPath, dstPath string, startLine int64) {
 	}()
 	br := bufio.NewReader(srcFile)
 
-	dstFile, err := os.OpenFile(filepath.Clean(dstPath), os.O_CREATE, CacheFilePerm)
+	dstFile, err := os.OpenFile(filepath.Clean(dstPath), os.O_CREATE|os.O_WRONLY|os.O_TRUNC, CacheFilePerm)
 	if err != nil {
 		log.Println("ERROR: OpenFile " + dstPath + " failed")
 		return
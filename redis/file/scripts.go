@@ -0,0 +1,81 @@
+/*
+ * Copyright (c) Huawei Technologies Co., Ltd. 2021.
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use
+ * this file except in compliance with the License.  You may obtain a copy of the
+ * License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package file
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// ScriptSource returns the body of the script of the SHA, it is used to load the script of EVALSHA on NOSCRIPT.
+type ScriptSource func(sha string) (string, bool)
+
+// ExecItemWithScripts execute the item like ExecItem and loads the scripts of its EVALSHA commands by SCRIPT LOAD
+// on demand. A single command is retried once after loading if it fails with NOSCRIPT; the scripts of a pipeline
+// are loaded before it is executed, since it can not be retried without executing its other commands twice.
+func ExecItemWithScripts(ctx context.Context, client redis.UniversalClient, item Item, scripts ScriptSource) error {
+	if scripts == nil {
+		return ExecItem(ctx, client, item)
+	}
+	if item.Pipeline != nil {
+		if err := loadScripts(ctx, client, ScriptSHAs(item.Pipeline), scripts); err != nil {
+			return err
+		}
+		return ExecItem(ctx, client, item)
+	}
+	err := ExecItem(ctx, client, item)
+	if !IsNoScript(err) {
+		return err
+	}
+	if err := loadScripts(ctx, client, ScriptSHAs([][]interface{}{item.Args}), scripts); err != nil {
+		return err
+	}
+	return ExecItem(ctx, client, item)
+}
+
+// loadScripts load the known scripts of the SHAs, the unknown ones are skipped.
+func loadScripts(ctx context.Context, client redis.UniversalClient, shas []string, scripts ScriptSource) error {
+	for _, sha := range shas {
+		script, ok := scripts(sha)
+		if !ok {
+			log.Printf("WARNING: script %s is unknown, it can not be loaded", sha)
+			continue
+		}
+		if err := client.ScriptLoad(ctx, script).Err(); err != nil {
+			return fmt.Errorf("load script %s failed, %w", sha, err)
+		}
+	}
+	return nil
+}
+
+// ScriptSHAs returns the SHAs of the EVALSHA commands, whose args start with the command name.
+func ScriptSHAs(commands [][]interface{}) []string {
+	var shas []string
+	for _, args := range commands {
+		if len(args) >= 2 && strings.EqualFold(fmt.Sprint(args[0]), "evalsha") {
+			shas = append(shas, fmt.Sprint(args[1]))
+		}
+	}
+	return shas
+}
+
+// IsNoScript whether the error is the NOSCRIPT reply of EVALSHA.
+func IsNoScript(err error) bool {
+	return err != nil && strings.HasPrefix(err.Error(), "NOSCRIPT")
+}
@@ -0,0 +1,571 @@
+/*
+ * Copyright (c) Huawei Technologies Co., Ltd. 2021.
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use
+ * this file except in compliance with the License.  You may obtain a copy of the
+ * License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations under the License.
+ *
+ */
+
+package file
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	SegmentSuffix       = ".wal"
+	DefaultSegmentSize  = 64 << 20
+	DefaultSyncInterval = time.Second
+	recordHeaderSize    = 8
+	maxRecordSize       = 64 << 20
+	segmentNameDigits   = 20
+	walDirPerm          = 0750
+	walFilePerm         = 0640
+	SyncPolicyAlways    = "always"
+	SyncPolicyInterval  = "interval"
+	SyncPolicyNever     = "never"
+)
+
+// ErrCorruptRecord is returned when a record is torn or its CRC does not match.
+var ErrCorruptRecord = errors.New("wal: corrupt record")
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+// WALOptions SyncPolicy is one of always, interval and never: always fsync after every record, interval fsync
+// every SyncInterval, never leaves it to the operating system. A segment is rotated after SegmentSize bytes.
+type WALOptions struct {
+	SyncPolicy   string
+	SyncInterval time.Duration
+	SegmentSize  int64
+}
+
+// errStopRead stops ReadSegmentFrom without error.
+var errStopRead = errors.New("wal: stop read")
+
+// ReplayLag is the records of a WAL which are not replayed yet.
+type ReplayLag struct {
+	PendingSegments int   // segments having records not replayed, including the active one
+	PendingBytes    int64 // size of the records not replayed
+	// OldestTimestamp is the append time of the oldest record not replayed, zero if nothing is pending
+	OldestTimestamp time.Time
+}
+
+// WAL is a segment based write-ahead log. A record is a 4 bytes little-endian payload length, a 4 bytes CRC32-C
+// of the payload and the binary encoded Item, see encodeItem. Records are appended to the active segment, replay
+// reads the sealed segments only, and the replay position is committed to a checkpoint after every replayed
+// record, so that a replay interrupted by failures or crashes resumes after the last acknowledged record.
+type WAL struct {
+	dir     string
+	options WALOptions
+
+	mutex          sync.Mutex
+	segment        *os.File
+	segmentSeq     uint64
+	segmentSize    int64
+	dirty          bool
+	closed         bool
+	checkpointFile *checkpointFile
+	checkpoint     checkpoint
+	replayMutex    sync.Mutex
+	stop           chan struct{}
+	done           chan struct{}
+	// key and refs are guarded by openWALs.mutex
+	key  string
+	refs int
+}
+
+// openWALs are the WALs opened in the process by directory. A directory has a single writer, the strategy
+// rebuilt by a reload shares the WALs of the strategy it replaces, which is still draining.
+var openWALs = struct {
+	mutex sync.Mutex
+	wals  map[string]*WAL
+}{wals: make(map[string]*WAL)}
+
+// OpenWAL open the WAL in dir, the torn tail of the last segment left by a crash is truncated. If the WAL of dir
+// is already opened in the process, it is shared with its options, every opener closes it once, and it is closed
+// after closed by all openers. The directory must not be shared by processes.
+func OpenWAL(dir string, options WALOptions) (*WAL, error) {
+	key, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	openWALs.mutex.Lock()
+	defer openWALs.mutex.Unlock()
+	if w, ok := openWALs.wals[key]; ok {
+		w.refs++
+		return w, nil
+	}
+	w, err := openWAL(dir, options)
+	if err != nil {
+		return nil, err
+	}
+	w.key, w.refs = key, 1
+	openWALs.wals[key] = w
+	return w, nil
+}
+
+func openWAL(dir string, options WALOptions) (*WAL, error) {
+	if options.SyncPolicy == "" {
+		options.SyncPolicy = SyncPolicyInterval
+	}
+	if options.SyncPolicy != SyncPolicyAlways && options.SyncPolicy != SyncPolicyInterval &&
+		options.SyncPolicy != SyncPolicyNever {
+		return nil, fmt.Errorf("wal: invalid sync policy '%s'", options.SyncPolicy)
+	}
+	if options.SyncInterval <= 0 {
+		options.SyncInterval = DefaultSyncInterval
+	}
+	if options.SegmentSize <= 0 {
+		options.SegmentSize = DefaultSegmentSize
+	}
+	if err := os.MkdirAll(dir, walDirPerm); err != nil {
+		return nil, err
+	}
+	w := &WAL{dir: dir, options: options, stop: make(chan struct{}), done: make(chan struct{})}
+	seqs, err := w.segmentSeqs()
+	if err != nil {
+		return nil, err
+	}
+	if w.checkpointFile, w.checkpoint, err = openCheckpointFile(dir); err != nil {
+		return nil, err
+	}
+	if w.checkpoint.seq == 0 {
+		w.checkpoint.seq = 1
+	}
+	if len(seqs) == 0 || seqs[len(seqs)-1] < w.checkpoint.seq {
+		// all segments are replayed, new records are appended after the checkpoint
+		err = w.openSegment(w.checkpoint.seq)
+		w.checkpoint.offset = 0
+	} else {
+		err = w.recoverSegment(seqs[len(seqs)-1])
+	}
+	if err != nil {
+		_ = w.checkpointFile.close()
+		return nil, err
+	}
+	if options.SyncPolicy == SyncPolicyInterval {
+		go w.syncLoop()
+	} else {
+		close(w.done)
+	}
+	return w, nil
+}
+
+// Dir returns the directory of the WAL.
+func (w *WAL) Dir() string {
+	return w.dir
+}
+
+// Append write the item to the active segment, and rotate the segment when it is full.
+func (w *WAL) Append(item Item) error {
+	if item.Timestamp == 0 {
+		item.Timestamp = time.Now().UnixMilli()
+	}
+	payload, err := encodeItem(item)
+	if err != nil {
+		return err
+	}
+	if len(payload) > maxRecordSize {
+		return fmt.Errorf("wal: record size %d exceeds %d", len(payload), maxRecordSize)
+	}
+	record := make([]byte, recordHeaderSize+len(payload))
+	binary.LittleEndian.PutUint32(record[0:4], uint32(len(payload)))
+	binary.LittleEndian.PutUint32(record[4:8], crc32.Checksum(payload, crcTable))
+	copy(record[recordHeaderSize:], payload)
+
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if w.closed {
+		return errors.New("wal: closed")
+	}
+	if _, err = w.segment.Write(record); err != nil {
+		return err
+	}
+	w.segmentSize += int64(len(record))
+	w.dirty = true
+	if w.options.SyncPolicy == SyncPolicyAlways {
+		if err = w.syncLocked(); err != nil {
+			return err
+		}
+	}
+	if w.segmentSize >= w.options.SegmentSize {
+		return w.rotateLocked()
+	}
+	return nil
+}
+
+// Sync fsync the active segment.
+func (w *WAL) Sync() error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if w.closed {
+		return nil
+	}
+	return w.syncLocked()
+}
+
+// Seal rotate the active segment if it has records, then returns the paths of all sealed segments in order.
+func (w *WAL) Seal() ([]string, error) {
+	seqs, err := w.seal()
+	if err != nil {
+		return nil, err
+	}
+	segments := make([]string, 0, len(seqs))
+	for _, seq := range seqs {
+		segments = append(segments, w.segmentPath(seq))
+	}
+	return segments, nil
+}
+
+func (w *WAL) seal() ([]uint64, error) {
+	w.mutex.Lock()
+	if !w.closed && w.segmentSize > 0 {
+		if err := w.rotateLocked(); err != nil {
+			w.mutex.Unlock()
+			return nil, err
+		}
+	}
+	activeSeq := w.segmentSeq
+	w.mutex.Unlock()
+	seqs, err := w.segmentSeqs()
+	if err != nil {
+		return nil, err
+	}
+	var sealed []uint64
+	for _, seq := range seqs {
+		if seq < activeSeq {
+			sealed = append(sealed, seq)
+		}
+	}
+	return sealed, nil
+}
+
+// Replay seal the active segment, then call fn for the records of the sealed segments after the checkpoint in
+// order. The checkpoint is committed after every record fn succeeded, and a segment is removed after all its
+// records are replayed. Replay stops at the first error of fn, the failed record is replayed again next time.
+func (w *WAL) Replay(fn func(item Item) error) error {
+	w.replayMutex.Lock()
+	defer w.replayMutex.Unlock()
+	seqs, err := w.seal()
+	if err != nil {
+		return err
+	}
+	for _, seq := range seqs {
+		path := w.segmentPath(seq)
+		if offset, replayed := w.replayOffset(seq); !replayed {
+			_, err = ReadSegmentFrom(path, offset, func(item Item, next int64) error {
+				if err := fn(item); err != nil {
+					return err
+				}
+				return w.commit(checkpoint{seq: seq, offset: next})
+			})
+			if errors.Is(err, ErrCorruptRecord) {
+				log.Printf("ERROR: sealed wal segment '%s' is corrupt, the rest records are dropped", path)
+			} else if err != nil {
+				return err
+			}
+			if err = w.commit(checkpoint{seq: seq + 1}); err != nil {
+				return err
+			}
+		}
+		if err = os.Remove(path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Lag returns the records which are not replayed yet.
+func (w *WAL) Lag() (ReplayLag, error) {
+	w.mutex.Lock()
+	cp := w.checkpoint
+	w.mutex.Unlock()
+	var lag ReplayLag
+	seqs, err := w.segmentSeqs()
+	if err != nil {
+		return lag, err
+	}
+	for _, seq := range seqs {
+		if seq < cp.seq {
+			continue
+		}
+		path := w.segmentPath(seq)
+		info, err := os.Stat(path)
+		if os.IsNotExist(err) {
+			// removed by replay
+			continue
+		} else if err != nil {
+			return lag, err
+		}
+		var offset int64
+		if seq == cp.seq {
+			offset = cp.offset
+		}
+		if info.Size() <= offset {
+			continue
+		}
+		lag.PendingSegments++
+		lag.PendingBytes += info.Size() - offset
+		if lag.OldestTimestamp.IsZero() {
+			_, _ = ReadSegmentFrom(path, offset, func(item Item, next int64) error {
+				if item.Timestamp > 0 {
+					lag.OldestTimestamp = time.UnixMilli(item.Timestamp)
+				}
+				return errStopRead
+			})
+		}
+	}
+	return lag, nil
+}
+
+// replayOffset returns the offset to replay the segment from, replayed is true if the whole segment is replayed.
+func (w *WAL) replayOffset(seq uint64) (offset int64, replayed bool) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	switch {
+	case seq < w.checkpoint.seq:
+		return 0, true
+	case seq == w.checkpoint.seq:
+		return w.checkpoint.offset, false
+	default:
+		return 0, false
+	}
+}
+
+func (w *WAL) commit(cp checkpoint) error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if w.closed {
+		return errors.New("wal: closed")
+	}
+	if err := w.checkpointFile.write(cp); err != nil {
+		return err
+	}
+	w.checkpoint = cp
+	if w.options.SyncPolicy == SyncPolicyAlways {
+		return w.checkpointFile.sync()
+	}
+	return nil
+}
+
+// Close fsync and close the active segment when it is closed by all openers.
+func (w *WAL) Close() error {
+	if !w.release() {
+		return nil
+	}
+	w.mutex.Lock()
+	if w.closed {
+		w.mutex.Unlock()
+		return nil
+	}
+	w.closed = true
+	close(w.stop)
+	err := w.syncLocked()
+	if closeErr := w.segment.Close(); err == nil {
+		err = closeErr
+	}
+	if closeErr := w.checkpointFile.close(); err == nil {
+		err = closeErr
+	}
+	w.mutex.Unlock()
+	<-w.done
+	return err
+}
+
+// release returns true if the WAL is released by the last opener.
+func (w *WAL) release() bool {
+	openWALs.mutex.Lock()
+	defer openWALs.mutex.Unlock()
+	if w.refs == 0 {
+		return false
+	}
+	w.refs--
+	if w.refs > 0 {
+		return false
+	}
+	delete(openWALs.wals, w.key)
+	return true
+}
+
+func (w *WAL) syncLoop() {
+	defer close(w.done)
+	ticker := time.NewTicker(w.options.SyncInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := w.Sync(); err != nil {
+				log.Printf("ERROR: wal '%s' sync failed, %v", w.dir, err)
+			}
+		case <-w.stop:
+			return
+		}
+	}
+}
+
+func (w *WAL) syncLocked() error {
+	if err := w.checkpointFile.sync(); err != nil {
+		return err
+	}
+	if !w.dirty {
+		return nil
+	}
+	if err := w.segment.Sync(); err != nil {
+		return err
+	}
+	w.dirty = false
+	return nil
+}
+
+// rotateLocked seal the active segment and open the next one, a sealed segment is always synced.
+func (w *WAL) rotateLocked() error {
+	w.dirty = true
+	if err := w.syncLocked(); err != nil {
+		return err
+	}
+	if err := w.segment.Close(); err != nil {
+		return err
+	}
+	return w.openSegment(w.segmentSeq + 1)
+}
+
+func (w *WAL) openSegment(seq uint64) error {
+	segment, err := os.OpenFile(w.segmentPath(seq), os.O_CREATE|os.O_WRONLY|os.O_APPEND, walFilePerm)
+	if err != nil {
+		return err
+	}
+	info, err := segment.Stat()
+	if err != nil {
+		_ = segment.Close()
+		return err
+	}
+	w.segment, w.segmentSeq, w.segmentSize = segment, seq, info.Size()
+	return nil
+}
+
+// recoverSegment truncate the segment after its last valid record, then open it as the active segment.
+func (w *WAL) recoverSegment(seq uint64) error {
+	path := w.segmentPath(seq)
+	validSize, err := ReadSegment(path, func(item Item) error {
+		return nil
+	})
+	if err != nil && !errors.Is(err, ErrCorruptRecord) {
+		return err
+	}
+	if err != nil {
+		info, statErr := os.Stat(path)
+		if statErr != nil {
+			return statErr
+		}
+		log.Printf("WARNING: wal segment '%s' has a torn tail, truncate %d bytes", path,
+			info.Size()-validSize)
+		if err = os.Truncate(path, validSize); err != nil {
+			return err
+		}
+	}
+	return w.openSegment(seq)
+}
+
+func (w *WAL) segmentPath(seq uint64) string {
+	return filepath.Join(w.dir, fmt.Sprintf("%0*d%s", segmentNameDigits, seq, SegmentSuffix))
+}
+
+func (w *WAL) segmentSeqs() ([]uint64, error) {
+	entries, err := os.ReadDir(w.dir)
+	if err != nil {
+		return nil, err
+	}
+	var seqs []uint64
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, SegmentSuffix) {
+			continue
+		}
+		seq, err := strconv.ParseUint(strings.TrimSuffix(name, SegmentSuffix), 10, 64)
+		if err != nil {
+			continue
+		}
+		seqs = append(seqs, seq)
+	}
+	sort.Slice(seqs, func(i, j int) bool {
+		return seqs[i] < seqs[j]
+	})
+	return seqs, nil
+}
+
+// ReadSegment call fn for every record of the segment in order, it returns the size of the valid records. A torn
+// or corrupt record stops the reading with ErrCorruptRecord, an error of fn stops the reading and is returned.
+func ReadSegment(path string, fn func(item Item) error) (int64, error) {
+	return ReadSegmentFrom(path, 0, func(item Item, next int64) error {
+		return fn(item)
+	})
+}
+
+// ReadSegmentFrom is ReadSegment starting from offset, fn receives the offset of the next record as well.
+func ReadSegmentFrom(path string, offset int64, fn func(item Item, next int64) error) (int64, error) {
+	segment, err := os.Open(filepath.Clean(path))
+	if err != nil {
+		return offset, err
+	}
+	defer func() {
+		if err := segment.Close(); err != nil {
+			log.Printf("ERROR: close wal segment '%s' failed, %v", path, err)
+		}
+	}()
+	if _, err = segment.Seek(offset, io.SeekStart); err != nil {
+		return offset, err
+	}
+	reader := bufio.NewReader(segment)
+	header := make([]byte, recordHeaderSize)
+	for {
+		if _, err = io.ReadFull(reader, header); err != nil {
+			if err == io.EOF {
+				return offset, nil
+			}
+			return offset, ErrCorruptRecord
+		}
+		size := binary.LittleEndian.Uint32(header[0:4])
+		if size > maxRecordSize {
+			return offset, ErrCorruptRecord
+		}
+		payload := make([]byte, size)
+		if _, err = io.ReadFull(reader, payload); err != nil {
+			return offset, ErrCorruptRecord
+		}
+		if crc32.Checksum(payload, crcTable) != binary.LittleEndian.Uint32(header[4:8]) {
+			return offset, ErrCorruptRecord
+		}
+		item, err := decodeItem(payload)
+		if err != nil {
+			return offset, ErrCorruptRecord
+		}
+		next := offset + int64(recordHeaderSize) + int64(size)
+		if err = fn(item, next); err != nil {
+			if err == errStopRead {
+				return offset, nil
+			}
+			return offset, err
+		}
+		offset = next
+	}
+}
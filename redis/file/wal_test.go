@@ -0,0 +1,403 @@
+/*
+ * Copyright (c) Huawei Technologies Co., Ltd. 2021.
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use
+ * this file except in compliance with the License.  You may obtain a copy of the
+ * License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package file
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/huaweicloud/devcloud-go/mock"
+)
+
+func readItems(t *testing.T, segments []string) [][]interface{} {
+	var items [][]interface{}
+	for _, segment := range segments {
+		_, err := ReadSegment(segment, func(item Item) error {
+			items = append(items, item.Args)
+			return nil
+		})
+		assert.Nil(t, err)
+	}
+	return items
+}
+
+func TestWAL_AppendAndRotate(t *testing.T) {
+	wal, err := OpenWAL(t.TempDir(), WALOptions{SyncPolicy: SyncPolicyAlways, SegmentSize: 32})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer wal.Close()
+	for _, key := range []string{"key1", "key2", "key3"} {
+		assert.Nil(t, wal.Append(Item{Args: []interface{}{"set", key, "value"}}))
+	}
+	segments, err := wal.Seal()
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(segments))
+	assert.Equal(t, [][]interface{}{{"set", "key1", "value"}, {"set", "key2", "value"}, {"set", "key3", "value"}},
+		readItems(t, segments))
+
+	// the active segment is empty, nothing is sealed
+	segments, err = wal.Seal()
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(segments))
+	_, err = OpenWAL(t.TempDir(), WALOptions{SyncPolicy: "sometimes"})
+	assert.NotNil(t, err)
+}
+
+func TestWAL_RecoverTornTail(t *testing.T) {
+	dir := t.TempDir()
+	wal, err := OpenWAL(dir, WALOptions{SyncPolicy: SyncPolicyNever})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Nil(t, wal.Append(Item{Args: []interface{}{"set", "key1", "value"}}))
+	assert.Nil(t, wal.Append(Item{Args: []interface{}{"set", "key2", "value"}}))
+	path := wal.segmentPath(wal.segmentSeq)
+	assert.Nil(t, wal.Close())
+
+	// crash in the middle of writing the second record
+	info, err := os.Stat(path)
+	assert.Nil(t, err)
+	assert.Nil(t, os.Truncate(path, info.Size()-3))
+	_, err = ReadSegment(path, func(item Item) error {
+		return nil
+	})
+	assert.Equal(t, ErrCorruptRecord, err)
+
+	wal, err = OpenWAL(dir, WALOptions{SyncPolicy: SyncPolicyNever})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer wal.Close()
+	assert.Nil(t, wal.Append(Item{Args: []interface{}{"set", "key3", "value"}}))
+	segments, err := wal.Seal()
+	assert.Nil(t, err)
+	assert.Equal(t, [][]interface{}{{"set", "key1", "value"}, {"set", "key3", "value"}}, readItems(t, segments))
+}
+
+func TestBatchReplay(t *testing.T) {
+	redisMock := &mock.RedisMock{}
+	if err := redisMock.StartMockRedis(); err != nil {
+		t.Fatal(err)
+	}
+	defer redisMock.StopMockRedis()
+	client := redis.NewClient(&redis.Options{Addr: redisMock.Addr})
+	defer client.Close()
+	wal, err := OpenWAL(t.TempDir(), WALOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer wal.Close()
+	_ = redisMock.GetMockRedis().Set("string_key", "value")
+	assert.Nil(t, wal.Append(Item{Args: []interface{}{"set", "key", "value"}}))
+	assert.Nil(t, wal.Append(Item{Args: []interface{}{"hset", "string_key", "field", "value"}}))
+	assert.Nil(t, wal.Append(Item{Args: []interface{}{"incrby", "counter", int64(9007199254740993)}}))
+
+	ctx := context.Background()
+	BatchReplay(ctx, map[string]redis.UniversalClient{"dc2": client}, map[string]*WAL{"dc2": wal}, nil)
+	res, _ := redisMock.GetMockRedis().Get("key")
+	assert.Equal(t, "value", res)
+	res, _ = redisMock.GetMockRedis().Get("counter")
+	assert.Equal(t, "9007199254740993", res)
+	segments, err := wal.Seal()
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(segments))
+
+	// the server is down, segments are kept for the next replay
+	assert.Nil(t, wal.Append(Item{Args: []interface{}{"set", "key", "value2"}}))
+	redisMock.StopMockRedis()
+	BatchReplay(ctx, map[string]redis.UniversalClient{"dc2": client}, map[string]*WAL{"dc2": wal}, nil)
+	segments, err = wal.Seal()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(segments))
+}
+
+func TestWAL_ReplayCheckpoint(t *testing.T) {
+	dir := t.TempDir()
+	wal, err := OpenWAL(dir, WALOptions{SyncPolicy: SyncPolicyAlways})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"key1", "key2", "key3"} {
+		assert.Nil(t, wal.Append(Item{Args: []interface{}{"incr", key}}))
+	}
+	lag, err := wal.Lag()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, lag.PendingSegments)
+	assert.False(t, lag.OldestTimestamp.IsZero())
+
+	// the second record fails, the first one is not replayed again after reopen
+	var replayed []interface{}
+	replayFailed := errors.New("connection refused")
+	err = wal.Replay(func(item Item) error {
+		if item.Args[1] == "key2" && len(replayed) == 1 {
+			return replayFailed
+		}
+		replayed = append(replayed, item.Args[1])
+		return nil
+	})
+	assert.Equal(t, replayFailed, err)
+	assert.Nil(t, wal.Close())
+
+	wal, err = OpenWAL(dir, WALOptions{SyncPolicy: SyncPolicyAlways})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer wal.Close()
+	lag, err = wal.Lag()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, lag.PendingSegments)
+	assert.Nil(t, wal.Replay(func(item Item) error {
+		replayed = append(replayed, item.Args[1])
+		return nil
+	}))
+	assert.Equal(t, []interface{}{"key1", "key2", "key3"}, replayed)
+	lag, err = wal.Lag()
+	assert.Nil(t, err)
+	assert.Equal(t, ReplayLag{}, lag)
+
+	// records appended after the replay are not skipped after reopen
+	assert.Nil(t, wal.Close())
+	wal, err = OpenWAL(dir, WALOptions{SyncPolicy: SyncPolicyAlways})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Nil(t, wal.Append(Item{Args: []interface{}{"incr", "key4"}}))
+	assert.Nil(t, wal.Replay(func(item Item) error {
+		replayed = append(replayed, item.Args[1])
+		return nil
+	}))
+	assert.Equal(t, []interface{}{"key1", "key2", "key3", "key4"}, replayed)
+	assert.Nil(t, wal.Close())
+}
+
+func TestBatchReplay_Pipeline(t *testing.T) {
+	redisMock := &mock.RedisMock{}
+	if err := redisMock.StartMockRedis(); err != nil {
+		t.Fatal(err)
+	}
+	defer redisMock.StopMockRedis()
+	client := redis.NewClient(&redis.Options{Addr: redisMock.Addr})
+	defer client.Close()
+	wal, err := OpenWAL(t.TempDir(), WALOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer wal.Close()
+	assert.Nil(t, wal.Append(Item{Pipeline: [][]interface{}{{"set", "key1", "value"}, {"incrby", "counter", 2}},
+		Transaction: true}))
+	assert.Nil(t, wal.Append(Item{Pipeline: [][]interface{}{{"set", "key2", "value"}}}))
+
+	BatchReplay(context.Background(), map[string]redis.UniversalClient{"dc2": client}, map[string]*WAL{"dc2": wal},
+		nil)
+	for key, value := range map[string]string{"key1": "value", "key2": "value", "counter": "2"} {
+		res, _ := redisMock.GetMockRedis().Get(key)
+		assert.Equal(t, value, res)
+	}
+	lag, err := wal.Lag()
+	assert.Nil(t, err)
+	assert.Equal(t, 0, lag.PendingSegments)
+}
+
+func TestWAL_BinaryRoundTrip(t *testing.T) {
+	redisMock := &mock.RedisMock{}
+	if err := redisMock.StartMockRedis(); err != nil {
+		t.Fatal(err)
+	}
+	defer redisMock.StopMockRedis()
+	client := redis.NewClient(&redis.Options{Addr: redisMock.Addr})
+	defer client.Close()
+	wal, err := OpenWAL(t.TempDir(), WALOptions{SyncPolicy: SyncPolicyAlways})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer wal.Close()
+	binaryValue := []byte{0xff, 0x00, 0xfe, '\r', '\n', 0x80}
+	assert.Nil(t, wal.Append(Item{Args: []interface{}{"set", []byte("hello"), binaryValue}}))
+	assert.Nil(t, wal.Append(Item{Pipeline: [][]interface{}{{"set", "binary", binaryValue},
+		{"set", "float", 1.5, "px", time.Minute / time.Millisecond}}, Transaction: true}))
+
+	segments, err := wal.Seal()
+	assert.Nil(t, err)
+	var items []Item
+	for _, segment := range segments {
+		_, err = ReadSegment(segment, func(item Item) error {
+			items = append(items, item)
+			return nil
+		})
+		assert.Nil(t, err)
+	}
+	if assert.Equal(t, 2, len(items)) {
+		assert.Equal(t, []interface{}{"set", "hello", string(binaryValue)}, items[0].Args)
+		assert.True(t, items[0].Timestamp > 0)
+		assert.True(t, items[1].Transaction)
+		assert.Equal(t, [][]interface{}{{"set", "binary", string(binaryValue)}, {"set", "float", "1.5", "px", "60000"}},
+			items[1].Pipeline)
+	}
+
+	BatchReplay(context.Background(), map[string]redis.UniversalClient{"dc2": client}, map[string]*WAL{"dc2": wal},
+		nil)
+	for key, value := range map[string]string{"hello": string(binaryValue), "binary": string(binaryValue),
+		"float": "1.5"} {
+		res, _ := redisMock.GetMockRedis().Get(key)
+		assert.Equal(t, value, res)
+	}
+}
+
+func TestDecodeItem_JSON(t *testing.T) {
+	item, err := decodeItem([]byte(`{"Args":["incrby","counter",9007199254740993],"Timestamp":1}`))
+	assert.Nil(t, err)
+	assert.Equal(t, []interface{}{"incrby", "counter", "9007199254740993"}, item.Args)
+	_, err = decodeItem([]byte{recordFormatRESP})
+	assert.NotNil(t, err)
+}
+
+func TestOpenWAL_Shared(t *testing.T) {
+	dir := t.TempDir()
+	replaced, err := OpenWAL(dir, WALOptions{SyncPolicy: SyncPolicyAlways})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the strategy rebuilt by a reload opens the same directory while the replaced one is draining
+	reloaded, err := OpenWAL(dir+string(os.PathSeparator), WALOptions{SyncPolicy: SyncPolicyAlways})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.True(t, replaced == reloaded)
+	assert.Nil(t, replaced.Append(Item{Args: []interface{}{"set", "key1", "value"}}))
+	assert.Nil(t, reloaded.Append(Item{Args: []interface{}{"set", "key2", "value"}}))
+
+	// closed by the replaced strategy, the WAL is still open for the reloaded one
+	assert.Nil(t, replaced.Close())
+	assert.Nil(t, reloaded.Append(Item{Args: []interface{}{"set", "key3", "value"}}))
+	segments, err := reloaded.Seal()
+	assert.Nil(t, err)
+	assert.Equal(t, [][]interface{}{{"set", "key1", "value"}, {"set", "key2", "value"}, {"set", "key3", "value"}},
+		readItems(t, segments))
+	assert.Nil(t, reloaded.Close())
+	assert.NotNil(t, reloaded.Append(Item{Args: []interface{}{"set", "key4", "value"}}))
+}
+
+func TestMigrateFiles(t *testing.T) {
+	dir := t.TempDir()
+	legacyFiles := map[string]string{
+		"dc2-1700000000000-1.dat": "{\"Args\":[\"set\",\"key2\",\"value\"]}\r\n",
+		"dc2-1700000000000-0.dat": "{\"Args\":[\"set\",\"key1\",\"value\"]}\r\nnot json\r\n" +
+			"{\"Args\":[\"incrby\",\"counter\",9007199254740993]}\r\n",
+		"dc1-1700000000000-0.dat": "{\"Args\":[\"set\",\"key3\",\"value\"]}\r\n",
+	}
+	for name, content := range legacyFiles {
+		assert.Nil(t, os.WriteFile(filepath.Join(dir, name), []byte(content), CacheFilePerm))
+	}
+	fileNames := LegacyFiles(dir, "dc2")
+	assert.Equal(t, []string{filepath.Join(dir, "dc2-1700000000000-0.dat"), filepath.Join(dir, "dc2-1700000000000-1.dat")},
+		fileNames)
+	wal, err := OpenWAL(filepath.Join(dir, "dc2"), WALOptions{SyncPolicy: SyncPolicyAlways})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer wal.Close()
+	assert.Nil(t, MigrateFiles(fileNames, wal))
+	assert.Equal(t, 0, len(LegacyFiles(dir, "dc2")))
+	assert.Equal(t, 1, len(LegacyFiles(dir, "dc1")))
+
+	lag, err := wal.Lag()
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1700000000000), lag.OldestTimestamp.UnixMilli())
+	segments, err := wal.Seal()
+	assert.Nil(t, err)
+	assert.Equal(t, [][]interface{}{{"set", "key1", "value"}, {"incrby", "counter", "9007199254740993"},
+		{"set", "key2", "value"}}, readItems(t, segments))
+}
+
+// startLoadingServer start a server which answers every command with LOADING, like a redis server loading its
+// dataset after restart.
+func startLoadingServer(t *testing.T) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				reader := bufio.NewReader(conn)
+				for {
+					line, err := reader.ReadString('\n')
+					if err != nil {
+						return
+					}
+					// the bulk strings of the command array are skipped, every array is answered once
+					if strings.HasPrefix(line, "*") {
+						if _, err = conn.Write([]byte("-LOADING Redis is loading the dataset in memory\r\n")); err != nil {
+							return
+						}
+					}
+				}
+			}()
+		}
+	}()
+	return listener.Addr().String()
+}
+
+func TestBatchReplay_Transient(t *testing.T) {
+	loading := redis.NewClient(&redis.Options{Addr: startLoadingServer(t), MaxRetries: -1})
+	defer loading.Close()
+	wal, err := OpenWAL(t.TempDir(), WALOptions{SyncPolicy: SyncPolicyAlways})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer wal.Close()
+	assert.Nil(t, wal.Append(Item{Args: []interface{}{"set", "key", "value"}}))
+
+	// the record is kept while the target is loading
+	BatchReplay(context.Background(), map[string]redis.UniversalClient{"dc2": loading}, map[string]*WAL{"dc2": wal},
+		nil)
+	lag, err := wal.Lag()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, lag.PendingSegments)
+
+	redisMock := &mock.RedisMock{}
+	if err = redisMock.StartMockRedis(); err != nil {
+		t.Fatal(err)
+	}
+	defer redisMock.StopMockRedis()
+	client := redis.NewClient(&redis.Options{Addr: redisMock.Addr})
+	defer client.Close()
+	BatchReplay(context.Background(), map[string]redis.UniversalClient{"dc2": client}, map[string]*WAL{"dc2": wal},
+		nil)
+	res, _ := redisMock.GetMockRedis().Get("key")
+	assert.Equal(t, "value", res)
+
+	assert.True(t, IsRejected(errors.New("WRONGTYPE Operation against a key holding the wrong kind of value")))
+	assert.True(t, IsRejected(errors.New("BUSYKEY Target key name already exists.")))
+	assert.False(t, IsRejected(errors.New("READONLY You can't write against a read only replica.")))
+	assert.False(t, IsRejected(errors.New("OOM command not allowed when used memory > 'maxmemory'.")))
+}
@@ -0,0 +1,130 @@
+/*
+ * Copyright (c) Huawei Technologies Co., Ltd. 2021.
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use
+ * this file except in compliance with the License.  You may obtain a copy of the
+ * License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package redis
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/huaweicloud/devcloud-go/redis/config"
+	"github.com/huaweicloud/devcloud-go/redis/strategy"
+)
+
+type healthEventRecorder struct {
+	mutex  sync.Mutex
+	events []strategy.HealthEvent
+}
+
+func (r *healthEventRecorder) onEvent(event strategy.HealthEvent) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.events = append(r.events, event)
+}
+
+func (r *healthEventRecorder) has(eventType strategy.HealthEventType, server, from, to string) bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	for _, event := range r.events {
+		if event.Type == eventType && event.Server == server && event.From == from && event.To == to {
+			return true
+		}
+	}
+	return false
+}
+
+func healthCheckConfiguration(routeAlgorithm, addr1, addr2 string) *config.Configuration {
+	configuration := doubleWriteConfiguration(routeAlgorithm, addr1, addr2)
+	configuration.Active = "dc1"
+	configuration.RedisConfig.HealthCheck = &config.HealthCheckConfiguration{
+		Enable:           true,
+		IntervalMillis:   50,
+		TimeoutMillis:    100,
+		FailureThreshold: 2,
+		SuccessThreshold: 2,
+	}
+	return configuration
+}
+
+func TestDevsporeClient_HealthCheckSwitchActive(t *testing.T) {
+	redisMock1, redisMock2 := startDoubleWriteMocks(t)
+	client := NewDevsporeClient(healthCheckConfiguration(strategy.SingleReadWriteMode, redisMock1.Addr, redisMock2.Addr))
+	defer client.Close()
+	recorder := &healthEventRecorder{}
+	client.HealthChecker().AddListener(recorder.onEvent)
+	ctx := context.Background()
+
+	// dc1 is down, switch active to dc2
+	redisMock1.StopMockRedis()
+	assert.Eventually(t, func() bool {
+		return client.configuration.Snapshot().Active == "dc2"
+	}, 5*time.Second, 20*time.Millisecond)
+	assert.True(t, recorder.has(strategy.HealthEventServerDown, "dc1", "", ""))
+	assert.True(t, recorder.has(strategy.HealthEventActiveSwitched, "", "dc1", "dc2"))
+	assert.Nil(t, client.Set(ctx, "key", "dc2", 0).Err())
+	res, _ := redisMock2.GetMockRedis().Get("key")
+	assert.Equal(t, "dc2", res)
+
+	// dc1 recovers, switch active back to dc1
+	if err := redisMock1.StartMockRedis(); err != nil {
+		t.Fatal(err)
+	}
+	assert.Eventually(t, func() bool {
+		return client.configuration.Snapshot().Active == "dc1"
+	}, 5*time.Second, 20*time.Millisecond)
+	assert.True(t, recorder.has(strategy.HealthEventServerUp, "dc1", "", ""))
+	assert.True(t, recorder.has(strategy.HealthEventActiveSwitched, "", "dc2", "dc1"))
+	assert.Eventually(t, func() bool {
+		_ = client.Set(ctx, "key", "dc1", 0)
+		res, _ := redisMock1.GetMockRedis().Get("key")
+		return res == "dc1"
+	}, 5*time.Second, 20*time.Millisecond)
+}
+
+func TestDevsporeClient_HealthCheckSwitchNearest(t *testing.T) {
+	redisMock1, redisMock2 := startDoubleWriteMocks(t)
+	client := NewDevsporeClient(healthCheckConfiguration(strategy.LocalReadDoubleWriteMode, redisMock1.Addr,
+		redisMock2.Addr))
+	defer client.Close()
+	recorder := &healthEventRecorder{}
+	client.HealthChecker().AddListener(recorder.onEvent)
+	ctx := context.Background()
+
+	redisMock1.StopMockRedis()
+	assert.Eventually(t, func() bool {
+		return client.configuration.Snapshot().Nearest == "dc2"
+	}, 5*time.Second, 20*time.Millisecond)
+	assert.True(t, recorder.has(strategy.HealthEventNearestSwitched, "", "dc1", "dc2"))
+	assert.Equal(t, "dc1", client.configuration.Snapshot().Active)
+	_ = redisMock2.GetMockRedis().Set("read_key", "dc2")
+	assert.Equal(t, "dc2", client.Get(ctx, "read_key").Val())
+}
+
+func TestDevsporeClient_HealthCheckUnknownNearest(t *testing.T) {
+	redisMock1, redisMock2 := startDoubleWriteMocks(t)
+	configuration := healthCheckConfiguration(strategy.LocalReadSingleWriteMode, redisMock1.Addr, redisMock2.Addr)
+	configuration.RedisConfig.Nearest = ""
+	assert.NotNil(t, validateConfiguration(configuration))
+
+	configuration.RedisConfig.Nearest = "dc3"
+	client := NewDevsporeClient(configuration)
+	defer client.Close()
+	assert.Eventually(t, func() bool {
+		return client.configuration.Snapshot().Nearest == "dc1"
+	}, 5*time.Second, 20*time.Millisecond)
+}
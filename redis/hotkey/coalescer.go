@@ -0,0 +1,191 @@
+/*
+ * Copyright (c) Huawei Technologies Co., Ltd. 2021.
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use
+ * this file except in compliance with the License.  You may obtain a copy of the
+ * License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+// Package hotkey mitigates and reports the hot keys of the servers: the identical reads sent concurrently are
+// coalesced, and the keys of the commands are counted in a sliding window to report the top-N keys.
+package hotkey
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/huaweicloud/devcloud-go/redis/config"
+	"github.com/huaweicloud/devcloud-go/redis/strategy"
+)
+
+// ErrCoalesced is returned by the Process of the client when the read shared the reply of another read, the
+// reply and its error are set to the command.
+var ErrCoalesced = errors.New("redis: read coalesced")
+
+// Coalescer executes the identical reads sent to a server concurrently once, the later ones wait for the first
+// and share its reply, so the replies of them must not be modified. Pipelines and transactions are not coalesced.
+type Coalescer struct {
+	isRead func(args []interface{}) bool
+	mutex  sync.Mutex
+	groups map[string]*group
+}
+
+// group is the reads in flight of a server, by the command type and the args.
+type group struct {
+	coalesced uint64
+	mutex     sync.Mutex
+	calls     map[string]*call
+}
+
+type call struct {
+	key  string
+	cmd  redis.Cmder
+	done chan struct{}
+}
+
+// NewCoalescer create a Coalescer, nil if read coalescing is not enabled; isRead classify the commands with the
+// command name as the first arg.
+func NewCoalescer(cfg *config.ReadCoalescingConfiguration, isRead func(args []interface{}) bool) *Coalescer {
+	if cfg == nil || !cfg.Enable {
+		return nil
+	}
+	return &Coalescer{isRead: isRead, groups: make(map[string]*group)}
+}
+
+// Hook returns the hook of the client of the server, the reloaded clients of a server share the reads in flight.
+func (c *Coalescer) Hook(serverName string) redis.Hook {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	g, ok := c.groups[serverName]
+	if !ok {
+		g = &group{calls: make(map[string]*call)}
+		c.groups[serverName] = g
+	}
+	return &coalesceHook{group: g, isRead: c.isRead}
+}
+
+// Coalesced returns the reads which shared the reply of another read, of every server.
+func (c *Coalescer) Coalesced() map[string]uint64 {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	coalesced := make(map[string]uint64, len(c.groups))
+	for name, g := range c.groups {
+		coalesced[name] = atomic.LoadUint64(&g.coalesced)
+	}
+	return coalesced
+}
+
+// coalescedKey marks the context of the read, it is the leader or a follower of the call.
+type coalescedKey struct{}
+
+type coalesced struct {
+	call   *call
+	cmd    redis.Cmder
+	leader bool
+}
+
+type coalesceHook struct {
+	group  *group
+	isRead func(args []interface{}) bool
+}
+
+func (h *coalesceHook) BeforeProcess(ctx context.Context, cmd redis.Cmder) (context.Context, error) {
+	// the reads for read-your-writes must not share the reply of a read sent before the write
+	if !settable(cmd) || !h.isRead(cmd.Args()) ||
+		strategy.RouteHintFrom(ctx).ReadPreference == strategy.ReadPreferenceMaster {
+		return ctx, nil
+	}
+	key := callKey(cmd)
+	h.group.mutex.Lock()
+	if leader, ok := h.group.calls[key]; ok {
+		h.group.mutex.Unlock()
+		select {
+		case <-leader.done:
+		case <-ctx.Done():
+			return ctx, ctx.Err()
+		}
+		// the reply of a canceled leader is not shared, the read is executed itself
+		if err := leader.cmd.Err(); errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+			return ctx, nil
+		}
+		atomic.AddUint64(&h.group.coalesced, 1)
+		return context.WithValue(ctx, coalescedKey{}, &coalesced{call: leader, cmd: cmd}), ErrCoalesced
+	}
+	leader := &call{key: key, cmd: cmd, done: make(chan struct{})}
+	h.group.calls[key] = leader
+	h.group.mutex.Unlock()
+	return context.WithValue(ctx, coalescedKey{}, &coalesced{call: leader, cmd: cmd, leader: true}), nil
+}
+
+func (h *coalesceHook) AfterProcess(ctx context.Context, cmd redis.Cmder) error {
+	marked, ok := ctx.Value(coalescedKey{}).(*coalesced)
+	if !ok || marked.cmd != cmd {
+		return nil
+	}
+	if !marked.leader {
+		setVal(cmd, marked.call.cmd)
+		cmd.SetErr(marked.call.cmd.Err())
+		return nil
+	}
+	h.group.mutex.Lock()
+	if h.group.calls[marked.call.key] == marked.call {
+		delete(h.group.calls, marked.call.key)
+	}
+	h.group.mutex.Unlock()
+	close(marked.call.done)
+	return nil
+}
+
+func (h *coalesceHook) BeforeProcessPipeline(ctx context.Context, cmds []redis.Cmder) (context.Context, error) {
+	return ctx, nil
+}
+
+func (h *coalesceHook) AfterProcessPipeline(ctx context.Context, cmds []redis.Cmder) error {
+	return nil
+}
+
+// callKey is the command type and the args, the reply of a read is shared by the commands of the same type only.
+func callKey(cmd redis.Cmder) string {
+	var builder strings.Builder
+	builder.WriteString(reflect.TypeOf(cmd).String())
+	for _, arg := range cmd.Args() {
+		builder.WriteByte(0)
+		builder.WriteString(fmt.Sprint(arg))
+	}
+	return builder.String()
+}
+
+// settableTypes whether the reply of the command type can be copied by its Val and SetVal.
+var settableTypes sync.Map // reflect.Type -> bool
+
+func settable(cmd redis.Cmder) bool {
+	cmdType := reflect.TypeOf(cmd)
+	if ok, loaded := settableTypes.Load(cmdType); loaded {
+		return ok.(bool)
+	}
+	val, hasVal := cmdType.MethodByName("Val")
+	setVal, hasSetVal := cmdType.MethodByName("SetVal")
+	ok := hasVal && hasSetVal && val.Type.NumOut() == setVal.Type.NumIn()-1
+	for i := 0; ok && i < val.Type.NumOut(); i++ {
+		ok = val.Type.Out(i).AssignableTo(setVal.Type.In(i + 1))
+	}
+	settableTypes.Store(cmdType, ok)
+	return ok
+}
+
+func setVal(cmd, from redis.Cmder) {
+	values := reflect.ValueOf(from).MethodByName("Val").Call(nil)
+	reflect.ValueOf(cmd).MethodByName("SetVal").Call(values)
+}
@@ -0,0 +1,210 @@
+/*
+ * Copyright (c) Huawei Technologies Co., Ltd. 2021.
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use
+ * this file except in compliance with the License.  You may obtain a copy of the
+ * License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package hotkey
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/huaweicloud/devcloud-go/redis/config"
+	"github.com/huaweicloud/devcloud-go/redis/strategy"
+)
+
+const (
+	defaultWindowMillis = 10000
+	defaultBuckets      = 10
+	defaultTopN         = 10
+	defaultMaxKeys      = 10000
+)
+
+// commands whose args are not keys, they are not counted
+var keylessCommandMap = map[string]struct{}{
+	"auth": {}, "hello": {}, "ping": {}, "echo": {}, "info": {}, "client": {}, "config": {}, "cluster": {},
+	"command": {}, "slowlog": {}, "latency": {}, "memory": {}, "acl": {}, "publish": {}, "spublish": {},
+	"pubsub": {}, "multi": {}, "exec": {}, "discard": {}, "wait": {}, "debug": {}, "scan": {}, "keys": {},
+}
+
+// KeyCount is the commands of a key in the window.
+type KeyCount struct {
+	Key   string
+	Count uint64
+}
+
+// Detector counts the keys of the commands of every server in a sliding window, which slides by a bucket.
+type Detector struct {
+	width   time.Duration // of a bucket
+	buckets int
+	topN    int
+	maxKeys int
+	mutex   sync.Mutex
+	servers map[string]*counter
+}
+
+// counter is the buckets of a server, a bucket is reused when its epoch passed.
+type counter struct {
+	mutex   sync.Mutex
+	buckets []bucket
+}
+
+type bucket struct {
+	epoch  int64
+	counts map[string]uint64
+}
+
+// NewDetector create a Detector, nil if hot key detection is not enabled.
+func NewDetector(cfg *config.HotKeyConfiguration) *Detector {
+	if cfg == nil || !cfg.Enable {
+		return nil
+	}
+	windowMillis, buckets, topN, maxKeys := cfg.WindowMillis, cfg.Buckets, cfg.TopN, cfg.MaxKeys
+	if windowMillis <= 0 {
+		windowMillis = defaultWindowMillis
+	}
+	if buckets <= 0 {
+		buckets = defaultBuckets
+	}
+	if topN <= 0 {
+		topN = defaultTopN
+	}
+	if maxKeys <= 0 {
+		maxKeys = defaultMaxKeys
+	}
+	width := time.Duration(windowMillis) * time.Millisecond / time.Duration(buckets)
+	if width <= 0 {
+		width = time.Millisecond
+	}
+	return &Detector{width: width, buckets: buckets, topN: topN, maxKeys: maxKeys, servers: make(map[string]*counter)}
+}
+
+// Hook returns the hook of the client of the server, the reloaded clients of a server share the counts.
+func (d *Detector) Hook(serverName string) redis.Hook {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	c, ok := d.servers[serverName]
+	if !ok {
+		c = &counter{buckets: make([]bucket, d.buckets)}
+		d.servers[serverName] = c
+	}
+	return &detectHook{detector: d, counter: c}
+}
+
+// TopN returns the most used keys of every server in the window, in descending order of the counts.
+func (d *Detector) TopN() map[string][]KeyCount {
+	d.mutex.Lock()
+	counters := make(map[string]*counter, len(d.servers))
+	for name, c := range d.servers {
+		counters[name] = c
+	}
+	d.mutex.Unlock()
+	epoch := d.epoch(time.Now())
+	top := make(map[string][]KeyCount, len(counters))
+	for name, c := range counters {
+		top[name] = c.top(epoch, d.topN)
+	}
+	return top
+}
+
+func (d *Detector) epoch(now time.Time) int64 {
+	return now.UnixNano() / int64(d.width)
+}
+
+func (c *counter) add(epoch int64, maxKeys int, keys []string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	b := &c.buckets[int(epoch%int64(len(c.buckets)))]
+	if b.epoch != epoch || b.counts == nil {
+		b.epoch = epoch
+		b.counts = make(map[string]uint64)
+	}
+	for _, key := range keys {
+		if _, ok := b.counts[key]; ok || len(b.counts) < maxKeys {
+			b.counts[key]++
+		}
+	}
+}
+
+func (c *counter) top(epoch int64, n int) []KeyCount {
+	counts := make(map[string]uint64)
+	c.mutex.Lock()
+	for _, b := range c.buckets {
+		if b.epoch > epoch-int64(len(c.buckets)) && b.epoch <= epoch {
+			for key, count := range b.counts {
+				counts[key] += count
+			}
+		}
+	}
+	c.mutex.Unlock()
+	top := make([]KeyCount, 0, len(counts))
+	for key, count := range counts {
+		top = append(top, KeyCount{Key: key, Count: count})
+	}
+	sort.Slice(top, func(i, j int) bool {
+		if top[i].Count != top[j].Count {
+			return top[i].Count > top[j].Count
+		}
+		return top[i].Key < top[j].Key
+	})
+	if len(top) > n {
+		top = top[:n]
+	}
+	return top
+}
+
+// detectHook counts the keys before the commands executed, include the ones failed or coalesced.
+type detectHook struct {
+	detector *Detector
+	counter  *counter
+}
+
+func (h *detectHook) BeforeProcess(ctx context.Context, cmd redis.Cmder) (context.Context, error) {
+	if keys := commandKeys(cmd); len(keys) > 0 {
+		h.counter.add(h.detector.epoch(time.Now()), h.detector.maxKeys, keys)
+	}
+	return ctx, nil
+}
+
+func (h *detectHook) AfterProcess(ctx context.Context, cmd redis.Cmder) error {
+	return nil
+}
+
+func (h *detectHook) BeforeProcessPipeline(ctx context.Context, cmds []redis.Cmder) (context.Context, error) {
+	var keys []string
+	for _, cmd := range cmds {
+		keys = append(keys, commandKeys(cmd)...)
+	}
+	if len(keys) > 0 {
+		h.counter.add(h.detector.epoch(time.Now()), h.detector.maxKeys, keys)
+	}
+	return ctx, nil
+}
+
+func (h *detectHook) AfterProcessPipeline(ctx context.Context, cmds []redis.Cmder) error {
+	return nil
+}
+
+func commandKeys(cmd redis.Cmder) []string {
+	if _, ok := keylessCommandMap[strings.ToLower(cmd.Name())]; ok {
+		return nil
+	}
+	keys, global := strategy.CommandKeys(cmd.Args())
+	if global {
+		return nil
+	}
+	return keys
+}
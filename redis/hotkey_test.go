@@ -0,0 +1,131 @@
+/*
+ * Copyright (c) Huawei Technologies Co., Ltd. 2021.
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use
+ * this file except in compliance with the License.  You may obtain a copy of the
+ * License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package redis
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	goredis "github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/huaweicloud/devcloud-go/redis/config"
+	"github.com/huaweicloud/devcloud-go/redis/hotkey"
+	"github.com/huaweicloud/devcloud-go/redis/strategy"
+)
+
+// delayHook delays the commands, so that the concurrent reads overlap.
+type delayHook struct {
+	delay time.Duration
+}
+
+func (h delayHook) BeforeProcess(ctx context.Context, cmd goredis.Cmder) (context.Context, error) {
+	time.Sleep(h.delay)
+	return ctx, nil
+}
+
+func (h delayHook) AfterProcess(ctx context.Context, cmd goredis.Cmder) error {
+	return nil
+}
+
+func (h delayHook) BeforeProcessPipeline(ctx context.Context, cmds []goredis.Cmder) (context.Context, error) {
+	return ctx, nil
+}
+
+func (h delayHook) AfterProcessPipeline(ctx context.Context, cmds []goredis.Cmder) error {
+	return nil
+}
+
+func TestDevsporeClient_ReadCoalescing(t *testing.T) {
+	dc1, dc2 := startDoubleWriteMocks(t)
+	configuration := doubleWriteConfiguration(strategy.SingleReadWriteMode, dc1.Addr, dc2.Addr)
+	configuration.RedisConfig.ReadCoalescing = &config.ReadCoalescingConfiguration{Enable: true}
+	client := NewDevsporeClient(configuration)
+	defer client.Close()
+	// added after the coalescer, only the leader is delayed
+	client.strategy.AddClientHook(func(serverName string) goredis.Hook {
+		return delayHook{delay: 300 * time.Millisecond}
+	})
+	ctx := context.Background()
+	m := dc2.GetMockRedis()
+	_ = m.Set("hot", "value")
+	m.HSet("hash", "field", "value")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			assert.Equal(t, "value", client.Get(ctx, "hot").Val())
+		}()
+		go func() {
+			defer wg.Done()
+			cmd := goredis.NewStringStringMapCmd(ctx, "hgetall", "hash")
+			assert.Nil(t, client.Process(ctx, cmd))
+			assert.Equal(t, map[string]string{"field": "value"}, cmd.Val())
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, uint64(18), client.CoalescedReads()["dc2"])
+
+	// nil replies are shared, writes are never coalesced
+	wg.Add(4)
+	for i := 0; i < 2; i++ {
+		go func() {
+			defer wg.Done()
+			assert.Equal(t, goredis.Nil, client.Get(ctx, "missing").Err())
+		}()
+		go func() {
+			defer wg.Done()
+			assert.Nil(t, client.Incr(ctx, "counter").Err())
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, uint64(19), client.CoalescedReads()["dc2"])
+	counter, _ := m.Get("counter")
+	assert.Equal(t, "2", counter)
+}
+
+func TestDevsporeClient_HotKeys(t *testing.T) {
+	dc1, dc2 := startDoubleWriteMocks(t)
+	configuration := doubleWriteConfiguration(strategy.LocalReadSingleWriteMode, dc1.Addr, dc2.Addr)
+	configuration.RedisConfig.HotKey = &config.HotKeyConfiguration{Enable: true, WindowMillis: 400, Buckets: 4,
+		TopN: 2}
+	client := NewDevsporeClient(configuration)
+	defer client.Close()
+	ctx := context.Background()
+
+	for i := 0; i < 5; i++ {
+		client.Get(ctx, "k1")
+	}
+	for i := 0; i < 3; i++ {
+		client.Get(ctx, "k2")
+	}
+	client.MGet(ctx, "k2", "k3")
+	client.Ping(ctx)
+	// writes to the active server
+	assert.Nil(t, client.Set(ctx, "k1", "v", 0).Err())
+
+	hotKeys := client.HotKeys()
+	assert.Equal(t, []hotkey.KeyCount{{Key: "k1", Count: 5}, {Key: "k2", Count: 4}}, hotKeys["dc1"])
+	assert.Equal(t, []hotkey.KeyCount{{Key: "k1", Count: 1}}, hotKeys["dc2"])
+
+	// the counts slide out of the window
+	assert.Eventually(t, func() bool {
+		return len(client.HotKeys()["dc1"]) == 0
+	}, 5*time.Second, 50*time.Millisecond)
+}
@@ -0,0 +1,169 @@
+/*
+ * Copyright (c) Huawei Technologies Co., Ltd. 2021.
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use
+ * this file except in compliance with the License.  You may obtain a copy of the
+ * License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+// Package instrument observes the commands executed on the redis servers, every command reports its name, the
+// server, the route type, the latency, the error and the retries to the enabled instrumentations.
+package instrument
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	goredis "github.com/go-redis/redis/v8"
+	redigo "github.com/gomodule/redigo/redis"
+	"github.com/huaweicloud/devcloud-go/redis/config"
+)
+
+// route types of the commands
+const (
+	RouteTypeRead   = "read"
+	RouteTypeWrite  = "write"
+	RouteTypeMirror = "mirror" // a write mirrored to another server by double-write
+)
+
+const (
+	ProviderPrometheus    = "prometheus"
+	ProviderOpenTelemetry = "opentelemetry"
+)
+
+// Event of a command, a pipeline or a transaction is one event whose Command is pipeline or multi.
+type Event struct {
+	Command   string
+	Server    string
+	RouteType string
+	// Latency, Err and Retries are set after the command is executed
+	Latency time.Duration
+	Err     error
+	Retries int
+}
+
+// Instrumentation observes the commands, it must be safe for concurrent use.
+type Instrumentation interface {
+	// Before is called before the command is executed, the returned context is passed to After.
+	Before(ctx context.Context, event *Event) context.Context
+	// After is called after the command is executed.
+	After(ctx context.Context, event *Event)
+}
+
+// Factory create the instrumentation from the configuration.
+type Factory func(configuration *config.InstrumentationConfiguration) (Instrumentation, error)
+
+var (
+	factoriesMutex sync.RWMutex
+	factories      = map[string]Factory{
+		ProviderPrometheus:    newPrometheusFromConfiguration,
+		ProviderOpenTelemetry: newOpenTelemetryFromConfiguration,
+	}
+)
+
+// Register the factory of the instrumentation, which is enabled by adding the name to instrumentation.providers.
+func Register(name string, factory Factory) {
+	factoriesMutex.Lock()
+	defer factoriesMutex.Unlock()
+	factories[name] = factory
+}
+
+// New create the instrumentation of all providers of the configuration, nil if instrumentation is not enabled.
+func New(configuration *config.InstrumentationConfiguration) Instrumentation {
+	if configuration == nil || !configuration.Enable {
+		return nil
+	}
+	factoriesMutex.RLock()
+	defer factoriesMutex.RUnlock()
+	var instrumentations multiInstrumentation
+	for _, name := range configuration.Providers {
+		factory, ok := factories[name]
+		if !ok {
+			log.Printf("ERROR: instrumentation provider '%s' is not registered", name)
+			continue
+		}
+		instrumentation, err := factory(configuration)
+		if err != nil {
+			log.Printf("ERROR: create instrumentation '%s' failed, %v", name, err)
+			continue
+		}
+		instrumentations = append(instrumentations, instrumentation)
+	}
+	switch len(instrumentations) {
+	case 0:
+		return nil
+	case 1:
+		return instrumentations[0]
+	}
+	return instrumentations
+}
+
+type multiInstrumentation []Instrumentation
+
+func (m multiInstrumentation) Before(ctx context.Context, event *Event) context.Context {
+	for _, instrumentation := range m {
+		ctx = instrumentation.Before(ctx, event)
+	}
+	return ctx
+}
+
+func (m multiInstrumentation) After(ctx context.Context, event *Event) {
+	for i := len(m) - 1; i >= 0; i-- {
+		m[i].After(ctx, event)
+	}
+}
+
+// Observe the execution of fn as the event, fn is executed directly if instrumentation is nil.
+func Observe(ctx context.Context, instrumentation Instrumentation, event *Event, fn func(ctx context.Context) error) error {
+	if instrumentation == nil {
+		return fn(ctx)
+	}
+	start := time.Now()
+	ctx = instrumentation.Before(ctx, event)
+	err := fn(ctx)
+	event.Latency = time.Since(start)
+	event.Err = err
+	event.Retries = Retries(ctx)
+	instrumentation.After(ctx, event)
+	return err
+}
+
+type routeTypeKey struct{}
+
+type retriesKey struct{}
+
+// WithRouteType set the route type of the commands executed with the context.
+func WithRouteType(ctx context.Context, routeType string) context.Context {
+	return context.WithValue(ctx, routeTypeKey{}, routeType)
+}
+
+// RouteType returns the route type set by WithRouteType, empty if it is not set.
+func RouteType(ctx context.Context) string {
+	routeType, _ := ctx.Value(routeTypeKey{}).(string)
+	return routeType
+}
+
+// WithRetries set the times the commands executed with the context have been retried.
+func WithRetries(ctx context.Context, retries int) context.Context {
+	return context.WithValue(ctx, retriesKey{}, retries)
+}
+
+// Retries returns the retries set by WithRetries.
+func Retries(ctx context.Context) int {
+	retries, _ := ctx.Value(retriesKey{}).(int)
+	return retries
+}
+
+// Failed whether the event is a failed command, a nil reply is not a failure.
+func (e *Event) Failed() bool {
+	return e.Err != nil && !errors.Is(e.Err, goredis.Nil) && !errors.Is(e.Err, redigo.ErrNil)
+}
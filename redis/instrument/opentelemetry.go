@@ -0,0 +1,69 @@
+/*
+ * Copyright (c) Huawei Technologies Co., Ltd. 2021.
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use
+ * this file except in compliance with the License.  You may obtain a copy of the
+ * License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package instrument
+
+import (
+	"context"
+
+	"github.com/huaweicloud/devcloud-go/redis/config"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const defaultTracerName = "github.com/huaweicloud/devcloud-go/redis"
+
+// OpenTelemetryInstrumentation create a client span of every command.
+type OpenTelemetryInstrumentation struct {
+	tracer trace.Tracer
+}
+
+// NewOpenTelemetryInstrumentation create the instrumentation with the tracer.
+func NewOpenTelemetryInstrumentation(tracer trace.Tracer) *OpenTelemetryInstrumentation {
+	return &OpenTelemetryInstrumentation{tracer: tracer}
+}
+
+// newOpenTelemetryFromConfiguration create the instrumentation with the tracer of the global tracer provider.
+func newOpenTelemetryFromConfiguration(configuration *config.InstrumentationConfiguration) (Instrumentation, error) {
+	tracerName := defaultTracerName
+	if configuration.OpenTelemetry != nil && configuration.OpenTelemetry.TracerName != "" {
+		tracerName = configuration.OpenTelemetry.TracerName
+	}
+	return NewOpenTelemetryInstrumentation(otel.Tracer(tracerName)), nil
+}
+
+func (o *OpenTelemetryInstrumentation) Before(ctx context.Context, event *Event) context.Context {
+	ctx, _ = o.tracer.Start(ctx, "redis "+event.Command, trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("db.system", "redis"),
+			attribute.String("db.operation", event.Command),
+			attribute.String("devspore.redis.server", event.Server),
+			attribute.String("devspore.redis.route", event.RouteType),
+		))
+	return ctx
+}
+
+func (o *OpenTelemetryInstrumentation) After(ctx context.Context, event *Event) {
+	span := trace.SpanFromContext(ctx)
+	if event.Retries > 0 {
+		span.SetAttributes(attribute.Int("devspore.redis.retries", event.Retries))
+	}
+	if event.Failed() {
+		span.RecordError(event.Err)
+		span.SetStatus(codes.Error, event.Err.Error())
+	}
+	span.End()
+}
@@ -0,0 +1,119 @@
+/*
+ * Copyright (c) Huawei Technologies Co., Ltd. 2021.
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use
+ * this file except in compliance with the License.  You may obtain a copy of the
+ * License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package instrument
+
+import (
+	"context"
+	"errors"
+
+	"github.com/huaweicloud/devcloud-go/redis/config"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const defaultNamespace = "devspore"
+
+// PrometheusInstrumentation collects the commands, latency, errors and retries by command, server and route type.
+type PrometheusInstrumentation struct {
+	commands *prometheus.CounterVec
+	errors   *prometheus.CounterVec
+	retries  *prometheus.CounterVec
+	latency  *prometheus.HistogramVec
+}
+
+// NewPrometheusInstrumentation create the collectors and register them to the registerer, the collectors which
+// are already registered, by another client, are shared.
+func NewPrometheusInstrumentation(registerer prometheus.Registerer, namespace string,
+	buckets []float64) (*PrometheusInstrumentation, error) {
+	if namespace == "" {
+		namespace = defaultNamespace
+	}
+	if len(buckets) == 0 {
+		buckets = prometheus.DefBuckets
+	}
+	labels := []string{"command", "server", "route"}
+	p := &PrometheusInstrumentation{
+		commands: prometheus.NewCounterVec(prometheus.CounterOpts{Namespace: namespace, Subsystem: "redis",
+			Name: "commands_total", Help: "Total number of redis commands."}, labels),
+		errors: prometheus.NewCounterVec(prometheus.CounterOpts{Namespace: namespace, Subsystem: "redis",
+			Name: "command_errors_total", Help: "Total number of failed redis commands."}, labels),
+		retries: prometheus.NewCounterVec(prometheus.CounterOpts{Namespace: namespace, Subsystem: "redis",
+			Name: "command_retries_total", Help: "Total number of retried redis commands."}, labels),
+		latency: prometheus.NewHistogramVec(prometheus.HistogramOpts{Namespace: namespace, Subsystem: "redis",
+			Name: "command_duration_seconds", Help: "Latency of redis commands.", Buckets: buckets}, labels),
+	}
+	var err error
+	if p.commands, err = registerCounter(registerer, p.commands); err != nil {
+		return nil, err
+	}
+	if p.errors, err = registerCounter(registerer, p.errors); err != nil {
+		return nil, err
+	}
+	if p.retries, err = registerCounter(registerer, p.retries); err != nil {
+		return nil, err
+	}
+	if err = registerer.Register(p.latency); err != nil {
+		var registered prometheus.AlreadyRegisteredError
+		if !errors.As(err, &registered) {
+			return nil, err
+		}
+		histogram, ok := registered.ExistingCollector.(*prometheus.HistogramVec)
+		if !ok {
+			return nil, err
+		}
+		p.latency = histogram
+	}
+	return p, nil
+}
+
+func registerCounter(registerer prometheus.Registerer, counter *prometheus.CounterVec) (*prometheus.CounterVec, error) {
+	err := registerer.Register(counter)
+	if err == nil {
+		return counter, nil
+	}
+	var registered prometheus.AlreadyRegisteredError
+	if !errors.As(err, &registered) {
+		return nil, err
+	}
+	existing, ok := registered.ExistingCollector.(*prometheus.CounterVec)
+	if !ok {
+		return nil, err
+	}
+	return existing, nil
+}
+
+func newPrometheusFromConfiguration(configuration *config.InstrumentationConfiguration) (Instrumentation, error) {
+	prometheusConfig := configuration.Prometheus
+	if prometheusConfig == nil {
+		prometheusConfig = &config.PrometheusConfiguration{}
+	}
+	return NewPrometheusInstrumentation(prometheus.DefaultRegisterer, prometheusConfig.Namespace,
+		prometheusConfig.Buckets)
+}
+
+func (p *PrometheusInstrumentation) Before(ctx context.Context, event *Event) context.Context {
+	return ctx
+}
+
+func (p *PrometheusInstrumentation) After(ctx context.Context, event *Event) {
+	labels := prometheus.Labels{"command": event.Command, "server": event.Server, "route": event.RouteType}
+	p.commands.With(labels).Inc()
+	p.latency.With(labels).Observe(event.Latency.Seconds())
+	if event.Failed() {
+		p.errors.With(labels).Inc()
+	}
+	if event.Retries > 0 {
+		p.retries.With(labels).Add(float64(event.Retries))
+	}
+}
@@ -0,0 +1,217 @@
+/*
+ * Copyright (c) Huawei Technologies Co., Ltd. 2021.
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use
+ * this file except in compliance with the License.  You may obtain a copy of the
+ * License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package redis
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	goredis "github.com/go-redis/redis/v8"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	"github.com/huaweicloud/devcloud-go/redis/config"
+	"github.com/huaweicloud/devcloud-go/redis/instrument"
+	"github.com/huaweicloud/devcloud-go/redis/strategy"
+)
+
+type eventRecorder struct {
+	mutex  sync.Mutex
+	events []instrument.Event
+}
+
+func (r *eventRecorder) Before(ctx context.Context, event *instrument.Event) context.Context {
+	return ctx
+}
+
+func (r *eventRecorder) After(ctx context.Context, event *instrument.Event) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.events = append(r.events, *event)
+}
+
+func (r *eventRecorder) find(command, server string) (instrument.Event, bool) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	for _, event := range r.events {
+		if event.Command == command && event.Server == server {
+			return event, true
+		}
+	}
+	return instrument.Event{}, false
+}
+
+// registerRecorder register a provider recording the events, and returns the configuration enabling it.
+func registerRecorder(name string) (*eventRecorder, *config.InstrumentationConfiguration) {
+	recorder := &eventRecorder{}
+	instrument.Register(name, func(*config.InstrumentationConfiguration) (instrument.Instrumentation, error) {
+		return recorder, nil
+	})
+	return recorder, &config.InstrumentationConfiguration{Enable: true, Providers: []string{name}}
+}
+
+func assertEvent(t *testing.T, recorder *eventRecorder, command, server, routeType string, failed bool) {
+	var event instrument.Event
+	assert.Eventually(t, func() bool {
+		var ok bool
+		event, ok = recorder.find(command, server)
+		return ok
+	}, 5*time.Second, 10*time.Millisecond, "no event of %s on %s", command, server)
+	assert.Equal(t, routeType, event.RouteType, command)
+	assert.Equal(t, failed, event.Failed(), command)
+	assert.True(t, event.Latency > 0, command)
+}
+
+func TestDevsporeClient_Instrumentation(t *testing.T) {
+	dc1, dc2 := startDoubleWriteMocks(t)
+	recorder, instrumentationConfig := registerRecorder("recorder-goredis")
+	configuration := doubleWriteConfiguration(strategy.SingleReadDoubleWriteMode, dc1.Addr, dc2.Addr)
+	configuration.RedisConfig.Instrumentation = instrumentationConfig
+	client := NewDevsporeClient(configuration)
+	defer client.Close()
+	ctx := context.Background()
+
+	client.Set(ctx, "key", "value", 0)
+	client.Get(ctx, "missing")
+	client.LPush(ctx, "list", "a")
+	client.Incr(ctx, "list")
+	pipeline := client.Pipeline()
+	pipeline.Get(ctx, "key")
+	_, _ = pipeline.Exec(ctx)
+	_, _ = client.TxPipelined(ctx, func(pipe goredis.Pipeliner) error {
+		pipe.Set(ctx, "tx", "1", 0)
+		return nil
+	})
+
+	assertEvent(t, recorder, "set", "dc2", instrument.RouteTypeWrite, false)
+	assertEvent(t, recorder, "get", "dc2", instrument.RouteTypeRead, false)
+	assertEvent(t, recorder, "incr", "dc2", instrument.RouteTypeWrite, true)
+	assertEvent(t, recorder, "pipeline", "dc2", instrument.RouteTypeRead, false)
+	assertEvent(t, recorder, "multi", "dc2", instrument.RouteTypeWrite, false)
+	assertEvent(t, recorder, "set", "dc1", instrument.RouteTypeMirror, false)
+}
+
+func TestDevsporeRedigoClient_Instrumentation(t *testing.T) {
+	dc1, dc2 := startDoubleWriteMocks(t)
+	recorder, instrumentationConfig := registerRecorder("recorder-redigo")
+	configuration := doubleWriteConfiguration(strategy.SingleReadDoubleWriteMode, dc1.Addr, dc2.Addr)
+	configuration.RedisConfig.Instrumentation = instrumentationConfig
+	client := NewDevsporeRedigoClient(configuration)
+	defer client.strategy.Close()
+
+	_, _ = client.Do("SET", "key", "value")
+	_, _ = client.Do("GET", "key")
+	_, _ = client.Do("LPUSH", "list", "a")
+	_, _ = client.Do("INCR", "list")
+	_, _ = client.Pipeline([][]string{{"GET", "key"}})
+	_, _ = client.Transactions([][]string{{"SET", "tx", "1"}})
+
+	assertEvent(t, recorder, "set", "dc2", instrument.RouteTypeWrite, false)
+	assertEvent(t, recorder, "get", "dc2", instrument.RouteTypeRead, false)
+	assertEvent(t, recorder, "incr", "dc2", instrument.RouteTypeWrite, true)
+	assertEvent(t, recorder, "pipeline", "dc2", instrument.RouteTypeRead, false)
+	assertEvent(t, recorder, "multi", "dc2", instrument.RouteTypeWrite, false)
+	assertEvent(t, recorder, "set", "dc1", instrument.RouteTypeMirror, false)
+}
+
+func TestPrometheusInstrumentation(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	instrumentation, err := instrument.NewPrometheusInstrumentation(registry, "test", nil)
+	assert.Nil(t, err)
+	// the collectors registered by another client are shared
+	shared, err := instrument.NewPrometheusInstrumentation(registry, "test", nil)
+	assert.Nil(t, err)
+
+	ctx := context.Background()
+	failure := assert.AnError
+	_ = instrument.Observe(ctx, instrumentation, &instrument.Event{Command: "get", Server: "dc1",
+		RouteType: instrument.RouteTypeRead}, func(ctx context.Context) error { return nil })
+	_ = instrument.Observe(instrument.WithRetries(ctx, 2), shared, &instrument.Event{Command: "get",
+		Server: "dc1", RouteType: instrument.RouteTypeRead}, func(ctx context.Context) error { return failure })
+
+	expected := `
+# HELP test_redis_commands_total Total number of redis commands.
+# TYPE test_redis_commands_total counter
+test_redis_commands_total{command="get",route="read",server="dc1"} 2
+# HELP test_redis_command_errors_total Total number of failed redis commands.
+# TYPE test_redis_command_errors_total counter
+test_redis_command_errors_total{command="get",route="read",server="dc1"} 1
+# HELP test_redis_command_retries_total Total number of retried redis commands.
+# TYPE test_redis_command_retries_total counter
+test_redis_command_retries_total{command="get",route="read",server="dc1"} 2
+`
+	assert.Nil(t, testutil.GatherAndCompare(registry, strings.NewReader(expected), "test_redis_commands_total",
+		"test_redis_command_errors_total", "test_redis_command_retries_total"))
+	count, err := testutil.GatherAndCount(registry, "test_redis_command_duration_seconds")
+	assert.Nil(t, err)
+	assert.Equal(t, 1, count)
+}
+
+func TestOpenTelemetryInstrumentation(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	instrumentation := instrument.NewOpenTelemetryInstrumentation(provider.Tracer("test"))
+	instrument.Register("otel-test", func(*config.InstrumentationConfiguration) (instrument.Instrumentation, error) {
+		return instrumentation, nil
+	})
+	redisMock, _ := startDoubleWriteMocks(t)
+	configuration := doubleWriteConfiguration(strategy.SingleReadWriteMode, redisMock.Addr, redisMock.Addr)
+	configuration.RedisConfig.Instrumentation = &config.InstrumentationConfiguration{Enable: true,
+		Providers: []string{"otel-test"}}
+	client := NewDevsporeClient(configuration)
+	defer client.Close()
+	ctx := context.Background()
+	client.LPush(ctx, "list", "a")
+	client.Incr(ctx, "list")
+
+	spans := exporter.GetSpans()
+	assert.Equal(t, 2, len(spans))
+	assert.Equal(t, "redis lpush", spans[0].Name)
+	assert.Equal(t, codes.Unset, spans[0].StatusCode)
+	assert.Equal(t, "redis incr", spans[1].Name)
+	assert.Equal(t, codes.Error, spans[1].StatusCode)
+}
+
+func TestInstrumentation_FromYaml(t *testing.T) {
+	configuration, err := config.LoadConfiguration("./resources/config_instrumentation.yaml")
+	assert.Nil(t, err)
+	instrumentationConfig := configuration.RedisConfig.Instrumentation
+	assert.True(t, instrumentationConfig.Enable)
+	assert.Equal(t, []string{instrument.ProviderPrometheus, instrument.ProviderOpenTelemetry},
+		instrumentationConfig.Providers)
+	assert.Equal(t, "yaml", instrumentationConfig.Prometheus.Namespace)
+	assert.NotNil(t, instrument.New(instrumentationConfig))
+	assert.Nil(t, instrument.New(&config.InstrumentationConfiguration{Providers: []string{"prometheus"}}))
+
+	// the collectors of the clients created from yaml are shared in the default registry
+	shared := instrument.New(instrumentationConfig)
+	assert.NotNil(t, shared)
+	_ = instrument.Observe(context.Background(), shared, &instrument.Event{Command: "get", Server: "dc1",
+		RouteType: instrument.RouteTypeRead}, func(ctx context.Context) error { return nil })
+	families, err := prometheus.DefaultGatherer.Gather()
+	assert.Nil(t, err)
+	names := make([]string, 0, len(families))
+	for _, family := range families {
+		names = append(names, family.GetName())
+	}
+	assert.Contains(t, names, "yaml_redis_command_duration_seconds")
+}
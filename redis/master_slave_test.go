@@ -0,0 +1,161 @@
+/*
+ * Copyright (c) Huawei Technologies Co., Ltd. 2021.
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use
+ * this file except in compliance with the License.  You may obtain a copy of the
+ * License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package redis
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	redigo "github.com/gomodule/redigo/redis"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/huaweicloud/devcloud-go/mock"
+	"github.com/huaweicloud/devcloud-go/redis/config"
+	"github.com/huaweicloud/devcloud-go/redis/strategy"
+)
+
+func masterSlaveConfiguration(master string, replicas string) *config.Configuration {
+	return &config.Configuration{
+		RouteAlgorithm: strategy.SingleReadWriteMode,
+		Active:         "dc1",
+		RedisConfig: &config.RedisConfiguration{
+			Nearest: "dc1",
+			Servers: map[string]*config.ServerConfiguration{
+				"dc1": {Hosts: master, Type: config.ServerTypeMasterSlave, Replicas: replicas,
+					ReplicaCheckIntervalMillis: 50, ConnectionPool: &config.ServerConnectionPoolConfiguration{
+						MaxTotal: 10, MaxIdle: 2}},
+			},
+		},
+	}
+}
+
+func startMasterSlaveMocks(t *testing.T) (*mock.RedisMock, *mock.RedisMock, *mock.RedisMock) {
+	master, replica1 := startDoubleWriteMocks(t)
+	replica2 := &mock.RedisMock{}
+	if err := replica2.StartMockRedis(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(replica2.StopMockRedis)
+	_ = master.GetMockRedis().Set("key", "master")
+	_ = replica1.GetMockRedis().Set("key", "replica1")
+	_ = replica2.GetMockRedis().Set("key", "replica2")
+	return master, replica1, replica2
+}
+
+func TestReplicaBalancer(t *testing.T) {
+	var mutex sync.Mutex
+	down := map[string]bool{}
+	probe := func(addr string) error {
+		mutex.Lock()
+		defer mutex.Unlock()
+		if down[addr] {
+			return errors.New("connection refused")
+		}
+		return nil
+	}
+	balancer := strategy.NewReplicaBalancer(config.ReadFromRoundRobin, 10*time.Millisecond,
+		strategy.StaticReplicas([]string{"r1", "r2"}), probe)
+	defer balancer.Close()
+	first, _ := balancer.Pick()
+	second, _ := balancer.Pick()
+	assert.ElementsMatch(t, []string{"r1", "r2"}, []string{first, second})
+
+	mutex.Lock()
+	down["r1"] = true
+	mutex.Unlock()
+	assert.Eventually(t, func() bool {
+		addr, ok := balancer.Pick()
+		next, _ := balancer.Pick()
+		return ok && addr == "r2" && next == "r2"
+	}, 5*time.Second, 10*time.Millisecond)
+
+	mutex.Lock()
+	down["r2"] = true
+	mutex.Unlock()
+	assert.Eventually(t, func() bool {
+		_, ok := balancer.Pick()
+		return !ok
+	}, 5*time.Second, 10*time.Millisecond)
+
+	mutex.Lock()
+	down["r1"] = false
+	mutex.Unlock()
+	assert.Eventually(t, func() bool {
+		addr, ok := balancer.Pick()
+		return ok && addr == "r1"
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestDevsporeClient_MasterSlave(t *testing.T) {
+	master, replica1, replica2 := startMasterSlaveMocks(t)
+	client := NewDevsporeClient(masterSlaveConfiguration(master.Addr, replica1.Addr+","+replica2.Addr))
+	defer client.Close()
+	ctx := context.Background()
+
+	// reads are balanced across the replicas by round-robin
+	reads := map[string]bool{}
+	for i := 0; i < 4; i++ {
+		reads[client.Get(ctx, "key").Val()] = true
+	}
+	assert.Equal(t, map[string]bool{"replica1": true, "replica2": true}, reads)
+
+	// writes go to the master
+	assert.Nil(t, client.Set(ctx, "write_key", "value", 0).Err())
+	value, err := master.GetMockRedis().Get("write_key")
+	assert.Nil(t, err)
+	assert.Equal(t, "value", value)
+	assert.False(t, replica1.GetMockRedis().Exists("write_key"))
+
+	// a down replica is skipped
+	replica1.StopMockRedis()
+	assert.Eventually(t, func() bool {
+		return client.Get(ctx, "key").Val() == "replica2" && client.Get(ctx, "key").Val() == "replica2"
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// the master serves reads when no replica is healthy
+	replica2.StopMockRedis()
+	assert.Eventually(t, func() bool {
+		return client.Get(ctx, "key").Val() == "master"
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestDevsporeRedigoClient_MasterSlave(t *testing.T) {
+	master, replica1, replica2 := startMasterSlaveMocks(t)
+	client := NewDevsporeRedigoClient(masterSlaveConfiguration(master.Addr, replica1.Addr+","+replica2.Addr))
+	defer client.strategy.Close()
+
+	reads := map[string]bool{}
+	for i := 0; i < 4; i++ {
+		value, err := redigo.String(client.Do("GET", "key"))
+		assert.Nil(t, err)
+		reads[value] = true
+	}
+	assert.Equal(t, map[string]bool{"replica1": true, "replica2": true}, reads)
+
+	_, err := client.Do("SET", "write_key", "value")
+	assert.Nil(t, err)
+	assert.True(t, master.GetMockRedis().Exists("write_key"))
+	assert.False(t, replica2.GetMockRedis().Exists("write_key"))
+
+	replica2.StopMockRedis()
+	assert.Eventually(t, func() bool {
+		value, _ := redigo.String(client.Do("GET", "key"))
+		next, _ := redigo.String(client.Do("GET", "key"))
+		return value == "replica1" && next == "replica1"
+	}, 5*time.Second, 10*time.Millisecond)
+}
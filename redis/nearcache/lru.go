@@ -0,0 +1,161 @@
+/*
+ * Copyright (c) Huawei Technologies Co., Ltd. 2021.
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use
+ * this file except in compliance with the License.  You may obtain a copy of the
+ * License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package nearcache
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// reply is a cached reply of a read, err is nil or redis.Nil.
+type reply struct {
+	value    interface{}
+	err      error
+	expireAt time.Time
+}
+
+// entry is the cached replies of a key by the read, such as "get" and "hget field".
+type entry struct {
+	key     string
+	replies map[string]reply
+}
+
+// lru caches the replies of at most maxEntries keys. A reply is stored only if the key is not invalidated after it
+// was reserved, so that a reply read before a write is not cached after the invalidation of the write.
+type lru struct {
+	mutex      sync.Mutex
+	maxEntries int
+	ttl        time.Duration
+	order      *list.List // *entry, the most recently used at front
+	entries    map[string]*list.Element
+	pending    map[string]uint64 // the latest reservation of every key being read
+	token      uint64
+
+	evictions     uint64
+	invalidations uint64
+	flushes       uint64
+}
+
+func newLRU(maxEntries int, ttl time.Duration) *lru {
+	return &lru{
+		maxEntries: maxEntries,
+		ttl:        ttl,
+		order:      list.New(),
+		entries:    make(map[string]*list.Element),
+		pending:    make(map[string]uint64),
+	}
+}
+
+// get returns the cached reply of the read of the key, an expired reply is removed.
+func (l *lru) get(key, read string) (reply, bool) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	element, ok := l.entries[key]
+	if !ok {
+		return reply{}, false
+	}
+	e := element.Value.(*entry)
+	r, ok := e.replies[read]
+	if !ok {
+		return reply{}, false
+	}
+	if time.Now().After(r.expireAt) {
+		delete(e.replies, read)
+		if len(e.replies) == 0 {
+			l.remove(element)
+		}
+		return reply{}, false
+	}
+	l.order.MoveToFront(element)
+	return r, true
+}
+
+// reserve is called before the read is sent, the token is passed to store or cancel after the reply received.
+func (l *lru) reserve(key string) uint64 {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.token++
+	l.pending[key] = l.token
+	return l.token
+}
+
+func (l *lru) cancel(key string, token uint64) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if l.pending[key] == token {
+		delete(l.pending, key)
+	}
+}
+
+// store cache the reply if the key is not invalidated since reserved, the least recently used key is evicted when
+// the cache is full.
+func (l *lru) store(key, read string, token uint64, value interface{}, err error) bool {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if l.pending[key] != token {
+		return false
+	}
+	delete(l.pending, key)
+	r := reply{value: value, err: err, expireAt: time.Now().Add(l.ttl)}
+	if element, ok := l.entries[key]; ok {
+		element.Value.(*entry).replies[read] = r
+		l.order.MoveToFront(element)
+		return true
+	}
+	l.entries[key] = l.order.PushFront(&entry{key: key, replies: map[string]reply{read: r}})
+	for l.order.Len() > l.maxEntries {
+		l.remove(l.order.Back())
+		l.evictions++
+	}
+	return true
+}
+
+// invalidate remove the keys and fail their reservations.
+func (l *lru) invalidate(keys ...string) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	for _, key := range keys {
+		delete(l.pending, key)
+		if element, ok := l.entries[key]; ok {
+			l.remove(element)
+			l.invalidations++
+		}
+	}
+}
+
+// flush remove all keys and fail all reservations.
+func (l *lru) flush() {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.order.Init()
+	l.entries = make(map[string]*list.Element)
+	l.pending = make(map[string]uint64)
+	l.flushes++
+}
+
+func (l *lru) remove(element *list.Element) {
+	l.order.Remove(element)
+	delete(l.entries, element.Value.(*entry).key)
+}
+
+func (l *lru) stats(stats *Stats) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	stats.Entries = l.order.Len()
+	stats.Evictions = l.evictions
+	stats.Invalidations = l.invalidations
+	stats.Flushes = l.flushes
+}
@@ -0,0 +1,303 @@
+/*
+ * Copyright (c) Huawei Technologies Co., Ltd. 2021.
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use
+ * this file except in compliance with the License.  You may obtain a copy of the
+ * License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+// Package nearcache caches the replies of the hot reads in process. The cached keys are invalidated by the redis 6
+// CLIENT TRACKING of the server which the reads are routed to, the writes of this process invalidate them at once,
+// and the whole cache is flushed when the active or nearest server switched.
+package nearcache
+
+import (
+	"context"
+	"log"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/huaweicloud/devcloud-go/redis/config"
+	"github.com/huaweicloud/devcloud-go/redis/strategy"
+)
+
+const (
+	ModeDefault   = "default"
+	ModeBroadcast = "bcast"
+
+	defaultMaxEntries    = 10000
+	defaultTTLMillis     = 60000
+	trackerRetryInterval = 5 * time.Second
+
+	readGet     = "get"
+	readHGetAll = "hgetall"
+)
+
+// Stats of the near cache.
+type Stats struct {
+	Server        string // the server whose replies are cached, empty if no server is tracked
+	Entries       int
+	Hits          uint64
+	Misses        uint64
+	Evictions     uint64 // keys evicted by the size bound
+	Invalidations uint64 // cached keys invalidated by the server or the writes of this process
+	Flushes       uint64
+}
+
+// NearCache caches the replies of GET, HGET and HGETALL of the read server, which is the nearest server of the
+// local-read route algorithms and the active server of the others. The reads of a master-slave server are sent
+// to the master, cluster servers are not supported and their reads are not cached.
+type NearCache struct {
+	hits          uint64
+	misses        uint64
+	configuration *config.Configuration
+	cfg           config.NearCacheConfiguration
+	cache         *lru
+	mutex         sync.Mutex
+	tracker       atomic.Value // trackerHolder
+	closed        bool
+}
+
+// trackerHolder is the tracker of the server config, tracker is nil if it failed to start.
+type trackerHolder struct {
+	server       string
+	serverConfig *config.ServerConfiguration
+	tracker      *tracker
+	retryAt      time.Time
+}
+
+// New create a NearCache, nil if the near cache is not enabled.
+func New(configuration *config.Configuration) *NearCache {
+	nearCacheConfig := configuration.RedisConfig.NearCache
+	if nearCacheConfig == nil || !nearCacheConfig.Enable {
+		return nil
+	}
+	cfg := *nearCacheConfig
+	if cfg.MaxEntries <= 0 {
+		cfg.MaxEntries = defaultMaxEntries
+	}
+	if cfg.TTLMillis <= 0 {
+		cfg.TTLMillis = defaultTTLMillis
+	}
+	switch cfg.Mode {
+	case ModeDefault, ModeBroadcast:
+	case "":
+		cfg.Mode = ModeDefault
+	default:
+		log.Printf("WARNING: invalid near cache mode '%s', use %s", cfg.Mode, ModeDefault)
+		cfg.Mode = ModeDefault
+	}
+	n := &NearCache{
+		configuration: configuration,
+		cfg:           cfg,
+		cache:         newLRU(cfg.MaxEntries, time.Duration(cfg.TTLMillis)*time.Millisecond),
+	}
+	n.tracker.Store(trackerHolder{})
+	return n
+}
+
+// Get returns the cached reply of GET, ok is false if the key can not be cached, the caller sends the read to
+// the strategy then.
+func (n *NearCache) Get(ctx context.Context, key string) (cmd *redis.StringCmd, ok bool) {
+	value, err, ok := n.load(ctx, key, readGet, func(client *redis.Client) (interface{}, error) {
+		return client.Get(ctx, key).Result()
+	})
+	if !ok {
+		return nil, false
+	}
+	return redis.NewStringResult(value.(string), err), true
+}
+
+// HGet returns the cached reply of HGET.
+func (n *NearCache) HGet(ctx context.Context, key, field string) (cmd *redis.StringCmd, ok bool) {
+	value, err, ok := n.load(ctx, key, "hget "+field, func(client *redis.Client) (interface{}, error) {
+		return client.HGet(ctx, key, field).Result()
+	})
+	if !ok {
+		return nil, false
+	}
+	return redis.NewStringResult(value.(string), err), true
+}
+
+// HGetAll returns the cached reply of HGETALL, the map must not be modified by the caller.
+func (n *NearCache) HGetAll(ctx context.Context, key string) (cmd *redis.StringStringMapCmd, ok bool) {
+	value, err, ok := n.load(ctx, key, readHGetAll, func(client *redis.Client) (interface{}, error) {
+		return client.HGetAll(ctx, key).Result()
+	})
+	if !ok {
+		return nil, false
+	}
+	return redis.NewStringStringMapResult(value.(map[string]string), err), true
+}
+
+// load returns the cached reply of the read of the key, or reads it from the tracked server and caches it. The
+// replies other than redis.Nil errors are not cached, and ok is false if the read failed.
+func (n *NearCache) load(ctx context.Context, key, read string,
+	fn func(client *redis.Client) (interface{}, error)) (value interface{}, err error, ok bool) {
+	if !n.cacheable(key) {
+		return nil, nil, false
+	}
+	t := n.current()
+	if t == nil {
+		return nil, nil, false
+	}
+	if cached, ok := n.cache.get(key, read); ok {
+		atomic.AddUint64(&n.hits, 1)
+		return cached.value, cached.err, true
+	}
+	atomic.AddUint64(&n.misses, 1)
+	token := n.cache.reserve(key)
+	value, err = fn(t.readerClient())
+	if err != nil && err != redis.Nil {
+		n.cache.cancel(key, token)
+		return nil, nil, false
+	}
+	n.cache.store(key, read, token, value, err)
+	return value, err, true
+}
+
+// cacheable whether the key is tracked, in the broadcast mode only the keys of the prefixes are tracked.
+func (n *NearCache) cacheable(key string) bool {
+	if n.cfg.Mode != ModeBroadcast || len(n.cfg.Prefixes) == 0 {
+		return true
+	}
+	for _, prefix := range n.cfg.Prefixes {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// current returns the tracker of the read server of the current routing snapshot, the tracker of the previous
+// server is closed and the cache is flushed when the read server switched.
+func (n *NearCache) current() *tracker {
+	snapshot := n.configuration.Snapshot()
+	server := readServer(snapshot)
+	serverConfig := snapshot.Servers[server]
+	if holder := n.tracker.Load().(trackerHolder); holder.valid(server, serverConfig) {
+		return holder.tracker
+	}
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	holder := n.tracker.Load().(trackerHolder)
+	if n.closed || holder.valid(server, serverConfig) {
+		return holder.tracker
+	}
+	if holder.tracker != nil {
+		holder.tracker.close()
+		log.Printf("INFO: near cache switched from server '%s' to '%s'", holder.server, server)
+	}
+	n.cache.flush()
+	holder = trackerHolder{server: server, serverConfig: serverConfig}
+	if serverConfig == nil {
+		log.Printf("ERROR: near cache server '%s' has no config", server)
+		holder.retryAt = time.Now().Add(trackerRetryInterval)
+	} else if t, err := newTracker(server, serverConfig, &n.cfg, n.cache); err != nil {
+		log.Printf("WARNING: near cache of server '%s' is not available, %v", server, err)
+		if err != errClusterNotSupported {
+			holder.retryAt = time.Now().Add(trackerRetryInterval)
+		}
+	} else {
+		holder.tracker = t
+	}
+	n.tracker.Store(holder)
+	return holder.tracker
+}
+
+// valid whether the holder is of the server config, a failed tracker is retried after retryAt, never if zero.
+func (h trackerHolder) valid(server string, serverConfig *config.ServerConfiguration) bool {
+	if h.server != server || h.serverConfig != serverConfig {
+		return false
+	}
+	return h.tracker != nil || h.retryAt.IsZero() || time.Now().Before(h.retryAt)
+}
+
+func readServer(snapshot *config.RoutingSnapshot) string {
+	switch snapshot.RouteAlgorithm {
+	case strategy.LocalReadSingleWriteMode, strategy.LocalReadDoubleWriteMode:
+		return snapshot.Nearest
+	}
+	return snapshot.Active
+}
+
+// Hook returns the hook of the strategy clients, it invalidates the keys written by this process, so that they
+// are read again at once instead of after the invalidation messages.
+func (n *NearCache) Hook(serverName string) redis.Hook {
+	return &writeHook{cache: n.cache}
+}
+
+// Stats returns the stats of the near cache.
+func (n *NearCache) Stats() Stats {
+	stats := Stats{
+		Server: n.tracker.Load().(trackerHolder).server,
+		Hits:   atomic.LoadUint64(&n.hits),
+		Misses: atomic.LoadUint64(&n.misses),
+	}
+	n.cache.stats(&stats)
+	return stats
+}
+
+// Flush removes all cached replies.
+func (n *NearCache) Flush() {
+	n.cache.flush()
+}
+
+// Close stops the tracking and flushes the cache.
+func (n *NearCache) Close() {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	n.closed = true
+	if holder := n.tracker.Load().(trackerHolder); holder.tracker != nil {
+		holder.tracker.close()
+		n.tracker.Store(trackerHolder{})
+	}
+	n.cache.flush()
+}
+
+// writeHook invalidates the keys of the write commands after they executed, even failed, for a timeout write may
+// have been executed.
+type writeHook struct {
+	cache *lru
+}
+
+func (h *writeHook) BeforeProcess(ctx context.Context, cmd redis.Cmder) (context.Context, error) {
+	return ctx, nil
+}
+
+func (h *writeHook) AfterProcess(ctx context.Context, cmd redis.Cmder) error {
+	h.invalidate(cmd)
+	return nil
+}
+
+func (h *writeHook) BeforeProcessPipeline(ctx context.Context, cmds []redis.Cmder) (context.Context, error) {
+	return ctx, nil
+}
+
+func (h *writeHook) AfterProcessPipeline(ctx context.Context, cmds []redis.Cmder) error {
+	for _, cmd := range cmds {
+		h.invalidate(cmd)
+	}
+	return nil
+}
+
+func (h *writeHook) invalidate(cmd redis.Cmder) {
+	if !strategy.IsWriteCommand(cmd.Name(), cmd.Args()) {
+		return
+	}
+	keys, global := strategy.CommandKeys(cmd.Args())
+	if global {
+		h.cache.flush()
+		return
+	}
+	h.cache.invalidate(keys...)
+}
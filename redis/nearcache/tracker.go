@@ -0,0 +1,216 @@
+/*
+ * Copyright (c) Huawei Technologies Co., Ltd. 2021.
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use
+ * this file except in compliance with the License.  You may obtain a copy of the
+ * License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package nearcache
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/huaweicloud/devcloud-go/redis/config"
+)
+
+const (
+	invalidateChannel = "__redis__:invalidate"
+	// receiveTimeout the invalidation connection is pinged when no message received in it
+	receiveTimeout       = time.Second
+	receiveRetryInterval = 100 * time.Millisecond
+	// readerCloseDelay the replaced reader is closed after the in-flight reads finished
+	readerCloseDelay = time.Second
+)
+
+var errClusterNotSupported = errors.New("cluster server is not supported")
+
+// tracker subscribes the invalidation messages of a server, and reads from the server by the connections whose
+// CLIENT TRACKING redirects to the subscription. go-redis v8 speaks RESP2 only, so the invalidations are received
+// by the redirection instead of the RESP3 push messages.
+type tracker struct {
+	clientID     int64 // the CLIENT ID of the subscription connection, first for the 64-bit alignment of atomic
+	server       string
+	serverConfig *config.ServerConfiguration
+	cfg          *config.NearCacheConfiguration
+	cache        *lru
+	invalidator  *redis.Client
+	pubSub       *redis.PubSub
+	reader       atomic.Value // readerHolder
+	ctx          context.Context
+	cancel       context.CancelFunc
+	done         chan struct{}
+}
+
+// readerHolder makes atomic.Value always store the same concrete type.
+type readerHolder struct {
+	client *redis.Client
+}
+
+func newTracker(server string, serverConfig *config.ServerConfiguration, cfg *config.NearCacheConfiguration,
+	cache *lru) (*tracker, error) {
+	if serverConfig.Type == config.ServerTypeCluster {
+		return nil, errClusterNotSupported
+	}
+	t := &tracker{server: server, serverConfig: serverConfig, cfg: cfg, cache: cache, done: make(chan struct{})}
+	t.ctx, t.cancel = context.WithCancel(context.Background())
+	t.invalidator = newServerClient(serverConfig, t.onSubscriptionConnect)
+	t.reader.Store(readerHolder{client: newServerClient(serverConfig, t.onReaderConnect)})
+	t.pubSub = t.invalidator.Subscribe(t.ctx, invalidateChannel)
+	// the subscription confirmation, or the error of connecting
+	if _, err := t.pubSub.ReceiveTimeout(t.ctx, receiveTimeout); err != nil {
+		t.cancel()
+		t.closeClients()
+		return nil, err
+	}
+	go t.receive()
+	return t, nil
+}
+
+// newServerClient create a client of the master of a normal, master-slave or sentinel server, onConnect is called
+// after the server's own OnConnect.
+func newServerClient(serverConfig *config.ServerConfiguration,
+	onConnect func(ctx context.Context, cn *redis.Conn) error) *redis.Client {
+	if serverConfig.Type == config.ServerTypeSentinel {
+		options := *serverConfig.FailoverOptions
+		options.OnConnect = chainOnConnect(options.OnConnect, onConnect)
+		return redis.NewFailoverClient(&options)
+	}
+	options := *serverConfig.Options
+	options.OnConnect = chainOnConnect(options.OnConnect, onConnect)
+	return redis.NewClient(&options)
+}
+
+func chainOnConnect(first, second func(ctx context.Context, cn *redis.Conn) error) func(ctx context.Context,
+	cn *redis.Conn) error {
+	if first == nil {
+		return second
+	}
+	return func(ctx context.Context, cn *redis.Conn) error {
+		if err := first(ctx, cn); err != nil {
+			return err
+		}
+		return second(ctx, cn)
+	}
+}
+
+// onSubscriptionConnect record the CLIENT ID of the subscription connection. The invalidations are lost while it
+// reconnects, and the tracking of the reader connections still redirects to the old id, so the reader is replaced
+// and the cache is flushed.
+func (t *tracker) onSubscriptionConnect(ctx context.Context, cn *redis.Conn) error {
+	id, err := cn.ClientID(ctx).Result()
+	if err != nil {
+		return err
+	}
+	if t.cfg.Mode == ModeBroadcast {
+		if err = tracking(ctx, cn, t.trackingArgs(id)); err != nil {
+			return err
+		}
+	}
+	if previous := atomic.SwapInt64(&t.clientID, id); previous != 0 && t.cfg.Mode != ModeBroadcast {
+		t.resetReader()
+	}
+	if t.ctx.Err() == nil {
+		t.cache.flush()
+	}
+	return nil
+}
+
+// onReaderConnect turn on the tracking of the reader connection, in the broadcast mode the subscription
+// connection tracks the prefixes for itself.
+func (t *tracker) onReaderConnect(ctx context.Context, cn *redis.Conn) error {
+	if t.cfg.Mode == ModeBroadcast {
+		return nil
+	}
+	id := atomic.LoadInt64(&t.clientID)
+	if id == 0 {
+		return errors.New("near cache subscription is not connected")
+	}
+	return tracking(ctx, cn, t.trackingArgs(id))
+}
+
+func tracking(ctx context.Context, cn *redis.Conn, args []interface{}) error {
+	cmd := redis.NewStatusCmd(ctx, args...)
+	_ = cn.Process(ctx, cmd)
+	return cmd.Err()
+}
+
+func (t *tracker) trackingArgs(redirect int64) []interface{} {
+	args := []interface{}{"client", "tracking", "on", "redirect", redirect}
+	if t.cfg.Mode == ModeBroadcast {
+		args = append(args, "bcast")
+		for _, prefix := range t.cfg.Prefixes {
+			args = append(args, "prefix", prefix)
+		}
+	}
+	return args
+}
+
+func (t *tracker) resetReader() {
+	previous := t.readerClient()
+	t.reader.Store(readerHolder{client: newServerClient(t.serverConfig, t.onReaderConnect)})
+	log.Printf("INFO: near cache subscription of server '%s' reconnected, the reader is replaced", t.server)
+	go func() {
+		time.Sleep(readerCloseDelay)
+		_ = previous.Close()
+	}()
+}
+
+func (t *tracker) readerClient() *redis.Client {
+	return t.reader.Load().(readerHolder).client
+}
+
+// receive invalidate the keys of the messages until the tracker closed.
+func (t *tracker) receive() {
+	defer close(t.done)
+	for {
+		msg, err := t.pubSub.ReceiveTimeout(t.ctx, receiveTimeout)
+		if t.ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				_ = t.pubSub.Ping(t.ctx)
+				continue
+			}
+			// such as the invalidation of FLUSHALL whose payload is nil, or the connection is broken
+			log.Printf("WARNING: near cache receive invalidation of server '%s' failed, flush the cache, %v",
+				t.server, err)
+			t.cache.flush()
+			time.Sleep(receiveRetryInterval)
+			continue
+		}
+		if message, ok := msg.(*redis.Message); ok && message.Channel == invalidateChannel {
+			if len(message.PayloadSlice) > 0 {
+				t.cache.invalidate(message.PayloadSlice...)
+			} else {
+				t.cache.invalidate(message.Payload)
+			}
+		}
+	}
+}
+
+func (t *tracker) close() {
+	t.cancel()
+	t.closeClients()
+	<-t.done
+}
+
+func (t *tracker) closeClients() {
+	_ = t.pubSub.Close()
+	_ = t.invalidator.Close()
+	_ = t.readerClient().Close()
+}
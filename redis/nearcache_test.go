@@ -0,0 +1,206 @@
+/*
+ * Copyright (c) Huawei Technologies Co., Ltd. 2021.
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use
+ * this file except in compliance with the License.  You may obtain a copy of the
+ * License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package redis
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/alicebob/miniredis/v2/server"
+	goredis "github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/huaweicloud/devcloud-go/redis/config"
+	"github.com/huaweicloud/devcloud-go/redis/nearcache"
+	"github.com/huaweicloud/devcloud-go/redis/strategy"
+)
+
+// fakeTracking is the CLIENT ID and CLIENT TRACKING of redis 6 which miniredis does not support, the invalidation
+// messages are published by the tests.
+type fakeTracking struct {
+	mutex    sync.Mutex
+	ids      map[*server.Peer]int
+	tracking [][]string
+}
+
+func registerFakeTracking(t *testing.T, m *miniredis.Miniredis) *fakeTracking {
+	f := &fakeTracking{ids: map[*server.Peer]int{}}
+	err := m.Server().Register("CLIENT", func(c *server.Peer, cmd string, args []string) {
+		f.mutex.Lock()
+		defer f.mutex.Unlock()
+		switch strings.ToUpper(args[0]) {
+		case "ID":
+			if _, ok := f.ids[c]; !ok {
+				f.ids[c] = len(f.ids) + 1
+			}
+			c.WriteInt(f.ids[c])
+		case "TRACKING":
+			f.tracking = append(f.tracking, args[1:])
+			c.WriteOK()
+		default:
+			c.WriteError("ERR unknown subcommand")
+		}
+	})
+	assert.Nil(t, err)
+	return f
+}
+
+func (f *fakeTracking) trackings() [][]string {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return append([][]string(nil), f.tracking...)
+}
+
+func nearCacheConfiguration(routeAlgorithm, addr1, addr2 string, nearCache *config.NearCacheConfiguration) *config.Configuration {
+	configuration := doubleWriteConfiguration(routeAlgorithm, addr1, addr2)
+	configuration.RedisConfig.NearCache = nearCache
+	return configuration
+}
+
+func TestDevsporeClient_NearCache(t *testing.T) {
+	dc1, dc2 := startDoubleWriteMocks(t)
+	tracking := registerFakeTracking(t, dc2.GetMockRedis())
+	client := NewDevsporeClient(nearCacheConfiguration(strategy.SingleReadWriteMode, dc1.Addr, dc2.Addr,
+		&config.NearCacheConfiguration{Enable: true}))
+	defer client.Close()
+	ctx := context.Background()
+	m := dc2.GetMockRedis()
+
+	_ = m.Set("key", "v1")
+	assert.Equal(t, "v1", client.Get(ctx, "key").Val())
+	// changed without invalidation, the cached reply is returned
+	_ = m.Set("key", "v2")
+	assert.Equal(t, "v1", client.Get(ctx, "key").Val())
+	// the reader connection redirects the invalidations to the subscription connection, which connected first
+	assert.Equal(t, []string{"on", "redirect", "1"}, tracking.trackings()[0])
+
+	m.Publish("__redis__:invalidate", "key")
+	assert.Eventually(t, func() bool {
+		return client.Get(ctx, "key").Val() == "v2"
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// the writes of this process invalidate at once
+	assert.Nil(t, client.Set(ctx, "key", "v3", 0).Err())
+	assert.Equal(t, "v3", client.Get(ctx, "key").Val())
+
+	// nil replies are cached too
+	assert.Equal(t, goredis.Nil, client.Get(ctx, "missing").Err())
+	_ = m.Set("missing", "found")
+	assert.Equal(t, goredis.Nil, client.Get(ctx, "missing").Err())
+
+	assert.Nil(t, client.HSet(ctx, "hash", "f1", "a", "f2", "b").Err())
+	assert.Equal(t, map[string]string{"f1": "a", "f2": "b"}, client.HGetAll(ctx, "hash").Val())
+	assert.Equal(t, "a", client.HGet(ctx, "hash", "f1").Val())
+	m.HSet("hash", "f1", "c")
+	assert.Equal(t, "a", client.HGet(ctx, "hash", "f1").Val())
+	m.Publish("__redis__:invalidate", "hash")
+	assert.Eventually(t, func() bool {
+		return client.HGet(ctx, "hash", "f1").Val() == "c" && client.HGetAll(ctx, "hash").Val()["f1"] == "c"
+	}, 5*time.Second, 10*time.Millisecond)
+
+	stats := client.NearCacheStats()
+	assert.Equal(t, "dc2", stats.Server)
+	assert.True(t, stats.Hits >= 3)
+	assert.True(t, stats.Misses >= 5)
+	assert.True(t, stats.Invalidations >= 3)
+}
+
+func TestDevsporeClient_NearCacheSwitchActive(t *testing.T) {
+	dc1, dc2 := startDoubleWriteMocks(t)
+	registerFakeTracking(t, dc1.GetMockRedis())
+	registerFakeTracking(t, dc2.GetMockRedis())
+	configuration := nearCacheConfiguration(strategy.SingleReadWriteMode, dc1.Addr, dc2.Addr,
+		&config.NearCacheConfiguration{Enable: true})
+	client := NewDevsporeClient(configuration)
+	defer client.Close()
+	ctx := context.Background()
+	_ = dc1.GetMockRedis().Set("key", "dc1")
+	_ = dc2.GetMockRedis().Set("key", "dc2")
+
+	assert.Equal(t, "dc2", client.Get(ctx, "key").Val())
+	assert.Equal(t, "dc2", client.Get(ctx, "key").Val())
+	flushes := client.NearCacheStats().Flushes
+
+	configuration.SwitchActive("dc1")
+	assert.Equal(t, "dc1", client.Get(ctx, "key").Val())
+	stats := client.NearCacheStats()
+	assert.Equal(t, "dc1", stats.Server)
+	assert.True(t, stats.Flushes > flushes)
+	assert.Equal(t, 1, stats.Entries)
+}
+
+func TestDevsporeClient_NearCacheBounds(t *testing.T) {
+	dc1, dc2 := startDoubleWriteMocks(t)
+	registerFakeTracking(t, dc2.GetMockRedis())
+	client := NewDevsporeClient(nearCacheConfiguration(strategy.SingleReadWriteMode, dc1.Addr, dc2.Addr,
+		&config.NearCacheConfiguration{Enable: true, MaxEntries: 2, TTLMillis: 200}))
+	defer client.Close()
+	ctx := context.Background()
+	m := dc2.GetMockRedis()
+
+	for i := 0; i < 3; i++ {
+		_ = m.Set("key"+strconv.Itoa(i), "old")
+		assert.Equal(t, "old", client.Get(ctx, "key"+strconv.Itoa(i)).Val())
+	}
+	stats := client.NearCacheStats()
+	assert.Equal(t, 2, stats.Entries)
+	assert.Equal(t, uint64(1), stats.Evictions)
+
+	_ = m.Set("key2", "new")
+	assert.Equal(t, "old", client.Get(ctx, "key2").Val())
+	time.Sleep(300 * time.Millisecond)
+	assert.Equal(t, "new", client.Get(ctx, "key2").Val())
+}
+
+func TestDevsporeClient_NearCacheBroadcast(t *testing.T) {
+	dc1, dc2 := startDoubleWriteMocks(t)
+	tracking := registerFakeTracking(t, dc1.GetMockRedis())
+	client := NewDevsporeClient(nearCacheConfiguration(strategy.LocalReadSingleWriteMode, dc1.Addr, dc2.Addr,
+		&config.NearCacheConfiguration{Enable: true, Mode: nearcache.ModeBroadcast, Prefixes: []string{"user:"}}))
+	defer client.Close()
+	ctx := context.Background()
+	_ = dc1.GetMockRedis().Set("user:1", "alice")
+	_ = dc1.GetMockRedis().Set("order:1", "book")
+
+	assert.Equal(t, "alice", client.Get(ctx, "user:1").Val())
+	assert.Equal(t, "alice", client.Get(ctx, "user:1").Val())
+	assert.Equal(t, "book", client.Get(ctx, "order:1").Val())
+	// the subscription connection tracks the prefixes for itself
+	assert.Equal(t, [][]string{{"on", "redirect", "1", "bcast", "prefix", "user:"}}, tracking.trackings())
+	stats := client.NearCacheStats()
+	assert.Equal(t, "dc1", stats.Server)
+	assert.Equal(t, uint64(1), stats.Hits)
+	assert.Equal(t, uint64(1), stats.Misses)
+}
+
+func TestDevsporeClient_NearCacheNotSupported(t *testing.T) {
+	dc1, dc2 := startDoubleWriteMocks(t)
+	client := NewDevsporeClient(nearCacheConfiguration(strategy.SingleReadWriteMode, dc1.Addr, dc2.Addr,
+		&config.NearCacheConfiguration{Enable: true}))
+	defer client.Close()
+	ctx := context.Background()
+
+	// the server has no CLIENT TRACKING, the reads are not cached
+	_ = dc2.GetMockRedis().Set("key", "v1")
+	assert.Equal(t, "v1", client.Get(ctx, "key").Val())
+	_ = dc2.GetMockRedis().Set("key", "v2")
+	assert.Equal(t, "v2", client.Get(ctx, "key").Val())
+	assert.Equal(t, nearcache.Stats{Server: "dc2", Flushes: 1}, client.NearCacheStats())
+}
@@ -0,0 +1,126 @@
+/*
+ * Copyright (c) Huawei Technologies Co., Ltd. 2021.
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use
+ * this file except in compliance with the License.  You may obtain a copy of the
+ * License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package redis
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	goredis "github.com/go-redis/redis/v8"
+	redigo "github.com/gomodule/redigo/redis"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v3"
+
+	"github.com/huaweicloud/devcloud-go/mock"
+	"github.com/huaweicloud/devcloud-go/redis/config"
+	"github.com/huaweicloud/devcloud-go/redis/strategy"
+)
+
+func poolConfiguration(addr string) *config.Configuration {
+	return &config.Configuration{
+		RouteAlgorithm: strategy.SingleReadWriteMode,
+		Active:         "dc1",
+		RedisConfig: &config.RedisConfiguration{
+			UserName: "user",
+			Servers: map[string]*config.ServerConfiguration{
+				"dc1": {Hosts: addr, Type: config.ServerTypeNormal, Password: "secret",
+					ConnectionPool: &config.ServerConnectionPoolConfiguration{MaxTotal: 3, MaxIdle: 2, MinIdle: 1,
+						MaxWaitMillis: 200, TimeBetweenEvictionRunsMillis: 50, MinEvictableIdleTimeMillis: 60000,
+						MaxConnLifetimeMillis: 120000, Lifo: true}},
+			},
+		},
+	}
+}
+
+func TestDevsporeRedigoClient_PoolEquivalence(t *testing.T) {
+	redisMock := &mock.RedisMock{}
+	if err := redisMock.StartMockRedis(); err != nil {
+		t.Fatal(err)
+	}
+	defer redisMock.StopMockRedis()
+	redisMock.GetMockRedis().RequireUserAuth("user", "secret")
+	ctx := context.Background()
+
+	goredisConfiguration := poolConfiguration(redisMock.Addr)
+	goredisClient := NewDevsporeClient(goredisConfiguration)
+	defer goredisClient.Close()
+	redigoClient := NewDevsporeRedigoClient(poolConfiguration(redisMock.Addr))
+	defer redigoClient.strategy.Close()
+	assert.Nil(t, goredisClient.Set(ctx, "key", "value", 0).Err())
+	_, err := redigoClient.Do("SET", "key", "value")
+	assert.Nil(t, err)
+
+	// the go-redis options with the defaults of go-redis
+	serverConfig := goredisConfiguration.RedisConfig.Servers["dc1"]
+	serverClient := goredis.NewClient(serverConfig.Options)
+	defer serverClient.Close()
+	opts := serverClient.Options()
+	pool := redigoClient.strategy.RouteClient(context.Background(), strategy.CommandTypeWrite).Pool
+	assert.Equal(t, opts.PoolSize, pool.MaxActive)
+	assert.Equal(t, 2, pool.MaxIdle)
+	assert.Equal(t, opts.IdleTimeout, pool.IdleTimeout)
+	assert.Equal(t, opts.MaxConnAge, pool.MaxConnLifetime)
+	// redigo pools are lifo
+	assert.False(t, opts.PoolFIFO)
+	assert.True(t, pool.Wait)
+	assert.Eventually(t, func() bool {
+		return pool.IdleCount() >= opts.MinIdleConns
+	}, time.Second, 10*time.Millisecond)
+
+	// an exhausted pool fails after PoolTimeout in both clients
+	redigoConns := make([]redigo.Conn, 0, opts.PoolSize)
+	for i := 0; i < opts.PoolSize; i++ {
+		conn := redigoClient.strategy.RouteClient(context.Background(), strategy.CommandTypeWrite).Get()
+		assert.Nil(t, conn.Err())
+		redigoConns = append(redigoConns, conn)
+	}
+	start := time.Now()
+	_, err = redigoClient.Do("GET", "key")
+	assert.NotNil(t, err)
+	assert.GreaterOrEqual(t, time.Since(start), opts.PoolTimeout)
+	for _, conn := range redigoConns {
+		_ = conn.Close()
+	}
+	_, err = redigoClient.Do("GET", "key")
+	assert.Nil(t, err)
+
+	goredisConns := make([]*goredis.Conn, 0, opts.PoolSize)
+	for i := 0; i < opts.PoolSize; i++ {
+		conn := serverClient.Conn(ctx)
+		assert.Nil(t, conn.Ping(ctx).Err())
+		goredisConns = append(goredisConns, conn)
+	}
+	start = time.Now()
+	assert.EqualError(t, serverClient.Get(ctx, "key").Err(), "redis: connection pool timeout")
+	assert.GreaterOrEqual(t, time.Since(start), opts.PoolTimeout)
+	for _, conn := range goredisConns {
+		_ = conn.Close()
+	}
+}
+
+func TestDevsporeRedigoClient_PoolFIFO(t *testing.T) {
+	configuration := poolConfiguration("127.0.0.1:6379")
+	pool := &config.ServerConnectionPoolConfiguration{}
+	assert.Nil(t, yaml.Unmarshal([]byte("{maxTotal: 3, lifo: false}"), pool))
+	configuration.RedisConfig.Servers["dc1"].ConnectionPool = pool
+	configuration.ConvertServerConfiguration()
+
+	// go-redis pools are fifo, redigo pools can not be, so the configuration is rejected
+	assert.True(t, configuration.RedisConfig.Servers["dc1"].Options.PoolFIFO)
+	assert.EqualError(t, validateRedigoConfiguration(configuration),
+		"server dc1: lifo false is not supported by redigo pools")
+	assert.Nil(t, validateConfiguration(configuration))
+}
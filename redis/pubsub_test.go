@@ -0,0 +1,270 @@
+/*
+ * Copyright (c) Huawei Technologies Co., Ltd. 2021.
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use
+ * this file except in compliance with the License.  You may obtain a copy of the
+ * License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package redis
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	goredis "github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/huaweicloud/devcloud-go/redis/config"
+	"github.com/huaweicloud/devcloud-go/redis/redigostrategy"
+	"github.com/huaweicloud/devcloud-go/redis/strategy"
+)
+
+var subscribeOptions = &redigostrategy.SubcribeOptions{QueueSize: 1, ReconnectInterval: 50 * time.Millisecond,
+	CheckInterval: 50 * time.Millisecond}
+
+func assertEventuallySubscribed(t *testing.T, m *miniredis.Miniredis, channel string, patterns int) {
+	assert.Eventually(t, func() bool {
+		return m.PubSubNumSub(channel)[channel] == 1 && m.PubSubNumPat() == patterns
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestSubcribeTool_SubscribeAndPSubscribe(t *testing.T) {
+	_, active := startDoubleWriteMocks(t)
+	client := NewDevsporeRedigoClient(doubleWriteConfiguration(strategy.SingleReadWriteMode, "127.0.0.1:0",
+		active.Addr))
+	defer client.strategy.Close()
+	tool := client.GetSubscribeToolWithOptions(subscribeOptions)
+
+	messages := make(chan string, 10)
+	tool.Subscribe(func(channel, message string) {
+		messages <- channel + ":" + message
+	}, "news")
+	tool.PSubscribe(func(channel, message string) {
+		messages <- "pattern " + channel + ":" + message
+	}, "sport.*")
+	assertEventuallySubscribed(t, active.GetMockRedis(), "news", 1)
+
+	active.GetMockRedis().Publish("news", "hello")
+	active.GetMockRedis().Publish("sport.football", "goal")
+	received := []string{<-messages, <-messages}
+	assert.ElementsMatch(t, []string{"news:hello", "pattern sport.football:goal"}, received)
+
+	tool.UnSubscribe("news")
+	tool.PUnSubscribe("sport.*")
+	assert.Eventually(t, func() bool {
+		return active.GetMockRedis().PubSubNumSub("news")["news"] == 0 && active.GetMockRedis().PubSubNumPat() == 0
+	}, 5*time.Second, 10*time.Millisecond)
+
+	closed := make(chan struct{})
+	go func() {
+		_ = tool.Close()
+		_ = tool.Close()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("close SubcribeTool timeout")
+	}
+}
+
+func TestSubcribeTool_Resubscribe(t *testing.T) {
+	dc1, dc2 := startDoubleWriteMocks(t)
+	configuration := doubleWriteConfiguration(strategy.SingleReadWriteMode, dc1.Addr, dc2.Addr)
+	client := NewDevsporeRedigoClient(configuration)
+	defer client.strategy.Close()
+	tool := client.GetSubscribeToolWithOptions(subscribeOptions)
+	defer tool.Close()
+
+	messages := make(chan string, 10)
+	tool.Subscribe(func(channel, message string) {
+		messages <- message
+	}, "news")
+	tool.PSubscribe(func(channel, message string) {
+		messages <- message
+	}, "sport.*")
+	assertEventuallySubscribed(t, dc2.GetMockRedis(), "news", 1)
+
+	// reconnect after the server restarted
+	dc2.GetMockRedis().Close()
+	assert.Nil(t, dc2.GetMockRedis().Restart())
+	assertEventuallySubscribed(t, dc2.GetMockRedis(), "news", 1)
+	dc2.GetMockRedis().Publish("news", "after restart")
+	assert.Equal(t, "after restart", <-messages)
+
+	// follow the active server
+	configuration.SwitchActive("dc1")
+	assertEventuallySubscribed(t, dc1.GetMockRedis(), "news", 1)
+	dc1.GetMockRedis().Publish("sport.tennis", "after switch")
+	assert.Equal(t, "after switch", <-messages)
+}
+
+func TestSubcribeTool_Backpressure(t *testing.T) {
+	_, active := startDoubleWriteMocks(t)
+	client := NewDevsporeRedigoClient(doubleWriteConfiguration(strategy.SingleReadWriteMode, "127.0.0.1:0",
+		active.Addr))
+	defer client.strategy.Close()
+	tool := client.GetSubscribeToolWithOptions(subscribeOptions)
+
+	release := make(chan struct{})
+	slow := make(chan string, 10)
+	fast := make(chan string, 10)
+	tool.Subscribe(func(channel, message string) {
+		<-release
+		slow <- message
+	}, "slow")
+	tool.Subscribe(func(channel, message string) {
+		fast <- message
+	}, "fast")
+	assertEventuallySubscribed(t, active.GetMockRedis(), "fast", 0)
+	assertEventuallySubscribed(t, active.GetMockRedis(), "slow", 0)
+
+	// the slow callback does not block the other channels until its queue is full
+	active.GetMockRedis().Publish("slow", "1")
+	active.GetMockRedis().Publish("fast", "1")
+	assert.Equal(t, "1", <-fast)
+
+	// the messages are received in order, so "2" of slow is queued when "2" of fast is received
+	active.GetMockRedis().Publish("slow", "2")
+	active.GetMockRedis().Publish("fast", "2")
+	assert.Equal(t, "2", <-fast)
+
+	// the queued messages are passed to the callback before Close returns
+	close(release)
+	assert.Nil(t, tool.Close())
+	assert.Equal(t, 2, len(slow))
+	assert.Equal(t, "1", <-slow)
+	assert.Equal(t, "2", <-slow)
+}
+
+func receivePayloads(t *testing.T, ch <-chan *goredis.Message, count int) []string {
+	var payloads []string
+	for len(payloads) < count {
+		select {
+		case msg := <-ch:
+			payloads = append(payloads, msg.Channel+":"+msg.Payload)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("received %v, want %d messages", payloads, count)
+		}
+	}
+	select {
+	case msg := <-ch:
+		t.Fatalf("unexpected message %s:%s", msg.Channel, msg.Payload)
+	case <-time.After(100 * time.Millisecond):
+	}
+	return payloads
+}
+
+func TestDevsporeClient_FanInSubscribe(t *testing.T) {
+	dc1, dc2 := startDoubleWriteMocks(t)
+	client := NewDevsporeClient(doubleWriteConfiguration(strategy.SingleReadWriteMode, dc1.Addr, dc2.Addr))
+	defer client.Close()
+	ctx := context.Background()
+	fanIn := client.FanInSubscribe(ctx, "news")
+	assert.Nil(t, fanIn.PSubscribe(ctx, "sport.*"))
+	assertEventuallySubscribed(t, dc1.GetMockRedis(), "news", 1)
+	assertEventuallySubscribed(t, dc2.GetMockRedis(), "news", 1)
+
+	dc1.GetMockRedis().Publish("news", "from dc1")
+	dc2.GetMockRedis().Publish("news", "from dc2")
+	dc2.GetMockRedis().Publish("sport.football", "goal")
+	assert.ElementsMatch(t, []string{"news:from dc1", "news:from dc2", "sport.football:goal"},
+		receivePayloads(t, fanIn.Channel(), 3))
+
+	assert.Nil(t, fanIn.Close())
+	assert.Nil(t, fanIn.Close())
+	_, ok := <-fanIn.Channel()
+	assert.False(t, ok)
+}
+
+func TestDevsporeClient_FanInSubscribe_DoubleWrite(t *testing.T) {
+	dc1, dc2 := startDoubleWriteMocks(t)
+	configuration := doubleWriteConfiguration(strategy.SingleReadDoubleWriteMode, dc1.Addr, dc2.Addr)
+	configuration.RedisConfig.PubSub = &config.PubSubConfiguration{MirrorPublish: true}
+	client := NewDevsporeClient(configuration)
+	defer client.Close()
+	ctx := context.Background()
+	fanIn := client.FanInSubscribe(ctx, "news")
+	defer fanIn.Close()
+	assertEventuallySubscribed(t, dc1.GetMockRedis(), "news", 0)
+	assertEventuallySubscribed(t, dc2.GetMockRedis(), "news", 0)
+
+	// the publishes are mirrored to dc1, the copies are dropped, the repeated publishes are not
+	client.Publish(ctx, "news", "hello")
+	client.Publish(ctx, "news", "hello")
+	client.Publish(ctx, "news", "bye")
+	assert.ElementsMatch(t, []string{"news:hello", "news:hello", "news:bye"}, receivePayloads(t, fanIn.Channel(), 3))
+}
+
+func TestDevsporeClient_MirrorPublish(t *testing.T) {
+	dc1, dc2 := startDoubleWriteMocks(t)
+	configuration := doubleWriteConfiguration(strategy.SingleReadWriteMode, dc1.Addr, dc2.Addr)
+	configuration.RedisConfig.PubSub = &config.PubSubConfiguration{MirrorPublish: true}
+	client := NewDevsporeClient(configuration)
+	defer client.Close()
+	ctx := context.Background()
+	subscriber := goredis.NewClient(&goredis.Options{Addr: dc1.Addr})
+	defer subscriber.Close()
+	pubSub := subscriber.Subscribe(ctx, "news")
+	defer pubSub.Close()
+	assertEventuallySubscribed(t, dc1.GetMockRedis(), "news", 0)
+
+	assert.Nil(t, client.Publish(ctx, "news", "hello").Err())
+	receivePayloads(t, pubSub.Channel(), 1)
+
+	// published to the hinted server, it is mirrored to the other servers only
+	dc2Subscriber := goredis.NewClient(&goredis.Options{Addr: dc2.Addr})
+	defer dc2Subscriber.Close()
+	dc2PubSub := dc2Subscriber.Subscribe(ctx, "news")
+	defer dc2PubSub.Close()
+	assertEventuallySubscribed(t, dc2.GetMockRedis(), "news", 0)
+	assert.Nil(t, client.Publish(strategy.WithServer(ctx, "dc1"), "news", "pinned").Err())
+	assert.Equal(t, []string{"news:pinned"}, receivePayloads(t, pubSub.Channel(), 1))
+	assert.Equal(t, []string{"news:pinned"}, receivePayloads(t, dc2PubSub.Channel(), 1))
+}
+
+func TestDevsporeClient_MirrorPublish_DoubleWrite(t *testing.T) {
+	dc1, dc2 := startDoubleWriteMocks(t)
+	ctx := context.Background()
+	subscriber := goredis.NewClient(&goredis.Options{Addr: dc1.Addr})
+	defer subscriber.Close()
+	pubSub := subscriber.Subscribe(ctx, "news")
+	defer pubSub.Close()
+	assertEventuallySubscribed(t, dc1.GetMockRedis(), "news", 0)
+
+	// the publishes on the active dc2 are not mirrored to dc1 unless mirrorPublish is enabled
+	configuration := doubleWriteConfiguration(strategy.SingleReadDoubleWriteMode, dc1.Addr, dc2.Addr)
+	client := NewDevsporeClient(configuration)
+	defer client.Close()
+	assert.Nil(t, client.Publish(ctx, "news", "hello").Err())
+	redigoClient := NewDevsporeRedigoClient(doubleWriteConfiguration(strategy.SingleReadDoubleWriteMode, dc1.Addr,
+		dc2.Addr))
+	defer redigoClient.strategy.Close()
+	_, err := redigoClient.Do("PUBLISH", "news", "hello")
+	assert.Nil(t, err)
+	receivePayloads(t, pubSub.Channel(), 0)
+
+	configuration = doubleWriteConfiguration(strategy.SingleReadDoubleWriteMode, dc1.Addr, dc2.Addr)
+	configuration.RedisConfig.PubSub = &config.PubSubConfiguration{MirrorPublish: true}
+	mirrorClient := NewDevsporeClient(configuration)
+	defer mirrorClient.Close()
+	assert.Nil(t, mirrorClient.Publish(ctx, "news", "mirrored").Err())
+	assert.Equal(t, []string{"news:mirrored"}, receivePayloads(t, pubSub.Channel(), 1))
+
+	configuration = doubleWriteConfiguration(strategy.SingleReadDoubleWriteMode, dc1.Addr, dc2.Addr)
+	configuration.RedisConfig.PubSub = &config.PubSubConfiguration{MirrorPublish: true}
+	mirrorRedigoClient := NewDevsporeRedigoClient(configuration)
+	defer mirrorRedigoClient.strategy.Close()
+	_, err = mirrorRedigoClient.Do("PUBLISH", "news", "redigo")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"news:redigo"}, receivePayloads(t, pubSub.Channel(), 1))
+}
@@ -1,5 +1,5 @@
 /*
- * Copyright (c) Huawei Technologies Co., Ltd. 2024-2025.
+ * Copyright (c) Huawei Technologies Co., Ltd. 2021.
  * Licensed under the Apache License, Version 2.0 (the "License"); you may not use
  * this file except in compliance with the License.  You may obtain a copy of the
  * License at
@@ -17,8 +17,14 @@ package redigostrategy
 
 import (
 	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
 	"log"
+	"math/rand"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	sentinel "github.com/FZambia/sentinel/v2"
@@ -26,6 +32,8 @@ import (
 	"github.com/gomodule/redigo/redis"
 	"github.com/huaweicloud/devcloud-go/mas"
 	"github.com/huaweicloud/devcloud-go/redis/config"
+	"github.com/huaweicloud/devcloud-go/redis/instrument"
+	"github.com/huaweicloud/devcloud-go/redis/strategy"
 	"github.com/mna/redisc"
 )
 
@@ -33,9 +41,33 @@ import (
 type RedigoUniversalClient struct {
 	*redis.Pool
 	*redisc.Cluster
+	// replicas the replicas for reads of master-slave, or of sentinel with routeByLatency/routeRandomly
+	replicas *redigoReplicas
+	// poolTimeout the max time Get waits for a connection of the exhausted pool
+	poolTimeout time.Duration
+	keeper      *idleKeeper
+	// injection the chaos injection before every command, nil if chaos is not configured
+	injection *mas.InjectionManagement
+	// serverClient the client of the server if it is the client of a replica for reads
+	serverClient *RedigoUniversalClient
+	// instrumentation observes every command, nil if instrumentation is not enabled
+	instrumentation instrument.Instrumentation
+	serverName      string
+}
+
+// server returns the client of the server, which is the same for all replicas of the server.
+func (r *RedigoUniversalClient) server() *RedigoUniversalClient {
+	if r == nil || r.serverClient == nil {
+		return r
+	}
+	return r.serverClient
 }
 
 func (r RedigoUniversalClient) Close() error {
+	r.keeper.close()
+	if r.replicas != nil {
+		r.replicas.close()
+	}
 	if r.Pool != nil {
 		return r.Pool.Close()
 	} else if r.Cluster != nil {
@@ -46,7 +78,7 @@ func (r RedigoUniversalClient) Close() error {
 
 func (r RedigoUniversalClient) Get() redis.Conn {
 	if r.Pool != nil {
-		return r.Pool.Get()
+		return getConn(r.Pool, r.poolTimeout)
 	} else if r.Cluster != nil {
 		return r.Cluster.Get()
 	}
@@ -70,6 +102,23 @@ func (r RedigoUniversalClient) Stats() redis.PoolStats {
 	return redis.PoolStats{}
 }
 
+// inUseCount returns the number of connections which are not idle.
+func (r RedigoUniversalClient) inUseCount() int {
+	if r.Pool != nil {
+		stats := r.Pool.Stats()
+		inUse := stats.ActiveCount - stats.IdleCount
+		if r.replicas != nil {
+			inUse += r.replicas.inUseCount()
+		}
+		return inUse
+	}
+	inUse := 0
+	for _, stats := range r.ClusterStats() {
+		inUse += stats.ActiveCount - stats.IdleCount
+	}
+	return inUse
+}
+
 func (r RedigoUniversalClient) ClusterStats() map[string]redis.PoolStats {
 	if r.Cluster != nil {
 		return r.Cluster.Stats()
@@ -77,16 +126,51 @@ func (r RedigoUniversalClient) ClusterStats() map[string]redis.PoolStats {
 	return nil
 }
 
+// observe execute fn as the command, which is reported to the instrumentation if it is enabled.
+func (r RedigoUniversalClient) observe(ctx context.Context, commandName, routeType string,
+	fn func(ctx context.Context) error) error {
+	if r.instrumentation == nil {
+		return fn(ctx)
+	}
+	event := &instrument.Event{Command: strings.ToLower(commandName), Server: r.serverName, RouteType: routeType}
+	return instrument.Observe(ctx, r.instrumentation, event, fn)
+}
+
 func (r RedigoUniversalClient) Do(commandName string, args ...interface{}) (reply interface{}, err error) {
-	conn := r.Get()
-	defer conn.Close()
-	return conn.Do(commandName, args...)
+	ctx := context.Background()
+	routeType := strategy.InstrumentRouteType(ctx, commandName, args)
+	err = r.observe(ctx, commandName, routeType, func(ctx context.Context) error {
+		if err := r.injection.Inject(); err != nil {
+			return err
+		}
+		conn := r.Get()
+		if conn == nil {
+			return fmt.Errorf("get no available pool")
+		}
+		defer conn.Close()
+		var err error
+		reply, err = conn.Do(commandName, args...)
+		return err
+	})
+	return reply, err
 }
 
 func (r RedigoUniversalClient) DoContext(ctx context.Context, commandName string, args ...interface{}) (reply interface{}, err error) {
-	conn := r.Get()
-	defer conn.Close()
-	return redis.DoContext(conn, ctx, commandName, args...)
+	routeType := strategy.InstrumentRouteType(ctx, commandName, args)
+	err = r.observe(ctx, commandName, routeType, func(ctx context.Context) error {
+		if err := r.injection.Inject(); err != nil {
+			return err
+		}
+		conn := r.Get()
+		if conn == nil {
+			return fmt.Errorf("get no available pool")
+		}
+		defer conn.Close()
+		var err error
+		reply, err = redis.DoContext(conn, ctx, commandName, args...)
+		return err
+	})
+	return reply, err
 }
 
 type RedigoCommandArgs struct {
@@ -100,12 +184,40 @@ type RedigoPipeineArgs struct {
 }
 
 func (r RedigoUniversalClient) Pipeline(transactions bool, cmds interface{}) (reply []interface{}, err error) {
+	return r.pipelineContext(context.Background(), transactions, cmds)
+}
+
+func (r RedigoUniversalClient) pipelineContext(ctx context.Context, transactions bool,
+	cmds interface{}) (reply []interface{}, err error) {
 	args, err := covertPipelineCmds(cmds)
 	if err != nil {
 		return nil, err
 	}
 	if transactions {
-		return r.Transactions(args)
+		return r.transactionsContext(ctx, args)
+	}
+	err = r.observe(ctx, "pipeline", pipelineRouteType(ctx, args), func(ctx context.Context) error {
+		var err error
+		reply, err = r.pipeline(args)
+		return err
+	})
+	return reply, err
+}
+
+// pipelineRouteType the route type of a pipeline is write if any command of it is a write.
+func pipelineRouteType(ctx context.Context, args []*RedigoCommandArgs) string {
+	for _, cmd := range args {
+		routeType := strategy.InstrumentRouteType(ctx, cmd.CommandName, cmd.Args)
+		if routeType != instrument.RouteTypeRead {
+			return routeType
+		}
+	}
+	return instrument.RouteTypeRead
+}
+
+func (r RedigoUniversalClient) pipeline(args []*RedigoCommandArgs) (reply []interface{}, err error) {
+	if err = r.injection.Inject(); err != nil {
+		return nil, err
 	}
 	conn := r.Get()
 	defer conn.Close()
@@ -169,6 +281,23 @@ func covertPipelineCmds(cmds interface{}) ([]*RedigoCommandArgs, error) {
 }
 
 func (r RedigoUniversalClient) Transactions(args []*RedigoCommandArgs) (reply []interface{}, err error) {
+	return r.transactionsContext(context.Background(), args)
+}
+
+func (r RedigoUniversalClient) transactionsContext(ctx context.Context,
+	args []*RedigoCommandArgs) (reply []interface{}, err error) {
+	err = r.observe(ctx, "multi", pipelineRouteType(ctx, args), func(ctx context.Context) error {
+		var err error
+		reply, err = r.transactions(args)
+		return err
+	})
+	return reply, err
+}
+
+func (r RedigoUniversalClient) transactions(args []*RedigoCommandArgs) (reply []interface{}, err error) {
+	if err = r.injection.Inject(); err != nil {
+		return nil, err
+	}
 	conn := r.Get()
 	defer conn.Close()
 	conn.Send("MULTI")
@@ -184,82 +313,245 @@ func (r RedigoUniversalClient) Transactions(args []*RedigoCommandArgs) (reply []
 }
 
 type abstractRedigoStrategy struct {
-	ClientPool          map[string]*RedigoUniversalClient
 	Configuration       *config.Configuration
 	injectionManagement *mas.InjectionManagement
+	// clientPool map[string]*RedigoUniversalClient, it is never modified after stored, so commands get clients
+	// without lock; changes are made on a copy under mutex.
+	clientPool *atomic.Value
+	mutex      *sync.Mutex
+	// classifier classify commands by the COMMAND INFO of every server
+	classifier      *strategy.CommandClassifier
+	instrumentation instrument.Instrumentation
 }
 
 func newAbstractStrategy(configuration *config.Configuration) abstractRedigoStrategy {
-	strategy := abstractRedigoStrategy{
+	redigoStrategy := abstractRedigoStrategy{
 		Configuration: configuration,
-		ClientPool:    map[string]*RedigoUniversalClient{}}
-	strategy.initClients(false)
+		clientPool:    &atomic.Value{},
+		mutex:         &sync.Mutex{}}
+	if configuration.Chaos != nil {
+		redigoStrategy.injectionManagement = mas.NewInjectionManagement(configuration.Chaos)
+		redigoStrategy.injectionManagement.SetError(mas.RedisErrors())
+	}
+	redigoStrategy.instrumentation = instrument.New(configuration.RedisConfig.Instrumentation)
+	redigoStrategy.initClients()
+	redigoStrategy.classifier = strategy.NewCommandClassifier(redigoStrategy.fetchCommandTable)
+	redigoStrategy.classifier.SetMirrorPublish(configuration.RedisConfig.MirrorPublish())
+	return redigoStrategy
+}
 
-	return strategy
+// fetchCommandTable fetch the COMMAND INFO of all commands of the server.
+func (a *abstractRedigoStrategy) fetchCommandTable(serverName string) (strategy.CommandTable, error) {
+	reply, err := a.getClientByServerName(serverName).Do("COMMAND")
+	if err != nil {
+		return nil, err
+	}
+	return strategy.ParseCommandTable(reply)
 }
 
-func (a *abstractRedigoStrategy) initClients(chaos bool) {
-	for name, serverConfig := range a.Configuration.RedisConfig.Servers {
-		client := newClient(serverConfig)
-		if chaos {
-			log.Println("Info: redigo client no support chaos")
-		}
-		a.ClientPool[name] = client
+// CommandType returns the type of the command on the active server, by its COMMAND INFO.
+func (a *abstractRedigoStrategy) CommandType(commandName string, args ...interface{}) strategy.CommandType {
+	return a.classifier.CommandType(a.routing().Active, commandName, args)
+}
+
+// Scripts returns the script registry of the classifier.
+func (a *abstractRedigoStrategy) Scripts() *strategy.ScriptRegistry {
+	return a.classifier.Scripts()
+}
+
+func (a *abstractRedigoStrategy) initClients() {
+	clientPool := map[string]*RedigoUniversalClient{}
+	for name, serverConfig := range a.routing().Servers {
+		clientPool[name] = a.createClient(name, serverConfig)
 	}
+	a.clientPool.Store(clientPool)
+}
+
+// createClient create a client of the server with the chaos injection and the instrumentation of the strategy.
+func (a *abstractRedigoStrategy) createClient(serverName string,
+	serverConfig *config.ServerConfiguration) *RedigoUniversalClient {
+	client := newClient(serverConfig)
+	if client != nil {
+		client.injection = a.injectionManagement
+		client.instrumentation = a.instrumentation
+		client.serverName = serverName
+	}
+	return client
+}
+
+// DoubleWriteStats returns the async executor stats of every target server, empty if the strategy has no
+// double-write.
+func (a *abstractRedigoStrategy) DoubleWriteStats() map[string]strategy.AsyncExecutorStats {
+	return map[string]strategy.AsyncExecutorStats{}
+}
+
+// routing returns the current routing snapshot, callers should route one command with one snapshot.
+func (a *abstractRedigoStrategy) routing() *config.RoutingSnapshot {
+	return a.Configuration.Snapshot()
 }
 
 func (a *abstractRedigoStrategy) activeClient() *RedigoUniversalClient {
-	activeServer := a.Configuration.Active
-	return a.getClientByServerName(activeServer)
+	return a.getClientByServerName(a.routing().Active)
 }
 
 func (a *abstractRedigoStrategy) noActiveClient() *RedigoUniversalClient {
-	activeServer := a.Configuration.Active
-	for name, _ := range a.Configuration.RedisConfig.Servers {
-		if name != activeServer {
-			return a.getClientByServerName(name)
-		}
+	if noActiveServer := a.routing().NoActive(); noActiveServer != "" {
+		return a.getClientByServerName(noActiveServer)
 	}
 	log.Println("info: 'single-read-async-double-write' need another redis server for double write!")
 	return nil
 }
 
 func (a *abstractRedigoStrategy) nearestClient() *RedigoUniversalClient {
-	nearest := a.Configuration.RedisConfig.Nearest
-	return a.getClientByServerName(nearest)
+	return a.getClientByServerName(a.routing().Nearest)
 }
 
 func (a *abstractRedigoStrategy) remoteClient() *RedigoUniversalClient {
-	nearest := a.Configuration.RedisConfig.Nearest
-	for name, _ := range a.Configuration.RedisConfig.Servers {
-		if name != nearest {
-			return a.getClientByServerName(name)
-		}
+	if remoteServer := a.routing().Remote(); remoteServer != "" {
+		return a.getClientByServerName(remoteServer)
 	}
 	log.Println("ERROR: routeAlgorithm 'local-read-async-double-write' need another redis server for double write!")
 	return &RedigoUniversalClient{}
 }
 
+// hintedClient returns the client of the routing hint of the context, writeServer is the server which the route
+// algorithm routes the writes to.
+func (a *abstractRedigoStrategy) hintedClient(ctx context.Context, opType strategy.CommandType,
+	writeServer string) (*RedigoUniversalClient, bool) {
+	server, master, ok := strategy.HintedServer(ctx, a.routing(), opType, writeServer)
+	if !ok {
+		return nil, false
+	}
+	client := a.getClientByServerName(server)
+	if master {
+		return client, true
+	}
+	return readClient(client, opType), true
+}
+
 func (a *abstractRedigoStrategy) getClientByServerName(serverName string) *RedigoUniversalClient {
-	if client, ok := a.ClientPool[serverName]; ok {
+	if client, ok := a.clients()[serverName]; ok {
 		return client
 	}
-	if serverConfig, ok := a.Configuration.RedisConfig.Servers[serverName]; ok && serverConfig != nil {
-		a.ClientPool[serverName] = newClient(serverConfig)
-		return a.ClientPool[serverName]
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	clientPool := a.clients()
+	if client, ok := clientPool[serverName]; ok {
+		return client
+	}
+	if serverConfig, ok := a.routing().Servers[serverName]; ok && serverConfig != nil {
+		client := a.createClient(serverName, serverConfig)
+		a.storeClients(clientPool, map[string]*RedigoUniversalClient{serverName: client})
+		return client
 	}
 	log.Printf("ERROR: server '%s' has no config!", serverName)
 	return &RedigoUniversalClient{}
 }
 
+// clients return the current client pool, which must not be modified.
+func (a *abstractRedigoStrategy) clients() map[string]*RedigoUniversalClient {
+	clientPool, _ := a.clientPool.Load().(map[string]*RedigoUniversalClient)
+	return clientPool
+}
+
+// storeClients store a copy of the client pool with the new clients, the caller must hold the mutex.
+func (a *abstractRedigoStrategy) storeClients(clientPool, newClients map[string]*RedigoUniversalClient) {
+	newClientPool := make(map[string]*RedigoUniversalClient, len(clientPool)+len(newClients))
+	for name, client := range clientPool {
+		newClientPool[name] = client
+	}
+	for name, client := range newClients {
+		newClientPool[name] = client
+	}
+	a.clientPool.Store(newClientPool)
+}
+
+// ReloadClients rebuild the clients of the servers with the current server configuration, the replaced
+// clients are closed after their in-flight commands finished.
+func (a *abstractRedigoStrategy) ReloadClients(serverNames ...string) {
+	a.mutex.Lock()
+	clientPool := a.clients()
+	servers := a.routing().Servers
+	newClients := make(map[string]*RedigoUniversalClient, len(serverNames))
+	replacedClients := make([]*RedigoUniversalClient, 0, len(serverNames))
+	for _, serverName := range serverNames {
+		serverConfig, ok := servers[serverName]
+		if !ok || serverConfig == nil {
+			log.Printf("ERROR: server '%s' has no config!", serverName)
+			continue
+		}
+		if client, ok := clientPool[serverName]; ok && client != nil {
+			replacedClients = append(replacedClients, client)
+		}
+		newClients[serverName] = a.createClient(serverName, serverConfig)
+		a.classifier.Reset(serverName)
+		log.Printf("INFO: redis server '%s' redigo client reloaded", serverName)
+	}
+	a.storeClients(clientPool, newClients)
+	a.mutex.Unlock()
+	for _, client := range replacedClients {
+		go func(client *RedigoUniversalClient) {
+			drainClient(client)
+			if err := client.Close(); err != nil {
+				log.Printf("WARNING: close replaced client failed, %v", err)
+			}
+		}(client)
+	}
+}
+
+// drain waits for the in-flight commands of all clients finished.
+func (a *abstractRedigoStrategy) drain() {
+	var wg sync.WaitGroup
+	for _, client := range a.clients() {
+		if client == nil {
+			continue
+		}
+		wg.Add(1)
+		go func(client *RedigoUniversalClient) {
+			defer wg.Done()
+			drainClient(client)
+		}(client)
+	}
+	wg.Wait()
+}
+
+// GracefulClose waits for the in-flight commands finished and closes all clients.
+func (a *abstractRedigoStrategy) GracefulClose() error {
+	a.drain()
+	return a.Close()
+}
+
 func (a *abstractRedigoStrategy) Close() error {
 	var err error
-	for _, client := range a.ClientPool {
+	for _, client := range a.clients() {
+		if client == nil {
+			continue
+		}
 		err = client.Close()
 	}
 	return err
 }
 
+const (
+	drainGracePeriod   = time.Second
+	drainTimeout       = 30 * time.Second
+	drainCheckInterval = 100 * time.Millisecond
+)
+
+// drainClient waits until the client has no connection in use or drainTimeout reached. The grace period lets
+// the callers which already got the client start their commands.
+func drainClient(client *RedigoUniversalClient) {
+	time.Sleep(drainGracePeriod)
+	deadline := time.Now().Add(drainTimeout)
+	for time.Now().Before(deadline) {
+		if client.inUseCount() == 0 {
+			return
+		}
+		time.Sleep(drainCheckInterval)
+	}
+	log.Println("WARNING: drain redigo client timeout, close it with connections in use")
+}
+
 func newClient(serverConfig *config.ServerConfiguration) *RedigoUniversalClient {
 	var client *RedigoUniversalClient
 	switch serverConfig.Type {
@@ -267,6 +559,8 @@ func newClient(serverConfig *config.ServerConfiguration) *RedigoUniversalClient
 		client = newClusterClient(serverConfig)
 	case config.ServerTypeNormal:
 		client = newNormalClient(serverConfig)
+	case config.ServerTypeMasterSlave:
+		client = newMasterSlaveClient(serverConfig)
 	case config.ServerTypeSentinel:
 		client = newSentinelClient(serverConfig)
 	default:
@@ -276,87 +570,127 @@ func newClient(serverConfig *config.ServerConfiguration) *RedigoUniversalClient
 }
 
 func newNormalClient(serverConfig *config.ServerConfiguration) *RedigoUniversalClient {
-	pool := &redis.Pool{
-
-		MaxIdle:     serverConfig.ConnectionPool.MaxIdle,
-		MaxActive:   serverConfig.ConnectionPool.MaxTotal,
-		IdleTimeout: 240 * time.Second,
-
-		Dial: func() (redis.Conn, error) {
-			c, err := redis.Dial("tcp", serverConfig.Hosts,
-				redis.DialPassword(serverConfig.Password),
-				redis.DialConnectTimeout(time.Duration(serverConfig.Options.DialTimeout)),
-				redis.DialWriteTimeout(time.Duration(serverConfig.Options.DialTimeout)),
-				redis.DialReadTimeout(time.Duration(serverConfig.Options.DialTimeout)),
-				redis.DialDatabase(serverConfig.Options.DB),
-			)
-			if err != nil {
-				return nil, err
-			}
-			return c, err
-		},
+	options := newRedigoPoolOptions(serverConfig)
+	keeper := newIdleKeeper(options)
+	return &RedigoUniversalClient{
+		Pool:        newNormalPool(serverConfig, serverConfig.Hosts, options, keeper),
+		poolTimeout: options.waitTimeout,
+		keeper:      keeper,
+	}
+}
 
-		TestOnBorrow: func(c redis.Conn, t time.Time) error {
-			_, err := c.Do("PING")
-			return err
-		},
+// newNormalPool create the pool of the redis server at addr, which is the hosts of a normal server, or the master
+// or a replica of a master-slave server.
+func newNormalPool(serverConfig *config.ServerConfiguration, addr string, options redigoPoolOptions,
+	keeper *idleKeeper) *redis.Pool {
+	return newPool(options, func() (redis.Conn, error) {
+		opts := serverConfig.Options
+		return redis.Dial("tcp", addr,
+			dialOptions(opts.Username, opts.Password, opts.TLSConfig, opts.DialTimeout, opts.DB)...)
+	}, keeper)
+}
+
+// dialOptions create the options to dial a redis server, AUTH is sent with the username if it is not empty,
+// and TLS is used if tlsConfig is not nil.
+func dialOptions(username, password string, tlsConfig *tls.Config, timeout time.Duration,
+	db int) []redis.DialOption {
+	opts := []redis.DialOption{
+		redis.DialUsername(username),
+		redis.DialPassword(password),
+		redis.DialConnectTimeout(timeout),
+		redis.DialWriteTimeout(timeout),
+		redis.DialReadTimeout(timeout),
+		redis.DialDatabase(db),
 	}
-	return &RedigoUniversalClient{
-		Pool: pool,
+	if tlsConfig != nil {
+		opts = append(opts, redis.DialUseTLS(true), redis.DialTLSConfig(tlsConfig))
 	}
+	return opts
 }
 
 func newSentinelClient(serverConfig *config.ServerConfiguration) *RedigoUniversalClient {
+	failoverOptions := serverConfig.FailoverOptions
 	sntnl := &sentinel.Sentinel{
-		Addrs:      serverConfig.FailoverOptions.SentinelAddrs,
-		MasterName: serverConfig.FailoverOptions.MasterName,
+		Addrs:      failoverOptions.SentinelAddrs,
+		MasterName: failoverOptions.MasterName,
 		Dial: func(addr string) (redis.Conn, error) {
-			c, err := redis.Dial("tcp", addr,
-				redis.DialConnectTimeout(time.Duration(serverConfig.FailoverOptions.DialTimeout)))
+			c, err := redis.Dial("tcp", addr, dialOptions("", failoverOptions.SentinelPassword,
+				failoverOptions.TLSConfig, failoverOptions.DialTimeout, 0)...)
 			if err != nil {
 				return nil, err
 			}
 			return c, nil
 		},
 	}
-	pool := &redis.Pool{
-		MaxIdle:     serverConfig.FailoverOptions.PoolSize,
-		MaxActive:   serverConfig.FailoverOptions.PoolSize,
-		Wait:        true,
-		IdleTimeout: serverConfig.FailoverOptions.PoolTimeout,
-		Dial: func() (redis.Conn, error) {
-			masterAddr, err := sntnl.MasterAddr()
-			if err != nil {
-				return nil, err
-			}
-			c, err := redis.Dial("tcp", masterAddr,
-				redis.DialPassword(serverConfig.Password),
-				redis.DialConnectTimeout(time.Duration(serverConfig.FailoverOptions.DialTimeout)),
-				redis.DialWriteTimeout(time.Duration(serverConfig.FailoverOptions.DialTimeout)),
-				redis.DialReadTimeout(time.Duration(serverConfig.FailoverOptions.DialTimeout)),
-				redis.DialDatabase(serverConfig.FailoverOptions.DB))
-			if err != nil {
-				return nil, err
-			}
-			isMaster, err := sentinel.TestRole(c, "master")
-			if err != nil {
-				c.Close()
-				return nil, err
-			}
-			if !isMaster {
-				c.Close()
-				return nil, fmt.Errorf("%s is not redis master", masterAddr)
+	options := newRedigoPoolOptions(serverConfig)
+	keeper := newIdleKeeper(options)
+	client := &RedigoUniversalClient{
+		Pool: newSentinelPool(serverConfig, func() (string, error) {
+			if failoverOptions.SlaveOnly {
+				return randomSlaveAddr(sntnl)
 			}
+			return sntnl.MasterAddr()
+		}, !failoverOptions.SlaveOnly, options, keeper),
+		poolTimeout: options.waitTimeout,
+		keeper:      keeper,
+	}
+	if failoverOptions.RouteByLatency || failoverOptions.RouteRandomly {
+		readFrom := config.ReadFromRandom
+		if failoverOptions.RouteByLatency {
+			readFrom = config.ReadFromLeastLatency
+		}
+		interval := time.Duration(serverConfig.ReplicaCheckIntervalMillis) * time.Millisecond
+		client.replicas = newRedigoReplicas(readFrom, interval, sntnl.SlaveAddrs, options.waitTimeout,
+			func(addr string) *redis.Pool {
+				return newSentinelPool(serverConfig, func() (string, error) {
+					return addr, nil
+				}, false, options, keeper)
+			})
+	}
+	return client
+}
+
+// newSentinelPool create the pool of the server at the address returned by addr, the role of the connections is
+// checked if master is true.
+func newSentinelPool(serverConfig *config.ServerConfiguration, addr func() (string, error), master bool,
+	options redigoPoolOptions, keeper *idleKeeper) *redis.Pool {
+	return newPool(options, func() (redis.Conn, error) {
+		serverAddr, err := addr()
+		if err != nil {
+			return nil, err
+		}
+		opts := serverConfig.FailoverOptions
+		c, err := redis.Dial("tcp", serverAddr,
+			dialOptions(opts.Username, opts.Password, opts.TLSConfig, opts.DialTimeout, opts.DB)...)
+		if err != nil {
+			return nil, err
+		}
+		if !master {
 			return c, nil
-		},
-		TestOnBorrow: func(c redis.Conn, t time.Time) error {
-			_, err := c.Do("PING")
-			return err
-		},
+		}
+		isMaster, err := sentinel.TestRole(c, "master")
+		if err != nil {
+			c.Close()
+			return nil, err
+		}
+		if !isMaster {
+			c.Close()
+			return nil, fmt.Errorf("%s is not redis master", serverAddr)
+		}
+		return c, nil
+	}, keeper)
+}
+
+// randomSlaveAddr returns the address of a random available replica of the sentinel master.
+func randomSlaveAddr(sntnl *sentinel.Sentinel) (string, error) {
+	addrs, err := sntnl.SlaveAddrs()
+	if err != nil {
+		return "", err
 	}
-	return &RedigoUniversalClient{
-		Pool: pool,
+	if len(addrs) == 0 {
+		return "", fmt.Errorf("master '%s' has no available replica", sntnl.MasterName)
 	}
+	return addrs[rand.Intn(len(addrs))], nil
 }
 
 func newClusterClient(serverConfig *config.ServerConfiguration) *RedigoUniversalClient {
@@ -365,9 +699,11 @@ func newClusterClient(serverConfig *config.ServerConfiguration) *RedigoUniversal
 		StartupNodes: serverConfig.ClusterOptions.Addrs,
 		DialOptions:  []redis.DialOption{redis.DialConnectTimeout(5 * time.Second)},
 		CreatePool:   createPool(config),
+		PoolWaitTime: config.options.waitTimeout,
 	}
 	return &RedigoUniversalClient{
 		Cluster: cluster,
+		keeper:  config.keeper,
 	}
 }
 
@@ -383,10 +719,32 @@ func Watch(client redis.Conn, keys ...string) error {
 	return nil
 }
 
+// watchConn execute fn on a connection of the client watching the keys, the connection is closed after fn
+// returns, so it is released to the pool.
+func watchConn(client *RedigoUniversalClient, fn func(conn redis.Conn) error, keys ...string) error {
+	if client == nil {
+		return errors.New("no available redis client")
+	}
+	conn := client.Get()
+	if conn == nil {
+		return errors.New("get no available connection")
+	}
+	defer func() {
+		if err := conn.Close(); err != nil {
+			log.Printf("ERROR: close watched connection failed, %v", err)
+		}
+	}()
+	if err := Watch(conn, keys...); err != nil {
+		return err
+	}
+	return fn(conn)
+}
+
 func (a *abstractRedigoStrategy) BeforeProcess(ctx context.Context, cmd goredis.Cmder) (context.Context, error) {
+	// the context is returned with the error, the hooks before it still process it in AfterProcess
 	err := a.injectionManagement.Inject()
 	if err != nil {
-		return nil, err
+		return ctx, err
 	}
 	return ctx, nil
 }
@@ -1,6 +1,7 @@
 package redigostrategy
 
 import (
+	"crypto/tls"
 	"time"
 
 	"github.com/gomodule/redigo/redis"
@@ -10,41 +11,38 @@ import (
 type RedigoClusterConfig struct {
 	MaxIdle   int
 	MaxActive int
+	Username  string
 	Password  string
 	Timeout   time.Duration
+	TLSConfig *tls.Config
+	options   redigoPoolOptions
+	keeper    *idleKeeper
 }
 
 func newRedigoClusterConfig(serverConfig *config.ServerConfiguration) *RedigoClusterConfig {
+	options := newRedigoPoolOptions(serverConfig)
 	return &RedigoClusterConfig{
-		MaxIdle:   serverConfig.ConnectionPool.MaxIdle,
-		MaxActive: serverConfig.ConnectionPool.MaxTotal,
-		Password:  serverConfig.Password,
+		MaxIdle:   options.maxIdle,
+		MaxActive: options.maxActive,
+		Username:  serverConfig.ClusterOptions.Username,
+		Password:  serverConfig.ClusterOptions.Password,
 		Timeout:   serverConfig.ClusterOptions.DialTimeout,
+		TLSConfig: serverConfig.ClusterOptions.TLSConfig,
+		options:   options,
+		keeper:    newIdleKeeper(options),
 	}
 }
 
+// createPool create the pool of a cluster node, the configured options take precedence over opts of the cluster.
 func (r RedigoClusterConfig) createPool(addr string, opts ...redis.DialOption) (*redis.Pool, error) {
-	return &redis.Pool{
-		MaxIdle:     r.MaxIdle,
-		MaxActive:   r.MaxActive,
-		Wait:        true,
-		IdleTimeout: time.Minute,
-		Dial: func() (redis.Conn, error) {
-			c, err := redis.Dial("tcp", addr,
-				redis.DialPassword(r.Password),
-				redis.DialConnectTimeout(time.Duration(r.Timeout)),
-				redis.DialWriteTimeout(time.Duration(r.Timeout)),
-				redis.DialReadTimeout(time.Duration(r.Timeout)))
-			if err != nil {
-				return nil, err
-			}
-			return c, err
-		},
-		TestOnBorrow: func(c redis.Conn, t time.Time) error {
-			_, err := c.Do("PING")
-			return err
-		},
-	}, nil
+	dialOpts := make([]redis.DialOption, 0, len(opts)+8)
+	dialOpts = append(dialOpts, opts...)
+	dialOpts = append(dialOpts, dialOptions(r.Username, r.Password, r.TLSConfig, r.Timeout, 0)...)
+	options := r.options
+	options.maxIdle, options.maxActive = r.MaxIdle, r.MaxActive
+	return newPool(options, func() (redis.Conn, error) {
+		return redis.Dial("tcp", addr, dialOpts...)
+	}, r.keeper), nil
 }
 
 func createPool(r *RedigoClusterConfig) func(addr string, opts ...redis.DialOption) (*redis.Pool, error) {
@@ -1,5 +1,5 @@
 /*
- * Copyright (c) Huawei Technologies Co., Ltd. 2024-2025.
+ * Copyright (c) Huawei Technologies Co., Ltd. 2021.
  * Licensed under the Apache License, Version 2.0 (the "License"); you may not use
  * this file except in compliance with the License.  You may obtain a copy of the
  * License at
@@ -17,62 +17,238 @@ package redigostrategy
 
 import (
 	"context"
+	"fmt"
 	"log"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
 
 	"github.com/huaweicloud/devcloud-go/redis/config"
 	"github.com/huaweicloud/devcloud-go/redis/file"
+	"github.com/huaweicloud/devcloud-go/redis/instrument"
 	"github.com/huaweicloud/devcloud-go/redis/strategy"
 )
 
+const defaultReplayInterval = 10 * time.Second
+
 // local-read-async-double-write
 type DoubleWriteRedigoStrategy struct {
 	abstractRedigoStrategy
-	jobChan chan job
+	replicas      map[string]*replica
+	replicasMutex sync.Mutex
+	stop          chan struct{}
+	stopOnce      sync.Once
+	// sourceServer returns the server which executes the commands
+	sourceServer func(routing *config.RoutingSnapshot) string
+	// targetServers returns the servers which receive the mirrored writes
+	targetServers func(routing *config.RoutingSnapshot) []string
+}
+
+// replica is a target server of double write with its own executor, so a slow or down server does not block the
+// others. The WAL keeps the commands spilled by the executor, or all the mirrored commands with persist, which
+// has no executor.
+type replica struct {
+	name     string
+	executor *strategy.AsyncExecutor
+	wal      *file.WAL
+	scripts  *strategy.ScriptRegistry
 }
 
 func newDoubleWriteStrategy(configuration *config.Configuration) *DoubleWriteRedigoStrategy {
 	doubleWriteStrategy := &DoubleWriteRedigoStrategy{
 		abstractRedigoStrategy: newAbstractStrategy(configuration),
-		jobChan:                make(chan job, 0),
 	}
-	if configuration.RedisConfig.AsyncRemotePoolConfiguration == nil {
+	doubleWriteStrategy.sourceServer = routeNearest
+	doubleWriteStrategy.targetServers = (*config.RoutingSnapshot).Remotes
+	doubleWriteStrategy.initDoubleWrite()
+	return doubleWriteStrategy
+}
+
+func routeNearest(routing *config.RoutingSnapshot) string {
+	return routing.Nearest
+}
+
+func routeActive(routing *config.RoutingSnapshot) string {
+	return routing.Active
+}
+
+// initDoubleWrite create the replicas of all servers.
+func (d *DoubleWriteRedigoStrategy) initDoubleWrite() {
+	poolConfig := d.Configuration.RedisConfig.AsyncRemotePoolConfiguration
+	if poolConfig == nil {
 		log.Fatalln("asyncRemotePool is required")
 	}
-	file.MkDirs(configuration.RedisConfig.AsyncRemotePoolConfiguration.PersistDir)
-	doubleWriteStrategy.createThreadPoolExecutor(configuration.RedisConfig.AsyncRemotePoolConfiguration)
-	go doubleWriteStrategy.asyncDoubleWrite()
-	return doubleWriteStrategy
+	d.replicas = make(map[string]*replica)
+	d.stop = make(chan struct{})
+	replay := poolConfig.Persist || poolConfig.OverflowPolicy == strategy.OverflowSpill
+	for _, name := range d.routing().ServerNames() {
+		if r := d.replica(name); r != nil && r.wal != nil {
+			// the files left by old versions are migrated to the wal
+			replay = true
+		}
+	}
+	if replay {
+		go d.asyncReplay(poolConfig)
+	}
+}
+
+func (d *DoubleWriteRedigoStrategy) RouteClient(ctx context.Context, opType strategy.CommandType) *RedigoUniversalClient {
+	if client, ok := d.hintedClient(ctx, opType, d.routing().Nearest); ok {
+		return client
+	}
+	return readClient(d.nearestClient(), opType)
 }
 
-func (d *DoubleWriteRedigoStrategy) RouteClient(opType strategy.CommandType) *RedigoUniversalClient {
-	return d.nearestClient()
+// Watch execute fn on a connection of the source server watching the keys, the succeeded writes executed on it
+// are mirrored, the writes of MULTI/EXEC are mirrored as one transaction after EXEC succeeded.
+func (d *DoubleWriteRedigoStrategy) Watch(ctx context.Context, fn func(conn redis.Conn) error, keys ...string) error {
+	source, client, targets := d.route(ctx)
+	return watchConn(client, func(conn redis.Conn) error {
+		return fn(&mirrorConn{Conn: conn, strategy: d, source: source, targets: targets})
+	}, keys...)
 }
 
-func (d *DoubleWriteRedigoStrategy) Watch(ctx context.Context, keys ...string) error {
-	go func() {
-		_ = Watch(d.remoteClient().Get(), keys...)
-	}()
-	err := Watch(d.nearestClient().Get(), keys...)
-	return err
+func (d *DoubleWriteRedigoStrategy) Do(ctx context.Context, opType strategy.CommandType, commandName string, args ...interface{}) (reply interface{}, err error) {
+	return d.doAndMirror(ctx, opType, commandName, args...)
 }
 
-func (d *DoubleWriteRedigoStrategy) Do(opType strategy.CommandType, commandName string, args ...interface{}) (reply interface{}, err error) {
-	reply, err = d.RouteClient(opType).Do(commandName, args...)
-	if strategy.IsWriteCommand(commandName, args) {
-		d.executeAsyncNotPersist(context.TODO(), RedigoCommandArgs{
-			CommandName: commandName,
-			Args:        args,
-		})
+func (d *DoubleWriteRedigoStrategy) Pipeline(ctx context.Context, transactions bool, cmds interface{}) ([]interface{}, error) {
+	return d.pipelineAndMirror(ctx, transactions, cmds)
+}
+
+// route returns the source server, its client and the target servers from the same routing snapshot, so a
+// switch never mirrors back to the source. The server pinned by the context is the source of its commands.
+func (d *DoubleWriteRedigoStrategy) route(ctx context.Context) (string, *RedigoUniversalClient, []string) {
+	routing := d.routing()
+	source := d.sourceServer(routing)
+	if pinned := strategy.RouteHintFrom(ctx).Server; pinned != "" && pinned != source {
+		if _, ok := routing.Servers[pinned]; ok {
+			return pinned, d.getClientByServerName(pinned), strategy.OtherServers(routing, pinned)
+		}
+	}
+	return source, d.getClientByServerName(source), d.targetServers(routing)
+}
+
+// doAndMirror execute the command on source server, mirror it when it is a write command and executed successfully.
+// Reads are executed on a replica of the source server if it has replicas.
+func (d *DoubleWriteRedigoStrategy) doAndMirror(ctx context.Context, opType strategy.CommandType, commandName string,
+	args ...interface{}) (reply interface{}, err error) {
+	source, client, targets := d.route(ctx)
+	if hinted, ok := d.hintedClient(ctx, opType, source); ok {
+		client = hinted
+	} else {
+		client = readClient(client, opType)
+	}
+	reply, err = client.Do(commandName, args...)
+	if err == nil {
+		d.Scripts().ObserveScriptLoad(append([]interface{}{commandName}, args...))
+	}
+	if err == nil && d.classifier.IsWrite(source, commandName, args) {
+		for _, target := range targets {
+			d.executeAsyncNotPersist(mirrorContext(), target, d.mirrorArgs(target, commandName, args, reply))
+		}
 	}
 	return
 }
 
-func (d *DoubleWriteRedigoStrategy) Pipeline(transactions bool, cmds interface{}) ([]interface{}, error) {
-	reply, err := d.RouteClient(strategy.CommandTypeMulti).Pipeline(transactions, cmds)
-	d.executePipelineAsyncNotPersist(context.TODO(), transactions, cmds)
+// mirrorArgs returns the command mirrored to the target server, rewritten in idempotent form if it is enabled for
+// the target, EVAL is mirrored as EVALSHA.
+func (d *DoubleWriteRedigoStrategy) mirrorArgs(target, commandName string, args []interface{},
+	reply interface{}) RedigoCommandArgs {
+	rewritten := append([]interface{}{commandName}, args...)
+	if asyncRemoteWrite := d.asyncRemoteWrite(target); asyncRemoteWrite != nil && asyncRemoteWrite.IdempotentRewrite {
+		rewritten = strategy.IdempotentArgs(rewritten, reply)
+	}
+	rewritten = d.Scripts().MirrorScriptArgs(rewritten)
+	name, _ := rewritten[0].(string)
+	return RedigoCommandArgs{CommandName: name, Args: rewritten[1:]}
+}
+
+// pipelineAndMirror execute the pipeline on source server, mirror the write commands of it which are executed
+// successfully as one unit, in MULTI/EXEC if it is a transaction.
+func (d *DoubleWriteRedigoStrategy) pipelineAndMirror(ctx context.Context, transactions bool,
+	cmds interface{}) ([]interface{}, error) {
+	source, client, targets := d.route(ctx)
+	reply, err := client.Pipeline(transactions, cmds)
+	if transactions && err != nil {
+		// EXEC is aborted or failed, nothing is executed
+		return reply, err
+	}
+	args, _ := covertPipelineCmds(cmds)
+	var writes []*RedigoCommandArgs
+	var writeReplies []interface{}
+	// the replies are of the commands with names only
+	i := 0
+	for _, arg := range args {
+		if arg.CommandName == "" {
+			continue
+		}
+		if i >= len(reply) {
+			break
+		}
+		cmdReply := reply[i]
+		i++
+		if _, failed := cmdReply.(error); failed {
+			continue
+		}
+		d.Scripts().ObserveScriptLoad(commandArgs(arg))
+		if d.classifier.IsWrite(source, arg.CommandName, arg.Args) {
+			writes = append(writes, arg)
+			writeReplies = append(writeReplies, cmdReply)
+		}
+	}
+	if len(writes) == 0 {
+		return reply, err
+	}
+	for _, target := range targets {
+		writeArgs := make([]*RedigoCommandArgs, 0, len(writes))
+		for j, write := range writes {
+			mirrorArgs := d.mirrorArgs(target, write.CommandName, write.Args, writeReplies[j])
+			writeArgs = append(writeArgs, &mirrorArgs)
+		}
+		d.executePipelineAsyncNotPersist(mirrorContext(), target, transactions, writeArgs)
+	}
 	return reply, err
 }
 
+// GracefulClose waits for the in-flight commands and the queued double write jobs finished, then stops the
+// async executor and closes all clients.
+func (d *DoubleWriteRedigoStrategy) GracefulClose() error {
+	d.drain()
+	deadline := time.Now().Add(drainTimeout)
+	for d.queuedJobs() > 0 && time.Now().Before(deadline) {
+		time.Sleep(drainCheckInterval)
+	}
+	d.stopExecutor()
+	return d.abstractRedigoStrategy.Close()
+}
+
+func (d *DoubleWriteRedigoStrategy) Close() error {
+	d.stopExecutor()
+	return d.abstractRedigoStrategy.Close()
+}
+
+// stopExecutor stop the executors and close the WALs, the spilled or persisted commands are replayed after
+// restart.
+func (d *DoubleWriteRedigoStrategy) stopExecutor() {
+	d.stopOnce.Do(func() {
+		close(d.stop)
+		for _, r := range d.replicaList() {
+			if r.executor != nil {
+				r.executor.Close()
+			}
+			if r.wal == nil {
+				continue
+			}
+			if err := r.wal.Close(); err != nil {
+				log.Printf("ERROR: close wal of server '%s' failed, %v", r.name, err)
+			}
+		}
+	})
+}
+
 type JobType int32
 
 const (
@@ -84,46 +260,298 @@ type job struct {
 	JobType
 	RedigoCommandArgs
 	ctx          context.Context
+	target       string
 	cmds         interface{}
 	transactions bool
 }
 
-// asyncDoubleWrite Memory double-write
-func (d *DoubleWriteRedigoStrategy) asyncDoubleWrite() {
-	for jobs := range d.jobChan {
-		switch jobs.JobType {
-		case JobTypeDo:
-			for i := 0; i < d.Configuration.RedisConfig.AsyncRemoteWrite.RetryTimes; i++ {
-				if _, err := d.remoteClient().DoContext(jobs.ctx, jobs.CommandName, jobs.Args...); err == nil {
-					break
-				} else {
-					log.Printf("asyncDoubleWrite Do fail %s %v,err is %s,", jobs.CommandName, jobs.Args, err.Error())
+// replica returns the replica of the target server, it is created on the first write mirrored to the server.
+// It returns nil if the strategy is closed or the WAL can not be opened.
+func (d *DoubleWriteRedigoStrategy) replica(target string) *replica {
+	d.replicasMutex.Lock()
+	defer d.replicasMutex.Unlock()
+	if r, ok := d.replicas[target]; ok {
+		return r
+	}
+	select {
+	case <-d.stop:
+		return nil
+	default:
+	}
+	configuration := d.Configuration.RedisConfig.AsyncRemotePoolConfiguration
+	r := &replica{name: target, scripts: d.Scripts()}
+	legacyFiles := file.LegacyFiles(configuration.PersistDir, target)
+	if configuration.Persist || configuration.OverflowPolicy == strategy.OverflowSpill || len(legacyFiles) > 0 {
+		wal, err := file.OpenWAL(filepath.Join(configuration.PersistDir, target), file.WALOptions{
+			SyncPolicy:   configuration.FsyncPolicy,
+			SyncInterval: time.Duration(configuration.FsyncIntervalMillis) * time.Millisecond,
+			SegmentSize:  configuration.SegmentSize,
+		})
+		if err != nil {
+			log.Printf("ERROR: open wal of server '%s' failed, %v", target, err)
+			return nil
+		}
+		r.wal = wal
+		// the commands left by old versions are replayed before the new ones
+		if err = file.MigrateFiles(legacyFiles, wal); err != nil {
+			log.Printf("ERROR: %v", err)
+		}
+	}
+	if !configuration.Persist {
+		r.executor = strategy.NewAsyncExecutor(configuration, r.spill)
+		if r.wal != nil && !r.caughtUp() {
+			// the spilled commands of the last run are replayed before the new ones
+			r.executor.SpillAll()
+		}
+	}
+	d.replicas[target] = r
+	return r
+}
+
+// spill append the overflow task, or the task of persist, to the WAL, it is replayed by asyncReplay.
+func (r *replica) spill(task strategy.AsyncTask) error {
+	return r.wal.Append(r.scripts.PersistItem(task.Item()))
+}
+
+// caughtUp whether all the spilled commands are replayed.
+func (r *replica) caughtUp() bool {
+	lag, err := r.wal.Lag()
+	if err != nil {
+		log.Printf("ERROR: get replay lag of server '%s' failed, %v", r.name, err)
+		return false
+	}
+	return lag.PendingSegments == 0
+}
+
+func (d *DoubleWriteRedigoStrategy) replicaList() []*replica {
+	d.replicasMutex.Lock()
+	defer d.replicasMutex.Unlock()
+	replicas := make([]*replica, 0, len(d.replicas))
+	for _, r := range d.replicas {
+		replicas = append(replicas, r)
+	}
+	return replicas
+}
+
+func (d *DoubleWriteRedigoStrategy) queuedJobs() int {
+	queued := 0
+	for _, r := range d.replicaList() {
+		if r.executor != nil {
+			queued += r.executor.Queued()
+		}
+	}
+	return queued
+}
+
+// DoubleWriteStats returns the executor stats of every target server of memory double-write.
+func (d *DoubleWriteRedigoStrategy) DoubleWriteStats() map[string]strategy.AsyncExecutorStats {
+	stats := make(map[string]strategy.AsyncExecutorStats)
+	for _, r := range d.replicaList() {
+		if r.executor != nil {
+			stats[r.name] = r.executor.Stats()
+		}
+	}
+	return stats
+}
+
+// asyncReplay replay the spilled or persisted commands on the target servers periodically.
+func (d *DoubleWriteRedigoStrategy) asyncReplay(configuration *config.AsyncRemotePoolConfiguration) {
+	interval := defaultReplayInterval
+	if configuration.ReplayIntervalMillis > 0 {
+		interval = time.Duration(configuration.ReplayIntervalMillis) * time.Millisecond
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-d.stop:
+			return
+		}
+		for _, r := range d.replicaList() {
+			switch {
+			case r.wal == nil:
+			case r.executor == nil:
+				d.replay(r)
+			default:
+				r.executor.Replay(func() {
+					d.replay(r)
+				}, r.caughtUp)
+			}
+		}
+	}
+}
+
+// replay the spilled or persisted commands of the replica, the commands rejected by the redis server are logged and skipped.
+func (d *DoubleWriteRedigoStrategy) replay(r *replica) {
+	client := d.getClientByServerName(r.name)
+	if client == nil {
+		return
+	}
+	ctx := mirrorContext()
+	err := r.wal.Replay(func(item file.Item) error {
+		var err error
+		if item.Pipeline != nil {
+			cmds := make([]*RedigoCommandArgs, 0, len(item.Pipeline))
+			for _, args := range item.Pipeline {
+				if len(args) > 0 {
+					commandName, _ := args[0].(string)
+					cmds = append(cmds, &RedigoCommandArgs{CommandName: commandName, Args: args[1:]})
 				}
 			}
-		case JobTypePipeline:
-			_, err := d.remoteClient().Pipeline(jobs.transactions, jobs.cmds)
-			if err != nil {
+			err = d.pipelineWithScripts(ctx, client, item.Transaction, cmds)
+		} else if len(item.Args) > 0 {
+			commandName, _ := item.Args[0].(string)
+			err = d.doWithScripts(ctx, client, commandName, item.Args[1:]...)
+		}
+		if _, ok := err.(redis.Error); ok && file.IsRejected(err) {
+			log.Println("WARNING: replay", item.Commands(), err)
+			return nil
+		}
+		return err
+	})
+	if err != nil {
+		log.Printf("ERROR: replay spilled commands of server '%s' interrupted, %v", r.name, err)
+	}
+}
+
+func (d *DoubleWriteRedigoStrategy) executeJob(jobs job) {
+	if jobs.target == "" {
+		log.Println("ERROR: double write need another redis server!")
+		return
+	}
+	client := d.getClientByServerName(jobs.target)
+	switch jobs.JobType {
+	case JobTypeDo:
+		for i := 0; i < d.retryTimes(jobs.target); i++ {
+			ctx := instrument.WithRetries(jobs.ctx, i)
+			if err := d.doWithScripts(ctx, client, jobs.CommandName, jobs.Args...); err == nil {
+				break
+			} else {
+				log.Printf("asyncDoubleWrite Do fail %s %v,err is %s,", jobs.CommandName, jobs.Args, err.Error())
+			}
+		}
+	case JobTypePipeline:
+		for i := 0; i < d.retryTimes(jobs.target); i++ {
+			cmds, _ := jobs.cmds.([]*RedigoCommandArgs)
+			ctx := instrument.WithRetries(jobs.ctx, i)
+			if err := d.pipelineWithScripts(ctx, client, jobs.transactions, cmds); err == nil {
+				break
+			} else {
 				log.Printf("asyncDoubleWrite Pipeline fail %v,err is %s,", jobs.cmds, err.Error())
 			}
-		default:
-			log.Printf("asyncDoubleWrite not support type")
 		}
+	default:
+		log.Printf("asyncDoubleWrite not support type")
 	}
 }
 
-// createThreadPoolExecutor Memory double-write buffer creation
-func (d *DoubleWriteRedigoStrategy) createThreadPoolExecutor(configuration *config.AsyncRemotePoolConfiguration) {
-	if !configuration.Persist {
-		d.jobChan = make(chan job, configuration.TaskQueueSize)
+// doWithScripts execute the command on the client, EVALSHA is retried once after loading its script if it fails
+// with NOSCRIPT.
+func (d *DoubleWriteRedigoStrategy) doWithScripts(ctx context.Context, client *RedigoUniversalClient,
+	commandName string, args ...interface{}) error {
+	_, err := client.DoContext(ctx, commandName, args...)
+	if !file.IsNoScript(err) {
+		return err
+	}
+	shas := file.ScriptSHAs([][]interface{}{append([]interface{}{commandName}, args...)})
+	if err := d.loadScripts(client, shas); err != nil {
+		return err
+	}
+	_, err = client.DoContext(ctx, commandName, args...)
+	return err
+}
+
+// pipelineWithScripts load the scripts of the EVALSHA commands before executing the pipeline, since it can not be
+// retried without executing its other commands twice.
+func (d *DoubleWriteRedigoStrategy) pipelineWithScripts(ctx context.Context, client *RedigoUniversalClient,
+	transactions bool, cmds []*RedigoCommandArgs) error {
+	commands := make([][]interface{}, 0, len(cmds))
+	for _, cmd := range cmds {
+		commands = append(commands, commandArgs(cmd))
+	}
+	if err := d.loadScripts(client, file.ScriptSHAs(commands)); err != nil {
+		return err
+	}
+	_, err := client.pipelineContext(ctx, transactions, cmds)
+	return err
+}
+
+// mirrorContext the context of the mirrored commands, which are reported as mirror by the instrumentation.
+func mirrorContext() context.Context {
+	return instrument.WithRouteType(context.Background(), instrument.RouteTypeMirror)
+}
+
+// loadScripts load the known scripts of the SHAs by SCRIPT LOAD, the unknown ones are skipped.
+func (d *DoubleWriteRedigoStrategy) loadScripts(client *RedigoUniversalClient, shas []string) error {
+	for _, sha := range shas {
+		script, ok := d.Scripts().Script(sha)
+		if !ok {
+			log.Printf("WARNING: script %s is unknown, it can not be loaded", sha)
+			continue
+		}
+		if _, err := client.Do("SCRIPT", "LOAD", script); err != nil {
+			return fmt.Errorf("load script %s failed, %w", sha, err)
+		}
 	}
+	return nil
+}
+
+// asyncRemoteWrite returns the asyncRemoteWrite of the target server, which overrides the global one.
+func (d *DoubleWriteRedigoStrategy) asyncRemoteWrite(target string) *config.AsyncRemoteWrite {
+	if serverConfig, ok := d.routing().Servers[target]; ok && serverConfig.AsyncRemoteWrite != nil {
+		return serverConfig.AsyncRemoteWrite
+	}
+	return d.Configuration.RedisConfig.AsyncRemoteWrite
+}
+
+// retryTimes the remote write is executed at least once.
+func (d *DoubleWriteRedigoStrategy) retryTimes(target string) int {
+	asyncRemoteWrite := d.asyncRemoteWrite(target)
+	if asyncRemoteWrite == nil || asyncRemoteWrite.RetryTimes < 1 {
+		return 1
+	}
+	return asyncRemoteWrite.RetryTimes
 }
 
 // double-write command writing
-func (d *DoubleWriteRedigoStrategy) executeAsyncNotPersist(ctx context.Context, args RedigoCommandArgs) {
-	d.jobChan <- job{ctx: ctx, RedigoCommandArgs: args, JobType: JobTypeDo}
+func (d *DoubleWriteRedigoStrategy) executeAsyncNotPersist(ctx context.Context, target string, args RedigoCommandArgs) {
+	d.enqueue(job{ctx: ctx, target: target, RedigoCommandArgs: args, JobType: JobTypeDo},
+		[][]interface{}{commandArgs(&args)})
 }
 
 // double-write pipeline writing
-func (d *DoubleWriteRedigoStrategy) executePipelineAsyncNotPersist(ctx context.Context, transactions bool, cmds interface{}) {
-	d.jobChan <- job{ctx: ctx, cmds: cmds, transactions: transactions, JobType: JobTypePipeline}
+func (d *DoubleWriteRedigoStrategy) executePipelineAsyncNotPersist(ctx context.Context, target string,
+	transactions bool, cmds []*RedigoCommandArgs) {
+	commands := make([][]interface{}, 0, len(cmds))
+	for _, cmd := range cmds {
+		commands = append(commands, commandArgs(cmd))
+	}
+	d.enqueue(job{ctx: ctx, target: target, cmds: cmds, transactions: transactions, JobType: JobTypePipeline},
+		commands)
+}
+
+func (d *DoubleWriteRedigoStrategy) enqueue(jobs job, commands [][]interface{}) {
+	r := d.replica(jobs.target)
+	if r == nil {
+		log.Printf("WARNING: double write executor is stopped, drop %v", commands)
+		return
+	}
+	task := strategy.AsyncTask{
+		Run:         func() { d.executeJob(jobs) },
+		Commands:    commands,
+		Transaction: jobs.transactions,
+	}
+	if r.executor == nil {
+		if err := r.spill(task); err != nil {
+			log.Printf("ERROR: append %v to wal of server '%s' failed, %v", commands, jobs.target, err)
+		}
+		return
+	}
+	r.executor.Submit(task)
+}
+
+// commandArgs returns the command name and args in one slice.
+func commandArgs(args *RedigoCommandArgs) []interface{} {
+	return append([]interface{}{args.CommandName}, args.Args...)
 }
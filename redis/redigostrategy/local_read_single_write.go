@@ -1,5 +1,5 @@
 /*
- * Copyright (c) Huawei Technologies Co., Ltd. 2024-2025.
+ * Copyright (c) Huawei Technologies Co., Ltd. 2021.
  * Licensed under the Apache License, Version 2.0 (the "License"); you may not use
  * this file except in compliance with the License.  You may obtain a copy of the
  * License at
@@ -18,6 +18,7 @@ package redigostrategy
 import (
 	"context"
 
+	"github.com/gomodule/redigo/redis"
 	"github.com/huaweicloud/devcloud-go/redis/config"
 	"github.com/huaweicloud/devcloud-go/redis/strategy"
 )
@@ -30,21 +31,24 @@ func newLocalReadSingleWriteStrategy(configuration *config.Configuration) *Local
 	return &LocalReadSingleWriteRedigoStrategy{newAbstractStrategy(configuration)}
 }
 
-func (l *LocalReadSingleWriteRedigoStrategy) RouteClient(opType strategy.CommandType) *RedigoUniversalClient {
+func (l *LocalReadSingleWriteRedigoStrategy) RouteClient(ctx context.Context, opType strategy.CommandType) *RedigoUniversalClient {
+	if client, ok := l.hintedClient(ctx, opType, l.routing().Active); ok {
+		return client
+	}
 	if opType == strategy.CommandTypeRead {
-		return l.nearestClient()
+		return readClient(l.nearestClient(), opType)
 	}
 	return l.activeClient()
 }
 
-func (l *LocalReadSingleWriteRedigoStrategy) Watch(ctx context.Context, keys ...string) error {
-	return Watch(l.activeClient().Get(), keys...)
+func (l *LocalReadSingleWriteRedigoStrategy) Watch(ctx context.Context, fn func(conn redis.Conn) error, keys ...string) error {
+	return watchConn(l.RouteClient(ctx, strategy.CommandTypeMulti), fn, keys...)
 }
 
-func (l *LocalReadSingleWriteRedigoStrategy) Do(opType strategy.CommandType, commandName string, args ...interface{}) (reply interface{}, err error) {
-	return l.RouteClient(opType).Do(commandName, args...)
+func (l *LocalReadSingleWriteRedigoStrategy) Do(ctx context.Context, opType strategy.CommandType, commandName string, args ...interface{}) (reply interface{}, err error) {
+	return l.RouteClient(ctx, opType).Do(commandName, args...)
 }
 
-func (l *LocalReadSingleWriteRedigoStrategy) Pipeline(transactions bool, cmds interface{}) ([]interface{}, error) {
-	return l.RouteClient(strategy.CommandTypeWrite).Pipeline(transactions, cmds)
+func (l *LocalReadSingleWriteRedigoStrategy) Pipeline(ctx context.Context, transactions bool, cmds interface{}) ([]interface{}, error) {
+	return l.RouteClient(ctx, strategy.CommandTypeWrite).Pipeline(transactions, cmds)
 }
@@ -0,0 +1,125 @@
+/*
+ * Copyright (c) Huawei Technologies Co., Ltd. 2021.
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use
+ * this file except in compliance with the License.  You may obtain a copy of the
+ * License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations under the License.
+ *
+ */
+
+package redigostrategy
+
+import (
+	"sync"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+
+	"github.com/huaweicloud/devcloud-go/redis/config"
+	"github.com/huaweicloud/devcloud-go/redis/strategy"
+)
+
+// redigoReplicas is the replicas of a master-slave server, or of a sentinel server routing reads to replicas. The
+// pool of a replica is created on first use, since the replicas of sentinel are discovered.
+type redigoReplicas struct {
+	newPool     func(addr string) *redis.Pool
+	poolTimeout time.Duration
+	mutex       sync.Mutex
+	pools       map[string]*redis.Pool
+	balancer    *strategy.ReplicaBalancer
+}
+
+func newRedigoReplicas(readFrom string, interval time.Duration, discover func() ([]string, error),
+	poolTimeout time.Duration, newPool func(addr string) *redis.Pool) *redigoReplicas {
+	replicas := &redigoReplicas{newPool: newPool, poolTimeout: poolTimeout, pools: make(map[string]*redis.Pool)}
+	replicas.balancer = strategy.NewReplicaBalancer(readFrom, interval, discover, replicas.ping)
+	return replicas
+}
+
+func (r *redigoReplicas) pool(addr string) *redis.Pool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	pool, ok := r.pools[addr]
+	if !ok {
+		pool = r.newPool(addr)
+		r.pools[addr] = pool
+	}
+	return pool
+}
+
+func (r *redigoReplicas) ping(addr string) error {
+	conn := getConn(r.pool(addr), r.poolTimeout)
+	defer conn.Close()
+	_, err := conn.Do("PING")
+	return err
+}
+
+// readClient returns the client of the replica chosen by the balancer, false if no replica is healthy.
+func (r *redigoReplicas) readClient() (*RedigoUniversalClient, bool) {
+	addr, ok := r.balancer.Pick()
+	if !ok {
+		return nil, false
+	}
+	return &RedigoUniversalClient{Pool: r.pool(addr), poolTimeout: r.poolTimeout}, true
+}
+
+func (r *redigoReplicas) inUseCount() int {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	inUse := 0
+	for _, pool := range r.pools {
+		stats := pool.Stats()
+		inUse += stats.ActiveCount - stats.IdleCount
+	}
+	return inUse
+}
+
+func (r *redigoReplicas) close() {
+	r.balancer.Close()
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	for _, pool := range r.pools {
+		_ = pool.Close()
+	}
+}
+
+// readClient returns a replica for reads if the client is of a master-slave server or a sentinel server routing
+// reads to replicas.
+func readClient(client *RedigoUniversalClient, opType strategy.CommandType) *RedigoUniversalClient {
+	if client == nil || client.replicas == nil || opType != strategy.CommandTypeRead {
+		return client
+	}
+	if replica, ok := client.replicas.readClient(); ok {
+		replica.injection = client.injection
+		replica.instrumentation = client.instrumentation
+		replica.serverName = client.serverName
+		replica.serverClient = client
+		return replica
+	}
+	return client
+}
+
+func newMasterSlaveClient(serverConfig *config.ServerConfiguration) *RedigoUniversalClient {
+	addrs := make([]string, 0, len(serverConfig.ReplicaOptions))
+	for _, opts := range serverConfig.ReplicaOptions {
+		addrs = append(addrs, opts.Addr)
+	}
+	interval := time.Duration(serverConfig.ReplicaCheckIntervalMillis) * time.Millisecond
+	options := newRedigoPoolOptions(serverConfig)
+	keeper := newIdleKeeper(options)
+	return &RedigoUniversalClient{
+		Pool: newNormalPool(serverConfig, serverConfig.Hosts, options, keeper),
+		replicas: newRedigoReplicas(serverConfig.ReadFrom, interval, strategy.StaticReplicas(addrs),
+			options.waitTimeout, func(addr string) *redis.Pool {
+				return newNormalPool(serverConfig, addr, options, keeper)
+			}),
+		poolTimeout: options.waitTimeout,
+		keeper:      keeper,
+	}
+}
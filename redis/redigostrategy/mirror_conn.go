@@ -0,0 +1,167 @@
+/*
+ * Copyright (c) Huawei Technologies Co., Ltd. 2021.
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use
+ * this file except in compliance with the License.  You may obtain a copy of the
+ * License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations under the License.
+ *
+ */
+
+package redigostrategy
+
+import (
+	"strings"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+// mirrorConn is the watched connection of the double write strategies, the succeeded writes executed on it are
+// mirrored to the target servers, the writes queued between MULTI and EXEC are mirrored as one transaction after
+// EXEC succeeded.
+type mirrorConn struct {
+	redis.Conn
+	strategy *DoubleWriteRedigoStrategy
+	source   string
+	targets  []string
+	// pending the commands sent and not received yet
+	pending []*RedigoCommandArgs
+	multi   bool
+	// queued the commands queued in MULTI
+	queued []*RedigoCommandArgs
+}
+
+func (c *mirrorConn) Do(commandName string, args ...interface{}) (interface{}, error) {
+	if len(c.pending) == 0 {
+		reply, err := c.Conn.Do(commandName, args...)
+		if observed, ok := replyOf(reply, err); ok && commandName != "" {
+			c.observe(&RedigoCommandArgs{CommandName: commandName, Args: args}, observed)
+		}
+		return reply, err
+	}
+	// the replies of the sent commands are received one by one, so that every one of them is observed
+	if commandName != "" {
+		if err := c.Send(commandName, args...); err != nil {
+			return nil, err
+		}
+	}
+	if err := c.Flush(); err != nil {
+		return nil, err
+	}
+	// like redigo, the reply of the last command and the first error reply are returned
+	var reply interface{}
+	var replyErr error
+	for len(c.pending) > 0 {
+		r, err := c.Receive()
+		if _, ok := err.(redis.Error); err != nil && !ok {
+			return nil, err
+		} else if err != nil && replyErr == nil {
+			replyErr = err
+		}
+		reply = r
+	}
+	return reply, replyErr
+}
+
+func (c *mirrorConn) Send(commandName string, args ...interface{}) error {
+	if err := c.Conn.Send(commandName, args...); err != nil {
+		return err
+	}
+	c.pending = append(c.pending, &RedigoCommandArgs{CommandName: commandName, Args: args})
+	return nil
+}
+
+func (c *mirrorConn) Receive() (interface{}, error) {
+	reply, err := c.Conn.Receive()
+	if len(c.pending) == 0 {
+		return reply, err
+	}
+	cmd := c.pending[0]
+	c.pending = c.pending[1:]
+	if observed, ok := replyOf(reply, err); ok {
+		c.observe(cmd, observed)
+	}
+	return reply, err
+}
+
+// replyOf returns the error reply as the reply, ok is false if the connection failed.
+func replyOf(reply interface{}, err error) (interface{}, bool) {
+	if err == nil {
+		return reply, true
+	}
+	if _, ok := err.(redis.Error); ok {
+		return err, true
+	}
+	return nil, false
+}
+
+// observe the reply of the command executed on the watched connection, mirror it if it is a succeeded write. The
+// reply is the error if the command failed.
+func (c *mirrorConn) observe(cmd *RedigoCommandArgs, reply interface{}) {
+	_, failed := reply.(error)
+	switch strings.ToLower(cmd.CommandName) {
+	case "multi":
+		c.multi, c.queued = !failed, nil
+		return
+	case "discard":
+		c.multi, c.queued = false, nil
+		return
+	case "exec":
+		c.exec(reply)
+		return
+	}
+	if failed {
+		return
+	}
+	if c.multi {
+		c.queued = append(c.queued, cmd)
+		return
+	}
+	d := c.strategy
+	d.Scripts().ObserveScriptLoad(commandArgs(cmd))
+	if !d.classifier.IsWrite(c.source, cmd.CommandName, cmd.Args) {
+		return
+	}
+	for _, target := range c.targets {
+		d.executeAsyncNotPersist(mirrorContext(), target, d.mirrorArgs(target, cmd.CommandName, cmd.Args, reply))
+	}
+}
+
+// exec mirror the succeeded writes of the transaction, nothing is mirrored if it is aborted by WATCH.
+func (c *mirrorConn) exec(reply interface{}) {
+	queued := c.queued
+	c.multi, c.queued = false, nil
+	replies, ok := reply.([]interface{})
+	if !ok || len(replies) != len(queued) {
+		return
+	}
+	d := c.strategy
+	var writes []*RedigoCommandArgs
+	var writeReplies []interface{}
+	for i, cmd := range queued {
+		if _, failed := replies[i].(redis.Error); failed {
+			continue
+		}
+		d.Scripts().ObserveScriptLoad(commandArgs(cmd))
+		if d.classifier.IsWrite(c.source, cmd.CommandName, cmd.Args) {
+			writes = append(writes, cmd)
+			writeReplies = append(writeReplies, replies[i])
+		}
+	}
+	if len(writes) == 0 {
+		return
+	}
+	for _, target := range c.targets {
+		writeArgs := make([]*RedigoCommandArgs, 0, len(writes))
+		for j, write := range writes {
+			mirrorArgs := d.mirrorArgs(target, write.CommandName, write.Args, writeReplies[j])
+			writeArgs = append(writeArgs, &mirrorArgs)
+		}
+		d.executePipelineAsyncNotPersist(mirrorContext(), target, true, writeArgs)
+	}
+}
@@ -0,0 +1,202 @@
+/*
+ * Copyright (c) Huawei Technologies Co., Ltd. 2021.
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use
+ * this file except in compliance with the License.  You may obtain a copy of the
+ * License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations under the License.
+ *
+ */
+
+package redigostrategy
+
+import (
+	"context"
+	"log"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+
+	"github.com/huaweicloud/devcloud-go/redis/config"
+)
+
+// redigoPoolOptions the pool options of a server with the defaults of go-redis, so that the redigo pools of a
+// server behave as the go-redis pool of the same ServerConfiguration.
+type redigoPoolOptions struct {
+	maxActive       int
+	maxIdle         int
+	minIdle         int
+	waitTimeout     time.Duration
+	idleTimeout     time.Duration
+	checkInterval   time.Duration
+	maxConnLifetime time.Duration
+}
+
+func newRedigoPoolOptions(serverConfig *config.ServerConfiguration) redigoPoolOptions {
+	var options redigoPoolOptions
+	var readTimeout time.Duration
+	switch {
+	case serverConfig.Type == config.ServerTypeCluster && serverConfig.ClusterOptions != nil:
+		opts := serverConfig.ClusterOptions
+		options = redigoPoolOptions{maxActive: opts.PoolSize, minIdle: opts.MinIdleConns, waitTimeout: opts.PoolTimeout,
+			idleTimeout: opts.IdleTimeout, checkInterval: opts.IdleCheckFrequency, maxConnLifetime: opts.MaxConnAge}
+		readTimeout = opts.ReadTimeout
+		if options.maxActive == 0 {
+			// the pool size of every node of go-redis cluster client
+			options.maxActive = 5 * runtime.GOMAXPROCS(0)
+		}
+	case serverConfig.Type == config.ServerTypeSentinel && serverConfig.FailoverOptions != nil:
+		opts := serverConfig.FailoverOptions
+		options = redigoPoolOptions{maxActive: opts.PoolSize, minIdle: opts.MinIdleConns, waitTimeout: opts.PoolTimeout,
+			idleTimeout: opts.IdleTimeout, checkInterval: opts.IdleCheckFrequency, maxConnLifetime: opts.MaxConnAge}
+		readTimeout = opts.ReadTimeout
+	case serverConfig.Options != nil:
+		opts := serverConfig.Options
+		options = redigoPoolOptions{maxActive: opts.PoolSize, minIdle: opts.MinIdleConns, waitTimeout: opts.PoolTimeout,
+			idleTimeout: opts.IdleTimeout, checkInterval: opts.IdleCheckFrequency, maxConnLifetime: opts.MaxConnAge}
+		readTimeout = opts.ReadTimeout
+	}
+	// the defaults of go-redis Options
+	if options.maxActive == 0 {
+		options.maxActive = 10 * runtime.GOMAXPROCS(0)
+	}
+	if readTimeout == 0 {
+		readTimeout = 3 * time.Second
+	}
+	if options.waitTimeout == 0 {
+		options.waitTimeout = readTimeout + time.Second
+	}
+	if options.idleTimeout == 0 {
+		options.idleTimeout = 5 * time.Minute
+	}
+	if options.checkInterval == 0 {
+		options.checkInterval = time.Minute
+	}
+	if options.minIdle > options.maxActive {
+		options.minIdle = options.maxActive
+	}
+	if serverConfig.ConnectionPool != nil && serverConfig.ConnectionPool.FIFO() {
+		log.Printf("ERROR: lifo false of server '%s' is not supported by redigo pools, the pool is lifo",
+			serverConfig.Hosts)
+	}
+	// go-redis keeps all idle connections up to the pool size
+	options.maxIdle = options.maxActive
+	if serverConfig.ConnectionPool != nil && serverConfig.ConnectionPool.MaxIdle > 0 {
+		options.maxIdle = serverConfig.ConnectionPool.MaxIdle
+	}
+	return options
+}
+
+// newPool create a pool by the options, a connection is waited for at most waitTimeout by getConn, and the pool is
+// added to the keeper of its min idle connections.
+func newPool(options redigoPoolOptions, dial func() (redis.Conn, error), keeper *idleKeeper) *redis.Pool {
+	pool := &redis.Pool{
+		MaxIdle:         options.maxIdle,
+		MaxActive:       options.maxActive,
+		Wait:            true,
+		IdleTimeout:     options.idleTimeout,
+		MaxConnLifetime: options.maxConnLifetime,
+		Dial:            dial,
+		TestOnBorrow: func(c redis.Conn, t time.Time) error {
+			_, err := c.Do("PING")
+			return err
+		},
+	}
+	keeper.add(pool)
+	return pool
+}
+
+// getConn get a connection of the pool, waiting at most timeout for a connection when the pool is exhausted. The
+// returned connection reports the error if it fails, as pool.Get.
+func getConn(pool *redis.Pool, timeout time.Duration) redis.Conn {
+	if timeout <= 0 {
+		return pool.Get()
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	conn, _ := pool.GetContext(ctx)
+	return conn
+}
+
+// idleKeeper keep minIdle idle connections in every pool of a client, as MinIdleConns of go-redis. The pools are
+// filled when they are added and every checkInterval.
+type idleKeeper struct {
+	options  redigoPoolOptions
+	mutex    sync.Mutex
+	pools    []*redis.Pool
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+// newIdleKeeper create a keeper of the options, nil if minIdle is 0.
+func newIdleKeeper(options redigoPoolOptions) *idleKeeper {
+	if options.minIdle <= 0 {
+		return nil
+	}
+	keeper := &idleKeeper{options: options, stop: make(chan struct{})}
+	go keeper.run()
+	return keeper
+}
+
+func (k *idleKeeper) add(pool *redis.Pool) {
+	if k == nil {
+		return
+	}
+	k.mutex.Lock()
+	k.pools = append(k.pools, pool)
+	k.mutex.Unlock()
+	go k.fill(pool)
+}
+
+func (k *idleKeeper) run() {
+	ticker := time.NewTicker(k.options.checkInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-k.stop:
+			return
+		}
+		k.mutex.Lock()
+		pools := append([]*redis.Pool(nil), k.pools...)
+		k.mutex.Unlock()
+		for _, pool := range pools {
+			k.fill(pool)
+		}
+	}
+}
+
+// fill hold minIdle connections at once and return them, so that the pool has minIdle idle connections.
+func (k *idleKeeper) fill(pool *redis.Pool) {
+	if pool.IdleCount() >= k.options.minIdle {
+		return
+	}
+	conns := make([]redis.Conn, 0, k.options.minIdle)
+	for len(conns) < k.options.minIdle {
+		conn := getConn(pool, k.options.waitTimeout)
+		if conn.Err() != nil {
+			_ = conn.Close()
+			break
+		}
+		conns = append(conns, conn)
+	}
+	for _, conn := range conns {
+		_ = conn.Close()
+	}
+}
+
+func (k *idleKeeper) close() {
+	if k == nil {
+		return
+	}
+	k.stopOnce.Do(func() {
+		close(k.stop)
+	})
+}
@@ -0,0 +1,135 @@
+/*
+ * Copyright (c) Huawei Technologies Co., Ltd. 2021.
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use
+ * this file except in compliance with the License.  You may obtain a copy of the
+ * License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations under the License.
+ *
+ */
+
+package redigostrategy
+
+import (
+	"context"
+	"log"
+	"sync"
+	"sync/atomic"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/huaweicloud/devcloud-go/redis/config"
+	"github.com/huaweicloud/devcloud-go/redis/strategy"
+)
+
+// ReloadableRedigoStrategy follows the redis topology changes of Configuration, see strategy.ReloadableStrategy.
+type ReloadableRedigoStrategy struct {
+	configuration *config.Configuration
+	mode          atomic.Value // strategyHolder
+	mutex         sync.Mutex
+	closed        bool
+}
+
+// strategyHolder makes atomic.Value always store the same concrete type.
+type strategyHolder struct {
+	mode RedigoStrategyMode
+}
+
+// NewReloadableStrategy create a ReloadableRedigoStrategy and register it to the configuration's reload listeners,
+// nil if the route algorithm is invalid.
+func NewReloadableStrategy(configuration *config.Configuration) RedigoStrategyMode {
+	mode := NewStrategy(configuration)
+	if mode == nil {
+		return nil
+	}
+	reloadableStrategy := &ReloadableRedigoStrategy{configuration: configuration}
+	reloadableStrategy.mode.Store(strategyHolder{mode: mode})
+	configuration.AddReloadListener(reloadableStrategy)
+	return reloadableStrategy
+}
+
+// Current returns the strategy currently in use.
+func (r *ReloadableRedigoStrategy) Current() RedigoStrategyMode {
+	return r.mode.Load().(strategyHolder).mode
+}
+
+// OnReload rebuild the changed clients or the whole strategy.
+func (r *ReloadableRedigoStrategy) OnReload(changedServers []string, routeAlgorithmChanged bool) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.closed {
+		return
+	}
+	current := r.Current()
+	if routeAlgorithmChanged {
+		if mode := NewStrategy(r.configuration); mode != nil {
+			r.mode.Store(strategyHolder{mode: mode})
+			// merged after stored, the scripts registered to the old strategy meanwhile are not lost
+			mode.Scripts().Merge(current.Scripts())
+			log.Printf("INFO: redigo strategy switched to [%s]", r.configuration.Snapshot().RouteAlgorithm)
+			go func() {
+				if err := current.GracefulClose(); err != nil {
+					log.Printf("WARNING: close replaced strategy failed, %v", err)
+				}
+			}()
+			return
+		}
+		log.Printf("ERROR: switch to route algorithm [%s] failed, keep the current strategy",
+			r.configuration.Snapshot().RouteAlgorithm)
+	}
+	if len(changedServers) > 0 {
+		current.ReloadClients(changedServers...)
+	}
+}
+
+func (r *ReloadableRedigoStrategy) RouteClient(ctx context.Context, opType strategy.CommandType) *RedigoUniversalClient {
+	return r.Current().RouteClient(ctx, opType)
+}
+
+func (r *ReloadableRedigoStrategy) Watch(ctx context.Context, fn func(conn redis.Conn) error, keys ...string) error {
+	return r.Current().Watch(ctx, fn, keys...)
+}
+
+func (r *ReloadableRedigoStrategy) Do(ctx context.Context, opType strategy.CommandType, commandName string, args ...interface{}) (reply interface{}, err error) {
+	return r.Current().Do(ctx, opType, commandName, args...)
+}
+
+func (r *ReloadableRedigoStrategy) Pipeline(ctx context.Context, transactions bool, cmds interface{}) ([]interface{}, error) {
+	return r.Current().Pipeline(ctx, transactions, cmds)
+}
+
+func (r *ReloadableRedigoStrategy) ReloadClients(serverNames ...string) {
+	r.Current().ReloadClients(serverNames...)
+}
+
+func (r *ReloadableRedigoStrategy) DoubleWriteStats() map[string]strategy.AsyncExecutorStats {
+	return r.Current().DoubleWriteStats()
+}
+
+func (r *ReloadableRedigoStrategy) CommandType(commandName string, args ...interface{}) strategy.CommandType {
+	return r.Current().CommandType(commandName, args...)
+}
+
+func (r *ReloadableRedigoStrategy) Scripts() *strategy.ScriptRegistry {
+	return r.Current().Scripts()
+}
+
+func (r *ReloadableRedigoStrategy) GracefulClose() error {
+	r.markClosed()
+	return r.Current().GracefulClose()
+}
+
+func (r *ReloadableRedigoStrategy) Close() error {
+	r.markClosed()
+	return r.Current().Close()
+}
+
+func (r *ReloadableRedigoStrategy) markClosed() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.closed = true
+}
@@ -1,5 +1,5 @@
 /*
- * Copyright (c) Huawei Technologies Co., Ltd. 2024-2025.
+ * Copyright (c) Huawei Technologies Co., Ltd. 2021.
  * Licensed under the Apache License, Version 2.0 (the "License"); you may not use
  * this file except in compliance with the License.  You may obtain a copy of the
  * License at
@@ -18,6 +18,7 @@ package redigostrategy
 import (
 	"context"
 
+	"github.com/gomodule/redigo/redis"
 	"github.com/huaweicloud/devcloud-go/redis/config"
 	"github.com/huaweicloud/devcloud-go/redis/strategy"
 )
@@ -30,18 +31,21 @@ func newSingleReadWriteStrategy(configuration *config.Configuration) *SingleRead
 	return &SingleReadWriteRedigoStrategy{newAbstractStrategy(configuration)}
 }
 
-func (s *SingleReadWriteRedigoStrategy) RouteClient(opType strategy.CommandType) *RedigoUniversalClient {
-	return s.activeClient()
+func (s *SingleReadWriteRedigoStrategy) RouteClient(ctx context.Context, opType strategy.CommandType) *RedigoUniversalClient {
+	if client, ok := s.hintedClient(ctx, opType, s.routing().Active); ok {
+		return client
+	}
+	return readClient(s.activeClient(), opType)
 }
 
-func (s *SingleReadWriteRedigoStrategy) Watch(ctx context.Context, keys ...string) error {
-	return Watch(s.activeClient().Get(), keys...)
+func (s *SingleReadWriteRedigoStrategy) Watch(ctx context.Context, fn func(conn redis.Conn) error, keys ...string) error {
+	return watchConn(s.RouteClient(ctx, strategy.CommandTypeMulti), fn, keys...)
 }
 
-func (s *SingleReadWriteRedigoStrategy) Do(opType strategy.CommandType, commandName string, args ...interface{}) (reply interface{}, err error) {
-	return s.RouteClient(opType).Do(commandName, args...)
+func (s *SingleReadWriteRedigoStrategy) Do(ctx context.Context, opType strategy.CommandType, commandName string, args ...interface{}) (reply interface{}, err error) {
+	return s.RouteClient(ctx, opType).Do(commandName, args...)
 }
 
-func (s *SingleReadWriteRedigoStrategy) Pipeline(transactions bool, cmds interface{}) ([]interface{}, error) {
-	return s.RouteClient(strategy.CommandTypeMulti).Pipeline(transactions, cmds)
+func (s *SingleReadWriteRedigoStrategy) Pipeline(ctx context.Context, transactions bool, cmds interface{}) ([]interface{}, error) {
+	return s.RouteClient(ctx, strategy.CommandTypeMulti).Pipeline(transactions, cmds)
 }
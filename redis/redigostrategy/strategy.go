@@ -1,5 +1,5 @@
 /*
- * Copyright (c) Huawei Technologies Co., Ltd. 2024-2025.
+ * Copyright (c) Huawei Technologies Co., Ltd. 2021.
  * Licensed under the Apache License, Version 2.0 (the "License"); you may not use
  * this file except in compliance with the License.  You may obtain a copy of the
  * License at
@@ -20,34 +20,51 @@ import (
 	"context"
 	"log"
 
+	"github.com/gomodule/redigo/redis"
 	"github.com/huaweicloud/devcloud-go/redis/config"
 	"github.com/huaweicloud/devcloud-go/redis/strategy"
 )
 
 type RedigoStrategyMode interface {
-	RouteClient(opType strategy.CommandType) *RedigoUniversalClient
+	// RouteClient returns the client of the command type, the routing hints of the context override the route
+	// algorithm.
+	RouteClient(ctx context.Context, opType strategy.CommandType) *RedigoUniversalClient
 	Close() error
-	Watch(ctx context.Context, keys ...string) error
-	Do(opType strategy.CommandType, commandName string, args ...interface{}) (reply interface{}, err error)
-	Pipeline(transactions bool, cmds interface{}) ([]interface{}, error)
+	// Watch execute fn on a connection watching the keys, such as a MULTI/EXEC transaction, the connection is
+	// closed after fn returns.
+	Watch(ctx context.Context, fn func(conn redis.Conn) error, keys ...string) error
+	Do(ctx context.Context, opType strategy.CommandType, commandName string, args ...interface{}) (reply interface{}, err error)
+	Pipeline(ctx context.Context, transactions bool, cmds interface{}) ([]interface{}, error)
+	// ReloadClients rebuild the clients of the servers, the replaced clients are closed gracefully.
+	ReloadClients(serverNames ...string)
+	// GracefulClose waits for the in-flight commands finished and closes all clients.
+	GracefulClose() error
+	DoubleWriteStats() map[string]strategy.AsyncExecutorStats
+	// CommandType returns whether the command is a read or a write.
+	CommandType(commandName string, args ...interface{}) strategy.CommandType
+	// Scripts returns the registry of the read-only scripts and the script bodies to mirror by SHA.
+	Scripts() *strategy.ScriptRegistry
 }
 
 func NewStrategy(configuration *config.Configuration) RedigoStrategyMode {
-	switch configuration.RouteAlgorithm {
+	routeAlgorithm := configuration.Snapshot().RouteAlgorithm
+	switch routeAlgorithm {
 	case strategy.SingleReadWriteMode:
 		return newSingleReadWriteStrategy(configuration)
 	case strategy.LocalReadSingleWriteMode:
 		return newLocalReadSingleWriteStrategy(configuration)
 	case strategy.SingleReadDoubleWriteMode:
-		return newSingleReadWriteStrategy(configuration)
+		return newSingelReadDoubleWriteStrategy(configuration)
 	case strategy.LocalReadDoubleWriteMode:
-		return newLocalReadSingleWriteStrategy(configuration)
+		return newDoubleWriteStrategy(configuration)
 	default:
-		log.Printf("ERROR: invalid route algorithm:%v", configuration.RouteAlgorithm)
+		log.Printf("ERROR: invalid route algorithm:%v", routeAlgorithm)
 	}
 	return nil
 }
 
+// GetWriteReadCommandType classify the command by the static command map, RedigoStrategyMode.CommandType
+// classifies it by the COMMAND INFO of the server.
 func GetWriteReadCommandType(commandName string, args ...interface{}) strategy.CommandType {
 	commandType := strategy.CommandTypeRead
 	if strategy.IsWriteCommand(commandName, args) {
@@ -1,5 +1,5 @@
 /*
- * Copyright (c) Huawei Technologies Co., Ltd. 2024-2025.
+ * Copyright (c) Huawei Technologies Co., Ltd. 2021.
  * Licensed under the Apache License, Version 2.0 (the "License"); you may not use
  * this file except in compliance with the License.  You may obtain a copy of the
  * License at
@@ -19,6 +19,7 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"sync"
 	"time"
 
 	"github.com/gomodule/redigo/redis"
@@ -31,7 +32,11 @@ type SubscribeData struct {
 }
 
 func Subscribe(ctx context.Context, s RedigoStrategyMode, duration time.Duration, channel string) (interface{}, error) {
-	conn := s.RouteClient(strategy.CommandTypeRead).Get()
+	client := s.RouteClient(ctx, strategy.CommandTypeRead)
+	if err := client.injection.Inject(); err != nil {
+		return nil, err
+	}
+	conn := client.Get()
 	pubsubConn := redis.PubSubConn{Conn: conn}
 	err := pubsubConn.Subscribe(redis.Args{}.AddFlat(channel)...)
 	defer pubsubConn.Unsubscribe()
@@ -82,75 +87,388 @@ func Subscribe(ctx context.Context, s RedigoStrategyMode, duration time.Duration
 	}
 }
 
-// need start and close
+// SubcribeOptions the options of SubcribeTool, the zero values are the defaults.
+type SubcribeOptions struct {
+	// QueueSize the messages queued for the callback of a channel or pattern, receiving is blocked when the queue
+	// is full, default 100
+	QueueSize int
+	// ReconnectInterval the interval of reconnecting after the connection failed, default 1s
+	ReconnectInterval time.Duration
+	// CheckInterval the interval of PINGing the connection and checking whether the route server is switched,
+	// the connection is reconnected if nothing is received in 3 intervals, default 1s
+	CheckInterval time.Duration
+}
+
+const (
+	defaultSubscribeQueueSize     = 100
+	defaultSubscribeRetryInterval = time.Second
+	defaultSubscribeCheckInterval = time.Second
+)
+
+// SubcribeTool subscribe channels and patterns on the read route server, it reconnects and subscribes all of them
+// again after the connection failed or the route server switched. Every channel and pattern has its own callback
+// goroutine, so a slow callback only blocks the others when its queue is full. Close it after use.
 type SubcribeTool struct {
-	callMap    map[string]SubscribeCallback
+	strategy RedigoStrategyMode
+	options  SubcribeOptions
+	mutex    sync.Mutex
+	// client the client of the route server, which pubSubConn is from
+	client     *RedigoUniversalClient
 	pubSubConn *redis.PubSubConn
-	stop       chan struct{}
+	// reconnect whether the route server switched, the connection is reconnected by the receive loop
+	reconnect bool
+	channels  map[string]*subscriber
+	patterns  map[string]*subscriber
+	// wake wakes the receive loop up when the first channel or pattern is subscribed
+	wake     chan struct{}
+	stop     chan struct{}
+	stopOnce sync.Once
+	wg       sync.WaitGroup
+	// subscriberWg waits for the callback goroutines
+	subscriberWg sync.WaitGroup
 }
 
 type SubscribeCallback func(channel, message string)
 
+// subscriber call the callback of a channel or pattern with the queued messages.
+type subscriber struct {
+	call  SubscribeCallback
+	queue chan redis.Message
+	// done is closed when the channel or pattern is unsubscribed
+	done chan struct{}
+}
+
 func CreateSubcribeTool(r RedigoStrategyMode) *SubcribeTool {
-	conn := r.RouteClient(strategy.CommandTypeRead).Get()
-	pubsubConn := redis.PubSubConn{Conn: conn}
+	return NewSubcribeTool(r, nil)
+}
+
+// NewSubcribeTool create and start a SubcribeTool, options nil means the defaults.
+func NewSubcribeTool(r RedigoStrategyMode, options *SubcribeOptions) *SubcribeTool {
 	tool := &SubcribeTool{
-		callMap:    make(map[string]SubscribeCallback),
-		pubSubConn: &pubsubConn,
+		strategy: r,
+		channels: make(map[string]*subscriber),
+		patterns: make(map[string]*subscriber),
+		wake:     make(chan struct{}, 1),
+		stop:     make(chan struct{}),
+	}
+	if options != nil {
+		tool.options = *options
+	}
+	if tool.options.QueueSize <= 0 {
+		tool.options.QueueSize = defaultSubscribeQueueSize
+	}
+	if tool.options.ReconnectInterval <= 0 {
+		tool.options.ReconnectInterval = defaultSubscribeRetryInterval
+	}
+	if tool.options.CheckInterval <= 0 {
+		tool.options.CheckInterval = defaultSubscribeCheckInterval
 	}
 	tool.start()
 	return tool
 }
 
 func (s *SubcribeTool) start() {
+	s.wg.Add(2)
 	go func() {
-		for {
+		defer s.wg.Done()
+		s.run()
+	}()
+	go func() {
+		defer s.wg.Done()
+		s.check()
+	}()
+}
+
+// run connect and receive until the tool is closed, it is not connected while nothing is subscribed.
+func (s *SubcribeTool) run() {
+	for {
+		select {
+		case <-s.stop:
+			return
+		default:
+		}
+		if !s.subscribed() {
 			select {
+			case <-s.wake:
 			case <-s.stop:
 				return
-			default:
-				switch res := s.pubSubConn.ReceiveWithTimeout(time.Duration(0)).(type) {
-				case redis.Message:
-					if call, ok := s.callMap[res.Channel]; ok {
-						call(res.Channel, string(res.Data))
-					}
-				case redis.Subscription:
-					log.Printf("SubcribeTool Subscription channel:%s kind:%s count:%d\n", res.Channel, res.Kind, res.Count)
-				case error:
-					log.Printf("ERROR: SubcribeTool receive error %s", res.Error())
-					return
-				}
 			}
+			continue
+		}
+		conn, err := s.connect()
+		if err == nil {
+			s.receive(conn)
+			s.disconnect(conn)
+			continue
+		}
+		log.Printf("ERROR: SubcribeTool connect failed, %v", err)
+		select {
+		case <-time.After(s.options.ReconnectInterval):
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+func (s *SubcribeTool) subscribed() bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return len(s.channels)+len(s.patterns) > 0
+}
 
+// connect get a connection of the route server and subscribe all channels and patterns on it.
+func (s *SubcribeTool) connect() (*redis.PubSubConn, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	client := s.strategy.RouteClient(context.Background(), strategy.CommandTypeRead)
+	if err := client.injection.Inject(); err != nil {
+		return nil, err
+	}
+	conn := &redis.PubSubConn{Conn: client.Get()}
+	if err := conn.Conn.Err(); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	if err := s.subscribeAll(conn); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	s.client, s.pubSubConn, s.reconnect = client, conn, false
+	return conn, nil
+}
+
+func (s *SubcribeTool) subscribeAll(conn *redis.PubSubConn) error {
+	if len(s.channels) > 0 {
+		if err := conn.Subscribe(redis.Args{}.AddFlat(mapKeys(s.channels))...); err != nil {
+			return err
 		}
-	}()
+	}
+	if len(s.patterns) > 0 {
+		if err := conn.PSubscribe(redis.Args{}.AddFlat(mapKeys(s.patterns))...); err != nil {
+			return err
+		}
+	}
+	// the replies of the subscriptions are returned by Receive
+	return conn.Ping("")
 }
 
+func (s *SubcribeTool) disconnect(conn *redis.PubSubConn) {
+	s.mutex.Lock()
+	if s.pubSubConn == conn {
+		s.client, s.pubSubConn = nil, nil
+	}
+	s.mutex.Unlock()
+	_ = conn.Close()
+}
+
+// receive dispatch the messages to the subscribers until the connection fails, the route server switches or the
+// tool is closed.
+func (s *SubcribeTool) receive(conn *redis.PubSubConn) {
+	timeout := 3 * s.options.CheckInterval
+	for {
+		res := conn.ReceiveWithTimeout(timeout)
+		select {
+		case <-s.stop:
+			return
+		default:
+		}
+		switch res := res.(type) {
+		case redis.Message:
+			s.dispatch(res)
+		case redis.Subscription:
+			log.Printf("SubcribeTool Subscription channel:%s kind:%s count:%d\n", res.Channel, res.Kind, res.Count)
+			if res.Count == 0 && !s.subscribed() {
+				return
+			}
+		case error:
+			log.Printf("ERROR: SubcribeTool receive error %s, reconnect", res.Error())
+			return
+		}
+		s.mutex.Lock()
+		reconnect := s.reconnect
+		s.mutex.Unlock()
+		if reconnect {
+			return
+		}
+	}
+}
+
+// dispatch queue the message for the subscriber of its pattern or channel, it waits while the queue is full.
+func (s *SubcribeTool) dispatch(message redis.Message) {
+	s.mutex.Lock()
+	var sub *subscriber
+	if message.Pattern != "" {
+		sub = s.patterns[message.Pattern]
+	} else {
+		sub = s.channels[message.Channel]
+	}
+	injection := s.client.injection
+	s.mutex.Unlock()
+	if sub == nil {
+		return
+	}
+	if err := injection.Inject(); err != nil {
+		log.Printf("WARNING: SubcribeTool drop message of channel %s by chaos, %v", message.Channel, err)
+		return
+	}
+	select {
+	case sub.queue <- message:
+	case <-sub.done:
+	case <-s.stop:
+	}
+}
+
+// check PING the connection and reconnect it when the route server is switched.
+func (s *SubcribeTool) check() {
+	ticker := time.NewTicker(s.options.CheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-s.stop:
+			return
+		}
+		s.mutex.Lock()
+		if s.pubSubConn != nil && len(s.channels)+len(s.patterns) > 0 {
+			if route := s.strategy.RouteClient(context.Background(), strategy.CommandTypeRead); route.server() != s.client.server() {
+				log.Println("INFO: SubcribeTool route server switched, reconnect")
+				s.reconnect = true
+			}
+			// the reply wakes the receive loop up
+			_ = s.pubSubConn.Ping("")
+		}
+		s.mutex.Unlock()
+	}
+}
+
+// Close unsubscribe all and stop the tool, the queued messages are passed to the callbacks before it returns.
 func (s *SubcribeTool) Close() error {
-	s.stop <- struct{}{}
-	return s.pubSubConn.Close()
+	s.stopOnce.Do(func() {
+		close(s.stop)
+		s.mutex.Lock()
+		if s.pubSubConn != nil {
+			_ = s.pubSubConn.Ping("")
+		}
+		s.mutex.Unlock()
+		s.wg.Wait()
+		s.mutex.Lock()
+		for _, subscribers := range []map[string]*subscriber{s.channels, s.patterns} {
+			for key, sub := range subscribers {
+				close(sub.queue)
+				delete(subscribers, key)
+			}
+		}
+		s.mutex.Unlock()
+		s.subscriberWg.Wait()
+	})
+	return nil
 }
 
 // add subscribe item
 func (s *SubcribeTool) Subscribe(call SubscribeCallback, channel ...string) {
-	err := s.pubSubConn.Subscribe(redis.Args{}.AddFlat(channel)...)
-	if err != nil {
-		log.Println("redis Subscribe error.")
+	s.add(s.channels, call, channel, func(conn *redis.PubSubConn, args ...interface{}) error {
+		return conn.Subscribe(args...)
+	})
+}
+
+// delete subscribe item
+func (s *SubcribeTool) UnSubscribe(channel ...string) {
+	s.remove(s.channels, channel, func(conn *redis.PubSubConn, args ...interface{}) error {
+		return conn.Unsubscribe(args...)
+	})
+}
+
+// PSubscribe subscribe the patterns, call is called with the channel of the messages.
+func (s *SubcribeTool) PSubscribe(call SubscribeCallback, pattern ...string) {
+	s.add(s.patterns, call, pattern, func(conn *redis.PubSubConn, args ...interface{}) error {
+		return conn.PSubscribe(args...)
+	})
+}
+
+// PUnSubscribe unsubscribe the patterns.
+func (s *SubcribeTool) PUnSubscribe(pattern ...string) {
+	s.remove(s.patterns, pattern, func(conn *redis.PubSubConn, args ...interface{}) error {
+		return conn.PUnsubscribe(args...)
+	})
+}
+
+func (s *SubcribeTool) add(subscribers map[string]*subscriber, call SubscribeCallback, keys []string,
+	send func(conn *redis.PubSubConn, args ...interface{}) error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	select {
+	case <-s.stop:
+		log.Println("ERROR: SubcribeTool is closed")
+		return
+	default:
+	}
+	for _, key := range keys {
+		if old, ok := subscribers[key]; ok {
+			close(old.done)
+		}
+		sub := &subscriber{call: call, queue: make(chan redis.Message, s.options.QueueSize),
+			done: make(chan struct{})}
+		subscribers[key] = sub
+		s.subscriberWg.Add(1)
+		go func() {
+			defer s.subscriberWg.Done()
+			sub.run()
+		}()
+	}
+	if s.pubSubConn == nil {
+		// subscribed when it is connected
+		select {
+		case s.wake <- struct{}{}:
+		default:
+		}
+		return
+	}
+	if err := s.client.injection.Inject(); err != nil {
+		log.Printf("ERROR: redis Subscribe error, %v", err)
+		s.reconnect = true
+		return
+	}
+	if err := send(s.pubSubConn, redis.Args{}.AddFlat(keys)...); err != nil {
+		log.Printf("ERROR: redis Subscribe error, %v", err)
 	}
+}
 
-	for _, v := range channel {
-		s.callMap[v] = call
+func (s *SubcribeTool) remove(subscribers map[string]*subscriber, keys []string,
+	send func(conn *redis.PubSubConn, args ...interface{}) error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for _, key := range keys {
+		if sub, ok := subscribers[key]; ok {
+			close(sub.done)
+			delete(subscribers, key)
+		}
+	}
+	if s.pubSubConn == nil {
+		return
+	}
+	if err := send(s.pubSubConn, redis.Args{}.AddFlat(keys)...); err != nil {
+		log.Printf("ERROR: redis UnSubscribe error, %v", err)
 	}
 }
 
-// delete subscribe item
-func (s *SubcribeTool) UnSubscribe(channel ...string) {
-	err := s.pubSubConn.Subscribe(redis.Args{}.AddFlat(channel)...)
-	if err != nil {
-		log.Println("redis Subscribe error.")
+func (sub *subscriber) run() {
+	for {
+		select {
+		case message, ok := <-sub.queue:
+			if !ok {
+				return
+			}
+			sub.call(message.Channel, string(message.Data))
+		case <-sub.done:
+			return
+		}
 	}
+}
 
-	for _, v := range channel {
-		delete(s.callMap, v)
+func mapKeys(subscribers map[string]*subscriber) []string {
+	keys := make([]string, 0, len(subscribers))
+	for key := range subscribers {
+		keys = append(keys, key)
 	}
+	return keys
 }
@@ -0,0 +1,102 @@
+/*
+ * Copyright (c) Huawei Technologies Co., Ltd. 2021.
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use
+ * this file except in compliance with the License.  You may obtain a copy of the
+ * License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package resync
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"path/filepath"
+)
+
+// Checkpoint the SCAN cursors of the master nodes of a resync, a node not in Cursors starts from 0.
+type Checkpoint struct {
+	Source   string            `json:"source"`
+	Target   string            `json:"target"`
+	Match    string            `json:"match"`
+	Cursors  map[string]uint64 `json:"cursors"`
+	Done     map[string]bool   `json:"done"`
+	Progress Progress          `json:"progress"`
+}
+
+// loadCheckpoint load the checkpoint file, a new checkpoint is returned if there is no file or it is of another
+// resync.
+func (r *Resyncer) loadCheckpoint() *Checkpoint {
+	checkpoint := &Checkpoint{Source: r.source.Name, Target: r.target.Name, Match: r.options.Match,
+		Cursors: map[string]uint64{}, Done: map[string]bool{}}
+	if r.options.CheckpointFile == "" {
+		return checkpoint
+	}
+	data, err := os.ReadFile(r.options.CheckpointFile)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("WARNING: read resync checkpoint failed, resync from the beginning, %v", err)
+		}
+		return checkpoint
+	}
+	saved := &Checkpoint{}
+	if err = json.Unmarshal(data, saved); err != nil {
+		log.Printf("WARNING: parse resync checkpoint failed, resync from the beginning, %v", err)
+		return checkpoint
+	}
+	if saved.Source != checkpoint.Source || saved.Target != checkpoint.Target || saved.Match != checkpoint.Match {
+		log.Printf("WARNING: resync checkpoint is of '%s' to '%s', resync from the beginning", saved.Source,
+			saved.Target)
+		return checkpoint
+	}
+	if saved.Cursors == nil {
+		saved.Cursors = map[string]uint64{}
+	}
+	if saved.Done == nil {
+		saved.Done = map[string]bool{}
+	}
+	saved.Progress.Done = false
+	log.Printf("INFO: resync from '%s' to '%s' resumed, %d keys scanned", saved.Source, saved.Target,
+		saved.Progress.Scanned)
+	return saved
+}
+
+// saveCheckpoint write the checkpoint to a temp file and rename it, so that the file is never partially written.
+func (r *Resyncer) saveCheckpoint(checkpoint *Checkpoint) {
+	if r.options.CheckpointFile == "" {
+		return
+	}
+	data, err := json.Marshal(checkpoint)
+	if err != nil {
+		log.Printf("ERROR: marshal resync checkpoint failed, %v", err)
+		return
+	}
+	if err = os.MkdirAll(filepath.Dir(r.options.CheckpointFile), 0750); err != nil {
+		log.Printf("ERROR: create resync checkpoint dir failed, %v", err)
+		return
+	}
+	tmpFile := r.options.CheckpointFile + ".tmp"
+	if err = os.WriteFile(tmpFile, data, 0600); err != nil {
+		log.Printf("ERROR: write resync checkpoint failed, %v", err)
+		return
+	}
+	if err = os.Rename(tmpFile, r.options.CheckpointFile); err != nil {
+		log.Printf("ERROR: rename resync checkpoint failed, %v", err)
+	}
+}
+
+func (r *Resyncer) removeCheckpoint() {
+	if r.options.CheckpointFile == "" {
+		return
+	}
+	if err := os.Remove(r.options.CheckpointFile); err != nil && !os.IsNotExist(err) {
+		log.Printf("WARNING: remove resync checkpoint failed, %v", err)
+	}
+}
@@ -0,0 +1,191 @@
+/*
+ * Copyright (c) Huawei Technologies Co., Ltd. 2021.
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use
+ * this file except in compliance with the License.  You may obtain a copy of the
+ * License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package resync
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// errUnsupportedType the type can only be copied by DUMP/RESTORE, such as stream.
+var errUnsupportedType = errors.New("type can not be copied without DUMP/RESTORE")
+
+// entry a key read from the source server, by DUMP or by the commands of its type.
+type entry struct {
+	key   string
+	dump  string // DUMP payload, empty if it is read by type
+	typ   string
+	value interface{} // string, map[string]string, []string or []redis.Z
+	ttl   time.Duration
+}
+
+func (e *entry) dumped() bool {
+	return e.dump != ""
+}
+
+func (e *entry) sameValue(other *entry) bool {
+	if e.dumped() || other.dumped() {
+		return e.dump == other.dump
+	}
+	return e.typ == other.typ && reflect.DeepEqual(e.value, other.value)
+}
+
+// copier read keys from the source server and write them to the target server. It falls back to the commands of
+// the types if DUMP or RESTORE fails.
+type copier struct {
+	target    redis.UniversalClient
+	typeAware int32
+}
+
+func newCopier(target redis.UniversalClient, typeAware bool) *copier {
+	c := &copier{target: target}
+	if typeAware {
+		c.typeAware = 1
+	}
+	return c
+}
+
+// fallback to the commands of the types if the error is returned by the redis server, such as an unknown command
+// or an incompatible DUMP payload; it returns false if it has fallen back already.
+func (c *copier) fallback(err error) bool {
+	var redisErr redis.Error
+	if !errors.As(err, &redisErr) {
+		return false
+	}
+	return atomic.CompareAndSwapInt32(&c.typeAware, 0, 1)
+}
+
+// read the key, nil if the key does not exist.
+func (c *copier) read(ctx context.Context, source redis.Cmdable, key string) (*entry, error) {
+	if atomic.LoadInt32(&c.typeAware) == 0 {
+		e, err := c.readDump(ctx, source, key)
+		if err == nil || !c.fallback(err) {
+			return e, err
+		}
+	}
+	return c.readByType(ctx, source, key)
+}
+
+func (c *copier) readDump(ctx context.Context, source redis.Cmdable, key string) (*entry, error) {
+	var dumpCmd *redis.StringCmd
+	var ttlCmd *redis.DurationCmd
+	_, err := source.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		dumpCmd = pipe.Dump(ctx, key)
+		ttlCmd = pipe.PTTL(ctx, key)
+		return nil
+	})
+	if errors.Is(dumpCmd.Err(), redis.Nil) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &entry{key: key, dump: dumpCmd.Val(), ttl: ttlOf(ttlCmd.Val())}, nil
+}
+
+func (c *copier) readByType(ctx context.Context, source redis.Cmdable, key string) (*entry, error) {
+	var typeCmd *redis.StatusCmd
+	var ttlCmd *redis.DurationCmd
+	if _, err := source.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		typeCmd = pipe.Type(ctx, key)
+		ttlCmd = pipe.PTTL(ctx, key)
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	e := &entry{key: key, typ: typeCmd.Val(), ttl: ttlOf(ttlCmd.Val())}
+	var err error
+	switch e.typ {
+	case "none":
+		return nil, nil
+	case "string":
+		e.value, err = source.Get(ctx, key).Result()
+	case "hash":
+		e.value, err = source.HGetAll(ctx, key).Result()
+	case "list":
+		e.value, err = source.LRange(ctx, key, 0, -1).Result()
+	case "set":
+		var members []string
+		members, err = source.SMembers(ctx, key).Result()
+		sort.Strings(members)
+		e.value = members
+	case "zset":
+		e.value, err = source.ZRangeWithScores(ctx, key, 0, -1).Result()
+	default:
+		return e, fmt.Errorf("read key of type '%s' failed, %w", e.typ, errUnsupportedType)
+	}
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+	return e, err
+}
+
+// ttlOf returns the TTL of the PTTL reply, 0 if the key has no TTL.
+func ttlOf(pttl time.Duration) time.Duration {
+	if pttl < 0 {
+		return 0
+	}
+	return pttl
+}
+
+// del delete the key from the target server.
+func (c *copier) del(ctx context.Context, key string) error {
+	return c.target.Del(ctx, key).Err()
+}
+
+// write the key to the target server, the existing value is replaced.
+func (c *copier) write(ctx context.Context, e *entry) error {
+	if e.dumped() {
+		return c.target.RestoreReplace(ctx, e.key, e.ttl, e.dump).Err()
+	}
+	_, err := c.target.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(ctx, e.key)
+		switch value := e.value.(type) {
+		case string:
+			pipe.Set(ctx, e.key, value, e.ttl)
+			return nil
+		case map[string]string:
+			pipe.HSet(ctx, e.key, value)
+		case []string:
+			members := make([]interface{}, len(value))
+			for i, member := range value {
+				members[i] = member
+			}
+			if e.typ == "list" {
+				pipe.RPush(ctx, e.key, members...)
+			} else {
+				pipe.SAdd(ctx, e.key, members...)
+			}
+		case []redis.Z:
+			members := make([]*redis.Z, len(value))
+			for i := range value {
+				members[i] = &value[i]
+			}
+			pipe.ZAdd(ctx, e.key, members...)
+		}
+		if e.ttl > 0 {
+			pipe.PExpire(ctx, e.key, e.ttl)
+		}
+		return nil
+	})
+	return err
+}
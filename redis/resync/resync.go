@@ -0,0 +1,288 @@
+/*
+ * Copyright (c) Huawei Technologies Co., Ltd. 2021.
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use
+ * this file except in compliance with the License.  You may obtain a copy of the
+ * License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+// Package resync copies all keys of a source redis server to a target server, to bring a mirror back in sync after
+// it has been down for a long time or its double-write persist dir was lost. The source is walked by SCAN, every
+// master node of a cluster, while the live double-writes continue.
+package resync
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+
+	"github.com/go-redis/redis/v8"
+	"golang.org/x/time/rate"
+)
+
+const (
+	defaultScanCount   = 100
+	defaultMaxAttempts = 3
+)
+
+// Server a redis server to resync from or to.
+type Server struct {
+	Name   string
+	Client redis.UniversalClient
+}
+
+// Options of the resync, nil means the default options.
+type Options struct {
+	Match string // SCAN MATCH pattern, default all keys
+	Count int64  // SCAN COUNT, default 100
+	// KeysPerSecond the max keys copied per second, 0 means unlimited
+	KeysPerSecond int
+	// TypeAware copy the keys by the commands of their types instead of DUMP/RESTORE, which is used as well when
+	// DUMP or RESTORE is not supported, or the DUMP payload is not compatible with the target server
+	TypeAware bool
+	// MaxAttempts the times to copy a key which is modified while it is copied, default 3
+	MaxAttempts int
+	// CheckpointFile the file of the SCAN cursors, a resync interrupted is resumed from it. It is removed after the
+	// resync is done. Empty means the resync is not resumable.
+	CheckpointFile string
+	// OnProgress is called after every SCAN batch is copied and after the resync is done
+	OnProgress func(progress Progress)
+}
+
+// Progress of a resync.
+type Progress struct {
+	Nodes     int   `json:"nodes"`     // master nodes of the source server
+	NodesDone int   `json:"nodesDone"` // master nodes walked completely
+	Scanned   int64 `json:"scanned"`   // keys returned by SCAN
+	Copied    int64 `json:"copied"`    // keys copied to the target server
+	Skipped   int64 `json:"skipped"`   // keys expired or deleted before they were copied
+	Failed    int64 `json:"failed"`    // keys failed to copy
+	Done      bool  `json:"done"`
+}
+
+// Resyncer copies the keys of the source server to the target server.
+type Resyncer struct {
+	source   Server
+	target   Server
+	options  Options
+	limiter  *rate.Limiter
+	mutex    sync.Mutex
+	progress Progress
+	copier   *copier
+}
+
+// NewResyncer create a resyncer from the source server to the target server.
+func NewResyncer(source, target Server, options *Options) *Resyncer {
+	r := &Resyncer{source: source, target: target}
+	if options != nil {
+		r.options = *options
+	}
+	if r.options.Count <= 0 {
+		r.options.Count = defaultScanCount
+	}
+	if r.options.MaxAttempts <= 0 {
+		r.options.MaxAttempts = defaultMaxAttempts
+	}
+	if r.options.KeysPerSecond > 0 {
+		r.limiter = rate.NewLimiter(rate.Limit(r.options.KeysPerSecond), r.options.KeysPerSecond)
+	}
+	r.copier = newCopier(target.Client, r.options.TypeAware)
+	return r
+}
+
+// Progress returns the current progress.
+func (r *Resyncer) Progress() Progress {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.progress
+}
+
+// Run walk all master nodes of the source server and copy their keys to the target server, it returns when all
+// keys are walked, or the context is done; it is resumed from the checkpoint file if there is one.
+func (r *Resyncer) Run(ctx context.Context) (Progress, error) {
+	if r.source.Client == nil || r.target.Client == nil {
+		return Progress{}, errors.New("resync source and target clients cannot be nil")
+	}
+	nodes, err := masterNodes(ctx, r.source.Client)
+	if err != nil {
+		return r.Progress(), fmt.Errorf("get master nodes of server '%s' failed, %w", r.source.Name, err)
+	}
+	checkpoint := r.loadCheckpoint()
+	r.mutex.Lock()
+	r.progress = checkpoint.Progress
+	r.progress.Nodes = len(nodes)
+	r.progress.NodesDone = 0
+	r.mutex.Unlock()
+	log.Printf("INFO: resync from server '%s' to '%s' started, %d master nodes", r.source.Name, r.target.Name,
+		len(nodes))
+	for _, n := range nodes {
+		if checkpoint.Done[n.addr] {
+			r.update(func(p *Progress) { p.NodesDone++ })
+			continue
+		}
+		if err = r.walk(ctx, n, checkpoint); err != nil {
+			return r.Progress(), err
+		}
+		checkpoint.Done[n.addr] = true
+		delete(checkpoint.Cursors, n.addr)
+		r.update(func(p *Progress) { p.NodesDone++ })
+		checkpoint.Progress = r.Progress()
+		r.saveCheckpoint(checkpoint)
+	}
+	r.update(func(p *Progress) { p.Done = true })
+	r.removeCheckpoint()
+	progress := r.Progress()
+	r.report(progress)
+	log.Printf("INFO: resync from server '%s' to '%s' done, scanned %d, copied %d, skipped %d, failed %d",
+		r.source.Name, r.target.Name, progress.Scanned, progress.Copied, progress.Skipped, progress.Failed)
+	return progress, nil
+}
+
+// walk the keys of the node from the cursor of the checkpoint, the cursor is saved after every batch copied.
+func (r *Resyncer) walk(ctx context.Context, n node, checkpoint *Checkpoint) error {
+	cursor := checkpoint.Cursors[n.addr]
+	for {
+		keys, next, err := n.client.Scan(ctx, cursor, r.options.Match, r.options.Count).Result()
+		if err != nil {
+			return fmt.Errorf("scan node '%s' of server '%s' failed, %w", n.addr, r.source.Name, err)
+		}
+		r.update(func(p *Progress) { p.Scanned += int64(len(keys)) })
+		for _, key := range keys {
+			// the batch is walked again after resumed if it is interrupted
+			if err = ctx.Err(); err != nil {
+				return err
+			}
+			if r.limiter != nil {
+				if err = r.limiter.Wait(ctx); err != nil {
+					return err
+				}
+			}
+			result := r.copyKey(ctx, n.client, key)
+			r.update(func(p *Progress) {
+				switch result {
+				case copied:
+					p.Copied++
+				case skipped:
+					p.Skipped++
+				default:
+					p.Failed++
+				}
+			})
+		}
+		cursor = next
+		checkpoint.Cursors[n.addr] = cursor
+		if cursor != 0 {
+			checkpoint.Progress = r.Progress()
+			r.saveCheckpoint(checkpoint)
+			r.report(checkpoint.Progress)
+			continue
+		}
+		return nil
+	}
+}
+
+type copyResult int
+
+const (
+	copied copyResult = iota
+	skipped
+	failed
+)
+
+// copyKey copy the key to the target server. A key modified on the source server while it is copied is copied
+// again, so that the value restored is not older than the live double-writes mirrored after it. A key deleted while
+// it is copied is deleted on the target server, the mirrored DEL may be executed before the value is restored.
+func (r *Resyncer) copyKey(ctx context.Context, source redis.Cmdable, key string) copyResult {
+	for attempt := 0; attempt < r.options.MaxAttempts; attempt++ {
+		e, err := r.copier.read(ctx, source, key)
+		if err != nil {
+			log.Printf("ERROR: resync read key '%s' from server '%s' failed, %v", key, r.source.Name, err)
+			return failed
+		}
+		if e == nil {
+			return skipped
+		}
+		if err = r.copier.write(ctx, e); err != nil {
+			if !e.dumped() || !r.copier.fallback(err) {
+				log.Printf("ERROR: resync write key '%s' to server '%s' failed, %v", key, r.target.Name, err)
+				return failed
+			}
+			attempt--
+			continue
+		}
+		current, err := r.copier.read(ctx, source, key)
+		if err != nil {
+			log.Printf("ERROR: resync verify key '%s' of server '%s' failed, %v", key, r.source.Name, err)
+			return failed
+		}
+		if current == nil {
+			return r.deleteKey(ctx, source, key)
+		}
+		if e.sameValue(current) {
+			return copied
+		}
+	}
+	log.Printf("WARNING: resync key '%s' is modified during %d attempts", key, r.options.MaxAttempts)
+	return failed
+}
+
+// deleteKey delete the key deleted on the source server while it is copied from the target server, it is skipped
+// unless it is created again meanwhile.
+func (r *Resyncer) deleteKey(ctx context.Context, source redis.Cmdable, key string) copyResult {
+	if err := r.copier.del(ctx, key); err != nil {
+		log.Printf("ERROR: resync delete key '%s' from server '%s' failed, %v", key, r.target.Name, err)
+		return failed
+	}
+	exists, err := source.Exists(ctx, key).Result()
+	if err != nil {
+		log.Printf("ERROR: resync verify key '%s' of server '%s' failed, %v", key, r.source.Name, err)
+		return failed
+	}
+	if exists > 0 {
+		log.Printf("WARNING: resync key '%s' is created again while it is deleted", key)
+		return failed
+	}
+	return skipped
+}
+
+func (r *Resyncer) update(fn func(p *Progress)) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	fn(&r.progress)
+}
+
+func (r *Resyncer) report(progress Progress) {
+	if r.options.OnProgress != nil {
+		r.options.OnProgress(progress)
+	}
+}
+
+// node a master node of the source server, addr is empty if the server is not a cluster.
+type node struct {
+	addr   string
+	client redis.Cmdable
+}
+
+func masterNodes(ctx context.Context, client redis.UniversalClient) ([]node, error) {
+	clusterClient, ok := client.(*redis.ClusterClient)
+	if !ok {
+		return []node{{client: client}}, nil
+	}
+	var mutex sync.Mutex
+	var nodes []node
+	err := clusterClient.ForEachMaster(ctx, func(ctx context.Context, master *redis.Client) error {
+		mutex.Lock()
+		defer mutex.Unlock()
+		nodes = append(nodes, node{addr: master.Options().Addr, client: master})
+		return nil
+	})
+	return nodes, err
+}
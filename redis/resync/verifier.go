@@ -0,0 +1,402 @@
+/*
+ * Copyright (c) Huawei Technologies Co., Ltd. 2021.
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use
+ * this file except in compliance with the License.  You may obtain a copy of the
+ * License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package resync
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"golang.org/x/time/rate"
+)
+
+const (
+	defaultTTLTolerance = time.Second
+	defaultMaxDiffs     = 1000
+)
+
+// reasons of the mismatches
+const (
+	MismatchType  = "type"
+	MismatchValue = "value"
+	MismatchTTL   = "ttl"
+)
+
+// VerifyOptions of the verifier, nil means a full verification without repair.
+type VerifyOptions struct {
+	Match string // SCAN MATCH pattern, default all keys
+	Count int64  // SCAN COUNT, default 100
+	// SampleSize verify the keys picked by RANDOMKEY on every master node instead of all keys, 0 means all keys
+	SampleSize int
+	// KeysPerSecond the max keys verified per second, 0 means unlimited
+	KeysPerSecond int
+	// TTLTolerance the max TTL drift of a key, default 1s
+	TTLTolerance time.Duration
+	// RecheckDelay check a divergent key again after the delay, so that the writes in flight of double-write are
+	// not reported, 0 means no recheck
+	RecheckDelay time.Duration
+	// Repair copy the missing and mismatched keys from the source server to the target server
+	Repair bool
+	// DeleteExtra delete the extra keys of the target server when Repair is set
+	DeleteExtra bool
+	// MaxDiffs the max keys of every kind of difference in the report, the counts are not limited, default 1000
+	MaxDiffs int
+}
+
+// Mismatch a key on both servers with different type, value or TTL.
+type Mismatch struct {
+	Key        string        `json:"key"`
+	Reason     string        `json:"reason"`
+	SourceType string        `json:"sourceType"`
+	TargetType string        `json:"targetType"`
+	SourceTTL  time.Duration `json:"sourceTTL"` // 0 means no TTL
+	TargetTTL  time.Duration `json:"targetTTL"`
+}
+
+// Report the differences of the target server from the source server.
+type Report struct {
+	Source        string     `json:"source"`
+	Target        string     `json:"target"`
+	Sampled       bool       `json:"sampled"`
+	Checked       int64      `json:"checked"` // keys of both servers checked
+	MissingCount  int64      `json:"missingCount"`
+	MismatchCount int64      `json:"mismatchCount"`
+	ExtraCount    int64      `json:"extraCount"`
+	FailedCount   int64      `json:"failedCount"` // keys failed to read or repair
+	Repaired      int64      `json:"repaired"`
+	Missing       []string   `json:"missing"`    // keys of the source server missing on the target server
+	Mismatches    []Mismatch `json:"mismatches"` // keys of both servers which are different
+	Extra         []string   `json:"extra"`      // keys of the target server missing on the source server
+}
+
+// Consistent whether no difference is found.
+func (r *Report) Consistent() bool {
+	return r.MissingCount == 0 && r.MismatchCount == 0 && r.ExtraCount == 0 && r.FailedCount == 0
+}
+
+// Verifier compares the keys of the target server with the source server.
+type Verifier struct {
+	source  Server
+	target  Server
+	options VerifyOptions
+	limiter *rate.Limiter
+	copier  *copier
+	mutex   sync.Mutex
+	report  *Report
+}
+
+// NewVerifier create a verifier of the target server against the source server.
+func NewVerifier(source, target Server, options *VerifyOptions) *Verifier {
+	v := &Verifier{source: source, target: target}
+	if options != nil {
+		v.options = *options
+	}
+	if v.options.Count <= 0 {
+		v.options.Count = defaultScanCount
+	}
+	if v.options.TTLTolerance <= 0 {
+		v.options.TTLTolerance = defaultTTLTolerance
+	}
+	if v.options.MaxDiffs <= 0 {
+		v.options.MaxDiffs = defaultMaxDiffs
+	}
+	if v.options.KeysPerSecond > 0 {
+		v.limiter = rate.NewLimiter(rate.Limit(v.options.KeysPerSecond), v.options.KeysPerSecond)
+	}
+	v.copier = newCopier(target.Client, true)
+	return v
+}
+
+// Run verify the keys of the source server on the target server, then the keys of the target server on the source
+// server to find the extra keys.
+func (v *Verifier) Run(ctx context.Context) (*Report, error) {
+	if v.source.Client == nil || v.target.Client == nil {
+		return nil, errors.New("verify source and target clients cannot be nil")
+	}
+	v.report = &Report{Source: v.source.Name, Target: v.target.Name, Sampled: v.options.SampleSize > 0}
+	sourceNodes, err := masterNodes(ctx, v.source.Client)
+	if err != nil {
+		return nil, fmt.Errorf("get master nodes of server '%s' failed, %w", v.source.Name, err)
+	}
+	for _, n := range sourceNodes {
+		if err = v.walk(ctx, n, v.verifyKey); err != nil {
+			return v.report, err
+		}
+	}
+	targetNodes, err := masterNodes(ctx, v.target.Client)
+	if err != nil {
+		return v.report, fmt.Errorf("get master nodes of server '%s' failed, %w", v.target.Name, err)
+	}
+	for _, n := range targetNodes {
+		if err = v.walk(ctx, n, v.checkExtra); err != nil {
+			return v.report, err
+		}
+	}
+	report := v.report
+	log.Printf("INFO: verify server '%s' against '%s' done, checked %d, missing %d, mismatched %d, extra %d, "+
+		"failed %d, repaired %d", v.target.Name, v.source.Name, report.Checked, report.MissingCount,
+		report.MismatchCount, report.ExtraCount, report.FailedCount, report.Repaired)
+	return report, nil
+}
+
+// walk the keys of the node, all keys by SCAN or the sampled keys by RANDOMKEY.
+func (v *Verifier) walk(ctx context.Context, n node, fn func(ctx context.Context, n node, key string)) error {
+	if v.options.SampleSize > 0 {
+		return v.sample(ctx, n, fn)
+	}
+	var cursor uint64
+	for {
+		keys, next, err := n.client.Scan(ctx, cursor, v.options.Match, v.options.Count).Result()
+		if err != nil {
+			return fmt.Errorf("scan node '%s' failed, %w", n.addr, err)
+		}
+		for _, key := range keys {
+			if err = v.wait(ctx); err != nil {
+				return err
+			}
+			fn(ctx, n, key)
+		}
+		if next == 0 {
+			return nil
+		}
+		cursor = next
+	}
+}
+
+// sample verify SampleSize distinct random keys of the node, which match the pattern.
+func (v *Verifier) sample(ctx context.Context, n node, fn func(ctx context.Context, n node, key string)) error {
+	sampled := make(map[string]struct{}, v.options.SampleSize)
+	// the node may have fewer keys than the sample size, or few keys matching the pattern
+	for tries := 0; len(sampled) < v.options.SampleSize && tries < v.options.SampleSize*10; tries++ {
+		key, err := n.client.RandomKey(ctx).Result()
+		if errors.Is(err, redis.Nil) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("sample node '%s' failed, %w", n.addr, err)
+		}
+		if _, ok := sampled[key]; ok || !matchPattern(v.options.Match, key) {
+			continue
+		}
+		sampled[key] = struct{}{}
+		if err = v.wait(ctx); err != nil {
+			return err
+		}
+		fn(ctx, n, key)
+	}
+	return nil
+}
+
+func matchPattern(pattern, key string) bool {
+	if pattern == "" {
+		return true
+	}
+	matched, err := filepath.Match(pattern, key)
+	return err == nil && matched
+}
+
+func (v *Verifier) wait(ctx context.Context) error {
+	if v.limiter != nil {
+		return v.limiter.Wait(ctx)
+	}
+	return ctx.Err()
+}
+
+// verifyKey compare the key of the source node with the target server, the divergent key is checked again after
+// RecheckDelay and repaired if Repair is set.
+func (v *Verifier) verifyKey(ctx context.Context, n node, key string) {
+	source, target, mismatch, err := v.compare(ctx, n.client, key)
+	if err == nil && (source == nil || target == nil || mismatch != nil) && v.options.RecheckDelay > 0 {
+		time.Sleep(v.options.RecheckDelay)
+		source, target, mismatch, err = v.compare(ctx, n.client, key)
+	}
+	if err != nil {
+		log.Printf("ERROR: verify key '%s' failed, %v", key, err)
+		v.update(func(r *Report) { r.FailedCount++ })
+		return
+	}
+	if source == nil {
+		// deleted from the source server while it is verified, the target server is checked by checkExtra
+		return
+	}
+	v.update(func(r *Report) {
+		r.Checked++
+		if target == nil {
+			r.MissingCount++
+			if len(r.Missing) < v.options.MaxDiffs {
+				r.Missing = append(r.Missing, key)
+			}
+		} else if mismatch != nil {
+			r.MismatchCount++
+			if len(r.Mismatches) < v.options.MaxDiffs {
+				r.Mismatches = append(r.Mismatches, *mismatch)
+			}
+		}
+	})
+	if v.options.Repair && (target == nil || mismatch != nil) {
+		v.repair(ctx, source)
+	}
+}
+
+// compare read the key of both servers, the mismatch is nil if they are the same.
+func (v *Verifier) compare(ctx context.Context, sourceNode redis.Cmdable, key string) (*digestEntry, *digestEntry,
+	*Mismatch, error) {
+	source, err := v.read(ctx, sourceNode, key)
+	if err != nil || source == nil {
+		return nil, nil, nil, err
+	}
+	target, err := v.read(ctx, v.target.Client, key)
+	if err != nil || target == nil {
+		return source, nil, nil, err
+	}
+	mismatch := &Mismatch{Key: key, SourceType: source.typ, TargetType: target.typ, SourceTTL: source.ttl,
+		TargetTTL: target.ttl}
+	switch {
+	case source.typ != target.typ:
+		mismatch.Reason = MismatchType
+	case source.digest != target.digest:
+		mismatch.Reason = MismatchValue
+	case ttlDrift(source.ttl, target.ttl) > v.options.TTLTolerance:
+		mismatch.Reason = MismatchTTL
+	default:
+		return source, target, nil, nil
+	}
+	return source, target, mismatch, nil
+}
+
+// ttlDrift the difference of the TTLs, a key without TTL drifts from a key with TTL infinitely.
+func ttlDrift(a, b time.Duration) time.Duration {
+	if (a == 0) != (b == 0) {
+		return time.Duration(1<<63 - 1)
+	}
+	if a > b {
+		return a - b
+	}
+	return b - a
+}
+
+// checkExtra check the key of the target server exists on the source server.
+func (v *Verifier) checkExtra(ctx context.Context, _ node, key string) {
+	exists, err := v.source.Client.Exists(ctx, key).Result()
+	if err != nil {
+		log.Printf("ERROR: verify extra key '%s' failed, %v", key, err)
+		v.update(func(r *Report) { r.FailedCount++ })
+		return
+	}
+	if exists > 0 {
+		return
+	}
+	if v.options.RecheckDelay > 0 {
+		time.Sleep(v.options.RecheckDelay)
+		if exists, err = v.source.Client.Exists(ctx, key).Result(); err != nil || exists > 0 {
+			return
+		}
+	}
+	v.update(func(r *Report) {
+		r.ExtraCount++
+		if len(r.Extra) < v.options.MaxDiffs {
+			r.Extra = append(r.Extra, key)
+		}
+	})
+	if v.options.Repair && v.options.DeleteExtra {
+		if err = v.target.Client.Del(ctx, key).Err(); err != nil {
+			log.Printf("ERROR: delete extra key '%s' of server '%s' failed, %v", key, v.target.Name, err)
+			v.update(func(r *Report) { r.FailedCount++ })
+			return
+		}
+		v.update(func(r *Report) { r.Repaired++ })
+	}
+}
+
+// repair copy the key read from the source server to the target server.
+func (v *Verifier) repair(ctx context.Context, source *digestEntry) {
+	if err := v.copier.write(ctx, source.entry); err != nil {
+		log.Printf("ERROR: repair key '%s' of server '%s' failed, %v", source.key, v.target.Name, err)
+		v.update(func(r *Report) { r.FailedCount++ })
+		return
+	}
+	v.update(func(r *Report) { r.Repaired++ })
+}
+
+func (v *Verifier) update(fn func(r *Report)) {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	fn(v.report)
+}
+
+// digestEntry the entry of a key with the digest of its value.
+type digestEntry struct {
+	*entry
+	digest string
+}
+
+// read the key by the commands of its type, or by DUMP if the type is not supported, nil if it does not exist.
+func (v *Verifier) read(ctx context.Context, client redis.Cmdable, key string) (*digestEntry, error) {
+	e, err := v.copier.readByType(ctx, client, key)
+	if errors.Is(err, errUnsupportedType) {
+		typ := e.typ
+		if e, err = v.copier.readDump(ctx, client, key); e != nil {
+			e.typ = typ
+		}
+	}
+	if err != nil || e == nil {
+		return nil, err
+	}
+	return &digestEntry{entry: e, digest: digest(e)}, nil
+}
+
+// digest the SHA-256 of the value, the fields of hashes and the members of sets are sorted.
+func digest(e *entry) string {
+	hash := sha256.New()
+	write := func(values ...string) {
+		for _, value := range values {
+			hash.Write([]byte(strconv.Itoa(len(value))))
+			hash.Write([]byte{':'})
+			hash.Write([]byte(value))
+		}
+	}
+	if e.dumped() {
+		write(e.dump)
+	}
+	switch value := e.value.(type) {
+	case string:
+		write(value)
+	case map[string]string:
+		fields := make([]string, 0, len(value))
+		for field := range value {
+			fields = append(fields, field)
+		}
+		sort.Strings(fields)
+		for _, field := range fields {
+			write(field, value[field])
+		}
+	case []string:
+		write(value...)
+	case []redis.Z:
+		for _, z := range value {
+			write(fmt.Sprint(z.Member), strconv.FormatFloat(z.Score, 'g', -1, 64))
+		}
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
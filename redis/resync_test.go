@@ -0,0 +1,192 @@
+/*
+ * Copyright (c) Huawei Technologies Co., Ltd. 2021.
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use
+ * this file except in compliance with the License.  You may obtain a copy of the
+ * License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	goredis "github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/huaweicloud/devcloud-go/redis/resync"
+	"github.com/huaweicloud/devcloud-go/redis/strategy"
+)
+
+func fillResyncSource(m *miniredis.Miniredis) {
+	_ = m.Set("string", "value")
+	m.SetTTL("string", time.Hour)
+	m.HSet("hash", "field", "value")
+	_, _ = m.Push("list", "a", "b", "c")
+	_, _ = m.SetAdd("set", "x", "y")
+	_, _ = m.ZAdd("zset", 1.5, "member")
+	m.SetTTL("zset", time.Minute)
+}
+
+func assertResynced(t *testing.T, m *miniredis.Miniredis) {
+	value, _ := m.Get("string")
+	assert.Equal(t, "value", value)
+	assert.Equal(t, time.Hour, m.TTL("string"))
+	assert.Equal(t, "value", m.HGet("hash", "field"))
+	list, _ := m.List("list")
+	assert.Equal(t, []string{"a", "b", "c"}, list)
+	members, _ := m.Members("set")
+	assert.Equal(t, []string{"x", "y"}, members)
+	score, _ := m.ZScore("zset", "member")
+	assert.Equal(t, 1.5, score)
+	assert.Equal(t, time.Minute, m.TTL("zset"))
+}
+
+func TestDevsporeClient_Resync(t *testing.T) {
+	dc1, dc2 := startDoubleWriteMocks(t)
+	client := NewDevsporeClient(doubleWriteConfiguration(strategy.SingleReadDoubleWriteMode, dc1.Addr, dc2.Addr))
+	defer client.Close()
+	// dc1 was down, resync it to the active dc2
+	fillResyncSource(dc1.GetMockRedis())
+	// a stale value on the target is replaced
+	_ = dc2.GetMockRedis().Set("string", "stale")
+
+	var reports []resync.Progress
+	progress, err := client.Resync(context.Background(), "dc1", "dc2", &resync.Options{KeysPerSecond: 1000,
+		OnProgress: func(progress resync.Progress) {
+			reports = append(reports, progress)
+		}})
+	assert.Nil(t, err)
+	assert.Equal(t, resync.Progress{Nodes: 1, NodesDone: 1, Scanned: 5, Copied: 5, Done: true}, progress)
+	assert.Equal(t, progress, reports[len(reports)-1])
+	assertResynced(t, dc2.GetMockRedis())
+
+	// the copies to the active server are not mirrored back to the source
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(t, uint64(0), client.DoubleWriteStats()["dc1"].Executed)
+
+	_, err = client.Resync(context.Background(), "dc2", "dc3", nil)
+	assert.NotNil(t, err)
+}
+
+func TestResyncer_ClusterSource(t *testing.T) {
+	source, target := startDoubleWriteMocks(t)
+	fillResyncSource(source.GetMockRedis())
+	sourceClient := goredis.NewClusterClient(&goredis.ClusterOptions{Addrs: []string{source.Addr}})
+	defer sourceClient.Close()
+	targetClient := goredis.NewClient(&goredis.Options{Addr: target.Addr})
+	defer targetClient.Close()
+
+	resyncer := resync.NewResyncer(resync.Server{Name: "dc1", Client: sourceClient},
+		resync.Server{Name: "dc2", Client: targetClient}, &resync.Options{Match: "s*"})
+	progress, err := resyncer.Run(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), progress.Copied)
+	assert.Equal(t, progress, resyncer.Progress())
+	assert.ElementsMatch(t, []string{"string", "set"}, target.GetMockRedis().Keys())
+}
+
+func TestResyncer_Checkpoint(t *testing.T) {
+	source, target := startDoubleWriteMocks(t)
+	fillResyncSource(source.GetMockRedis())
+	sourceClient := goredis.NewClient(&goredis.Options{Addr: source.Addr})
+	defer sourceClient.Close()
+	targetClient := goredis.NewClient(&goredis.Options{Addr: target.Addr})
+	defer targetClient.Close()
+	checkpointFile := filepath.Join(t.TempDir(), "resync", "checkpoint.json")
+	newResyncer := func() *resync.Resyncer {
+		return resync.NewResyncer(resync.Server{Name: "dc1", Client: sourceClient},
+			resync.Server{Name: "dc2", Client: targetClient}, &resync.Options{CheckpointFile: checkpointFile})
+	}
+
+	// an interrupted resync saves no cursor of the unfinished batch
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := newResyncer().Run(ctx)
+	assert.ErrorIs(t, err, context.Canceled)
+
+	// the resync is resumed from the cursor of the checkpoint, which is after all keys
+	writeCheckpoint(t, checkpointFile, &resync.Checkpoint{Source: "dc1", Target: "dc2",
+		Cursors: map[string]uint64{"": 5}, Progress: resync.Progress{Scanned: 5, Copied: 5}})
+	progress, err := newResyncer().Run(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, resync.Progress{Nodes: 1, NodesDone: 1, Scanned: 5, Copied: 5, Done: true}, progress)
+	assert.Equal(t, 0, len(target.GetMockRedis().Keys()))
+	_, err = os.Stat(checkpointFile)
+	assert.True(t, os.IsNotExist(err))
+
+	// the checkpoint of another resync is ignored
+	writeCheckpoint(t, checkpointFile, &resync.Checkpoint{Source: "dc3", Target: "dc2",
+		Done: map[string]bool{"": true}})
+	progress, err = newResyncer().Run(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, int64(5), progress.Copied)
+	assertResynced(t, target.GetMockRedis())
+}
+
+// deleteOnWriteHook delete the key on the source server and executes the mirrored DEL on the target server
+// before the first write of the resync to the target server.
+type deleteOnWriteHook struct {
+	once   sync.Once
+	delete func()
+}
+
+func (h *deleteOnWriteHook) BeforeProcess(ctx context.Context, cmd goredis.Cmder) (context.Context, error) {
+	if cmd.Name() == "restore" {
+		h.once.Do(h.delete)
+	}
+	return ctx, nil
+}
+
+func (h *deleteOnWriteHook) AfterProcess(ctx context.Context, cmd goredis.Cmder) error {
+	return nil
+}
+
+func (h *deleteOnWriteHook) BeforeProcessPipeline(ctx context.Context, cmds []goredis.Cmder) (context.Context,
+	error) {
+	h.once.Do(h.delete)
+	return ctx, nil
+}
+
+func (h *deleteOnWriteHook) AfterProcessPipeline(ctx context.Context, cmds []goredis.Cmder) error {
+	return nil
+}
+
+func TestResyncer_KeyDeletedWhileCopied(t *testing.T) {
+	source, target := startDoubleWriteMocks(t)
+	_ = source.GetMockRedis().Set("deleted", "value")
+	sourceClient := goredis.NewClient(&goredis.Options{Addr: source.Addr})
+	defer sourceClient.Close()
+	targetClient := goredis.NewClient(&goredis.Options{Addr: target.Addr})
+	defer targetClient.Close()
+	targetClient.AddHook(&deleteOnWriteHook{delete: func() {
+		source.GetMockRedis().Del("deleted")
+		target.GetMockRedis().Del("deleted")
+	}})
+
+	progress, err := resync.NewResyncer(resync.Server{Name: "dc1", Client: sourceClient},
+		resync.Server{Name: "dc2", Client: targetClient}, nil).Run(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, resync.Progress{Nodes: 1, NodesDone: 1, Scanned: 1, Skipped: 1, Done: true}, progress)
+	assert.False(t, target.GetMockRedis().Exists("deleted"))
+}
+
+func writeCheckpoint(t *testing.T, checkpointFile string, checkpoint *resync.Checkpoint) {
+	data, err := json.Marshal(checkpoint)
+	assert.Nil(t, err)
+	assert.Nil(t, os.MkdirAll(filepath.Dir(checkpointFile), 0750))
+	assert.Nil(t, os.WriteFile(checkpointFile, data, 0600))
+}
@@ -0,0 +1,131 @@
+/*
+ * Copyright (c) Huawei Technologies Co., Ltd. 2021.
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use
+ * this file except in compliance with the License.  You may obtain a copy of the
+ * License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package redis
+
+import (
+	"context"
+	"testing"
+
+	goredis "github.com/go-redis/redis/v8"
+	redigo "github.com/gomodule/redigo/redis"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/huaweicloud/devcloud-go/redis/strategy"
+)
+
+func TestDevsporeClient_RouteHint(t *testing.T) {
+	dc1, dc2 := startDoubleWriteMocks(t)
+	client := NewDevsporeClient(doubleWriteConfiguration(strategy.LocalReadSingleWriteMode, dc1.Addr, dc2.Addr))
+	defer client.Close()
+	ctx := context.Background()
+	_ = dc1.GetMockRedis().Set("key", "dc1")
+	_ = dc2.GetMockRedis().Set("key", "dc2")
+
+	assert.Equal(t, "dc1", client.Get(ctx, "key").Val())
+	assert.Equal(t, "dc2", client.Get(strategy.WithRouteMaster(ctx), "key").Val())
+	assert.Equal(t, "dc2", client.Get(strategy.WithReadPreference(ctx, strategy.ReadPreferenceActive), "key").Val())
+	assert.Equal(t, "dc1", client.Get(strategy.WithReadPreference(ctx, strategy.ReadPreferenceNearest), "key").Val())
+	assert.Equal(t, "dc2", client.Get(strategy.WithServer(ctx, "dc2"), "key").Val())
+	// an unknown server is ignored
+	assert.Equal(t, "dc1", client.Get(strategy.WithServer(ctx, "dc3"), "key").Val())
+
+	// the writes are pinned too
+	assert.Nil(t, client.Set(strategy.WithServer(ctx, "dc1"), "pinned", "value", 0).Err())
+	assert.True(t, dc1.GetMockRedis().Exists("pinned"))
+	assert.False(t, dc2.GetMockRedis().Exists("pinned"))
+	_, err := client.TxPipelined(strategy.WithServer(ctx, "dc1"), func(pipe goredis.Pipeliner) error {
+		pipe.Incr(ctx, "counter")
+		return nil
+	})
+	assert.Nil(t, err)
+	assert.True(t, dc1.GetMockRedis().Exists("counter"))
+	assert.False(t, dc2.GetMockRedis().Exists("counter"))
+
+	pinned := strategy.WithServer(ctx, "dc1")
+	pipe := client.PipelineContext(pinned)
+	pipe.Set(pinned, "pipeline_key", "value", 0)
+	_, err = pipe.Exec(pinned)
+	assert.Nil(t, err)
+	txPipe := client.TxPipelineContext(pinned)
+	txPipe.Set(pinned, "tx_pipeline_key", "value", 0)
+	_, err = txPipe.Exec(pinned)
+	assert.Nil(t, err)
+	for _, key := range []string{"pipeline_key", "tx_pipeline_key"} {
+		assert.True(t, dc1.GetMockRedis().Exists(key))
+		assert.False(t, dc2.GetMockRedis().Exists(key))
+	}
+}
+
+func TestDevsporeClient_RouteMasterOfMasterSlave(t *testing.T) {
+	master, replica1, replica2 := startMasterSlaveMocks(t)
+	client := NewDevsporeClient(masterSlaveConfiguration(master.Addr, replica1.Addr+","+replica2.Addr))
+	defer client.Close()
+	ctx := context.Background()
+
+	assert.NotEqual(t, "master", client.Get(ctx, "key").Val())
+	assert.Equal(t, "master", client.Get(strategy.WithRouteMaster(ctx), "key").Val())
+	assert.Equal(t, "master", client.Get(strategy.WithRouteMaster(strategy.WithServer(ctx, "dc1")), "key").Val())
+}
+
+func TestDevsporeClient_RouteHintDoubleWrite(t *testing.T) {
+	dc1, dc2 := startDoubleWriteMocks(t)
+	client := NewDevsporeClient(doubleWriteConfiguration(strategy.SingleReadDoubleWriteMode, dc1.Addr, dc2.Addr))
+	defer client.Close()
+	ctx := context.Background()
+
+	// the write pinned to the standby server is mirrored from it to the active server
+	assert.Nil(t, client.Set(strategy.WithServer(ctx, "dc1"), "pinned", "value", 0).Err())
+	assert.True(t, dc1.GetMockRedis().Exists("pinned"))
+	assertEventuallyValue(t, dc2, "pinned", "value")
+	assert.Nil(t, client.Set(ctx, "routed", "value", 0).Err())
+	assert.True(t, dc2.GetMockRedis().Exists("routed"))
+	assertEventuallyValue(t, dc1, "routed", "value")
+}
+
+func TestDevsporeRedigoClient_RouteHint(t *testing.T) {
+	dc1, dc2 := startDoubleWriteMocks(t)
+	client := NewDevsporeRedigoClient(doubleWriteConfiguration(strategy.LocalReadSingleWriteMode, dc1.Addr, dc2.Addr))
+	defer client.strategy.Close()
+	ctx := context.Background()
+	_ = dc1.GetMockRedis().Set("key", "dc1")
+	_ = dc2.GetMockRedis().Set("key", "dc2")
+
+	assert.Equal(t, "dc1", mustString(client.DoContext(ctx, "GET", "key")))
+	assert.Equal(t, "dc2", mustString(client.DoContext(strategy.WithRouteMaster(ctx), "GET", "key")))
+	assert.Equal(t, "dc2", mustString(client.DoContext(strategy.WithServer(ctx, "dc2"), "GET", "key")))
+
+	_, err := client.PipelineContext(strategy.WithServer(ctx, "dc1"), [][]string{{"SET", "pinned", "value"}})
+	assert.Nil(t, err)
+	assert.True(t, dc1.GetMockRedis().Exists("pinned"))
+	assert.False(t, dc2.GetMockRedis().Exists("pinned"))
+}
+
+func TestDevsporeRedigoClient_RouteHintDoubleWrite(t *testing.T) {
+	dc1, dc2 := startDoubleWriteMocks(t)
+	client := NewDevsporeRedigoClient(doubleWriteConfiguration(strategy.SingleReadDoubleWriteMode, dc1.Addr,
+		dc2.Addr))
+	defer client.strategy.Close()
+	ctx := context.Background()
+
+	_, err := client.DoContext(strategy.WithServer(ctx, "dc1"), "SET", "pinned", "value")
+	assert.Nil(t, err)
+	assert.True(t, dc1.GetMockRedis().Exists("pinned"))
+	assertEventuallyValue(t, dc2, "pinned", "value")
+}
+
+func mustString(reply interface{}, err error) string {
+	value, _ := redigo.String(reply, err)
+	return value
+}
@@ -0,0 +1,150 @@
+/*
+ * Copyright (c) Huawei Technologies Co., Ltd. 2021.
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use
+ * this file except in compliance with the License.  You may obtain a copy of the
+ * License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package redis
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	goredis "github.com/go-redis/redis/v8"
+	redigo "github.com/gomodule/redigo/redis"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/huaweicloud/devcloud-go/redis/file"
+	"github.com/huaweicloud/devcloud-go/redis/redigostrategy"
+	"github.com/huaweicloud/devcloud-go/redis/strategy"
+)
+
+const (
+	readScript  = "return redis.call('get', KEYS[1])"
+	writeScript = "return redis.call('set', KEYS[1], ARGV[1])"
+)
+
+func TestDevsporeClient_ReadOnlyScript(t *testing.T) {
+	local, remote := startDoubleWriteMocks(t)
+	_ = local.GetMockRedis().Set("script_key", "local")
+	_ = remote.GetMockRedis().Set("script_key", "remote")
+	sha := strategy.ScriptSHA(readScript)
+	client := NewDevsporeClient(doubleWriteConfiguration(strategy.LocalReadSingleWriteMode, local.Addr, remote.Addr))
+	defer client.Close()
+	ctx := context.Background()
+
+	// not registered, executed on the active server
+	assert.Equal(t, "remote", client.Eval(ctx, readScript, []string{"script_key"}).Val())
+
+	client.RegisterReadOnlyScript(sha)
+	assert.Equal(t, "local", client.Eval(ctx, readScript, []string{"script_key"}).Val())
+	localClient := goredis.NewClient(&goredis.Options{Addr: local.Addr})
+	defer localClient.Close()
+	assert.Nil(t, localClient.ScriptLoad(ctx, readScript).Err())
+	assert.Equal(t, "local", client.EvalSha(ctx, sha, []string{"script_key"}).Val())
+
+	redigoClient := NewDevsporeRedigoClient(doubleWriteConfiguration(strategy.LocalReadSingleWriteMode, local.Addr,
+		remote.Addr))
+	defer redigoClient.strategy.Close()
+	reply, err := redigo.String(redigoClient.Do("EVAL", readScript, 1, "script_key"))
+	assert.Nil(t, err)
+	assert.Equal(t, "remote", reply)
+	redigoClient.RegisterReadOnlyScript(sha)
+	reply, err = redigo.String(redigoClient.Do("EVAL", readScript, 1, "script_key"))
+	assert.Nil(t, err)
+	assert.Equal(t, "local", reply)
+}
+
+func TestDevsporeClient_ScriptMirrorBySHA(t *testing.T) {
+	local, remote := startDoubleWriteMocks(t)
+	sha := strategy.ScriptSHA(writeScript)
+	client := NewDevsporeClient(doubleWriteConfiguration(strategy.LocalReadDoubleWriteMode, local.Addr, remote.Addr))
+	defer client.Close()
+	ctx := context.Background()
+
+	// EVAL is mirrored as EVALSHA, the script is loaded on NOSCRIPT
+	assert.Nil(t, client.Eval(ctx, writeScript, []string{"eval_key"}, "eval_value").Err())
+	assertEventuallyValue(t, remote, "eval_key", "eval_value")
+	remoteClient := goredis.NewClient(&goredis.Options{Addr: remote.Addr})
+	defer remoteClient.Close()
+	assert.Equal(t, []bool{true}, remoteClient.ScriptExists(ctx, sha).Val())
+
+	// the script of EVALSHA is known by SCRIPT LOAD on the source server
+	incrScript := "return redis.call('incrby', KEYS[1], ARGV[1])"
+	incrSHA := client.ScriptLoad(ctx, incrScript).Val()
+	assert.Nil(t, client.EvalSha(ctx, incrSHA, []string{"evalsha_key"}, 2).Err())
+	assertEventuallyValue(t, remote, "evalsha_key", "2")
+
+	// the scripts of a pipeline are loaded before it is executed
+	_, err := client.TxPipelined(ctx, func(pipe goredis.Pipeliner) error {
+		pipe.Eval(ctx, incrScript, []string{"pipeline_key"}, 3)
+		pipe.Set(ctx, "pipeline_set_key", "value", 0)
+		return nil
+	})
+	assert.Nil(t, err)
+	assertEventuallyValue(t, remote, "pipeline_key", "3")
+	assertEventuallyValue(t, remote, "pipeline_set_key", "value")
+
+	redigoClient := NewDevsporeRedigoClient(doubleWriteConfiguration(strategy.LocalReadDoubleWriteMode, local.Addr,
+		remote.Addr))
+	defer redigoClient.strategy.Close()
+	redigoScript := "return redis.call('set', KEYS[1], 'redigo')"
+	_, err = redigoClient.Do("EVAL", redigoScript, 1, "redigo_eval_key")
+	assert.Nil(t, err)
+	assertEventuallyValue(t, remote, "redigo_eval_key", "redigo")
+	_, err = redigoClient.Pipeline([]*redigostrategy.RedigoCommandArgs{
+		{CommandName: "EVAL", Args: []interface{}{"return redis.call('incrby', KEYS[1], 4)", 1, "redigo_pipeline_key"}},
+	})
+	assert.Nil(t, err)
+	assertEventuallyValue(t, remote, "redigo_pipeline_key", "4")
+}
+
+func TestDevsporeClient_PersistScriptMirror(t *testing.T) {
+	local, remote := startDoubleWriteMocks(t)
+	configuration := doubleWriteConfiguration(strategy.LocalReadDoubleWriteMode, local.Addr, remote.Addr)
+	poolConfig := configuration.RedisConfig.AsyncRemotePoolConfiguration
+	poolConfig.Persist = true
+	poolConfig.PersistDir = t.TempDir()
+	poolConfig.FsyncPolicy = "always"
+	poolConfig.ReplayIntervalMillis = 50
+	client := NewDevsporeClient(configuration)
+	ctx := context.Background()
+
+	// the script body is written to the wal, it is replayed after the restart of the client
+	remote.StopMockRedis()
+	assert.Nil(t, client.Eval(ctx, writeScript, []string{"eval_key"}, "eval_value").Err())
+	time.Sleep(200 * time.Millisecond)
+	assert.Nil(t, client.Close())
+	if err := remote.StartMockRedis(); err != nil {
+		t.Fatal(err)
+	}
+	configuration = doubleWriteConfiguration(strategy.LocalReadDoubleWriteMode, local.Addr, remote.Addr)
+	configuration.RedisConfig.AsyncRemotePoolConfiguration = poolConfig
+	client = NewDevsporeClient(configuration)
+	defer client.Close()
+	assertEventuallyValue(t, remote, "eval_key", "eval_value")
+}
+
+func TestScriptRegistry_Bounded(t *testing.T) {
+	registry := strategy.NewScriptRegistry()
+	var args []interface{}
+	for i := 0; i < 2000; i++ {
+		args = registry.MirrorScriptArgs([]interface{}{"eval", fmt.Sprintf("return %d", i), 0})
+	}
+	// the registry is full, EVAL is mirrored as it is
+	assert.Equal(t, []interface{}{"eval", "return 1999", 0}, args)
+	args = registry.MirrorScriptArgs([]interface{}{"eval", "return 0", 0})
+	assert.Equal(t, []interface{}{"evalsha", strategy.ScriptSHA("return 0"), 0}, args)
+	item := registry.PersistItem(file.Item{Pipeline: [][]interface{}{args, {"set", "key", "value"}}})
+	assert.Equal(t, [][]interface{}{{"eval", "return 0", 0}, {"set", "key", "value"}}, item.Pipeline)
+}
@@ -17,23 +17,46 @@ package strategy
 
 import (
 	"context"
+	"fmt"
 	"log"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/go-redis/redis/v8"
 	"github.com/huaweicloud/devcloud-go/mas"
 	"github.com/huaweicloud/devcloud-go/redis/config"
+	"github.com/huaweicloud/devcloud-go/redis/file"
+)
+
+const (
+	commandInfoTimeout = 5 * time.Second
+	drainGracePeriod   = time.Second
+	drainTimeout       = 30 * time.Second
+	drainCheckInterval = 100 * time.Millisecond
 )
 
 type abstractStrategy struct {
-	ClientPool          map[string]redis.UniversalClient
 	Configuration       *config.Configuration
 	injectionManagement *mas.InjectionManagement
+	// clientPool map[string]redis.UniversalClient, it is never modified after stored, so commands get clients
+	// without lock; changes are made on a copy under mutex.
+	clientPool *atomic.Value
+	// clientHooks create the hooks which are added to every client, include the reloaded ones
+	clientHooks []func(serverName string) redis.Hook
+	mutex       *sync.Mutex
+	// breakers circuit breaker of every server, nil if circuit breaker is not enabled
+	breakers map[string]*circuitBreaker
+	// classifier classify commands by the COMMAND INFO of every server
+	classifier *CommandClassifier
 }
 
 func newAbstractStrategy(configuration *config.Configuration) abstractStrategy {
 	strategy := abstractStrategy{
 		Configuration: configuration,
-		ClientPool:    map[string]redis.UniversalClient{}}
+		clientPool:    &atomic.Value{},
+		mutex:         &sync.Mutex{}}
+	strategy.initInstrumentation()
 	if configuration.Chaos != nil {
 		strategy.injectionManagement = mas.NewInjectionManagement(configuration.Chaos)
 		strategy.injectionManagement.SetError(mas.RedisErrors())
@@ -41,71 +64,311 @@ func newAbstractStrategy(configuration *config.Configuration) abstractStrategy {
 	} else {
 		strategy.initClients(false)
 	}
+	strategy.initCircuitBreakers()
+	strategy.classifier = NewCommandClassifier(strategy.fetchCommandTable)
+	strategy.classifier.SetMirrorPublish(configuration.RedisConfig.MirrorPublish())
 	return strategy
 }
 
-func (a *abstractStrategy) initClients(chaos bool) {
-	for name, serverConfig := range a.Configuration.RedisConfig.Servers {
-		client := newClient(serverConfig)
-		if chaos {
-			client.AddHook(a)
+// fetchCommandTable fetch the COMMAND INFO of all commands of the server.
+func (a *abstractStrategy) fetchCommandTable(serverName string) (CommandTable, error) {
+	client := a.getClientByServerName(serverName)
+	if client == nil {
+		return nil, fmt.Errorf("server '%s' has no client", serverName)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), commandInfoTimeout)
+	defer cancel()
+	reply, err := client.Do(ctx, "command").Result()
+	if err != nil {
+		return nil, err
+	}
+	return ParseCommandTable(reply)
+}
+
+// CommandType returns the type of the command on the active server, by its COMMAND INFO.
+func (a *abstractStrategy) CommandType(args ...interface{}) CommandType {
+	if len(args) == 0 {
+		return CommandTypeWrite
+	}
+	return a.classifier.CommandType(a.activeServer(), argString(args[0]), args)
+}
+
+// Scripts returns the script registry of the classifier.
+func (a *abstractStrategy) Scripts() *ScriptRegistry {
+	return a.classifier.Scripts()
+}
+
+// ServerClient returns the client of the server.
+func (a *abstractStrategy) ServerClient(serverName string) redis.UniversalClient {
+	return a.getClientByServerName(serverName)
+}
+
+// initCircuitBreakers create a circuit breaker for every server and add the breaker hook to the clients.
+func (a *abstractStrategy) initCircuitBreakers() {
+	breakerConfig := a.Configuration.RedisConfig.CircuitBreaker
+	if breakerConfig == nil || !breakerConfig.Enable {
+		return
+	}
+	breakers := make(map[string]*circuitBreaker)
+	for name := range a.routing().Servers {
+		breakers[name] = newCircuitBreaker(breakerConfig)
+	}
+	a.breakers = breakers
+	a.addClientHook(func(serverName string) redis.Hook {
+		breaker, ok := breakers[serverName]
+		if !ok {
+			breaker = newCircuitBreaker(breakerConfig)
 		}
-		a.ClientPool[name] = client
+		return &circuitBreakerHook{breaker: breaker}
+	})
+}
+
+// available whether the server's circuit breaker lets commands through.
+func (a *abstractStrategy) available(serverName string) bool {
+	breaker, ok := a.breakers[serverName]
+	return !ok || breaker.available()
+}
+
+// CircuitBreakerStats returns the circuit breaker stats of every server, empty if circuit breaker is not enabled.
+func (a *abstractStrategy) CircuitBreakerStats() map[string]CircuitBreakerStats {
+	stats := make(map[string]CircuitBreakerStats, len(a.breakers))
+	for name, breaker := range a.breakers {
+		stats[name] = breaker.snapshot()
 	}
+	return stats
+}
+
+// ReplayLag returns the replay lag of the file double-write of every target server, empty if the strategy has
+// no file double-write.
+func (a *abstractStrategy) ReplayLag() map[string]file.ReplayLag {
+	return map[string]file.ReplayLag{}
+}
+
+// DoubleWriteStats returns the async executor stats of every target server, empty if the strategy has no memory
+// double-write.
+func (a *abstractStrategy) DoubleWriteStats() map[string]AsyncExecutorStats {
+	return map[string]AsyncExecutorStats{}
+}
+
+func (a *abstractStrategy) initClients(chaos bool) {
+	if chaos {
+		a.clientHooks = append(a.clientHooks, func(serverName string) redis.Hook {
+			return a
+		})
+	}
+	clientPool := map[string]redis.UniversalClient{}
+	for name, serverConfig := range a.routing().Servers {
+		clientPool[name] = a.createClient(name, serverConfig)
+	}
+	a.clientPool.Store(clientPool)
+}
+
+// createClient create a client of the server and add all client hooks to it.
+func (a *abstractStrategy) createClient(serverName string, serverConfig *config.ServerConfiguration) redis.UniversalClient {
+	client := newClient(serverConfig)
+	for _, clientHook := range a.clientHooks {
+		client.AddHook(clientHook(serverName))
+	}
+	return client
+}
+
+func (a *abstractStrategy) AddClientHook(clientHook func(serverName string) redis.Hook) {
+	a.addClientHook(clientHook)
+}
+
+// addClientHook add the hook to all existing clients and the clients created later.
+func (a *abstractStrategy) addClientHook(clientHook func(serverName string) redis.Hook) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	a.clientHooks = append(a.clientHooks, clientHook)
+	for name, client := range a.clients() {
+		client.AddHook(clientHook(name))
+	}
+}
+
+// routing returns the current routing snapshot, callers should route one command with one snapshot.
+func (a *abstractStrategy) routing() *config.RoutingSnapshot {
+	return a.Configuration.Snapshot()
 }
 
 func (a *abstractStrategy) activeClient() redis.UniversalClient {
-	activeServer := a.Configuration.Active
-	return a.getClientByServerName(activeServer)
+	return a.getClientByServerName(a.activeServer())
 }
 
 func (a *abstractStrategy) noActiveClient() redis.UniversalClient {
-	activeServer := a.Configuration.Active
-	for name, _ := range a.Configuration.RedisConfig.Servers {
-		if name != activeServer {
-			return a.getClientByServerName(name)
-		}
+	noActiveServer := a.noActiveServer()
+	if noActiveServer == "" {
+		return nil
 	}
-	log.Println("info: 'double-write' need another redis server for double write!")
-	return nil
+	return a.getClientByServerName(noActiveServer)
 }
 
 func (a *abstractStrategy) nearestClient() redis.UniversalClient {
-	nearest := a.Configuration.RedisConfig.Nearest
-	return a.getClientByServerName(nearest)
+	return a.getClientByServerName(a.nearestServer())
 }
 
 func (a *abstractStrategy) remoteClient() redis.UniversalClient {
-	nearest := a.Configuration.RedisConfig.Nearest
-	for name, _ := range a.Configuration.RedisConfig.Servers {
-		if name != nearest {
-			return a.getClientByServerName(name)
-		}
+	remoteServer := a.remoteServer()
+	if remoteServer == "" {
+		return nil
 	}
-	log.Println("ERROR: routeAlgorithm 'double-write' need another redis server for double write!")
-	return nil
+	return a.getClientByServerName(remoteServer)
+}
+
+func (a *abstractStrategy) activeServer() string {
+	return a.routing().Active
+}
+
+func (a *abstractStrategy) noActiveServer() string {
+	noActiveServer := a.routing().NoActive()
+	if noActiveServer == "" {
+		log.Println("info: 'double-write' need another redis server for double write!")
+	}
+	return noActiveServer
+}
+
+func (a *abstractStrategy) nearestServer() string {
+	return a.routing().Nearest
+}
+
+func (a *abstractStrategy) remoteServer() string {
+	remoteServer := a.routing().Remote()
+	if remoteServer == "" {
+		log.Println("ERROR: routeAlgorithm 'double-write' need another redis server for double write!")
+	}
+	return remoteServer
+}
+
+// hintedClient returns the client of the routing hint of the context, writeServer is the server which the route
+// algorithm routes the writes to.
+func (a *abstractStrategy) hintedClient(ctx context.Context, opType CommandType,
+	writeServer string) (redis.UniversalClient, bool) {
+	server, master, ok := HintedServer(ctx, a.routing(), opType, writeServer)
+	if !ok {
+		return nil, false
+	}
+	client := a.getClientByServerName(server)
+	if master {
+		return client, true
+	}
+	return readClient(client, opType), true
 }
 
 func (a *abstractStrategy) getClientByServerName(serverName string) redis.UniversalClient {
-	if client, ok := a.ClientPool[serverName]; ok {
+	if client, ok := a.clients()[serverName]; ok {
 		return client
 	}
-	if serverConfig, ok := a.Configuration.RedisConfig.Servers[serverName]; ok && serverConfig != nil {
-		a.ClientPool[serverName] = newClient(serverConfig)
-		return a.ClientPool[serverName]
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	clientPool := a.clients()
+	if client, ok := clientPool[serverName]; ok {
+		return client
+	}
+	if serverConfig, ok := a.routing().Servers[serverName]; ok && serverConfig != nil {
+		client := a.createClient(serverName, serverConfig)
+		a.storeClients(clientPool, map[string]redis.UniversalClient{serverName: client})
+		return client
 	}
 	log.Printf("ERROR: server '%s' has no config!", serverName)
 	return nil
 }
 
+// clients return the current client pool, which must not be modified.
+func (a *abstractStrategy) clients() map[string]redis.UniversalClient {
+	clientPool, _ := a.clientPool.Load().(map[string]redis.UniversalClient)
+	return clientPool
+}
+
+// storeClients store a copy of the client pool with the new clients, the caller must hold the mutex.
+func (a *abstractStrategy) storeClients(clientPool, newClients map[string]redis.UniversalClient) {
+	newClientPool := make(map[string]redis.UniversalClient, len(clientPool)+len(newClients))
+	for name, client := range clientPool {
+		newClientPool[name] = client
+	}
+	for name, client := range newClients {
+		newClientPool[name] = client
+	}
+	a.clientPool.Store(newClientPool)
+}
+
+// ReloadClients rebuild the clients of the servers with the current server configuration, the replaced
+// clients are closed after their in-flight commands finished.
+func (a *abstractStrategy) ReloadClients(serverNames ...string) {
+	a.mutex.Lock()
+	clientPool := a.clients()
+	servers := a.routing().Servers
+	newClients := make(map[string]redis.UniversalClient, len(serverNames))
+	replacedClients := make([]redis.UniversalClient, 0, len(serverNames))
+	for _, serverName := range serverNames {
+		serverConfig, ok := servers[serverName]
+		if !ok || serverConfig == nil {
+			log.Printf("ERROR: server '%s' has no config!", serverName)
+			continue
+		}
+		if client, ok := clientPool[serverName]; ok {
+			replacedClients = append(replacedClients, client)
+		}
+		newClients[serverName] = a.createClient(serverName, serverConfig)
+		if breaker, ok := a.breakers[serverName]; ok {
+			breaker.reset()
+		}
+		a.classifier.Reset(serverName)
+		log.Printf("INFO: redis server '%s' client reloaded", serverName)
+	}
+	a.storeClients(clientPool, newClients)
+	a.mutex.Unlock()
+	for _, client := range replacedClients {
+		go func(client redis.UniversalClient) {
+			drainClient(client)
+			if err := client.Close(); err != nil {
+				log.Printf("WARNING: close replaced client failed, %v", err)
+			}
+		}(client)
+	}
+}
+
+// drain waits for the in-flight commands of all clients finished.
+func (a *abstractStrategy) drain() {
+	var wg sync.WaitGroup
+	for _, client := range a.clients() {
+		wg.Add(1)
+		go func(client redis.UniversalClient) {
+			defer wg.Done()
+			drainClient(client)
+		}(client)
+	}
+	wg.Wait()
+}
+
+// GracefulClose waits for the in-flight commands finished and closes all clients.
+func (a *abstractStrategy) GracefulClose() error {
+	a.drain()
+	return a.Close()
+}
+
 func (a *abstractStrategy) Close() error {
 	var err error
-	for _, client := range a.ClientPool {
+	for _, client := range a.clients() {
 		err = client.Close()
 	}
 	return err
 }
 
+// drainClient waits until the client has no connection in use or drainTimeout reached. The grace period lets
+// the callers which already got the client start their commands.
+func drainClient(client redis.UniversalClient) {
+	time.Sleep(drainGracePeriod)
+	deadline := time.Now().Add(drainTimeout)
+	for time.Now().Before(deadline) {
+		stats := client.PoolStats()
+		if stats.TotalConns <= stats.IdleConns {
+			return
+		}
+		time.Sleep(drainCheckInterval)
+	}
+	log.Println("WARNING: drain client timeout, close it with connections in use")
+}
+
 func newClient(serverConfig *config.ServerConfiguration) redis.UniversalClient {
 	var client redis.UniversalClient
 	switch serverConfig.Type {
@@ -113,8 +376,18 @@ func newClient(serverConfig *config.ServerConfiguration) redis.UniversalClient {
 		client = redis.NewClusterClient(serverConfig.ClusterOptions)
 	case config.ServerTypeNormal:
 		client = redis.NewClient(serverConfig.Options)
+	case config.ServerTypeMasterSlave:
+		client = newMasterSlaveClient(serverConfig)
 	case config.ServerTypeSentinel:
-		client = redis.NewFailoverClient(serverConfig.FailoverOptions)
+		// go-redis routes read-only commands to the replicas only by the failover cluster client
+		if serverConfig.FailoverOptions.RouteByLatency || serverConfig.FailoverOptions.RouteRandomly {
+			if serverConfig.FailoverOptions.DB != 0 {
+				log.Printf("WARNING: db %d is ignored by routeByLatency and routeRandomly", serverConfig.FailoverOptions.DB)
+			}
+			client = redis.NewFailoverClusterClient(serverConfig.FailoverOptions)
+		} else {
+			client = redis.NewFailoverClient(serverConfig.FailoverOptions)
+		}
 	default:
 		log.Printf("WARNING: invalid server type '%s'", serverConfig.Type)
 		client = redis.NewClient(serverConfig.Options)
@@ -123,9 +396,10 @@ func newClient(serverConfig *config.ServerConfiguration) redis.UniversalClient {
 }
 
 func (a *abstractStrategy) BeforeProcess(ctx context.Context, cmd redis.Cmder) (context.Context, error) {
+	// the context is returned with the error, the hooks before it still process it in AfterProcess
 	err := a.injectionManagement.Inject()
 	if err != nil {
-		return nil, err
+		return ctx, err
 	}
 	return ctx, nil
 }
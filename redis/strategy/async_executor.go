@@ -0,0 +1,526 @@
+/*
+ * Copyright (c) Huawei Technologies Co., Ltd. 2021.
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use
+ * this file except in compliance with the License.  You may obtain a copy of the
+ * License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations under the License.
+ *
+ */
+
+package strategy
+
+import (
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/mna/redisc"
+
+	"github.com/huaweicloud/devcloud-go/redis/config"
+	"github.com/huaweicloud/devcloud-go/redis/file"
+)
+
+// overflow policies of the async executor, applied when the queue is full and the pool reaches its maximum size.
+const (
+	// OverflowBlock blocks the caller until the queue has room
+	OverflowBlock = "block"
+	// OverflowDropNewest drops the submitted task
+	OverflowDropNewest = "drop-newest"
+	// OverflowDropOldest drops the oldest queued task to make room for the submitted one
+	OverflowDropOldest = "drop-oldest"
+	// OverflowSpill writes the commands of the submitted task to the persist directory, they are replayed later
+	OverflowSpill = "spill"
+)
+
+const (
+	defaultThreadCoreSize = 1
+	defaultKeepAliveTime  = time.Minute
+)
+
+// AsyncTask is a double write task, Commands are the commands executed by Run, which are spilled on overflow.
+// The keys of Commands decide the worker which runs the task. Transaction is true if Run executes Commands in
+// MULTI/EXEC.
+type AsyncTask struct {
+	Run         func()
+	Commands    [][]interface{}
+	Transaction bool
+}
+
+// Item returns the WAL item of the task, a task of more than one command, or a transaction, is one pipeline item.
+func (t AsyncTask) Item() file.Item {
+	if len(t.Commands) == 1 && !t.Transaction {
+		return file.Item{Args: t.Commands[0]}
+	}
+	return file.Item{Pipeline: t.Commands, Transaction: t.Transaction}
+}
+
+// AsyncExecutorStats is the state and counters of an async executor.
+type AsyncExecutorStats struct {
+	Queued   int
+	Workers  int
+	Executed uint64
+	Dropped  uint64
+	Spilled  uint64
+}
+
+// AsyncExecutor executes async tasks on MaximumPoolSize workers, every worker has its own queue of TaskQueueSize.
+// A task is queued to the worker of the hash slot of its key, so the commands of the same key are mirrored in
+// order while the others are mirrored in parallel. A task with keys of more than one worker, such as MSET and
+// RENAME, or without key, such as FLUSHDB, is queued to all those workers as a barrier, and it runs after all
+// of them reach it, so it is ordered against the commands of every key it touches.
+// ThreadCoreSize workers are always running, the others are started by the first task of their queue and exit
+// after idle for KeepAliveTime milliseconds. When the queue is full, the task is handled by the overflow policy,
+// Submit never blocks the caller unless the overflow policy is block. After a task is spilled, the later tasks of
+// its workers are spilled as well until the spilled tasks are replayed by Replay, so they are never executed
+// before the spilled ones of the same keys.
+type AsyncExecutor struct {
+	// counters are accessed atomically, keep them 64-bit aligned
+	executed uint64
+	dropped  uint64
+	spilled  uint64
+
+	shards         []*shard
+	coreSize       int
+	keepAlive      time.Duration
+	overflowPolicy string
+	spill          func(task AsyncTask) error
+
+	// barrierMutex keeps the barriers in the same order in all the queues, so they never wait for each other.
+	barrierMutex sync.Mutex
+	// spillMutex orders the spilled tasks, and the spilling state of the workers changed by them and Replay.
+	spillMutex sync.Mutex
+	stop       chan struct{}
+	stopOnce   sync.Once
+}
+
+// shard is a worker and its queue.
+type shard struct {
+	queue   chan *queuedTask
+	mutex   sync.Mutex
+	running bool
+	// pending is the number of tasks queued and not finished, it is accessed atomically
+	pending int32
+	// spilling is 1 while the spilled tasks of the worker are not replayed, it is accessed atomically
+	spilling int32
+}
+
+// send queue the item without blocking, returns false if the queue is full.
+func (s *shard) send(item *queuedTask) bool {
+	atomic.AddInt32(&s.pending, 1)
+	select {
+	case s.queue <- item:
+		return true
+	default:
+		atomic.AddInt32(&s.pending, -1)
+		return false
+	}
+}
+
+func (s *shard) isSpilling() bool {
+	return atomic.LoadInt32(&s.spilling) == 1
+}
+
+type queuedTask struct {
+	task    AsyncTask
+	barrier *barrier
+}
+
+// barrier is shared by the queued copies of a task in the queues of several workers, the last worker reaching
+// it runs the task while the others wait.
+type barrier struct {
+	remaining int32
+	done      chan struct{}
+	doneOnce  sync.Once
+	canceled  int32
+}
+
+// cancel the task, returns false if it was canceled already.
+func (b *barrier) cancel() bool {
+	canceled := false
+	b.doneOnce.Do(func() {
+		atomic.StoreInt32(&b.canceled, 1)
+		close(b.done)
+		canceled = true
+	})
+	return canceled
+}
+
+// release the workers waiting for the task.
+func (b *barrier) release() {
+	b.doneOnce.Do(func() {
+		close(b.done)
+	})
+}
+
+// NewAsyncExecutor create an executor with the pool configuration and start the core workers, spill is called
+// for the overflow tasks when the overflow policy is spill.
+func NewAsyncExecutor(configuration *config.AsyncRemotePoolConfiguration, spill func(task AsyncTask) error) *AsyncExecutor {
+	e := &AsyncExecutor{
+		coreSize:       configuration.ThreadCoreSize,
+		keepAlive:      time.Duration(configuration.KeepAliveTime) * time.Millisecond,
+		overflowPolicy: configuration.OverflowPolicy,
+		spill:          spill,
+		stop:           make(chan struct{}),
+	}
+	if e.coreSize < 1 {
+		e.coreSize = defaultThreadCoreSize
+	}
+	maxSize := configuration.MaximumPoolSize
+	if maxSize < e.coreSize {
+		maxSize = e.coreSize
+	}
+	if e.keepAlive <= 0 {
+		e.keepAlive = defaultKeepAliveTime
+	}
+	if e.overflowPolicy == "" {
+		e.overflowPolicy = OverflowBlock
+	}
+	e.shards = make([]*shard, maxSize)
+	for i := range e.shards {
+		e.shards[i] = &shard{queue: make(chan *queuedTask, configuration.TaskQueueSize)}
+	}
+	for i := 0; i < e.coreSize; i++ {
+		e.startWorker(i)
+	}
+	return e
+}
+
+// Submit queue the task to the workers of its keys, or apply the overflow policy if the queue is full.
+func (e *AsyncExecutor) Submit(task AsyncTask) {
+	select {
+	case <-e.stop:
+		e.drop(task)
+		return
+	default:
+	}
+	shards := e.shardsOf(task.Commands)
+	if e.spillBehind(shards, task) {
+		return
+	}
+	if len(shards) == 1 {
+		e.submitShard(shards[0], task)
+		return
+	}
+	e.submitBarrier(shards, task)
+}
+
+// spillBehind spill the task if any of its workers has spilled tasks not replayed, returns false if none has.
+func (e *AsyncExecutor) spillBehind(shards []int, task AsyncTask) bool {
+	spilling := false
+	for _, i := range shards {
+		if e.shards[i].isSpilling() {
+			spilling = true
+			break
+		}
+	}
+	if !spilling {
+		return false
+	}
+	e.spillMutex.Lock()
+	defer e.spillMutex.Unlock()
+	// checked again, the workers may resume meanwhile
+	for _, i := range shards {
+		if e.shards[i].isSpilling() {
+			e.spillLocked(shards, task)
+			return true
+		}
+	}
+	return false
+}
+
+// shardsOf returns the workers of the keys of the commands, all the workers if any command is global.
+func (e *AsyncExecutor) shardsOf(commands [][]interface{}) []int {
+	if len(e.shards) == 1 {
+		return []int{0}
+	}
+	seen := make(map[int]struct{})
+	var shards []int
+	for _, args := range commands {
+		keys, global := CommandKeys(args)
+		if global {
+			shards = shards[:0]
+			for i := range e.shards {
+				shards = append(shards, i)
+			}
+			return shards
+		}
+		for _, key := range keys {
+			i := redisc.Slot(key) % len(e.shards)
+			if _, ok := seen[i]; !ok {
+				seen[i] = struct{}{}
+				shards = append(shards, i)
+			}
+		}
+	}
+	if len(shards) == 0 {
+		shards = append(shards, 0)
+	}
+	return shards
+}
+
+// submitShard queue the task to a worker, the worker is started before queuing for an unbuffered queue, and
+// after queuing in case it exits in between.
+func (e *AsyncExecutor) submitShard(i int, task AsyncTask) {
+	item := &queuedTask{task: task}
+	s := e.shards[i]
+	e.startWorker(i)
+	defer e.startWorker(i)
+	if s.send(item) {
+		return
+	}
+	switch e.overflowPolicy {
+	case OverflowDropNewest:
+		e.drop(task)
+	case OverflowSpill:
+		e.spillTask([]int{i}, task)
+	case OverflowDropOldest:
+		e.dropOldest(s, item)
+	default:
+		if !e.enqueue(s, item) {
+			e.drop(task)
+		}
+	}
+}
+
+// submitBarrier queue the task to all the workers, if any queue is full with the drop-newest or spill policy,
+// the copies already queued are canceled.
+func (e *AsyncExecutor) submitBarrier(shards []int, task AsyncTask) {
+	b := &barrier{remaining: int32(len(shards)), done: make(chan struct{})}
+	item := &queuedTask{task: task, barrier: b}
+	e.barrierMutex.Lock()
+	defer e.barrierMutex.Unlock()
+	e.startWorkers(shards)
+	defer e.startWorkers(shards)
+	for _, i := range shards {
+		s := e.shards[i]
+		switch e.overflowPolicy {
+		case OverflowDropNewest, OverflowSpill:
+			if !s.send(item) {
+				b.cancel()
+				if e.overflowPolicy == OverflowSpill {
+					e.spillTask(shards, task)
+				} else {
+					e.drop(task)
+				}
+				return
+			}
+		case OverflowDropOldest:
+			e.dropOldest(s, item)
+		default:
+			if !e.enqueue(s, item) {
+				b.cancel()
+				e.drop(task)
+				return
+			}
+		}
+	}
+}
+
+// enqueue blocks until the queue has room or the executor is closed.
+func (e *AsyncExecutor) enqueue(s *shard, item *queuedTask) bool {
+	atomic.AddInt32(&s.pending, 1)
+	select {
+	case s.queue <- item:
+		return true
+	case <-e.stop:
+		atomic.AddInt32(&s.pending, -1)
+		return false
+	}
+}
+
+func (e *AsyncExecutor) dropOldest(s *shard, item *queuedTask) {
+	if cap(s.queue) == 0 {
+		e.enqueue(s, item)
+		return
+	}
+	for {
+		if s.send(item) {
+			return
+		}
+		select {
+		case oldest := <-s.queue:
+			atomic.AddInt32(&s.pending, -1)
+			e.discard(oldest)
+		default:
+		}
+	}
+}
+
+// discard a queued task, a barrier is canceled in the other queues as well.
+func (e *AsyncExecutor) discard(item *queuedTask) {
+	if item.barrier == nil || item.barrier.cancel() {
+		e.drop(item.task)
+	}
+}
+
+func (e *AsyncExecutor) drop(task AsyncTask) {
+	atomic.AddUint64(&e.dropped, 1)
+	log.Println("WARNING: double write queue is full or stopped, drop", task.Commands)
+}
+
+func (e *AsyncExecutor) spillTask(shards []int, task AsyncTask) {
+	e.spillMutex.Lock()
+	defer e.spillMutex.Unlock()
+	e.spillLocked(shards, task)
+}
+
+// spillLocked spill the task, and the workers of it spill the later tasks until the spilled ones are replayed.
+func (e *AsyncExecutor) spillLocked(shards []int, task AsyncTask) {
+	if e.spill == nil {
+		e.drop(task)
+	} else if err := e.spill(task); err != nil {
+		log.Printf("ERROR: spill double write task failed, %v", err)
+		e.drop(task)
+	} else {
+		atomic.AddUint64(&e.spilled, 1)
+		for _, i := range shards {
+			atomic.StoreInt32(&e.shards[i].spilling, 1)
+		}
+	}
+}
+
+// SpillAll spill all the later tasks until Replay, it is used when the spilled tasks of the last run are not
+// replayed yet.
+func (e *AsyncExecutor) SpillAll() {
+	e.spillMutex.Lock()
+	defer e.spillMutex.Unlock()
+	for _, s := range e.shards {
+		atomic.StoreInt32(&s.spilling, 1)
+	}
+}
+
+// Replay call replay to replay the spilled tasks after the tasks queued before them are finished, then the
+// workers execute the later tasks again if caughtUp returns true, which means all the spilled tasks are replayed.
+// caughtUp is called when no task is spilled.
+func (e *AsyncExecutor) Replay(replay func(), caughtUp func() bool) {
+	for _, s := range e.shards {
+		if s.isSpilling() && atomic.LoadInt32(&s.pending) > 0 {
+			return
+		}
+	}
+	replay()
+	e.spillMutex.Lock()
+	defer e.spillMutex.Unlock()
+	if !caughtUp() {
+		return
+	}
+	for _, s := range e.shards {
+		atomic.StoreInt32(&s.spilling, 0)
+	}
+}
+
+func (e *AsyncExecutor) startWorkers(shards []int) {
+	for _, i := range shards {
+		e.startWorker(i)
+	}
+}
+
+// startWorker start the worker of the queue if it is not running.
+func (e *AsyncExecutor) startWorker(i int) {
+	s := e.shards[i]
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.running {
+		return
+	}
+	s.running = true
+	go e.work(s, i < e.coreSize)
+}
+
+func (e *AsyncExecutor) work(s *shard, core bool) {
+	var idleC <-chan time.Time
+	var idle *time.Timer
+	if !core {
+		idle = time.NewTimer(e.keepAlive)
+		defer idle.Stop()
+		idleC = idle.C
+	}
+	for {
+		select {
+		case item := <-s.queue:
+			e.run(item)
+			atomic.AddInt32(&s.pending, -1)
+			if idle != nil {
+				if !idle.Stop() {
+					<-idle.C
+				}
+				idle.Reset(e.keepAlive)
+			}
+		case <-idleC:
+			// the task queued before the worker stops is run by a new worker
+			s.mutex.Lock()
+			if len(s.queue) == 0 {
+				s.running = false
+				s.mutex.Unlock()
+				return
+			}
+			s.mutex.Unlock()
+			idle.Reset(e.keepAlive)
+		case <-e.stop:
+			s.mutex.Lock()
+			s.running = false
+			s.mutex.Unlock()
+			return
+		}
+	}
+}
+
+func (e *AsyncExecutor) run(item *queuedTask) {
+	if b := item.barrier; b != nil {
+		if atomic.AddInt32(&b.remaining, -1) > 0 {
+			select {
+			case <-b.done:
+			case <-e.stop:
+			}
+			return
+		}
+		if atomic.LoadInt32(&b.canceled) == 1 {
+			return
+		}
+		defer b.release()
+	}
+	item.task.Run()
+	atomic.AddUint64(&e.executed, 1)
+}
+
+// Queued returns the number of queued tasks.
+func (e *AsyncExecutor) Queued() int {
+	queued := 0
+	for _, s := range e.shards {
+		queued += len(s.queue)
+	}
+	return queued
+}
+
+// Stats returns the state and counters of the executor.
+func (e *AsyncExecutor) Stats() AsyncExecutorStats {
+	workers := 0
+	for _, s := range e.shards {
+		s.mutex.Lock()
+		if s.running {
+			workers++
+		}
+		s.mutex.Unlock()
+	}
+	return AsyncExecutorStats{
+		Queued:   e.Queued(),
+		Workers:  workers,
+		Executed: atomic.LoadUint64(&e.executed),
+		Dropped:  atomic.LoadUint64(&e.dropped),
+		Spilled:  atomic.LoadUint64(&e.spilled),
+	}
+}
+
+// Close stop the workers, the queued tasks are discarded.
+func (e *AsyncExecutor) Close() {
+	e.stopOnce.Do(func() {
+		close(e.stop)
+	})
+}
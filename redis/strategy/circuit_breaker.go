@@ -0,0 +1,231 @@
+/*
+ * Copyright (c) Huawei Technologies Co., Ltd. 2021.
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use
+ * this file except in compliance with the License.  You may obtain a copy of the
+ * License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations under the License.
+ *
+ */
+
+package strategy
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+
+	"github.com/huaweicloud/devcloud-go/redis/config"
+)
+
+const (
+	defaultBreakerFailureThreshold    = 5
+	defaultBreakerOpenDuration        = 5 * time.Second
+	defaultBreakerHalfOpenMaxRequests = 1
+)
+
+// ErrCircuitOpen is returned without executing the command when the server's circuit breaker is open.
+var ErrCircuitOpen = errors.New("redis: circuit breaker is open")
+
+type CircuitState int32
+
+const (
+	CircuitClosed CircuitState = iota
+	CircuitOpen
+	CircuitHalfOpen
+)
+
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitClosed:
+		return "closed"
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	default:
+		return "unknown"
+	}
+}
+
+// CircuitBreakerStats is the state and counters of a server's circuit breaker.
+type CircuitBreakerStats struct {
+	State               CircuitState
+	ConsecutiveFailures int
+	Successes           uint64
+	Failures            uint64
+	Rejected            uint64
+	OpenedAt            time.Time // the last time the breaker opened, zero if never
+}
+
+// circuitBreaker opens after failureThreshold consecutive failures, rejects all commands for openDuration, then
+// lets halfOpenMaxRequests probes through; the breaker closes if all probes succeed and opens again on any failure.
+type circuitBreaker struct {
+	failureThreshold    int
+	openDuration        time.Duration
+	halfOpenMaxRequests int
+
+	mutex             sync.Mutex
+	stats             CircuitBreakerStats
+	halfOpenRequests  int
+	halfOpenSuccesses int
+}
+
+func newCircuitBreaker(configuration *config.CircuitBreakerConfiguration) *circuitBreaker {
+	breaker := &circuitBreaker{
+		failureThreshold:    defaultBreakerFailureThreshold,
+		openDuration:        defaultBreakerOpenDuration,
+		halfOpenMaxRequests: defaultBreakerHalfOpenMaxRequests,
+	}
+	if configuration.FailureThreshold > 0 {
+		breaker.failureThreshold = configuration.FailureThreshold
+	}
+	if configuration.OpenMillis > 0 {
+		breaker.openDuration = time.Duration(configuration.OpenMillis) * time.Millisecond
+	}
+	if configuration.HalfOpenMaxRequests > 0 {
+		breaker.halfOpenMaxRequests = configuration.HalfOpenMaxRequests
+	}
+	return breaker
+}
+
+// allow whether the command can be executed, an open breaker turns half-open after openDuration.
+func (b *circuitBreaker) allow() bool {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if b.stats.State == CircuitOpen && time.Since(b.stats.OpenedAt) >= b.openDuration {
+		b.stats.State = CircuitHalfOpen
+		b.halfOpenRequests = 0
+		b.halfOpenSuccesses = 0
+	}
+	switch b.stats.State {
+	case CircuitOpen:
+		b.stats.Rejected++
+		return false
+	case CircuitHalfOpen:
+		if b.halfOpenRequests >= b.halfOpenMaxRequests {
+			b.stats.Rejected++
+			return false
+		}
+		b.halfOpenRequests++
+	}
+	return true
+}
+
+// available whether the breaker lets commands through, without changing its state.
+func (b *circuitBreaker) available() bool {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.stats.State != CircuitOpen || time.Since(b.stats.OpenedAt) >= b.openDuration
+}
+
+func (b *circuitBreaker) record(failed bool) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if failed {
+		b.stats.Failures++
+		b.stats.ConsecutiveFailures++
+		if b.stats.State == CircuitHalfOpen || b.stats.ConsecutiveFailures >= b.failureThreshold {
+			b.open()
+		}
+		return
+	}
+	b.stats.Successes++
+	b.stats.ConsecutiveFailures = 0
+	if b.stats.State == CircuitHalfOpen {
+		b.halfOpenSuccesses++
+		if b.halfOpenSuccesses >= b.halfOpenMaxRequests {
+			b.stats.State = CircuitClosed
+		}
+	}
+}
+
+func (b *circuitBreaker) open() {
+	if b.stats.State != CircuitOpen {
+		log.Printf("WARNING: redis circuit breaker opened after %d consecutive failures", b.stats.ConsecutiveFailures)
+	}
+	b.stats.State = CircuitOpen
+	b.stats.OpenedAt = time.Now()
+}
+
+// reset close the breaker, it is used when the client of the server is rebuilt.
+func (b *circuitBreaker) reset() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.stats.State = CircuitClosed
+	b.stats.ConsecutiveFailures = 0
+}
+
+func (b *circuitBreaker) snapshot() CircuitBreakerStats {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	stats := b.stats
+	if stats.State == CircuitOpen && time.Since(stats.OpenedAt) >= b.openDuration {
+		stats.State = CircuitHalfOpen
+	}
+	return stats
+}
+
+// isBreakerFailure only the errors of connection and timeout are failures of the server, redis errors such as
+// WRONGTYPE and canceled commands are not.
+func isBreakerFailure(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, ErrCircuitOpen) {
+		return false
+	}
+	var redisErr redis.Error
+	return !errors.As(err, &redisErr)
+}
+
+// admittedKey marks the context of commands admitted by the breaker.
+type admittedKey struct{}
+
+// circuitBreakerHook is added to the client of a server, it rejects commands while the breaker is open and
+// records the results of the admitted ones.
+type circuitBreakerHook struct {
+	breaker *circuitBreaker
+}
+
+func (h *circuitBreakerHook) BeforeProcess(ctx context.Context, cmd redis.Cmder) (context.Context, error) {
+	if !h.breaker.allow() {
+		return ctx, ErrCircuitOpen
+	}
+	return context.WithValue(ctx, admittedKey{}, h.breaker), nil
+}
+
+func (h *circuitBreakerHook) AfterProcess(ctx context.Context, cmd redis.Cmder) error {
+	if ctx.Value(admittedKey{}) == h.breaker {
+		h.breaker.record(isBreakerFailure(cmd.Err()))
+	}
+	return nil
+}
+
+func (h *circuitBreakerHook) BeforeProcessPipeline(ctx context.Context, cmds []redis.Cmder) (context.Context, error) {
+	if !h.breaker.allow() {
+		return ctx, ErrCircuitOpen
+	}
+	return context.WithValue(ctx, admittedKey{}, h.breaker), nil
+}
+
+func (h *circuitBreakerHook) AfterProcessPipeline(ctx context.Context, cmds []redis.Cmder) error {
+	if ctx.Value(admittedKey{}) != h.breaker {
+		return nil
+	}
+	failed := false
+	for _, cmd := range cmds {
+		if isBreakerFailure(cmd.Err()) {
+			failed = true
+			break
+		}
+	}
+	h.breaker.record(failed)
+	return nil
+}
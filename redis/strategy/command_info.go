@@ -0,0 +1,232 @@
+/*
+ * Copyright (c) Huawei Technologies Co., Ltd. 2021.
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use
+ * this file except in compliance with the License.  You may obtain a copy of the
+ * License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations under the License.
+ *
+ */
+
+package strategy
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+// commandInfoRetryInterval is the minimum interval between two fetches of a server after a failure.
+const commandInfoRetryInterval = 30 * time.Second
+
+// CommandInfo is the flags of a command in the reply of COMMAND INFO.
+type CommandInfo struct {
+	Write       bool
+	ReadOnly    bool
+	MovableKeys bool
+}
+
+// CommandTable is the commands of a server by lowercase name, a subcommand of redis 7.0+ is named
+// "command|subcommand".
+type CommandTable map[string]CommandInfo
+
+// ParseCommandTable parse the reply of COMMAND or COMMAND INFO of both go-redis and redigo, the subcommands of
+// redis 7.0+ are parsed as well.
+func ParseCommandTable(reply interface{}) (CommandTable, error) {
+	commands, ok := reply.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("unexpected COMMAND reply type %T", reply)
+	}
+	table := make(CommandTable, len(commands))
+	if err := parseCommands(table, commands); err != nil {
+		return nil, err
+	}
+	return table, nil
+}
+
+func parseCommands(table CommandTable, commands []interface{}) error {
+	for _, command := range commands {
+		// COMMAND INFO returns nil for an unknown command
+		if command == nil {
+			continue
+		}
+		fields, ok := command.([]interface{})
+		if !ok || len(fields) < 3 {
+			return fmt.Errorf("unexpected COMMAND entry %v", command)
+		}
+		flags, ok := fields[2].([]interface{})
+		if !ok {
+			return fmt.Errorf("unexpected COMMAND flags %v", fields[2])
+		}
+		var info CommandInfo
+		for _, flag := range flags {
+			switch strings.ToLower(argString(flag)) {
+			case "write":
+				info.Write = true
+			case "readonly":
+				info.ReadOnly = true
+			case "movablekeys":
+				info.MovableKeys = true
+			}
+		}
+		table[strings.ToLower(argString(fields[0]))] = info
+		// the 10th field of redis 7.0+ is the subcommands
+		if len(fields) >= 10 {
+			if subcommands, ok := fields[9].([]interface{}); ok {
+				if err := parseCommands(table, subcommands); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// CommandClassifier classify commands by the COMMAND INFO flags of every server, which are fetched once per
+// server in background and cached. A command is a write if it has the write flag, a read if it has the readonly
+// flag. The commands without both flags, such as EVAL, and all commands before the flags are fetched or if the
+// fetch fails, are classified by IsWriteCommand. EVAL and EVALSHA of the scripts registered read-only in Scripts
+// are reads.
+type CommandClassifier struct {
+	fetch    func(serverName string) (CommandTable, error)
+	scripts  *ScriptRegistry
+	mutex    sync.RWMutex
+	tables   map[string]CommandTable
+	fetching map[string]bool
+	failed   map[string]time.Time
+	// mirrorPublish PUBLISH and SPUBLISH are writes, so that double-write mirrors them
+	mirrorPublish bool
+}
+
+// NewCommandClassifier create a classifier which fetches the command table of a server by fetch.
+func NewCommandClassifier(fetch func(serverName string) (CommandTable, error)) *CommandClassifier {
+	return &CommandClassifier{
+		fetch:    fetch,
+		scripts:  NewScriptRegistry(),
+		tables:   make(map[string]CommandTable),
+		fetching: make(map[string]bool),
+		failed:   make(map[string]time.Time),
+	}
+}
+
+// SetMirrorPublish classify PUBLISH and SPUBLISH as writes if mirrorPublish is true, they are not writes by default.
+func (c *CommandClassifier) SetMirrorPublish(mirrorPublish bool) {
+	c.mirrorPublish = mirrorPublish
+}
+
+// IsWrite whether the command is a write on the server, args may start with the command name or not.
+func (c *CommandClassifier) IsWrite(serverName, commandName string, args []interface{}) bool {
+	name := strings.ToLower(commandName)
+	if _, ok := publishCommandMap[name]; ok && c.mirrorPublish {
+		return true
+	}
+	if c.isReadOnlyScript(name, args) {
+		return false
+	}
+	if table := c.table(serverName); table != nil {
+		if sub, ok := firstArg(name, args); ok {
+			if info, ok := table[name+"|"+strings.ToLower(argString(sub))]; ok && (info.Write || info.ReadOnly) {
+				return info.Write
+			}
+		}
+		if info, ok := table[name]; ok && (info.Write || info.ReadOnly) {
+			return info.Write
+		}
+	}
+	return IsWriteCommand(commandName, args)
+}
+
+// CommandType returns CommandTypeWrite if the command is a write on the server, otherwise CommandTypeRead.
+func (c *CommandClassifier) CommandType(serverName, commandName string, args []interface{}) CommandType {
+	if c.IsWrite(serverName, commandName, args) {
+		return CommandTypeWrite
+	}
+	return CommandTypeRead
+}
+
+// Scripts returns the script registry of the classifier.
+func (c *CommandClassifier) Scripts() *ScriptRegistry {
+	return c.scripts
+}
+
+// isReadOnlyScript whether the command is EVAL or EVALSHA of a script registered read-only.
+func (c *CommandClassifier) isReadOnlyScript(name string, args []interface{}) bool {
+	script, ok := firstArg(name, args)
+	if !ok {
+		return false
+	}
+	switch name {
+	case "eval":
+		return c.scripts.IsReadOnly(ScriptSHA(argString(script)))
+	case "evalsha":
+		return c.scripts.IsReadOnly(argString(script))
+	}
+	return false
+}
+
+// Reset drop the cached table of the server, it is fetched again on the next command.
+func (c *CommandClassifier) Reset(serverName string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	delete(c.tables, serverName)
+	delete(c.failed, serverName)
+}
+
+// Load fetch the table of the server synchronously.
+func (c *CommandClassifier) Load(serverName string) error {
+	table, err := c.fetch(serverName)
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	delete(c.fetching, serverName)
+	if err != nil {
+		c.failed[serverName] = time.Now()
+		return err
+	}
+	c.tables[serverName] = table
+	delete(c.failed, serverName)
+	return nil
+}
+
+// table returns the cached table of the server, or nil and starts fetching it in background.
+func (c *CommandClassifier) table(serverName string) CommandTable {
+	c.mutex.RLock()
+	table, ok := c.tables[serverName]
+	c.mutex.RUnlock()
+	if ok {
+		return table
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if table, ok = c.tables[serverName]; ok {
+		return table
+	}
+	if c.fetching[serverName] || time.Since(c.failed[serverName]) < commandInfoRetryInterval {
+		return nil
+	}
+	c.fetching[serverName] = true
+	go func() {
+		if err := c.Load(serverName); err != nil {
+			log.Printf("WARNING: fetch COMMAND INFO of server '%s' failed, classify commands statically, %v",
+				serverName, err)
+		}
+	}()
+	return nil
+}
+
+// firstArg returns the first argument after the command name.
+func firstArg(name string, args []interface{}) (interface{}, bool) {
+	if len(args) > 0 && strings.EqualFold(argString(args[0]), name) {
+		args = args[1:]
+	}
+	if len(args) == 0 {
+		return nil, false
+	}
+	return args[0], true
+}
@@ -0,0 +1,136 @@
+/*
+ * Copyright (c) Huawei Technologies Co., Ltd. 2021.
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use
+ * this file except in compliance with the License.  You may obtain a copy of the
+ * License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations under the License.
+ *
+ */
+
+package strategy
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// commands which may touch any key of the database, they are ordered against all the other commands.
+var globalCommandMap = map[string]struct{}{
+	"flushall": {},
+	"flushdb":  {},
+	"swapdb":   {},
+	"select":   {},
+	"move":     {},
+	"script":   {},
+	"function": {},
+}
+
+// CommandKeys returns the keys of a command, global is true if the command has no key or may touch any
+// key, such as FLUSHDB and scripts without declared keys.
+func CommandKeys(args []interface{}) (keys []string, global bool) {
+	if len(args) < 2 {
+		return nil, true
+	}
+	name := strings.ToLower(argString(args[0]))
+	if _, ok := globalCommandMap[name]; ok {
+		return nil, true
+	}
+	switch name {
+	case "del", "unlink", "touch", "exists", "watch", "pfmerge", "sinterstore", "sunionstore", "sdiffstore",
+		"mget", "pfcount", "sinter", "sunion", "sdiff":
+		return argStrings(args[1:]), false
+	case "mset", "msetnx":
+		for i := 1; i < len(args); i += 2 {
+			keys = append(keys, argString(args[i]))
+		}
+		return keys, false
+	case "rename", "renamenx", "copy", "smove", "rpoplpush", "brpoplpush", "lmove", "blmove", "zrangestore",
+		"geosearchstore":
+		if len(args) < 3 {
+			return argStrings(args[1:]), false
+		}
+		return argStrings(args[1:3]), false
+	case "blpop", "brpop", "bzpopmin", "bzpopmax":
+		// the keys are followed by the timeout
+		if len(args) < 3 {
+			return argStrings(args[1:]), false
+		}
+		return argStrings(args[1 : len(args)-1]), false
+	case "sort":
+		return sortKeys(args), false
+	case "georadius", "georadiusbymember":
+		return georadiusKeys(args), false
+	case "bitop":
+		return argStrings(args[2:]), false
+	case "zunionstore", "zinterstore", "zdiffstore":
+		return append([]string{argString(args[1])}, numKeys(args, 2)...), false
+	case "lmpop", "zmpop":
+		return numKeys(args, 1), false
+	case "blmpop", "bzmpop":
+		return numKeys(args, 2), false
+	case "eval", "evalsha", "eval_ro", "evalsha_ro", "fcall", "fcall_ro":
+		keys = numKeys(args, 2)
+		return keys, len(keys) == 0
+	}
+	return []string{argString(args[1])}, false
+}
+
+// numKeys returns the keys after the numkeys argument at index i.
+func numKeys(args []interface{}, i int) []string {
+	if len(args) <= i {
+		return nil
+	}
+	n, err := strconv.Atoi(argString(args[i]))
+	if err != nil || n <= 0 || len(args) < i+1+n {
+		return nil
+	}
+	return argStrings(args[i+1 : i+1+n])
+}
+
+// georadiusKeys returns the key and the STORE/STOREDIST key of GEORADIUS and GEORADIUSBYMEMBER.
+func georadiusKeys(args []interface{}) []string {
+	keys := []string{argString(args[1])}
+	for i := 2; i < len(args)-1; i++ {
+		switch strings.ToLower(argString(args[i])) {
+		case "store", "storedist":
+			keys = append(keys, argString(args[i+1]))
+		}
+	}
+	return keys
+}
+
+// sortKeys returns the key and the STORE key of SORT.
+func sortKeys(args []interface{}) []string {
+	keys := []string{argString(args[1])}
+	for i := 2; i < len(args)-1; i++ {
+		if strings.EqualFold(argString(args[i]), "store") {
+			keys = append(keys, argString(args[i+1]))
+		}
+	}
+	return keys
+}
+
+func argStrings(args []interface{}) []string {
+	result := make([]string, 0, len(args))
+	for _, arg := range args {
+		result = append(result, argString(arg))
+	}
+	return result
+}
+
+func argString(arg interface{}) string {
+	switch a := arg.(type) {
+	case string:
+		return a
+	case []byte:
+		return string(a)
+	}
+	return fmt.Sprint(arg)
+}
@@ -18,138 +18,476 @@ package strategy
 import (
 	"context"
 	"log"
+	"path/filepath"
+	"sync"
 	"time"
 
 	"github.com/go-redis/redis/v8"
 
 	"github.com/huaweicloud/devcloud-go/redis/config"
 	"github.com/huaweicloud/devcloud-go/redis/file"
+	"github.com/huaweicloud/devcloud-go/redis/instrument"
 )
 
+const defaultReplayInterval = 10 * time.Second
+
+// DoubleWriteStrategy local-read-async-double-write, all commands are executed on the nearest server,
+// write commands are mirrored to all the remote servers asynchronously.
 type DoubleWriteStrategy struct {
 	abstractStrategy
-	asyncRemoteWriteExecutor []string
-	fileOperationMap         map[string]*file.Operation
-	jobChan                  chan job
+	replicas      map[string]*replica
+	replicasMutex sync.Mutex
+	stop          chan struct{}
+	stopOnce      sync.Once
+	// sourceServer returns the server whose writes are mirrored
+	sourceServer func(routing *config.RoutingSnapshot) string
+	// targetServers returns the servers which receive the mirrored writes
+	targetServers func(routing *config.RoutingSnapshot) []string
+}
+
+// replica is a target server of double write, it has its own executor for memory double-write, or its own WAL
+// for file double-write, so a slow or down server does not block the others. The WAL of memory double-write
+// keeps the commands spilled by the executor.
+type replica struct {
+	name     string
+	executor *AsyncExecutor
+	wal      *file.WAL
+	scripts  *ScriptRegistry
 }
 
 func newDoubleWriteStrategy(configuration *config.Configuration) *DoubleWriteStrategy {
 	doubleWriteStrategy := &DoubleWriteStrategy{
 		abstractStrategy: newAbstractStrategy(configuration),
-		jobChan:          make(chan job, 0),
-		fileOperationMap: make(map[string]*file.Operation),
 	}
-	if configuration.RedisConfig.AsyncRemotePoolConfiguration == nil {
+	doubleWriteStrategy.sourceServer = routeNearest
+	doubleWriteStrategy.targetServers = (*config.RoutingSnapshot).Remotes
+	doubleWriteStrategy.initDoubleWrite()
+	return doubleWriteStrategy
+}
+
+func routeNearest(routing *config.RoutingSnapshot) string {
+	return routing.Nearest
+}
+
+func routeActive(routing *config.RoutingSnapshot) string {
+	return routing.Active
+}
+
+// initDoubleWrite create the replicas of all servers and add double write hook for every client.
+func (d *DoubleWriteStrategy) initDoubleWrite() {
+	poolConfig := d.Configuration.RedisConfig.AsyncRemotePoolConfiguration
+	if poolConfig == nil {
 		log.Fatalln("asyncRemotePool is required")
 	}
-	file.MkDirs(configuration.RedisConfig.AsyncRemotePoolConfiguration.PersistDir)
-	doubleWriteStrategy.createThreadPoolExecutor(configuration.RedisConfig.AsyncRemotePoolConfiguration)
-	if configuration.RedisConfig.AsyncRemotePoolConfiguration.Persist {
-		for name, _ := range configuration.RedisConfig.Servers {
-			doubleWriteStrategy.fileOperationMap[name] = file.NewFileOperation()
+	d.replicas = make(map[string]*replica)
+	d.stop = make(chan struct{})
+	replay := poolConfig.Persist || poolConfig.OverflowPolicy == OverflowSpill
+	for _, name := range d.routing().ServerNames() {
+		if r := d.replica(name); r != nil && r.wal != nil {
+			// the files left by old versions are migrated to the wal
+			replay = true
 		}
-		go doubleWriteStrategy.asyncWrite(configuration.RedisConfig.AsyncRemotePoolConfiguration.PersistDir, doubleWriteStrategy.ClientPool)
-	} else {
-		go doubleWriteStrategy.asyncDoubleWrite()
 	}
-	// add hook for double write
-	doubleWriteStrategy.nearestClient().AddHook(doubleWriteStrategy)
-	return doubleWriteStrategy
+	if replay {
+		go d.asyncWrite(poolConfig)
+	}
+	// add hook for double write, the hook only mirrors commands executed on source server.
+	d.addClientHook(func(serverName string) redis.Hook {
+		return &doubleWriteHook{strategy: d, serverName: serverName}
+	})
 }
 
-func (d *DoubleWriteStrategy) RouteClient(opType CommandType) redis.UniversalClient {
-	return d.nearestClient()
+func (d *DoubleWriteStrategy) RouteClient(ctx context.Context, opType CommandType) redis.UniversalClient {
+	if client, ok := d.hintedClient(ctx, opType, d.nearestServer()); ok {
+		return client
+	}
+	return readClient(d.nearestClient(), opType)
 }
 
+// Watch executes the transaction on the source server only, the writes of the transaction are mirrored
+// by the double write hook.
 func (d *DoubleWriteStrategy) Watch(ctx context.Context, fn func(*redis.Tx) error, keys ...string) error {
-	go func() {
-		_ = d.remoteClient().Watch(ctx, fn, keys...)
-	}()
-	return d.nearestClient().Watch(ctx, fn, keys...)
+	return d.watch(ctx, d.RouteClient(ctx, CommandTypeMulti), fn, keys...)
 }
 
-func (d *DoubleWriteStrategy) BeforeProcess(ctx context.Context, cmd redis.Cmder) (context.Context, error) {
-	return ctx, nil
+// watch executes the transaction on the routed client. A cluster executes it on the client of the node of the
+// keys, which has not the double write hook of the cluster client, so the hook is added to the transaction.
+func (d *DoubleWriteStrategy) watch(ctx context.Context, client redis.UniversalClient, fn func(*redis.Tx) error,
+	keys ...string) error {
+	if _, ok := client.(*redis.ClusterClient); !ok {
+		return client.Watch(ctx, fn, keys...)
+	}
+	routing := d.routing()
+	source := d.sourceServer(routing)
+	serverName, _, ok := HintedServer(ctx, routing, CommandTypeMulti, source)
+	if !ok {
+		serverName = source
+	}
+	hook := &doubleWriteHook{strategy: d, serverName: serverName}
+	return client.Watch(ctx, func(tx *redis.Tx) error {
+		tx.AddHook(hook)
+		return fn(tx)
+	}, keys...)
 }
 
-func (d *DoubleWriteStrategy) AfterProcess(ctx context.Context, cmd redis.Cmder) error {
-	if IsWriteCommand(cmd.Name(), cmd.Args()) {
-		if d.Configuration.RedisConfig.AsyncRemotePoolConfiguration.Persist {
-			d.executeAsyncPersist(ctx, cmd.Args())
-		} else {
-			d.executeAsyncNotPersist(ctx, cmd.Args())
+// GracefulClose waits for the in-flight commands and the queued double write jobs finished, then stops the
+// async executor and closes all clients.
+func (d *DoubleWriteStrategy) GracefulClose() error {
+	d.drain()
+	deadline := time.Now().Add(drainTimeout)
+	for d.queuedJobs() > 0 && time.Now().Before(deadline) {
+		time.Sleep(drainCheckInterval)
+	}
+	d.stopExecutor()
+	return d.abstractStrategy.Close()
+}
+
+func (d *DoubleWriteStrategy) Close() error {
+	d.stopExecutor()
+	return d.abstractStrategy.Close()
+}
+
+// stopExecutor stop the async executor and close the WALs, the records not replayed are replayed after restart.
+func (d *DoubleWriteStrategy) stopExecutor() {
+	d.stopOnce.Do(func() {
+		close(d.stop)
+		for _, r := range d.replicaList() {
+			if r.executor != nil {
+				r.executor.Close()
+			}
+			if r.wal == nil {
+				continue
+			}
+			if err := r.wal.Close(); err != nil {
+				log.Printf("ERROR: close wal of server '%s' failed, %v", r.name, err)
+			}
+		}
+	})
+}
+
+type job struct {
+	ctx    context.Context
+	target string
+	item   file.Item
+}
+
+// mirrorKey marks the context of mirrored commands, so that they will not be mirrored again.
+type mirrorKey struct{}
+
+// MirrorContext marks the commands executed with the context as mirrored, they are not mirrored by double-write.
+// The mirrored commands are executed asynchronously after the caller's command returned, when the caller's context
+// may be canceled already, so they are executed with the mirror context of context.Background().
+func MirrorContext(ctx context.Context) context.Context {
+	return context.WithValue(ctx, mirrorKey{}, true)
+}
+
+func isMirrorContext(ctx context.Context) bool {
+	mirror, _ := ctx.Value(mirrorKey{}).(bool)
+	return mirror
+}
+
+// replica returns the replica of the target server, it is created on the first write mirrored to the server.
+// It returns nil if the strategy is closed or the WAL can not be opened.
+func (d *DoubleWriteStrategy) replica(target string) *replica {
+	d.replicasMutex.Lock()
+	defer d.replicasMutex.Unlock()
+	if r, ok := d.replicas[target]; ok {
+		return r
+	}
+	select {
+	case <-d.stop:
+		return nil
+	default:
+	}
+	configuration := d.Configuration.RedisConfig.AsyncRemotePoolConfiguration
+	r := &replica{name: target, scripts: d.Scripts()}
+	legacyFiles := file.LegacyFiles(configuration.PersistDir, target)
+	if configuration.Persist || configuration.OverflowPolicy == OverflowSpill || len(legacyFiles) > 0 {
+		wal, err := file.OpenWAL(filepath.Join(configuration.PersistDir, target), file.WALOptions{
+			SyncPolicy:   configuration.FsyncPolicy,
+			SyncInterval: time.Duration(configuration.FsyncIntervalMillis) * time.Millisecond,
+			SegmentSize:  configuration.SegmentSize,
+		})
+		if err != nil {
+			log.Printf("ERROR: open wal of server '%s' failed, %v", target, err)
+			return nil
+		}
+		r.wal = wal
+		// the commands left by old versions are replayed before the new ones
+		if err = file.MigrateFiles(legacyFiles, wal); err != nil {
+			log.Printf("ERROR: %v", err)
 		}
 	}
-	return nil
+	if !configuration.Persist {
+		r.executor = NewAsyncExecutor(configuration, r.spill)
+		if r.wal != nil && !r.caughtUp() {
+			// the spilled commands of the last run are replayed before the new ones
+			r.executor.SpillAll()
+		}
+	}
+	d.replicas[target] = r
+	return r
 }
 
-func (d *DoubleWriteStrategy) BeforeProcessPipeline(ctx context.Context, cmds []redis.Cmder) (context.Context, error) {
-	return ctx, nil
+// spill append the overflow task to the WAL, it is replayed by the file double-write loop.
+func (r *replica) spill(task AsyncTask) error {
+	return r.wal.Append(r.scripts.PersistItem(task.Item()))
 }
 
-func (d *DoubleWriteStrategy) AfterProcessPipeline(ctx context.Context, cmds []redis.Cmder) error {
-	for _, cmd := range cmds {
-		d.remoteClient().Do(ctx, cmd.Args()...)
+// caughtUp whether all the records of the WAL are replayed.
+func (r *replica) caughtUp() bool {
+	lag, err := r.wal.Lag()
+	if err != nil {
+		log.Printf("ERROR: get replay lag of server '%s' failed, %v", r.name, err)
+		return false
 	}
-	return nil
+	return lag.PendingSegments == 0
 }
 
-type job struct {
-	ctx  context.Context
-	args []interface{}
+func (d *DoubleWriteStrategy) replicaList() []*replica {
+	d.replicasMutex.Lock()
+	defer d.replicasMutex.Unlock()
+	replicas := make([]*replica, 0, len(d.replicas))
+	for _, r := range d.replicas {
+		replicas = append(replicas, r)
+	}
+	return replicas
+}
+
+func (d *DoubleWriteStrategy) queuedJobs() int {
+	queued := 0
+	for _, r := range d.replicaList() {
+		if r.executor != nil {
+			queued += r.executor.Queued()
+		}
+	}
+	return queued
+}
+
+// DoubleWriteStats returns the executor stats of every target server of memory double-write.
+func (d *DoubleWriteStrategy) DoubleWriteStats() map[string]AsyncExecutorStats {
+	stats := make(map[string]AsyncExecutorStats)
+	for _, r := range d.replicaList() {
+		if r.executor != nil {
+			stats[r.name] = r.executor.Stats()
+		}
+	}
+	return stats
+}
+
+func (d *DoubleWriteStrategy) executeJob(jobs job) {
+	client := d.getClientByServerName(jobs.target)
+	if client == nil {
+		return
+	}
+	for i := 0; i < d.retryTimes(jobs.target); i++ {
+		ctx := instrument.WithRetries(jobs.ctx, i)
+		if err := file.ExecItemWithScripts(ctx, client, jobs.item, d.Scripts().Script); err == nil {
+			break
+		} else {
+			log.Println(jobs.target, jobs.item.Commands(), err)
+		}
+	}
 }
 
-// asyncDoubleWrite Memory double-write
-func (d *DoubleWriteStrategy) asyncDoubleWrite() {
-	for jobs := range d.jobChan {
-		for i := 0; i < d.Configuration.RedisConfig.AsyncRemoteWrite.RetryTimes; i++ {
-			if c := d.remoteClient().Do(jobs.ctx, jobs.args...); c.Err() == nil {
-				break
+// asyncWrite File double-write, the sealed WAL segments are replayed on the target servers periodically.
+func (d *DoubleWriteStrategy) asyncWrite(configuration *config.AsyncRemotePoolConfiguration) {
+	interval := defaultReplayInterval
+	if configuration.ReplayIntervalMillis > 0 {
+		interval = time.Duration(configuration.ReplayIntervalMillis) * time.Millisecond
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	ctx := context.WithValue(context.Background(), mirrorKey{}, true)
+	for {
+		select {
+		case <-ticker.C:
+		case <-d.stop:
+			return
+		}
+		for _, r := range d.replicaList() {
+			if r.wal == nil {
+				continue
+			}
+			wals := map[string]*file.WAL{r.name: r.wal}
+			replay := func() {
+				file.BatchReplay(ctx, d.clients(), wals, d.Scripts().Script)
+			}
+			if r.executor != nil {
+				// the spilled commands are replayed in order with the ones queued in the executor
+				r.executor.Replay(replay, r.caughtUp)
 			} else {
-				log.Println(jobs.args, c.Err())
+				replay()
 			}
 		}
 	}
 }
 
-// asyncWrite File double-write
-func (d *DoubleWriteStrategy) asyncWrite(dir string, clients map[string]redis.UniversalClient) {
-	ticker := time.NewTicker(time.Second * 10)
-	defer ticker.Stop()
-	for range ticker.C {
-		filenames := file.FileListNeedReplay(dir)
-		if len(filenames) == 0 {
+// ReplayLag returns the replay lag of the WAL of every target server.
+func (d *DoubleWriteStrategy) ReplayLag() map[string]file.ReplayLag {
+	lags := make(map[string]file.ReplayLag)
+	for _, r := range d.replicaList() {
+		if r.wal == nil {
+			continue
+		}
+		lag, err := r.wal.Lag()
+		if err != nil {
+			log.Printf("ERROR: get replay lag of server '%s' failed, %v", r.name, err)
 			continue
 		}
-		log.Println("start replay redis file size: ", len(filenames))
-		file.BatchReplay(clients, filenames)
+		lags[r.name] = lag
 	}
+	return lags
 }
 
-// createThreadPoolExecutor Memory double-write buffer creation
-func (d *DoubleWriteStrategy) createThreadPoolExecutor(configuration *config.AsyncRemotePoolConfiguration) {
-	if !configuration.Persist {
-		d.jobChan = make(chan job, configuration.TaskQueueSize)
+// asyncRemoteWrite returns the asyncRemoteWrite of the target server, which overrides the global one.
+func (d *DoubleWriteStrategy) asyncRemoteWrite(target string) *config.AsyncRemoteWrite {
+	if serverConfig, ok := d.routing().Servers[target]; ok && serverConfig.AsyncRemoteWrite != nil {
+		return serverConfig.AsyncRemoteWrite
 	}
+	return d.Configuration.RedisConfig.AsyncRemoteWrite
 }
 
-// executeAsyncPersist Memory double-write command writing
-func (d *DoubleWriteStrategy) executeAsyncPersist(ctx context.Context, args []interface{}) {
-	var remotename string
-	nearest := d.Configuration.RedisConfig.Nearest
-	for name, _ := range d.Configuration.RedisConfig.Servers {
-		if name != nearest {
-			remotename = name
-			break
+// retryTimes the remote write is executed at least once.
+func (d *DoubleWriteStrategy) retryTimes(target string) int {
+	asyncRemoteWrite := d.asyncRemoteWrite(target)
+	if asyncRemoteWrite == nil || asyncRemoteWrite.RetryTimes < 1 {
+		return 1
+	}
+	return asyncRemoteWrite.RetryTimes
+}
+
+// mirrorArgs returns the args of the command mirrored to the target server, rewritten in idempotent form if it is
+// enabled for the target, EVAL is mirrored as EVALSHA.
+func (d *DoubleWriteStrategy) mirrorArgs(target string, cmd redis.Cmder) []interface{} {
+	args := cmd.Args()
+	if asyncRemoteWrite := d.asyncRemoteWrite(target); asyncRemoteWrite != nil && asyncRemoteWrite.IdempotentRewrite {
+		args = IdempotentArgs(args, CmdReply(cmd))
+	}
+	return d.Scripts().MirrorScriptArgs(args)
+}
+
+// mirror a write command, or the write commands of a pipeline as one unit, to the target server.
+func (d *DoubleWriteStrategy) mirror(target string, item file.Item) {
+	if d.Configuration.RedisConfig.AsyncRemotePoolConfiguration.Persist {
+		d.executeAsyncPersist(target, item)
+	} else {
+		d.executeAsyncNotPersist(target, item)
+	}
+}
+
+// executeAsyncPersist File double-write command writing
+func (d *DoubleWriteStrategy) executeAsyncPersist(target string, item file.Item) {
+	r := d.replica(target)
+	if r == nil {
+		log.Printf("ERROR: server '%s' has no wal, drop %v", target, item.Commands())
+		return
+	}
+	if err := r.wal.Append(r.scripts.PersistItem(item)); err != nil {
+		log.Printf("ERROR: append %v to wal of server '%s' failed, %v", item.Commands(), target, err)
+	}
+}
+
+// executeAsyncNotPersist Memory double-write command writing
+func (d *DoubleWriteStrategy) executeAsyncNotPersist(target string, item file.Item) {
+	r := d.replica(target)
+	if r == nil {
+		log.Println("WARNING: double write executor is stopped, drop", item.Commands())
+		return
+	}
+	jobs := job{ctx: MirrorContext(context.Background()), target: target, item: item}
+	r.executor.Submit(AsyncTask{
+		Run:         func() { d.executeJob(jobs) },
+		Commands:    item.Commands(),
+		Transaction: item.Transaction,
+	})
+}
+
+// doubleWriteHook is added to every client of the double write strategy, it mirrors the write commands which
+// are executed successfully on the source server.
+type doubleWriteHook struct {
+	strategy   *DoubleWriteStrategy
+	serverName string
+}
+
+// mirrorTargets returns the servers which the commands should be mirrored to, empty if they need no mirror. The
+// source and targets are got from the same routing snapshot, so a switch never mirrors back to the source.
+func (h *doubleWriteHook) mirrorTargets(ctx context.Context) []string {
+	if isMirrorContext(ctx) {
+		return nil
+	}
+	routing := h.strategy.routing()
+	source := h.strategy.sourceServer(routing)
+	if pinned := RouteHintFrom(ctx).Server; pinned != source && pinned == h.serverName {
+		// the command pinned to another server is mirrored from it
+		return OtherServers(routing, pinned)
+	}
+	if h.serverName != source {
+		return nil
+	}
+	targets := h.strategy.targetServers(routing)
+	if len(targets) == 0 {
+		log.Println("ERROR: double write need another redis server!")
+	}
+	return targets
+}
+
+func (h *doubleWriteHook) BeforeProcess(ctx context.Context, cmd redis.Cmder) (context.Context, error) {
+	return ctx, nil
+}
+
+func (h *doubleWriteHook) AfterProcess(ctx context.Context, cmd redis.Cmder) error {
+	if cmd.Err() == nil {
+		h.strategy.Scripts().ObserveScriptLoad(cmd.Args())
+	}
+	if !isSucceeded(cmd) || !h.strategy.classifier.IsWrite(h.serverName, cmd.Name(), cmd.Args()) {
+		return nil
+	}
+	for _, target := range h.mirrorTargets(ctx) {
+		h.strategy.mirror(target, file.Item{Args: h.strategy.mirrorArgs(target, cmd)})
+	}
+	return nil
+}
+
+func (h *doubleWriteHook) BeforeProcessPipeline(ctx context.Context, cmds []redis.Cmder) (context.Context, error) {
+	return ctx, nil
+}
+
+// AfterProcessPipeline mirrors the succeeded write commands of the pipeline as one unit, a TxPipeline, whose
+// commands are wrapped in MULTI/EXEC by go-redis, is mirrored in MULTI/EXEC as well.
+func (h *doubleWriteHook) AfterProcessPipeline(ctx context.Context, cmds []redis.Cmder) error {
+	for _, cmd := range cmds {
+		if cmd.Err() == nil {
+			h.strategy.Scripts().ObserveScriptLoad(cmd.Args())
 		}
 	}
-	item := file.Item{
-		Args: args,
+	targets := h.mirrorTargets(ctx)
+	if len(targets) == 0 {
+		return nil
+	}
+	transaction := len(cmds) >= 2 && cmds[0].Name() == "multi" && cmds[len(cmds)-1].Name() == "exec"
+	if transaction {
+		cmds = cmds[1 : len(cmds)-1]
 	}
-	d.fileOperationMap[remotename].WriteFile(d.Configuration.RedisConfig.AsyncRemotePoolConfiguration.PersistDir+remotename, item)
+	var writes []redis.Cmder
+	for _, cmd := range cmds {
+		if isSucceeded(cmd) && h.strategy.classifier.IsWrite(h.serverName, cmd.Name(), cmd.Args()) {
+			writes = append(writes, cmd)
+		}
+	}
+	if len(writes) == 0 {
+		return nil
+	}
+	for _, target := range targets {
+		pipeline := make([][]interface{}, 0, len(writes))
+		for _, cmd := range writes {
+			pipeline = append(pipeline, h.strategy.mirrorArgs(target, cmd))
+		}
+		h.strategy.mirror(target, file.Item{Pipeline: pipeline, Transaction: transaction})
+	}
+	return nil
 }
 
-// executeAsyncNotPersist File double-write command writing
-func (d *DoubleWriteStrategy) executeAsyncNotPersist(ctx context.Context, args []interface{}) {
-	d.jobChan <- job{ctx: ctx, args: args}
+func isSucceeded(cmd redis.Cmder) bool {
+	return cmd.Err() == nil || cmd.Err() == redis.Nil
 }
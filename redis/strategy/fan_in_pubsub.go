@@ -0,0 +1,189 @@
+/*
+ * Copyright (c) Huawei Technologies Co., Ltd. 2021.
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use
+ * this file except in compliance with the License.  You may obtain a copy of the
+ * License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations under the License.
+ *
+ */
+
+package strategy
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+const defaultDedupWindow = 10 * time.Second
+
+// FanInPubSub subscribe the channels and patterns on all servers and merge their messages. The copies of a message
+// mirrored to other servers are dropped, so a message is received once whichever server it is published to.
+type FanInPubSub struct {
+	pubSubs   map[string]*redis.PubSub
+	dedup     *messageDeduplicator
+	ch        chan *redis.Message
+	stop      chan struct{}
+	closeOnce sync.Once
+	wg        sync.WaitGroup
+}
+
+// NewFanInPubSub create a FanInPubSub of the clients by server name, dedupWindow <= 0 means the default 10s.
+func NewFanInPubSub(ctx context.Context, clients map[string]redis.UniversalClient,
+	dedupWindow time.Duration) *FanInPubSub {
+	if dedupWindow <= 0 {
+		dedupWindow = defaultDedupWindow
+	}
+	f := &FanInPubSub{
+		pubSubs: make(map[string]*redis.PubSub, len(clients)),
+		dedup:   newMessageDeduplicator(dedupWindow),
+		ch:      make(chan *redis.Message, 100),
+		stop:    make(chan struct{}),
+	}
+	for serverName, client := range clients {
+		pubSub := client.Subscribe(ctx)
+		f.pubSubs[serverName] = pubSub
+		f.wg.Add(1)
+		go f.receive(serverName, pubSub)
+	}
+	return f
+}
+
+func (f *FanInPubSub) receive(serverName string, pubSub *redis.PubSub) {
+	defer f.wg.Done()
+	for msg := range pubSub.Channel() {
+		if !f.dedup.accept(serverName, msg) {
+			continue
+		}
+		select {
+		case f.ch <- msg:
+		case <-f.stop:
+			return
+		}
+	}
+}
+
+// Channel returns the channel of the merged messages, it is closed by Close.
+func (f *FanInPubSub) Channel() <-chan *redis.Message {
+	return f.ch
+}
+
+// Subscribe the channels on all servers, a server failed to subscribe retries when it reconnects.
+func (f *FanInPubSub) Subscribe(ctx context.Context, channels ...string) error {
+	return f.each(func(pubSub *redis.PubSub) error {
+		return pubSub.Subscribe(ctx, channels...)
+	})
+}
+
+// PSubscribe the patterns on all servers.
+func (f *FanInPubSub) PSubscribe(ctx context.Context, patterns ...string) error {
+	return f.each(func(pubSub *redis.PubSub) error {
+		return pubSub.PSubscribe(ctx, patterns...)
+	})
+}
+
+// Unsubscribe the channels on all servers, all channels if none is given.
+func (f *FanInPubSub) Unsubscribe(ctx context.Context, channels ...string) error {
+	return f.each(func(pubSub *redis.PubSub) error {
+		return pubSub.Unsubscribe(ctx, channels...)
+	})
+}
+
+// PUnsubscribe the patterns on all servers, all patterns if none is given.
+func (f *FanInPubSub) PUnsubscribe(ctx context.Context, patterns ...string) error {
+	return f.each(func(pubSub *redis.PubSub) error {
+		return pubSub.PUnsubscribe(ctx, patterns...)
+	})
+}
+
+func (f *FanInPubSub) each(fn func(pubSub *redis.PubSub) error) error {
+	var lastErr error
+	for serverName, pubSub := range f.pubSubs {
+		if err := fn(pubSub); err != nil {
+			log.Printf("ERROR: fan-in pubsub of server '%s' failed, %v", serverName, err)
+			lastErr = err
+		}
+	}
+	return lastErr
+}
+
+// Close the subscriptions of all servers and the merged channel.
+func (f *FanInPubSub) Close() error {
+	var lastErr error
+	f.closeOnce.Do(func() {
+		close(f.stop)
+		for _, pubSub := range f.pubSubs {
+			if err := pubSub.Close(); err != nil {
+				lastErr = err
+			}
+		}
+		f.wg.Wait()
+		close(f.ch)
+	})
+	return lastErr
+}
+
+type messageKey struct {
+	channel string
+	pattern string
+	payload string
+}
+
+type dedupEntry struct {
+	counts map[string]int
+	expire time.Time
+}
+
+// messageDeduplicator drop the copies of the messages. A message received from a server is a copy if another
+// server has received the same message as many times within the window, so the messages published repeatedly
+// are still received as many times as they are published.
+type messageDeduplicator struct {
+	window    time.Duration
+	mutex     sync.Mutex
+	entries   map[messageKey]*dedupEntry
+	nextSweep time.Time
+}
+
+func newMessageDeduplicator(window time.Duration) *messageDeduplicator {
+	return &messageDeduplicator{window: window, entries: make(map[messageKey]*dedupEntry),
+		nextSweep: time.Now().Add(window)}
+}
+
+// accept whether the message received from the server is not a copy.
+func (d *messageDeduplicator) accept(serverName string, msg *redis.Message) bool {
+	now := time.Now()
+	key := messageKey{channel: msg.Channel, pattern: msg.Pattern, payload: msg.Payload}
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	if now.After(d.nextSweep) {
+		for k, entry := range d.entries {
+			if now.After(entry.expire) {
+				delete(d.entries, k)
+			}
+		}
+		d.nextSweep = now.Add(d.window)
+	}
+	entry, ok := d.entries[key]
+	if !ok || now.After(entry.expire) {
+		entry = &dedupEntry{counts: make(map[string]int)}
+		d.entries[key] = entry
+	}
+	entry.counts[serverName]++
+	entry.expire = now.Add(d.window)
+	count := entry.counts[serverName]
+	for otherServer, otherCount := range entry.counts {
+		if otherServer != serverName && otherCount >= count {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,349 @@
+/*
+ * Copyright (c) Huawei Technologies Co., Ltd. 2021.
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use
+ * this file except in compliance with the License.  You may obtain a copy of the
+ * License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations under the License.
+ *
+ */
+
+package strategy
+
+import (
+	"context"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+
+	"github.com/huaweicloud/devcloud-go/redis/config"
+)
+
+const (
+	defaultHealthCheckInterval = time.Second
+	defaultHealthCheckTimeout  = 500 * time.Millisecond
+	defaultFailureThreshold    = 3
+	defaultSuccessThreshold    = 3
+)
+
+type HealthEventType int32
+
+const (
+	// HealthEventServerDown a server failed FailureThreshold PINGs in a row
+	HealthEventServerDown HealthEventType = iota
+	// HealthEventServerUp a down server succeeded SuccessThreshold PINGs in a row
+	HealthEventServerUp
+	// HealthEventActiveSwitched the active server is switched
+	HealthEventActiveSwitched
+	// HealthEventNearestSwitched the nearest server is switched
+	HealthEventNearestSwitched
+)
+
+func (t HealthEventType) String() string {
+	switch t {
+	case HealthEventServerDown:
+		return "server-down"
+	case HealthEventServerUp:
+		return "server-up"
+	case HealthEventActiveSwitched:
+		return "active-switched"
+	case HealthEventNearestSwitched:
+		return "nearest-switched"
+	default:
+		return "unknown"
+	}
+}
+
+// HealthEvent is emitted on every transition of the health checker. Server is set for server down and up
+// events, From and To are set for switch events.
+type HealthEvent struct {
+	Type   HealthEventType
+	Server string
+	From   string
+	To     string
+	Err    error
+	Time   time.Time
+}
+
+// HealthListener receives the health events, it is called in the health check goroutine and should not block.
+type HealthListener func(event HealthEvent)
+
+// serverHealth is the state of one server, it is only accessed in the health check goroutine.
+type serverHealth struct {
+	serverConfig *config.ServerConfiguration
+	client       redis.UniversalClient
+	up           bool
+	failures     int
+	successes    int
+	lastErr      error
+}
+
+// failoverState original is the server before failover, switched is the server failed over to, both are ""
+// if not failed over.
+type failoverState struct {
+	original string
+	switched string
+}
+
+// HealthChecker PINGs every server of the configuration and marks them up or down. When the active server (or
+// the nearest server for local-read modes) is down, it is switched to a healthy peer, and switched back when the
+// original server recovers.
+type HealthChecker struct {
+	configuration    *config.Configuration
+	interval         time.Duration
+	timeout          time.Duration
+	failureThreshold int
+	successThreshold int
+
+	servers         map[string]*serverHealth
+	activeFailover  failoverState
+	nearestFailover failoverState
+
+	mutex     sync.RWMutex
+	listeners []HealthListener
+	started   bool
+	stop      chan struct{}
+	stopOnce  sync.Once
+	done      chan struct{}
+}
+
+// NewHealthChecker create a HealthChecker with the configuration's healthCheck settings.
+func NewHealthChecker(configuration *config.Configuration) *HealthChecker {
+	healthCheck := configuration.RedisConfig.HealthCheck
+	if healthCheck == nil {
+		healthCheck = &config.HealthCheckConfiguration{}
+	}
+	checker := &HealthChecker{
+		configuration:    configuration,
+		interval:         defaultHealthCheckInterval,
+		timeout:          defaultHealthCheckTimeout,
+		failureThreshold: defaultFailureThreshold,
+		successThreshold: defaultSuccessThreshold,
+		servers:          map[string]*serverHealth{},
+		stop:             make(chan struct{}),
+		done:             make(chan struct{}),
+	}
+	if healthCheck.IntervalMillis > 0 {
+		checker.interval = time.Duration(healthCheck.IntervalMillis) * time.Millisecond
+	}
+	if healthCheck.TimeoutMillis > 0 {
+		checker.timeout = time.Duration(healthCheck.TimeoutMillis) * time.Millisecond
+	}
+	if healthCheck.FailureThreshold > 0 {
+		checker.failureThreshold = healthCheck.FailureThreshold
+	}
+	if healthCheck.SuccessThreshold > 0 {
+		checker.successThreshold = healthCheck.SuccessThreshold
+	}
+	return checker
+}
+
+// AddListener add a listener of the health events.
+func (h *HealthChecker) AddListener(listener HealthListener) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.listeners = append(h.listeners, listener)
+}
+
+// Start the health check goroutine.
+func (h *HealthChecker) Start() {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	if h.started {
+		return
+	}
+	h.started = true
+	go h.run()
+}
+
+// Close stop the health check goroutine and close the PING clients.
+func (h *HealthChecker) Close() error {
+	h.stopOnce.Do(func() {
+		close(h.stop)
+		h.mutex.RLock()
+		started := h.started
+		h.mutex.RUnlock()
+		if started {
+			<-h.done
+		}
+		for _, server := range h.servers {
+			_ = server.client.Close()
+		}
+	})
+	return nil
+}
+
+func (h *HealthChecker) run() {
+	defer close(h.done)
+	ticker := time.NewTicker(h.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			h.check()
+		case <-h.stop:
+			return
+		}
+	}
+}
+
+// check PING all servers once, then switch the active and nearest server according to the servers' health.
+func (h *HealthChecker) check() {
+	routing := h.configuration.Snapshot()
+	h.syncServers(routing)
+	var wg sync.WaitGroup
+	errs := make(map[string]error, len(h.servers))
+	var errsMutex sync.Mutex
+	for name, server := range h.servers {
+		wg.Add(1)
+		go func(name string, client redis.UniversalClient) {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(context.Background(), h.timeout)
+			defer cancel()
+			err := client.Ping(ctx).Err()
+			errsMutex.Lock()
+			errs[name] = err
+			errsMutex.Unlock()
+		}(name, server.client)
+	}
+	wg.Wait()
+	for _, name := range sortedServerNames(h.servers) {
+		h.updateHealth(name, errs[name])
+	}
+	if switchActive(routing.RouteAlgorithm) {
+		h.failover(routing.Active, &h.activeFailover, h.configuration.SwitchActive, HealthEventActiveSwitched)
+	}
+	if switchNearest(routing.RouteAlgorithm) {
+		h.failover(routing.Nearest, &h.nearestFailover, h.configuration.SwitchNearest, HealthEventNearestSwitched)
+	}
+}
+
+// syncServers create PING clients for new or changed servers, and remove the ones no longer configured.
+func (h *HealthChecker) syncServers(routing *config.RoutingSnapshot) {
+	for name, serverConfig := range routing.Servers {
+		server, ok := h.servers[name]
+		if ok && server.serverConfig == serverConfig {
+			continue
+		}
+		if ok {
+			_ = server.client.Close()
+		}
+		h.servers[name] = &serverHealth{serverConfig: serverConfig, client: newClient(serverConfig), up: true}
+	}
+	for name, server := range h.servers {
+		if _, ok := routing.Servers[name]; !ok {
+			_ = server.client.Close()
+			delete(h.servers, name)
+		}
+	}
+}
+
+func (h *HealthChecker) updateHealth(name string, err error) {
+	server := h.servers[name]
+	if err != nil {
+		server.failures++
+		server.successes = 0
+		server.lastErr = err
+		if server.up && server.failures >= h.failureThreshold {
+			server.up = false
+			log.Printf("WARNING: redis server '%s' is down, %v", name, err)
+			h.emit(HealthEvent{Type: HealthEventServerDown, Server: name, Err: err})
+		}
+		return
+	}
+	server.successes++
+	server.failures = 0
+	if !server.up && server.successes >= h.successThreshold {
+		server.up = true
+		server.lastErr = nil
+		log.Printf("INFO: redis server '%s' is up", name)
+		h.emit(HealthEvent{Type: HealthEventServerUp, Server: name})
+	}
+}
+
+// failover switch the current server to a healthy peer when it is down, or back to the original server when
+// the original recovers. If the server is changed by others (etcd) after failover, the original is forgotten.
+func (h *HealthChecker) failover(current string, state *failoverState, switchTo func(string),
+	eventType HealthEventType) {
+	if state.original != "" && current != state.switched {
+		*state = failoverState{}
+	}
+	if state.original != "" && h.isUp(state.original) {
+		switchTo(state.original)
+		h.emit(HealthEvent{Type: eventType, From: current, To: state.original})
+		*state = failoverState{}
+		return
+	}
+	if current == "" {
+		// no nearest server configured, there is nothing to switch
+		return
+	}
+	if h.isUp(current) {
+		return
+	}
+	peer := h.healthyPeer(current)
+	if peer == "" {
+		log.Printf("ERROR: redis server '%s' is down and no healthy server to switch", current)
+		return
+	}
+	var lastErr error
+	if server, ok := h.servers[current]; ok {
+		lastErr = server.lastErr
+	}
+	switchTo(peer)
+	h.emit(HealthEvent{Type: eventType, From: current, To: peer, Err: lastErr})
+	if state.original == "" {
+		state.original = current
+	}
+	state.switched = peer
+}
+
+func (h *HealthChecker) isUp(name string) bool {
+	server, ok := h.servers[name]
+	return ok && server.up
+}
+
+func (h *HealthChecker) healthyPeer(name string) string {
+	for _, peer := range sortedServerNames(h.servers) {
+		if peer != name && h.servers[peer].up {
+			return peer
+		}
+	}
+	return ""
+}
+
+func (h *HealthChecker) emit(event HealthEvent) {
+	event.Time = time.Now()
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+	for _, listener := range h.listeners {
+		listener(event)
+	}
+}
+
+func sortedServerNames(servers map[string]*serverHealth) []string {
+	names := make([]string, 0, len(servers))
+	for name := range servers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// switchActive whether the route algorithm executes commands on the active server.
+func switchActive(routeAlgorithm string) bool {
+	return routeAlgorithm != LocalReadDoubleWriteMode
+}
+
+// switchNearest whether the route algorithm executes commands on the nearest server.
+func switchNearest(routeAlgorithm string) bool {
+	return routeAlgorithm == LocalReadSingleWriteMode || routeAlgorithm == LocalReadDoubleWriteMode
+}
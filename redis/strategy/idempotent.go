@@ -0,0 +1,100 @@
+/*
+ * Copyright (c) Huawei Technologies Co., Ltd. 2021.
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use
+ * this file except in compliance with the License.  You may obtain a copy of the
+ * License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations under the License.
+ *
+ */
+
+package strategy
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// IdempotentArgs rewrite a non-idempotent write command into an idempotent one with its reply on the source
+// server, so that replaying the mirrored command more than once gives the same result:
+//   - INCR/INCRBY/DECR/DECRBY/INCRBYFLOAT key ... => SET key reply KEEPTTL (redis 6.0+)
+//   - HINCRBY/HINCRBYFLOAT key field increment => HSET key field reply
+//   - ZINCRBY key increment member => ZADD key reply member
+//   - APPEND key value => SETRANGE key reply-len(value) value
+//
+// The other commands, such as LPUSH and RPUSH, can not be rewritten and are returned as they are.
+func IdempotentArgs(args []interface{}, reply interface{}) []interface{} {
+	if len(args) < 2 {
+		return args
+	}
+	name, ok := args[0].(string)
+	if !ok {
+		return args
+	}
+	result, ok := replyString(reply)
+	if !ok {
+		return args
+	}
+	switch strings.ToLower(name) {
+	case "incr", "incrby", "decr", "decrby", "incrbyfloat":
+		return []interface{}{"set", args[1], result, "keepttl"}
+	case "hincrby", "hincrbyfloat":
+		if len(args) == 4 {
+			return []interface{}{"hset", args[1], args[2], result}
+		}
+	case "zincrby":
+		if len(args) == 4 {
+			return []interface{}{"zadd", args[1], result, args[3]}
+		}
+	case "append":
+		length, err := strconv.ParseInt(result, 10, 64)
+		if err != nil || len(args) != 3 {
+			return args
+		}
+		var valueLen int
+		switch value := args[2].(type) {
+		case string:
+			valueLen = len(value)
+		case []byte:
+			valueLen = len(value)
+		default:
+			return args
+		}
+		return []interface{}{"setrange", args[1], length - int64(valueLen), args[2]}
+	}
+	return args
+}
+
+// CmdReply returns the reply of a go-redis command, nil if its reply type is not supported by IdempotentArgs.
+func CmdReply(cmd redis.Cmder) interface{} {
+	switch c := cmd.(type) {
+	case *redis.IntCmd:
+		return c.Val()
+	case *redis.FloatCmd:
+		return c.Val()
+	case *redis.Cmd:
+		return c.Val()
+	}
+	return nil
+}
+
+func replyString(reply interface{}) (string, bool) {
+	switch r := reply.(type) {
+	case int64:
+		return strconv.FormatInt(r, 10), true
+	case float64:
+		return strconv.FormatFloat(r, 'f', -1, 64), true
+	case string:
+		return r, true
+	case []byte:
+		return string(r), true
+	}
+	return "", false
+}
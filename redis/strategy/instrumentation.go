@@ -0,0 +1,124 @@
+/*
+ * Copyright (c) Huawei Technologies Co., Ltd. 2021.
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use
+ * this file except in compliance with the License.  You may obtain a copy of the
+ * License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package strategy
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/huaweicloud/devcloud-go/redis/instrument"
+)
+
+// initInstrumentation add the instrumentation hook to the clients, it is the first hook so that the latency
+// includes the other hooks, such as chaos delays, and the commands rejected by the circuit breaker are observed.
+func (a *abstractStrategy) initInstrumentation() {
+	instrumentation := instrument.New(a.Configuration.RedisConfig.Instrumentation)
+	if instrumentation == nil {
+		return
+	}
+	a.clientHooks = append(a.clientHooks, func(serverName string) redis.Hook {
+		return &instrumentationHook{instrumentation: instrumentation, serverName: serverName}
+	})
+}
+
+// InstrumentRouteType returns the route type of the command, which is set in the context or classified by the
+// static command map.
+func InstrumentRouteType(ctx context.Context, commandName string, args []interface{}) string {
+	if routeType := instrument.RouteType(ctx); routeType != "" {
+		return routeType
+	}
+	if isMirrorContext(ctx) {
+		return instrument.RouteTypeMirror
+	}
+	if IsWriteCommand(commandName, args) {
+		return instrument.RouteTypeWrite
+	}
+	return instrument.RouteTypeRead
+}
+
+// instrumentedKey marks the context of the commands observed by the hook.
+type instrumentedKey struct{}
+
+type instrumented struct {
+	hook  *instrumentationHook
+	event *instrument.Event
+	start time.Time
+}
+
+// instrumentationHook is added to the client of a server, it reports every command and pipeline.
+type instrumentationHook struct {
+	instrumentation instrument.Instrumentation
+	serverName      string
+}
+
+func (h *instrumentationHook) before(ctx context.Context, event *instrument.Event) context.Context {
+	ctx = h.instrumentation.Before(ctx, event)
+	return context.WithValue(ctx, instrumentedKey{}, &instrumented{hook: h, event: event, start: time.Now()})
+}
+
+func (h *instrumentationHook) after(ctx context.Context, err error) {
+	if ctx == nil {
+		return
+	}
+	observed, ok := ctx.Value(instrumentedKey{}).(*instrumented)
+	if !ok || observed.hook != h {
+		return
+	}
+	observed.event.Latency = time.Since(observed.start)
+	observed.event.Err = err
+	observed.event.Retries = instrument.Retries(ctx)
+	h.instrumentation.After(ctx, observed.event)
+}
+
+func (h *instrumentationHook) BeforeProcess(ctx context.Context, cmd redis.Cmder) (context.Context, error) {
+	return h.before(ctx, &instrument.Event{
+		Command:   cmd.Name(),
+		Server:    h.serverName,
+		RouteType: InstrumentRouteType(ctx, cmd.Name(), cmd.Args()),
+	}), nil
+}
+
+func (h *instrumentationHook) AfterProcess(ctx context.Context, cmd redis.Cmder) error {
+	h.after(ctx, cmd.Err())
+	return nil
+}
+
+func (h *instrumentationHook) BeforeProcessPipeline(ctx context.Context, cmds []redis.Cmder) (context.Context, error) {
+	event := &instrument.Event{Command: "pipeline", Server: h.serverName, RouteType: instrument.RouteTypeRead}
+	if len(cmds) > 0 && strings.EqualFold(cmds[0].Name(), "multi") {
+		event.Command = "multi"
+	}
+	for _, cmd := range cmds {
+		if routeType := InstrumentRouteType(ctx, cmd.Name(), cmd.Args()); routeType != instrument.RouteTypeRead {
+			event.RouteType = routeType
+			break
+		}
+	}
+	return h.before(ctx, event), nil
+}
+
+func (h *instrumentationHook) AfterProcessPipeline(ctx context.Context, cmds []redis.Cmder) error {
+	var err error
+	for _, cmd := range cmds {
+		if cmd.Err() != nil && cmd.Err() != redis.Nil {
+			err = cmd.Err()
+			break
+		}
+	}
+	h.after(ctx, err)
+	return nil
+}
@@ -30,13 +30,34 @@ func newLocalReadSingleWriteStrategy(configuration *config.Configuration) *Local
 	return &LocalReadSingleWriteStrategy{newAbstractStrategy(configuration)}
 }
 
-func (l *LocalReadSingleWriteStrategy) RouteClient(opType CommandType) redis.UniversalClient {
-	if opType == CommandTypeRead {
-		return l.nearestClient()
+// RouteClient reads from the nearest server, or another available server while the nearest server's circuit
+// breaker is open; writes to the active server.
+func (l *LocalReadSingleWriteStrategy) RouteClient(ctx context.Context, opType CommandType) redis.UniversalClient {
+	if client, ok := l.hintedClient(ctx, opType, l.activeServer()); ok {
+		return client
 	}
-	return l.activeClient()
+	return readClient(l.routeClient(opType), opType)
+}
+
+func (l *LocalReadSingleWriteStrategy) routeClient(opType CommandType) redis.UniversalClient {
+	routing := l.routing()
+	if opType != CommandTypeRead {
+		return l.getClientByServerName(routing.Active)
+	}
+	if l.available(routing.Nearest) {
+		return l.getClientByServerName(routing.Nearest)
+	}
+	if l.available(routing.Active) {
+		return l.getClientByServerName(routing.Active)
+	}
+	for _, name := range routing.ServerNames() {
+		if l.available(name) {
+			return l.getClientByServerName(name)
+		}
+	}
+	return l.getClientByServerName(routing.Nearest)
 }
 
 func (l *LocalReadSingleWriteStrategy) Watch(ctx context.Context, fn func(*redis.Tx) error, keys ...string) error {
-	return l.activeClient().Watch(ctx, fn, keys...)
+	return l.RouteClient(ctx, CommandTypeMulti).Watch(ctx, fn, keys...)
 }
@@ -0,0 +1,99 @@
+/*
+ * Copyright (c) Huawei Technologies Co., Ltd. 2021.
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use
+ * this file except in compliance with the License.  You may obtain a copy of the
+ * License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations under the License.
+ *
+ */
+
+package strategy
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+
+	"github.com/huaweicloud/devcloud-go/redis/config"
+)
+
+// masterSlaveClient is the client of a master-slave server, commands are executed on the master, ReadClient
+// returns a healthy replica for reads.
+type masterSlaveClient struct {
+	*redis.Client
+	replicas map[string]*redis.Client
+	balancer *ReplicaBalancer
+}
+
+func newMasterSlaveClient(serverConfig *config.ServerConfiguration) *masterSlaveClient {
+	client := &masterSlaveClient{
+		Client:   redis.NewClient(serverConfig.Options),
+		replicas: make(map[string]*redis.Client, len(serverConfig.ReplicaOptions)),
+	}
+	addrs := make([]string, 0, len(serverConfig.ReplicaOptions))
+	for _, opts := range serverConfig.ReplicaOptions {
+		client.replicas[opts.Addr] = redis.NewClient(opts)
+		addrs = append(addrs, opts.Addr)
+	}
+	interval := time.Duration(serverConfig.ReplicaCheckIntervalMillis) * time.Millisecond
+	client.balancer = NewReplicaBalancer(serverConfig.ReadFrom, interval, StaticReplicas(addrs), client.ping)
+	return client
+}
+
+func (c *masterSlaveClient) ping(addr string) error {
+	return c.replicas[addr].Ping(context.Background()).Err()
+}
+
+// ReadClient returns the replica chosen by the balancer, or the master if no replica is healthy.
+func (c *masterSlaveClient) ReadClient() redis.UniversalClient {
+	if addr, ok := c.balancer.Pick(); ok {
+		return c.replicas[addr]
+	}
+	return c.Client
+}
+
+// AddHook add the hook to the master and all replicas.
+func (c *masterSlaveClient) AddHook(hook redis.Hook) {
+	c.Client.AddHook(hook)
+	for _, replica := range c.replicas {
+		replica.AddHook(hook)
+	}
+}
+
+// PoolStats returns the sum of the pool stats of the master and all replicas.
+func (c *masterSlaveClient) PoolStats() *redis.PoolStats {
+	stats := *c.Client.PoolStats()
+	for _, replica := range c.replicas {
+		replicaStats := replica.PoolStats()
+		stats.Hits += replicaStats.Hits
+		stats.Misses += replicaStats.Misses
+		stats.Timeouts += replicaStats.Timeouts
+		stats.TotalConns += replicaStats.TotalConns
+		stats.IdleConns += replicaStats.IdleConns
+		stats.StaleConns += replicaStats.StaleConns
+	}
+	return &stats
+}
+
+func (c *masterSlaveClient) Close() error {
+	c.balancer.Close()
+	for _, replica := range c.replicas {
+		_ = replica.Close()
+	}
+	return c.Client.Close()
+}
+
+// readClient returns a replica for reads if the client is of a master-slave server.
+func readClient(client redis.UniversalClient, opType CommandType) redis.UniversalClient {
+	if masterSlave, ok := client.(*masterSlaveClient); ok && opType == CommandTypeRead {
+		return masterSlave.ReadClient()
+	}
+	return client
+}
@@ -0,0 +1,154 @@
+/*
+ * Copyright (c) Huawei Technologies Co., Ltd. 2021.
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use
+ * this file except in compliance with the License.  You may obtain a copy of the
+ * License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations under the License.
+ *
+ */
+
+package strategy
+
+import (
+	"context"
+	"log"
+	"sync"
+	"sync/atomic"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/huaweicloud/devcloud-go/redis/config"
+	"github.com/huaweicloud/devcloud-go/redis/file"
+)
+
+// ReloadableStrategy follows the redis topology changes of Configuration. When servers changed, the clients of
+// the changed servers are rebuilt; when route algorithm changed, the whole strategy is rebuilt. Commands which
+// already got the old client are not disturbed, the old clients are closed after they finished.
+type ReloadableStrategy struct {
+	configuration *config.Configuration
+	mode          atomic.Value // strategyHolder
+	mutex         sync.Mutex
+	closed        bool
+	// clientHooks added by AddClientHook, they are added to the rebuilt strategies too
+	clientHooks []func(serverName string) redis.Hook
+}
+
+// strategyHolder makes atomic.Value always store the same concrete type.
+type strategyHolder struct {
+	mode StrategyMode
+}
+
+// NewReloadableStrategy create a ReloadableStrategy and register it to the configuration's reload listeners, nil
+// if the route algorithm is invalid.
+func NewReloadableStrategy(configuration *config.Configuration) StrategyMode {
+	mode := NewStrategy(configuration)
+	if mode == nil {
+		return nil
+	}
+	reloadableStrategy := &ReloadableStrategy{configuration: configuration}
+	reloadableStrategy.mode.Store(strategyHolder{mode: mode})
+	configuration.AddReloadListener(reloadableStrategy)
+	return reloadableStrategy
+}
+
+// Current returns the strategy currently in use.
+func (r *ReloadableStrategy) Current() StrategyMode {
+	return r.mode.Load().(strategyHolder).mode
+}
+
+// OnReload rebuild the changed clients or the whole strategy.
+func (r *ReloadableStrategy) OnReload(changedServers []string, routeAlgorithmChanged bool) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.closed {
+		return
+	}
+	current := r.Current()
+	if routeAlgorithmChanged {
+		if mode := NewStrategy(r.configuration); mode != nil {
+			for _, clientHook := range r.clientHooks {
+				mode.AddClientHook(clientHook)
+			}
+			r.mode.Store(strategyHolder{mode: mode})
+			// merged after stored, the scripts registered to the old strategy meanwhile are not lost
+			mode.Scripts().Merge(current.Scripts())
+			log.Printf("INFO: redis strategy switched to [%s]", r.configuration.Snapshot().RouteAlgorithm)
+			// the WALs of the current strategy are shared with the new one while it is draining
+			go func() {
+				if err := current.GracefulClose(); err != nil {
+					log.Printf("WARNING: close replaced strategy failed, %v", err)
+				}
+			}()
+			return
+		}
+		log.Printf("ERROR: switch to route algorithm [%s] failed, keep the current strategy",
+			r.configuration.Snapshot().RouteAlgorithm)
+	}
+	if len(changedServers) > 0 {
+		current.ReloadClients(changedServers...)
+	}
+}
+
+func (r *ReloadableStrategy) RouteClient(ctx context.Context, opType CommandType) redis.UniversalClient {
+	return r.Current().RouteClient(ctx, opType)
+}
+
+func (r *ReloadableStrategy) Watch(ctx context.Context, fn func(*redis.Tx) error, keys ...string) error {
+	return r.Current().Watch(ctx, fn, keys...)
+}
+
+func (r *ReloadableStrategy) ReloadClients(serverNames ...string) {
+	r.Current().ReloadClients(serverNames...)
+}
+
+func (r *ReloadableStrategy) CircuitBreakerStats() map[string]CircuitBreakerStats {
+	return r.Current().CircuitBreakerStats()
+}
+
+func (r *ReloadableStrategy) ReplayLag() map[string]file.ReplayLag {
+	return r.Current().ReplayLag()
+}
+
+func (r *ReloadableStrategy) DoubleWriteStats() map[string]AsyncExecutorStats {
+	return r.Current().DoubleWriteStats()
+}
+
+func (r *ReloadableStrategy) CommandType(args ...interface{}) CommandType {
+	return r.Current().CommandType(args...)
+}
+
+func (r *ReloadableStrategy) Scripts() *ScriptRegistry {
+	return r.Current().Scripts()
+}
+
+func (r *ReloadableStrategy) ServerClient(serverName string) redis.UniversalClient {
+	return r.Current().ServerClient(serverName)
+}
+
+func (r *ReloadableStrategy) AddClientHook(clientHook func(serverName string) redis.Hook) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.clientHooks = append(r.clientHooks, clientHook)
+	r.Current().AddClientHook(clientHook)
+}
+
+func (r *ReloadableStrategy) GracefulClose() error {
+	r.markClosed()
+	return r.Current().GracefulClose()
+}
+
+func (r *ReloadableStrategy) Close() error {
+	r.markClosed()
+	return r.Current().Close()
+}
+
+func (r *ReloadableStrategy) markClosed() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.closed = true
+}
@@ -0,0 +1,225 @@
+/*
+ * Copyright (c) Huawei Technologies Co., Ltd. 2021.
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use
+ * this file except in compliance with the License.  You may obtain a copy of the
+ * License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations under the License.
+ *
+ */
+
+package strategy
+
+import (
+	"log"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/huaweicloud/devcloud-go/redis/config"
+)
+
+const (
+	defaultReplicaCheckInterval = time.Second
+	// replicaFailureThreshold consecutive failed PINGs to mark a replica down, a succeeded PING marks it up
+	replicaFailureThreshold = 2
+	// latencyWeight is the weight of the latest sample in the moving average of a replica's latency
+	latencyWeight = 0.3
+)
+
+// ReplicaStats is the health and the PING latency of a replica.
+type ReplicaStats struct {
+	Addr    string
+	Healthy bool
+	Latency time.Duration
+}
+
+type replicaState struct {
+	addr     string
+	healthy  bool
+	failures int
+	latency  time.Duration
+}
+
+// ReplicaBalancer chooses a healthy replica for reads by the readFrom policy of a master-slave server. The
+// replicas are discovered and PINGed by probe periodically, a replica is down after replicaFailureThreshold
+// consecutive failures and up after a success; the latency of least-latency is the moving average of the PINGs.
+type ReplicaBalancer struct {
+	readFrom string
+	interval time.Duration
+	discover func() ([]string, error)
+	probe    func(addr string) error
+	mutex    sync.RWMutex
+	replicas []*replicaState
+	next     uint32
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+// NewReplicaBalancer create a balancer of the replicas returned by discover and start checking them, interval
+// <= 0 means the default interval.
+func NewReplicaBalancer(readFrom string, interval time.Duration, discover func() ([]string, error),
+	probe func(addr string) error) *ReplicaBalancer {
+	if interval <= 0 {
+		interval = defaultReplicaCheckInterval
+	}
+	b := &ReplicaBalancer{readFrom: readFrom, interval: interval, discover: discover, probe: probe,
+		stop: make(chan struct{})}
+	b.refresh()
+	go b.run()
+	return b
+}
+
+// StaticReplicas returns a discover func of NewReplicaBalancer which always returns addrs.
+func StaticReplicas(addrs []string) func() ([]string, error) {
+	return func() ([]string, error) {
+		return addrs, nil
+	}
+}
+
+// refresh discover the replicas, they are kept if discover fails.
+func (b *ReplicaBalancer) refresh() {
+	addrs, err := b.discover()
+	if err != nil {
+		log.Printf("WARNING: discover replicas failed, %v", err)
+		return
+	}
+	b.SetReplicas(addrs)
+}
+
+// SetReplicas replace the replicas, the state of the kept ones is not changed and the new ones are healthy.
+func (b *ReplicaBalancer) SetReplicas(addrs []string) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	old := make(map[string]*replicaState, len(b.replicas))
+	for _, replica := range b.replicas {
+		old[replica.addr] = replica
+	}
+	replicas := make([]*replicaState, 0, len(addrs))
+	for _, addr := range addrs {
+		if replica, ok := old[addr]; ok {
+			replicas = append(replicas, replica)
+		} else {
+			replicas = append(replicas, &replicaState{addr: addr, healthy: true})
+		}
+	}
+	b.replicas = replicas
+}
+
+// Pick returns the replica for a read, false if no replica is healthy.
+func (b *ReplicaBalancer) Pick() (string, bool) {
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+	healthy := make([]*replicaState, 0, len(b.replicas))
+	for _, replica := range b.replicas {
+		if replica.healthy {
+			healthy = append(healthy, replica)
+		}
+	}
+	if len(healthy) == 0 {
+		return "", false
+	}
+	switch b.readFrom {
+	case config.ReadFromRandom:
+		return healthy[rand.Intn(len(healthy))].addr, true
+	case config.ReadFromLeastLatency:
+		closest := healthy[0]
+		for _, replica := range healthy[1:] {
+			if replica.latency < closest.latency {
+				closest = replica
+			}
+		}
+		return closest.addr, true
+	default:
+		next := atomic.AddUint32(&b.next, 1)
+		return healthy[int(next%uint32(len(healthy)))].addr, true
+	}
+}
+
+// Stats returns the health and latency of every replica.
+func (b *ReplicaBalancer) Stats() []ReplicaStats {
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+	stats := make([]ReplicaStats, 0, len(b.replicas))
+	for _, replica := range b.replicas {
+		stats = append(stats, ReplicaStats{Addr: replica.addr, Healthy: replica.healthy, Latency: replica.latency})
+	}
+	return stats
+}
+
+// Close stop checking the replicas.
+func (b *ReplicaBalancer) Close() {
+	b.stopOnce.Do(func() {
+		close(b.stop)
+	})
+}
+
+func (b *ReplicaBalancer) run() {
+	ticker := time.NewTicker(b.interval)
+	defer ticker.Stop()
+	for {
+		b.check()
+		select {
+		case <-ticker.C:
+		case <-b.stop:
+			return
+		}
+		b.refresh()
+	}
+}
+
+// check PING all replicas concurrently, so a hanging replica does not delay the others.
+func (b *ReplicaBalancer) check() {
+	b.mutex.RLock()
+	addrs := make([]string, 0, len(b.replicas))
+	for _, replica := range b.replicas {
+		addrs = append(addrs, replica.addr)
+	}
+	b.mutex.RUnlock()
+	var wg sync.WaitGroup
+	for _, addr := range addrs {
+		wg.Add(1)
+		go func(addr string) {
+			defer wg.Done()
+			start := time.Now()
+			err := b.probe(addr)
+			b.record(addr, time.Since(start), err)
+		}(addr)
+	}
+	wg.Wait()
+}
+
+func (b *ReplicaBalancer) record(addr string, latency time.Duration, err error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	for _, replica := range b.replicas {
+		if replica.addr != addr {
+			continue
+		}
+		if err != nil {
+			replica.failures++
+			if replica.healthy && replica.failures >= replicaFailureThreshold {
+				replica.healthy = false
+				log.Printf("WARNING: replica '%s' is down, %v", addr, err)
+			}
+			return
+		}
+		replica.failures = 0
+		if !replica.healthy {
+			replica.healthy = true
+			log.Printf("INFO: replica '%s' is up", addr)
+		}
+		if replica.latency == 0 {
+			replica.latency = latency
+		} else {
+			replica.latency = time.Duration(latencyWeight*float64(latency) + (1-latencyWeight)*float64(replica.latency))
+		}
+		return
+	}
+}
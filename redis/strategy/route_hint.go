@@ -0,0 +1,115 @@
+/*
+ * Copyright (c) Huawei Technologies Co., Ltd. 2021.
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use
+ * this file except in compliance with the License.  You may obtain a copy of the
+ * License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package strategy
+
+import (
+	"context"
+	"log"
+
+	"github.com/huaweicloud/devcloud-go/redis/config"
+)
+
+// ReadPreference where the reads of a context are routed, it overrides the route algorithm.
+type ReadPreference string
+
+const (
+	// ReadPreferenceMaster reads from the server which the writes are routed to, and from the master of a
+	// master-slave server, such as reading right after a write.
+	ReadPreferenceMaster ReadPreference = "master"
+	// ReadPreferenceActive reads from the active server, the replicas of a master-slave server are balanced.
+	ReadPreferenceActive ReadPreference = "active"
+	// ReadPreferenceNearest reads from the nearest server, the replicas of a master-slave server are balanced.
+	ReadPreferenceNearest ReadPreference = "nearest"
+)
+
+// RouteHint is the routing override carried by the context of the commands.
+type RouteHint struct {
+	// Server executes all commands of the context, in the double-write route algorithms the writes are mirrored
+	// from it to the other servers
+	Server         string
+	ReadPreference ReadPreference
+}
+
+type routeHintKey struct{}
+
+// WithRouteMaster routes the reads of the context to the master of the write server.
+func WithRouteMaster(ctx context.Context) context.Context {
+	return WithReadPreference(ctx, ReadPreferenceMaster)
+}
+
+// WithServer pins the commands of the context to the server.
+func WithServer(ctx context.Context, serverName string) context.Context {
+	hint := RouteHintFrom(ctx)
+	hint.Server = serverName
+	return context.WithValue(ctx, routeHintKey{}, hint)
+}
+
+// WithReadPreference routes the reads of the context by the preference.
+func WithReadPreference(ctx context.Context, preference ReadPreference) context.Context {
+	hint := RouteHintFrom(ctx)
+	hint.ReadPreference = preference
+	return context.WithValue(ctx, routeHintKey{}, hint)
+}
+
+// RouteHintFrom returns the routing hint of the context, zero if it has none.
+func RouteHintFrom(ctx context.Context) RouteHint {
+	if ctx == nil {
+		return RouteHint{}
+	}
+	hint, _ := ctx.Value(routeHintKey{}).(RouteHint)
+	return hint
+}
+
+// HintedServer returns the server which the command of the type is routed to by the hint of the context,
+// writeServer is the server of the writes by the route algorithm. master is true if a read must not be sent to
+// the replicas; ok is false if the command is routed by the route algorithm.
+func HintedServer(ctx context.Context, routing *config.RoutingSnapshot, opType CommandType,
+	writeServer string) (server string, master bool, ok bool) {
+	hint := RouteHintFrom(ctx)
+	if hint.Server != "" {
+		if _, exists := routing.Servers[hint.Server]; exists {
+			return hint.Server, hint.ReadPreference == ReadPreferenceMaster, true
+		}
+		log.Printf("ERROR: route hint server '%s' has no config, ignore it", hint.Server)
+	}
+	if opType != CommandTypeRead {
+		return "", false, false
+	}
+	switch hint.ReadPreference {
+	case ReadPreferenceMaster:
+		return writeServer, true, true
+	case ReadPreferenceActive:
+		return routing.Active, false, true
+	case ReadPreferenceNearest:
+		if routing.Nearest != "" {
+			return routing.Nearest, false, true
+		}
+	case "":
+	default:
+		log.Printf("WARNING: invalid read preference '%s', ignore it", hint.ReadPreference)
+	}
+	return "", false, false
+}
+
+// OtherServers returns the servers except the server, which are the mirror targets of a command pinned to it.
+func OtherServers(routing *config.RoutingSnapshot, serverName string) []string {
+	servers := make([]string, 0, len(routing.Servers))
+	for _, name := range routing.ServerNames() {
+		if name != serverName {
+			servers = append(servers, name)
+		}
+	}
+	return servers
+}
@@ -0,0 +1,177 @@
+/*
+ * Copyright (c) Huawei Technologies Co., Ltd. 2021.
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use
+ * this file except in compliance with the License.  You may obtain a copy of the
+ * License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations under the License.
+ *
+ */
+
+package strategy
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"strings"
+	"sync"
+
+	"github.com/huaweicloud/devcloud-go/redis/file"
+)
+
+// maxScripts is the max number of script bodies kept by a registry, EVAL of the other scripts is mirrored as it is.
+const maxScripts = 1024
+
+// ScriptRegistry keeps the SHAs of the scripts declared read-only, which are routed as reads, and the bodies of
+// the scripts seen by EVAL and SCRIPT LOAD, which are loaded on the target server when a mirrored EVALSHA fails
+// with NOSCRIPT. At most maxScripts bodies are kept, so that dynamically generated scripts do not grow it forever.
+type ScriptRegistry struct {
+	mutex    sync.RWMutex
+	readOnly map[string]struct{}
+	scripts  map[string]string
+}
+
+// NewScriptRegistry create an empty registry.
+func NewScriptRegistry() *ScriptRegistry {
+	return &ScriptRegistry{
+		readOnly: make(map[string]struct{}),
+		scripts:  make(map[string]string),
+	}
+}
+
+// ScriptSHA returns the SHA1 hex digest of the script, which is its name in EVALSHA.
+func ScriptSHA(script string) string {
+	sum := sha1.Sum([]byte(script))
+	return hex.EncodeToString(sum[:])
+}
+
+// RegisterReadOnly declare the script of the SHA does not write.
+func (s *ScriptRegistry) RegisterReadOnly(sha string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.readOnly[strings.ToLower(sha)] = struct{}{}
+}
+
+// IsReadOnly whether the script of the SHA is declared read-only.
+func (s *ScriptRegistry) IsReadOnly(sha string) bool {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	_, ok := s.readOnly[strings.ToLower(sha)]
+	return ok
+}
+
+// ReadOnlyScripts returns the SHAs of the read-only scripts.
+func (s *ScriptRegistry) ReadOnlyScripts() []string {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	shas := make([]string, 0, len(s.readOnly))
+	for sha := range s.readOnly {
+		shas = append(shas, sha)
+	}
+	return shas
+}
+
+// Add keep the body of the script and returns its SHA, kept is false if the registry is full.
+func (s *ScriptRegistry) Add(script string) (sha string, kept bool) {
+	sha = ScriptSHA(script)
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return sha, s.addLocked(sha, script)
+}
+
+func (s *ScriptRegistry) addLocked(sha, script string) bool {
+	if _, ok := s.scripts[sha]; ok {
+		return true
+	}
+	if len(s.scripts) >= maxScripts {
+		return false
+	}
+	s.scripts[sha] = script
+	return true
+}
+
+// Script returns the body of the script of the SHA.
+func (s *ScriptRegistry) Script(sha string) (string, bool) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	script, ok := s.scripts[strings.ToLower(sha)]
+	return script, ok
+}
+
+// Merge add the read-only scripts and the script bodies of other to the registry.
+func (s *ScriptRegistry) Merge(other *ScriptRegistry) {
+	if other == nil || other == s {
+		return
+	}
+	other.mutex.RLock()
+	defer other.mutex.RUnlock()
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for sha := range other.readOnly {
+		s.readOnly[sha] = struct{}{}
+	}
+	for sha, script := range other.scripts {
+		s.addLocked(sha, script)
+	}
+}
+
+// MirrorScriptArgs rewrite EVAL into EVALSHA and keep the script body, so that the mirrored script is sent by
+// SHA. args start with the command name, the other commands, and EVAL if the registry is full, are returned as
+// they are.
+func (s *ScriptRegistry) MirrorScriptArgs(args []interface{}) []interface{} {
+	if len(args) < 2 || !strings.EqualFold(argString(args[0]), "eval") {
+		return args
+	}
+	sha, kept := s.Add(argString(args[1]))
+	if !kept {
+		return args
+	}
+	rewritten := make([]interface{}, len(args))
+	copy(rewritten, args)
+	rewritten[0] = "evalsha"
+	rewritten[1] = sha
+	return rewritten
+}
+
+// PersistItem rewrite the EVALSHA of the known scripts in the item back into EVAL, the bodies are kept in memory
+// only, so the items written to the WAL carry them to be replayed after restart.
+func (s *ScriptRegistry) PersistItem(item file.Item) file.Item {
+	if item.Pipeline != nil {
+		pipeline := make([][]interface{}, len(item.Pipeline))
+		for i, args := range item.Pipeline {
+			pipeline[i] = s.persistArgs(args)
+		}
+		item.Pipeline = pipeline
+		return item
+	}
+	item.Args = s.persistArgs(item.Args)
+	return item
+}
+
+func (s *ScriptRegistry) persistArgs(args []interface{}) []interface{} {
+	if len(args) < 2 || !strings.EqualFold(argString(args[0]), "evalsha") {
+		return args
+	}
+	script, ok := s.Script(argString(args[1]))
+	if !ok {
+		return args
+	}
+	rewritten := make([]interface{}, len(args))
+	copy(rewritten, args)
+	rewritten[0] = "eval"
+	rewritten[1] = script
+	return rewritten
+}
+
+// ObserveScriptLoad keep the body of the script if args, which start with the command name, is SCRIPT LOAD.
+func (s *ScriptRegistry) ObserveScriptLoad(args []interface{}) {
+	if len(args) == 3 && strings.EqualFold(argString(args[0]), "script") &&
+		strings.EqualFold(argString(args[1]), "load") {
+		s.Add(argString(args[2]))
+	}
+}
@@ -1,5 +1,5 @@
 /*
- * Copyright (c) Huawei Technologies Co., Ltd. 2024-2025.
+ * Copyright (c) Huawei Technologies Co., Ltd. 2021.
  * Licensed under the Apache License, Version 2.0 (the "License"); you may not use
  * this file except in compliance with the License.  You may obtain a copy of the
  * License at
@@ -17,13 +17,13 @@ package strategy
 
 import (
 	"context"
-	"log"
 
 	"github.com/go-redis/redis/v8"
 	"github.com/huaweicloud/devcloud-go/redis/config"
-	"github.com/huaweicloud/devcloud-go/redis/file"
 )
 
+// SingelReadDoubleWriteStrategy single-read-async-double-write, all commands are executed on the active server,
+// write commands are mirrored to all the no active servers asynchronously.
 type SingelReadDoubleWriteStrategy struct {
 	DoubleWriteStrategy
 }
@@ -32,66 +32,23 @@ func newSingelReadDoubleWriteStrategy(configuration *config.Configuration) *Sing
 	doubleWriteStrategy := &SingelReadDoubleWriteStrategy{
 		DoubleWriteStrategy: DoubleWriteStrategy{
 			abstractStrategy: newAbstractStrategy(configuration),
-			jobChan:          make(chan job, 0),
-			fileOperationMap: make(map[string]*file.Operation),
 		},
 	}
-	if configuration.RedisConfig.AsyncRemotePoolConfiguration == nil {
-		log.Fatalln("asyncRemotePool is required")
-	}
-	file.MkDirs(configuration.RedisConfig.AsyncRemotePoolConfiguration.PersistDir)
-	doubleWriteStrategy.createThreadPoolExecutor(configuration.RedisConfig.AsyncRemotePoolConfiguration)
-
-	go doubleWriteStrategy.asyncDoubleWrite()
-	// add hook for double write
-	doubleWriteStrategy.activeClient().AddHook(doubleWriteStrategy)
-	doubleWriteStrategy.noActiveClient().AddHook(doubleWriteStrategy)
-
+	doubleWriteStrategy.sourceServer = routeActive
+	doubleWriteStrategy.targetServers = (*config.RoutingSnapshot).NoActives
+	doubleWriteStrategy.initDoubleWrite()
 	return doubleWriteStrategy
 }
 
-func (d *SingelReadDoubleWriteStrategy) RouteClient(opType CommandType) redis.UniversalClient {
-	return d.activeClient()
-}
-
-func (d *SingelReadDoubleWriteStrategy) Watch(ctx context.Context, fn func(*redis.Tx) error, keys ...string) error {
-	go func() {
-		_ = d.noActiveClient().Watch(ctx, fn, keys...)
-	}()
-	return d.activeClient().Watch(ctx, fn, keys...)
-}
-
-// singel read double-write
-func (d *SingelReadDoubleWriteStrategy) asyncDoubleWrite() {
-	for jobs := range d.jobChan {
-		for i := 0; i < d.Configuration.RedisConfig.AsyncRemoteWrite.RetryTimes; i++ {
-			if c := d.noActiveClient().Do(jobs.ctx, jobs.args...); c.Err() == nil {
-				break
-			} else {
-				log.Println(jobs.args, c.Err())
-			}
-		}
+func (d *SingelReadDoubleWriteStrategy) RouteClient(ctx context.Context, opType CommandType) redis.UniversalClient {
+	if client, ok := d.hintedClient(ctx, opType, d.activeServer()); ok {
+		return client
 	}
+	return readClient(d.activeClient(), opType)
 }
 
-func (d *SingelReadDoubleWriteStrategy) BeforeProcess(ctx context.Context, cmd redis.Cmder) (context.Context, error) {
-	return ctx, nil
-}
-
-func (d *SingelReadDoubleWriteStrategy) AfterProcess(ctx context.Context, cmd redis.Cmder) error {
-	if IsWriteCommand(cmd.Name(), cmd.Args()) {
-		d.executeAsyncNotPersist(ctx, cmd.Args())
-	}
-	return nil
-}
-
-func (d *SingelReadDoubleWriteStrategy) BeforeProcessPipeline(ctx context.Context, cmds []redis.Cmder) (context.Context, error) {
-	return ctx, nil
-}
-
-func (d *SingelReadDoubleWriteStrategy) AfterProcessPipeline(ctx context.Context, cmds []redis.Cmder) error {
-	for _, cmd := range cmds {
-		d.noActiveClient().Do(ctx, cmd.Args()...)
-	}
-	return nil
+// Watch executes the transaction on the active server only, the writes of the transaction are mirrored
+// by the double write hook.
+func (d *SingelReadDoubleWriteStrategy) Watch(ctx context.Context, fn func(*redis.Tx) error, keys ...string) error {
+	return d.watch(ctx, d.RouteClient(ctx, CommandTypeMulti), fn, keys...)
 }
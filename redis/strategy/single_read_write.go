@@ -30,10 +30,13 @@ func newSingleReadWriteStrategy(configuration *config.Configuration) *SingleRead
 	return &SingleReadWriteStrategy{newAbstractStrategy(configuration)}
 }
 
-func (s *SingleReadWriteStrategy) RouteClient(opType CommandType) redis.UniversalClient {
-	return s.activeClient()
+func (s *SingleReadWriteStrategy) RouteClient(ctx context.Context, opType CommandType) redis.UniversalClient {
+	if client, ok := s.hintedClient(ctx, opType, s.activeServer()); ok {
+		return client
+	}
+	return readClient(s.activeClient(), opType)
 }
 
 func (s *SingleReadWriteStrategy) Watch(ctx context.Context, fn func(*redis.Tx) error, keys ...string) error {
-	return s.activeClient().Watch(ctx, fn, keys...)
+	return s.RouteClient(ctx, CommandTypeMulti).Watch(ctx, fn, keys...)
 }
@@ -19,33 +19,50 @@ package strategy
 import (
 	"context"
 	"log"
-	"reflect"
 	"strings"
 
 	"github.com/go-redis/redis/v8"
 	"github.com/huaweicloud/devcloud-go/redis/config"
+	"github.com/huaweicloud/devcloud-go/redis/file"
 )
 
 type StrategyMode interface {
-	RouteClient(opType CommandType) redis.UniversalClient
+	// RouteClient returns the client of the command type, the routing hints of the context override the route
+	// algorithm.
+	RouteClient(ctx context.Context, opType CommandType) redis.UniversalClient
 	Close() error
 	Watch(ctx context.Context, fn func(*redis.Tx) error, keys ...string) error
+	// ReloadClients rebuild the clients of the servers, the replaced clients are closed gracefully.
+	ReloadClients(serverNames ...string)
+	// GracefulClose waits for the in-flight commands finished and closes all clients.
+	GracefulClose() error
+	CircuitBreakerStats() map[string]CircuitBreakerStats
+	ReplayLag() map[string]file.ReplayLag
+	DoubleWriteStats() map[string]AsyncExecutorStats
+	// CommandType returns whether the command, with its name as the first arg, is a read or a write.
+	CommandType(args ...interface{}) CommandType
+	// Scripts returns the registry of the read-only scripts and the script bodies to mirror by SHA.
+	Scripts() *ScriptRegistry
+	// ServerClient returns the client of the server.
+	ServerClient(serverName string) redis.UniversalClient
+	// AddClientHook add the hook created by clientHook to the client of every server, include the clients
+	// created later.
+	AddClientHook(clientHook func(serverName string) redis.Hook)
 }
 
 func NewStrategy(configuration *config.Configuration) StrategyMode {
-	switch configuration.RouteAlgorithm {
+	routeAlgorithm := configuration.Snapshot().RouteAlgorithm
+	switch routeAlgorithm {
 	case SingleReadWriteMode:
 		return newSingleReadWriteStrategy(configuration)
 	case LocalReadSingleWriteMode:
 		return newLocalReadSingleWriteStrategy(configuration)
 	case LocalReadDoubleWriteMode:
-		return newLocalReadSingleWriteStrategy(configuration)
 		return newDoubleWriteStrategy(configuration)
 	case SingleReadDoubleWriteMode:
-		return newSingleReadWriteStrategy(configuration)
 		return newSingelReadDoubleWriteStrategy(configuration)
 	default:
-		log.Printf("ERROR: invalid route algorithm:%v", configuration.RouteAlgorithm)
+		log.Printf("ERROR: invalid route algorithm:%v", routeAlgorithm)
 	}
 	return nil
 }
@@ -66,6 +83,7 @@ const (
 	LocalReadDoubleWriteMode  = "local-read-async-double-write"
 )
 
+// IsWriteCommand classify the command by the static command map, which is the fallback of CommandClassifier.
 func IsWriteCommand(funcName string, args []interface{}) bool {
 	funcName = strings.ToLower(funcName)
 	if _, ok := writeCommandMap[funcName]; ok {
@@ -74,23 +92,75 @@ func IsWriteCommand(funcName string, args []interface{}) bool {
 	switch funcName {
 	case "script":
 		return contains(args, "flush")
+	case "function":
+		sub, ok := firstArg(funcName, args)
+		if !ok {
+			return false
+		}
+		switch strings.ToLower(argString(sub)) {
+		case "load", "delete", "flush", "restore":
+			return true
+		}
+		return false
 	case "sort":
 		return contains(args, "store")
-	case "georadius":
-		return contains(args, "store")
+	case "georadius", "georadiusbymember":
+		return contains(args, "store") || contains(args, "storedist")
+	case "eval":
+		// a script declares it does not write by the no-writes flag of the shebang line, redis 7.0+
+		script, ok := firstArg(funcName, args)
+		return !ok || !isNoWritesScript(argString(script))
+	}
+	return strings.HasPrefix(funcName, "json.") && !isJSONReadCommand(funcName)
+}
+
+// isNoWritesScript whether the shebang line of the script has the no-writes flag, such as
+// "#!lua flags=no-writes,allow-stale".
+func isNoWritesScript(script string) bool {
+	if !strings.HasPrefix(script, "#!") {
+		return false
+	}
+	line := script
+	if i := strings.IndexByte(script, '\n'); i >= 0 {
+		line = script[:i]
+	}
+	for _, field := range strings.Fields(line) {
+		if strings.HasPrefix(field, "flags=") {
+			for _, flag := range strings.Split(strings.TrimPrefix(field, "flags="), ",") {
+				if flag == "no-writes" {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+func isJSONReadCommand(funcName string) bool {
+	switch funcName {
+	case "json.get", "json.mget", "json.type", "json.strlen", "json.arrlen", "json.arrindex", "json.objkeys",
+		"json.objlen", "json.resp", "json.debug":
+		return true
 	}
 	return false
 }
 
 func contains(args []interface{}, command string) bool {
 	for _, arg := range args {
-		if reflect.DeepEqual(arg, command) {
+		if strings.EqualFold(argString(arg), command) {
 			return true
 		}
 	}
 	return false
 }
 
+// publishCommandMap commands which are not writes by COMMAND INFO but are mirrored by double-write if
+// pubSub.mirrorPublish is enabled, so that the subscribers of every server receive the published messages.
+var publishCommandMap = map[string]bool{
+	"publish":  true,
+	"spublish": true,
+}
+
 var writeCommandMap = map[string]bool{
 	"set":              true,
 	"del":              true,
@@ -127,7 +197,7 @@ var writeCommandMap = map[string]bool{
 	"hsetnx":           true,
 	"blpop":            true,
 	"brpop":            true,
-	"blpoplpush":       true,
+	"brpoplpush":       true,
 	"linsert":          true,
 	"lpop":             true,
 	"lpush":            true,
@@ -169,8 +239,35 @@ var writeCommandMap = map[string]bool{
 	"flushall":         true,
 	"flushdb":          true,
 	"save":             true,
-	"eval":             true,
 	"evalsha":          true,
 	"geoadd":           true,
 	"geosearchstore":   true,
+	"unlink":           true,
+	"copy":             true,
+	"move":             true,
+	"migrate":          true,
+	"swapdb":           true,
+	"psetex":           true,
+	"hsetex":           true,
+	"hgetex":           true,
+	"hgetdel":          true,
+	"hexpire":          true,
+	"hpexpire":         true,
+	"hexpireat":        true,
+	"hpexpireat":       true,
+	"hpersist":         true,
+	"lmpop":            true,
+	"blmpop":           true,
+	"blmove":           true,
+	"zmpop":            true,
+	"bzmpop":           true,
+	"zrangestore":      true,
+	"xtrim":            true,
+	"xgroup":           true,
+	"xack":             true,
+	"xclaim":           true,
+	"xautoclaim":       true,
+	"xsetid":           true,
+	"xreadgroup":       true,
+	"fcall":            true,
 }
@@ -0,0 +1,102 @@
+/*
+ * Copyright (c) Huawei Technologies Co., Ltd. 2021.
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use
+ * this file except in compliance with the License.  You may obtain a copy of the
+ * License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software distributed
+ * under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR
+ * CONDITIONS OF ANY KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+
+package redis
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	goredis "github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/huaweicloud/devcloud-go/mock"
+	"github.com/huaweicloud/devcloud-go/redis/resync"
+	"github.com/huaweicloud/devcloud-go/redis/strategy"
+)
+
+// fillDivergentTarget fill the target with every kind of difference from the keys of fillResyncSource.
+func fillDivergentTarget(target *mock.RedisMock) {
+	m := target.GetMockRedis()
+	_ = m.Set("string", "value")
+	m.SetTTL("string", time.Hour)
+	m.HSet("hash", "field", "other")
+	_ = m.Set("set", "x")
+	_, _ = m.ZAdd("zset", 1.5, "member")
+	_ = m.Set("extra", "value")
+}
+
+func TestDevsporeClient_Verify(t *testing.T) {
+	dc1, dc2 := startDoubleWriteMocks(t)
+	client := NewDevsporeClient(doubleWriteConfiguration(strategy.SingleReadWriteMode, dc1.Addr, dc2.Addr))
+	defer client.Close()
+	fillResyncSource(dc2.GetMockRedis())
+	fillDivergentTarget(dc1)
+	ctx := context.Background()
+
+	report, err := client.Verify(ctx, "dc2", "dc1", nil)
+	assert.Nil(t, err)
+	assert.False(t, report.Consistent())
+	assert.Equal(t, int64(5), report.Checked)
+	assert.Equal(t, []string{"list"}, report.Missing)
+	assert.Equal(t, []string{"extra"}, report.Extra)
+	assert.Equal(t, int64(3), report.MismatchCount)
+	reasons := map[string]string{}
+	for _, mismatch := range report.Mismatches {
+		reasons[mismatch.Key] = mismatch.Reason
+	}
+	assert.Equal(t, map[string]string{"hash": resync.MismatchValue, "set": resync.MismatchType,
+		"zset": resync.MismatchTTL}, reasons)
+
+	report, err = client.Verify(ctx, "dc2", "dc1", &resync.VerifyOptions{Repair: true, DeleteExtra: true})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(5), report.Repaired)
+	report, err = client.Verify(ctx, "dc2", "dc1", nil)
+	assert.Nil(t, err)
+	assert.True(t, report.Consistent())
+	assertResynced(t, dc1.GetMockRedis())
+	assert.False(t, dc1.GetMockRedis().Exists("extra"))
+}
+
+func TestVerifier_SampleAndRecheck(t *testing.T) {
+	source, target := startDoubleWriteMocks(t)
+	fillResyncSource(source.GetMockRedis())
+	sourceClient := goredis.NewClusterClient(&goredis.ClusterOptions{Addrs: []string{source.Addr}})
+	defer sourceClient.Close()
+	targetClient := goredis.NewClient(&goredis.Options{Addr: target.Addr})
+	defer targetClient.Close()
+	newVerifier := func(options *resync.VerifyOptions) *resync.Verifier {
+		return resync.NewVerifier(resync.Server{Name: "dc1", Client: sourceClient},
+			resync.Server{Name: "dc2", Client: targetClient}, options)
+	}
+
+	report, err := newVerifier(&resync.VerifyOptions{SampleSize: 3}).Run(context.Background())
+	assert.Nil(t, err)
+	assert.True(t, report.Sampled)
+	assert.Equal(t, int64(3), report.Checked)
+	assert.Equal(t, int64(3), report.MissingCount)
+
+	// the keys written during the recheck delay, as mirrored by double-write, are not reported
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		_, _ = resync.NewResyncer(resync.Server{Name: "dc1", Client: sourceClient},
+			resync.Server{Name: "dc2", Client: targetClient}, nil).Run(context.Background())
+	}()
+	report, err = newVerifier(&resync.VerifyOptions{Match: "s*", RecheckDelay: 200 * time.Millisecond}).
+		Run(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), report.Checked)
+	assert.True(t, report.Consistent())
+}